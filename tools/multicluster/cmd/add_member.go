@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/10gen/ops-manager-kubernetes/multi/pkg/common"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+func init() {
+	multiclusterCmd.AddCommand(addMemberCmd)
+
+	addMemberCmd.Flags().StringVar(&addMemberFlags.ServiceAccount, "service-account", "mongodb-enterprise-operator-multi-cluster", "Name of the service account which should be used for the Operator to communicate with the member clusters. [optional, default: mongodb-enterprise-operator-multi-cluster]")
+	addMemberCmd.Flags().StringVar(&addMemberFlags.CentralCluster, "central-cluster", "", "The central cluster the operator is deployed in. [required]")
+	addMemberCmd.Flags().StringVar(&addMemberFlags.MemberClusterNamespace, "member-cluster-namespace", "", "The namespace the member cluster resources will be deployed to. [required]")
+	addMemberCmd.Flags().StringSliceVar(&addMemberFlags.MemberClusterNamespaces, "member-cluster-namespaces", nil, "Comma separated list of additional namespaces watched by the operator in every member cluster. The operator's Roles will be created in each of them. [optional]")
+	addMemberCmd.Flags().StringVar(&addMemberFlags.MemberNamespaceSelector, "member-namespace-selector", "", "Label selector of additional namespaces watched by the operator, matched in every cluster. [optional]")
+	addMemberCmd.Flags().StringVar(&addMemberFlags.CentralClusterNamespace, "central-cluster-namespace", "", "The namespace the Operator is deployed to. [required]")
+	addMemberCmd.Flags().StringVar(&addMemberFlags.OperatorName, "operator-name", common.DefaultOperatorName, "Name used to identify the deployment of the operator. [optional, default: mongodb-enterprise-operator]")
+	addMemberCmd.Flags().StringVar(&addMemberFlags.InstallationID, "installation-id", "", "Identifies the installation in the labels and in the names of the cluster scoped objects created for it. Pass the same value to every command managing the installation. [optional, default: derived from the UID of the kube-system namespace of the central cluster, the central namespace and the operator name]")
+	addMemberCmd.Flags().StringVar(&addMemberApiServer, "api-server", "", "Address of the api server of the new member cluster. [optional, default will take the address from KUBECONFIG env var]")
+	addMemberCmd.Flags().StringVar(&addMemberConnection.TLSServerName, "tls-server-name", "", "Name the certificate of the api server of the new member cluster is checked against. [optional, default: the host of the api server]")
+	addMemberCmd.Flags().StringVar(&addMemberConnection.ProxyURL, "proxy-url", "", "Proxy the operator connects to the api server of the new member cluster through. [optional]")
+	addMemberCmd.Flags().BoolVar(&addMemberConnection.DisableCompression, "disable-compression", false, "Disable the compression of the responses of the api server of the new member cluster. [optional default: false]")
+	addMemberCmd.Flags().StringVar(&addMemberCertificateAuthority, "certificate-authority", "", "Path to the PEM encoded CA the certificate of the api server of the new member cluster is checked against. [optional, default: the CA of the cluster]")
+	addMemberCmd.Flags().BoolVar(&addMemberFlags.CheckKubeConfig, "check-kubeconfig", true, "Connect to the new member cluster with the generated kubeconfig before writing it. Api servers found by --api-server-discovery were already probed from the central cluster and are skipped. [optional default: true]")
+	addMemberCmd.Flags().StringSliceVar(&addMemberFlags.ApiServerDiscovery, "api-server-discovery", nil, "Comma separated list of strategies tried in order to find api servers of the member clusters reachable from the central cluster: mapping, cluster-info, endpoints, kind, kubeconfig. Each address is probed from a pod in the central cluster. Api servers set explicitly are kept. [optional, default: the api servers of the local kubeconfig]")
+	addMemberCmd.Flags().StringToStringVar(&addMemberFlags.ApiServerMapping, "api-server-mapping", nil, "Comma separated list of cluster=address pairs tried by the mapping discovery strategy. [optional]")
+	addMemberCmd.Flags().StringVar(&addMemberFlags.ApiServerProbeImage, "api-server-probe-image", common.DefaultApiServerProbeImage, "Image of the pods probing the discovered api servers, it must provide curl. [optional default: curlimages/curl:8.10.1]")
+	addMemberCmd.Flags().StringVar(&addMemberFlags.ApiServerProbeNamespace, "api-server-probe-namespace", common.DefaultApiServerProbeNamespace, "Namespace of the central cluster the probe pods are run in. They pull their image with the --image-pull-secrets secret, if it exists in it. [optional default: default]")
+	addMemberCmd.Flags().BoolVar(&addMemberFlags.ClusterScoped, "cluster-scoped", false, "Create ClusterRole and ClusterRoleBindings for the member cluster. [optional default: false]")
+	addMemberCmd.Flags().BoolVar(&addMemberFlags.CreateTelemetryClusterRoles, "create-telemetry-roles", true, "Create ClusterRole and ClusterRoleBindings for the member cluster for telemetry. [optional default: true]")
+	addMemberCmd.Flags().BoolVar(&addMemberFlags.InstallDatabaseRoles, "install-database-roles", false, "Install the ServiceAccounts and Roles required for running database workloads in the member cluster. [optional default: false]")
+	addMemberCmd.Flags().BoolVar(&addMemberFlags.CreateServiceAccountSecrets, "create-service-account-secrets", true, "Create service account token secrets. [optional default: true]")
+	addMemberCmd.Flags().StringVar(&addMemberFlags.ImagePullSecrets, "image-pull-secrets", "", "Name of the secret for imagePullSecrets to set in created service accounts and the api server probe pods. It is created from --image-pull-secret-docker-config or the registry credentials if given, otherwise it must already exist. [optional]")
+	addMemberCmd.Flags().StringVar(&addMemberDockerConfig, "image-pull-secret-docker-config", "", "Path to a docker config file, like the ~/.docker/config.json written by docker login, the image pull secret is created with in every namespace holding the created service accounts. [optional]")
+	addMemberCmd.Flags().StringVar(&addMemberRegistry.Server, "registry-server", "", "Registry the image pull secret is created for. [optional]")
+	addMemberCmd.Flags().StringVar(&addMemberRegistry.Username, "registry-username", "", "Username of the registry the image pull secret is created for. [optional]")
+	addMemberCmd.Flags().StringVar(&addMemberRegistryPasswordFile, "registry-password-file", "", "Path to a file holding the password of the registry the image pull secret is created for. Prefer --image-pull-secret-docker-config. [optional, default: the MDB_REGISTRY_PASSWORD environment variable]")
+	addMemberCmd.Flags().StringVar(&addMemberConfigFile, "config", "", "Path to a topology file describing the central cluster and namespaces, used instead of the individual topology flags. [optional]")
+	addMemberCmd.Flags().StringVar(&addMemberRBACProfile, "rbac-profile", "", "Path to a file customizing the rules of the operator's Roles and ClusterRoles, see the RBACProfile documentation. [optional]")
+	addMemberCmd.Flags().StringSliceVar(&addMemberFlags.ManagedKinds, "managed-kinds", nil, "Comma separated list of the custom resource kinds the operator manages (MongoDB, MongoDBMultiCluster, MongoDBUser, MongoDBOpsManager). The operator is only granted the minimal rules for these kinds, without wildcard verbs. [optional, default: all kinds with all verbs]")
+	addMemberCmd.Flags().DurationVar(&addMemberFlags.TokenExpiry, "token-expiry", 0, "Mint a ServiceAccount token with the given expiry through the TokenRequest API instead of using a non-expiring token secret. [optional]")
+	addMemberCmd.Flags().BoolVar(&addMemberFlags.ClientCertificateAuth, "client-certificate-auth", false, "Authenticate the operator to the member cluster with a client certificate issued through the CertificateSigningRequest API. [optional default: false]")
+	addMemberCmd.Flags().StringVar(&addMemberFlags.ClientCertificateUser, "client-certificate-user", "", "User the client certificate is issued for. [optional, default: the name of the service account]")
+	addMemberCmd.Flags().StringVar(&addMemberFlags.ClientCertificateGroup, "client-certificate-group", "", "Group the client certificate is issued for. [optional]")
+	addMemberCmd.Flags().DurationVar(&addMemberFlags.ClientCertificateExpiry, "client-certificate-expiry", common.DefaultClientCertificateExpiry, "Lifetime requested for the client certificate. The signer of the cluster may shorten it. [optional default: 8760h]")
+	addMemberCmd.Flags().BoolVar(&addMemberFlags.ApproveCSR, "approve-csr", false, "Approve the CertificateSigningRequest with the current credentials instead of waiting for an administrator to approve it. [optional default: false]")
+	addMemberCmd.Flags().DurationVar(&addMemberFlags.CSRApprovalTimeout, "csr-approval-timeout", 10*time.Minute, "How long to wait for the CertificateSigningRequest to be approved and signed. [optional default: 10m]")
+	addMemberCmd.Flags().BoolVar(&addMemberFlags.DryRun, "dry-run", false, "Print the changes that would be made, without making them. [optional default: false]")
+}
+
+// addMemberCmd represents the add-member command
+var addMemberCmd = &cobra.Command{
+	Use:   "add-member <cluster>",
+	Short: "Add a member cluster to an existing multicluster environment",
+	Long: `'add-member' configures a single new member cluster. It creates the operator's ServiceAccount and Roles in the
+new cluster only, adds its context to the KubeConfig secret and adds it to the member list ConfigMap in the central
+cluster. The existing member clusters are not touched.
+
+With --client-certificate-auth, a CertificateSigningRequest is submitted in the new cluster and the command waits
+for an administrator to approve it with kubectl certificate approve, unless --approve-csr is set.
+
+Example:
+
+kubectl-mongodb multicluster add-member cluster-4 --central-cluster="operator-cluster" --member-cluster-namespace=mongodb --central-cluster-namespace=mongodb
+kubectl-mongodb multicluster add-member cluster-4 --config=topology.yaml
+
+`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		out := newCommandOutput(cmd, "add-member", "")
+		if err := parseAddMemberFlags(cmd, args); err != nil {
+			out.fail(xerrors.Errorf("error parsing flags: %w", err))
+		}
+
+		clientMap, err := common.CreateClientMap(addMemberFlags.MemberClusters, addMemberFlags.CentralCluster, common.LoadKubeConfigFilePath(), addMemberFlags.ClientGetter(common.GetKubernetesClient))
+		if err != nil {
+			out.fail(xerrors.Errorf("failed to create clientset map: %w", err))
+		}
+		if err := common.SelectMemberNamespaces(cmd.Context(), clientMap, &addMemberFlags); err != nil {
+			out.fail(err)
+		}
+		if err := common.ResolveInstallationID(cmd.Context(), clientMap[addMemberFlags.CentralCluster], &addMemberFlags); err != nil {
+			out.fail(err)
+		}
+		if err := discoverApiServers(cmd.Context(), &addMemberFlags, clientMap); err != nil {
+			out.fail(err)
+		}
+
+		clientMap = out.recordActions(clientMap, addMemberFlags.DryRun)
+
+		if err := common.AddMemberCluster(cmd.Context(), addMemberFlags, clientMap); err != nil {
+			out.fail(err)
+		}
+
+		if addMemberFlags.DryRun {
+			fmt.Fprintf(out.progress, "\n==== Dry run, no changes were made ====\n\n")
+			out.plan.Print(out.progress)
+			out.done()
+			return
+		}
+		common.Logger().Info("Added member cluster", "cluster", args[0])
+		out.done()
+	},
+}
+
+var (
+	addMemberFlags                = common.Flags{}
+	addMemberConfigFile           string
+	addMemberRBACProfile          string
+	addMemberDockerConfig         string
+	addMemberRegistry             common.RegistryCredentials
+	addMemberRegistryPasswordFile string
+	addMemberApiServer            string
+
+	addMemberConnection           common.ClusterConnection
+	addMemberCertificateAuthority string
+)
+
+func parseAddMemberFlags(cmd *cobra.Command, args []string) error {
+	if err := loadRBACProfile(addMemberRBACProfile, &addMemberFlags); err != nil {
+		return err
+	}
+	if err := loadImagePullSecret(addMemberDockerConfig, addMemberRegistry, addMemberRegistryPasswordFile, &addMemberFlags); err != nil {
+		return err
+	}
+	if addMemberFlags.TokenExpiry != 0 && addMemberFlags.TokenExpiry < common.MinTokenExpiry {
+		return xerrors.Errorf("token-expiry must be at least %s", common.MinTokenExpiry)
+	}
+	if addMemberFlags.ClientCertificateAuth && addMemberFlags.TokenExpiry != 0 {
+		return xerrors.Errorf("token-expiry cannot be used together with client-certificate-auth")
+	}
+	if addMemberFlags.ClientCertificateAuth && addMemberFlags.ClientCertificateExpiry < common.MinClientCertificateExpiry {
+		return xerrors.Errorf("client-certificate-expiry must be at least %s", common.MinClientCertificateExpiry)
+	}
+	if err := common.ValidateApiServerDiscovery(addMemberFlags.ApiServerDiscovery); err != nil {
+		return err
+	}
+
+	if addMemberConfigFile != "" {
+		if err := applyTopologyConfig(cmd, addMemberConfigFile, &addMemberFlags); err != nil {
+			return err
+		}
+	} else if common.AnyAreEmpty(addMemberFlags.ServiceAccount, addMemberFlags.CentralCluster, addMemberFlags.MemberClusterNamespace, addMemberFlags.CentralClusterNamespace) {
+		return xerrors.Errorf("non empty values are required for [service-account, central-cluster, member-cluster-namespace, central-cluster-namespace]")
+	}
+
+	if err := selectMemberCluster(&addMemberFlags, args[0], addMemberApiServer); err != nil {
+		return err
+	}
+	return setMemberClusterConnection(&addMemberFlags, args[0], addMemberConnection, addMemberCertificateAuthority)
+}
+
+// setMemberClusterConnection sets the connection settings given on the command line for the cluster, on top of the
+// ones from the topology file.
+func setMemberClusterConnection(flags *common.Flags, cluster string, connection common.ClusterConnection, certificateAuthority string) error {
+	if certificateAuthority != "" {
+		ca, err := os.ReadFile(certificateAuthority)
+		if err != nil {
+			return xerrors.Errorf("failed to read certificate-authority %s: %w", certificateAuthority, err)
+		}
+		connection.CertificateAuthorityData = ca
+	}
+
+	current := flags.ClusterConnections[cluster]
+	if connection.TLSServerName != "" {
+		current.TLSServerName = connection.TLSServerName
+	}
+	if connection.ProxyURL != "" {
+		current.ProxyURL = connection.ProxyURL
+	}
+	if len(connection.CertificateAuthorityData) > 0 {
+		current.CertificateAuthorityData = connection.CertificateAuthorityData
+	}
+	current.DisableCompression = current.DisableCompression || connection.DisableCompression
+	if flags.ClusterConnections == nil {
+		flags.ClusterConnections = map[string]common.ClusterConnection{}
+	}
+	flags.ClusterConnections[cluster] = current
+	return flags.ValidateConnections()
+}
+
+// selectMemberCluster restricts the flags to a single member cluster. Its api server is taken from apiServer if set,
+// then from the topology file and last from the local kubeconfig.
+func selectMemberCluster(flags *common.Flags, cluster, apiServer string) error {
+	url := apiServer
+	for i, memberCluster := range flags.MemberClusters {
+		if url == "" && memberCluster == cluster && i < len(flags.MemberClusterApiServerUrls) {
+			url = flags.MemberClusterApiServerUrls[i]
+		}
+	}
+	flags.MemberClusters = []string{cluster}
+	flags.MemberClusterApiServerUrls = []string{url}
+	if url != "" {
+		return nil
+	}
+
+	configFilePath := common.LoadKubeConfigFilePath()
+	kubeconfig, err := clientcmd.LoadFromFile(configFilePath)
+	if err != nil {
+		return xerrors.Errorf("error loading kubeconfig file '%s': %w", configFilePath, err)
+	}
+	return common.FillMemberClusterApiServerUrls(kubeconfig, flags)
+}
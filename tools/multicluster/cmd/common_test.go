@@ -3,12 +3,15 @@ package cmd
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
 	"testing"
 
+	"github.com/10gen/ops-manager-kubernetes/multi/pkg/common"
 	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
@@ -886,3 +889,21 @@ func readKubeConfig(client kubernetes.Interface, namespace string) (KubeConfigFi
 
 	return result, nil
 }
+
+func TestCommandOutput_WritesOnlyTheReportToStdout(t *testing.T) {
+	defer func() { _ = common.ConfigureLogging(os.Stdout, os.Stderr, common.LogOptions{}) }()
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd := &cobra.Command{}
+	cmd.SetOut(stdout)
+	cmd.SetErr(stderr)
+
+	out := newCommandOutput(cmd, "setup", "json")
+	common.Logger().Info("Ensured namespaces exist in all clusters.")
+	fmt.Fprintf(out.progress, "\nVerifying the operator's credentials\n")
+	out.done()
+
+	assert.Equal(t, "Ensured namespaces exist in all clusters.\n\nVerifying the operator's credentials\n", stderr.String())
+	report := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(stdout.Bytes(), &report))
+	assert.Equal(t, "setup", report["command"])
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/10gen/ops-manager-kubernetes/multi/pkg/common"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// topologyFlagNames are the flags describing the topology, which is fully described by the --config file instead.
+var topologyFlagNames = []string{"member-clusters", "member-clusters-api-servers", "central-cluster", "member-cluster-namespace", "member-cluster-namespaces", "member-namespace-selector", "central-cluster-namespace"}
+
+// applyTopologyConfig loads the topology file and sets the flags it describes. The api servers of member clusters
+// that are not set in the file are taken from the local kubeconfig.
+func applyTopologyConfig(cmd *cobra.Command, configFile string, flags *common.Flags) error {
+	if err := loadTopologyConfig(cmd, configFile, flags); err != nil {
+		return err
+	}
+
+	for _, url := range flags.MemberClusterApiServerUrls {
+		if url == "" {
+			configFilePath := common.LoadKubeConfigFilePath()
+			kubeconfig, err := clientcmd.LoadFromFile(configFilePath)
+			if err != nil {
+				return xerrors.Errorf("error loading kubeconfig file '%s': %w", configFilePath, err)
+			}
+			return common.FillMemberClusterApiServerUrls(kubeconfig, flags)
+		}
+	}
+	return nil
+}
+
+// loadTopologyConfig sets the topology flags from the config file, leaving the api servers it doesn't set empty.
+func loadTopologyConfig(cmd *cobra.Command, configFile string, flags *common.Flags) error {
+	for _, name := range topologyFlagNames {
+		if cmd.Flags().Changed(name) {
+			return xerrors.Errorf("--%s cannot be used together with --config, the topology is read from %s", name, configFile)
+		}
+	}
+
+	topology, err := common.LoadTopology(configFile)
+	if err != nil {
+		return err
+	}
+	topology.ApplyTo(flags)
+	return nil
+}
+
+// discoverApiServers replaces the api servers of the member clusters taken from the local kubeconfig with ones
+// found by the --api-server-discovery strategies. The addresses are probed from the central cluster, except in dry
+// runs, which must not create the probe pods.
+func discoverApiServers(ctx context.Context, flags *common.Flags, clientMap map[string]common.KubeClient) error {
+	if len(flags.ApiServerDiscovery) == 0 {
+		return nil
+	}
+	// without a local kubeconfig all api servers are treated as explicitly set
+	kubeconfig, _ := clientcmd.LoadFromFile(common.LoadKubeConfigFilePath())
+
+	var probe common.ApiServerProbe
+	if !flags.DryRun {
+		probe = common.NewPodApiServerProbe(clientMap[flags.CentralCluster], *flags)
+	}
+	return common.DiscoverApiServers(ctx, flags, clientMap, kubeconfig, probe)
+}
+
+// loadImagePullSecret reads the docker config file or builds one from the registry credentials, if either is given,
+// into the flags, so that the image pull secret is created with it. The registry password is read from
+// registryPasswordFile, or from the common.RegistryPasswordEnv environment variable, when a registry is given.
+func loadImagePullSecret(dockerConfigPath string, registry common.RegistryCredentials, registryPasswordFile string, flags *common.Flags) error {
+	if registryPasswordFile != "" || !registry.IsEmpty() {
+		password, err := common.LoadRegistryPassword(registryPasswordFile)
+		if err != nil {
+			return err
+		}
+		registry.Password = password
+	}
+	if dockerConfigPath == "" && registry.IsEmpty() {
+		return nil
+	}
+	if flags.ImagePullSecrets == "" {
+		return xerrors.Errorf("image-pull-secrets is required to name the image pull secret created from the registry credentials")
+	}
+	if dockerConfigPath != "" && !registry.IsEmpty() {
+		return xerrors.Errorf("image-pull-secret-docker-config cannot be used together with the registry-server, registry-username and registry-password-file flags")
+	}
+
+	var err error
+	if dockerConfigPath != "" {
+		flags.ImagePullSecretDockerConfig, err = common.LoadDockerConfig(dockerConfigPath)
+	} else {
+		flags.ImagePullSecretDockerConfig, err = common.DockerConfigFromCredentials(registry)
+	}
+	return err
+}
+
+// loadRBACProfile reads the RBAC profile file, if one is given, into the flags, and checks that it can be applied
+// to the rules generated for the managed kinds.
+func loadRBACProfile(path string, flags *common.Flags) error {
+	if path != "" {
+		profile, err := common.LoadRBACProfile(path)
+		if err != nil {
+			return err
+		}
+		flags.RBACProfile = profile
+	}
+	return flags.ValidateRBAC()
+}
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/10gen/ops-manager-kubernetes/multi/pkg/common"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func init() {
+	rootCmd.AddCommand(crdsCmd)
+	crdsCmd.AddCommand(crdsInstallCmd, crdsUpgradeCmd, crdsCheckCmd)
+
+	crdsCmd.PersistentFlags().StringVar(&crdsFlags.CentralCluster, "central-cluster", "", "The central cluster the operator is deployed in. [required]")
+	crdsCmd.PersistentFlags().StringVar(&common.MemberClusters, "member-clusters", "", "Comma separated list of member clusters the CRDs are also applied to. [optional]")
+	crdsCmd.PersistentFlags().StringVar(&crdsConfigFile, "config", "", "Path to a topology file describing the central and member clusters, used instead of the individual topology flags. The CRDs are applied to all its clusters. [optional]")
+	crdsCmd.PersistentFlags().IntVar(&crdsFlags.Parallelism, "parallelism", common.DefaultParallelism, "Number of clusters to process concurrently. [optional default: 5]")
+	crdsUpgradeCmd.Flags().BoolVar(&crdsForce, "force", false, "Upgrade the CRDs even if the compatibility check fails. [optional default: false]")
+}
+
+// crdsCmd represents the crds command
+var crdsCmd = &cobra.Command{
+	Use:   "crds",
+	Short: "Manage the MongoDB CustomResourceDefinitions",
+	Long: `'crds' installs, upgrades and checks the MongoDB CustomResourceDefinitions of the crds.yaml embedded in this
+tool, in the central cluster and optionally in the member clusters.`,
+}
+
+// crdsInstallCmd represents the crds install command
+var crdsInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Install the MongoDB CRDs that are missing",
+	Long: `'crds install' applies the embedded CRDs that are not installed yet. Installed CRDs are left untouched, use
+'crds upgrade' to update them.
+
+Example:
+
+kubectl-mongodb crds install --central-cluster="operator-cluster"
+kubectl-mongodb crds install --central-cluster="operator-cluster" --member-clusters="cluster-1,cluster-2,cluster-3"
+
+`,
+	Run: func(cmd *cobra.Command, _ []string) {
+		out := newCommandOutput(cmd, "crds install", "")
+		clientMap, crds := prepareCRDsCommand(cmd, out)
+		if err := common.InstallCRDs(cmd.Context(), crdsFlags, clientMap, crds, false); err != nil {
+			out.fail(err)
+		}
+		out.done()
+	},
+}
+
+// crdsUpgradeCmd represents the crds upgrade command
+var crdsUpgradeCmd = &cobra.Command{
+	Use:   "upgrade",
+	Short: "Upgrade the MongoDB CRDs after checking that existing resources stay valid",
+	Long: `'crds upgrade' runs the same checks as 'crds check' and applies all the embedded CRDs if none of them fails.
+Upgrade the CRDs before the operator, the new operator version relies on their new fields.
+
+Example:
+
+kubectl-mongodb crds upgrade --central-cluster="operator-cluster"
+kubectl-mongodb crds upgrade --config=topology.yaml
+
+`,
+	Run: func(cmd *cobra.Command, _ []string) {
+		out := newCommandOutput(cmd, "crds upgrade", "")
+		clientMap, crds := prepareCRDsCommand(cmd, out)
+		report := common.CheckCRDs(cmd.Context(), crdsFlags, clientMap, crds)
+		report.Print(out.progress)
+		if report.Failed() {
+			if !crdsForce {
+				out.fail(xerrors.Errorf("the CRDs are not compatible with the existing resources, fix them or pass --force to upgrade anyway"))
+			}
+			common.Warnf("upgrading incompatible CRDs because of --force")
+		}
+
+		if err := common.InstallCRDs(cmd.Context(), crdsFlags, clientMap, crds, true); err != nil {
+			out.fail(err)
+		}
+		out.done()
+	},
+}
+
+// crdsCheckCmd represents the crds check command
+var crdsCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check that the embedded MongoDB CRDs are compatible with the installed ones",
+	Long: `'crds check' compares the embedded CRDs with the installed ones without changing them. A CRD fails the check if
+it doesn't serve a version that existing resources are stored in, or if any existing MongoDB, MongoDBMultiCluster,
+MongoDBUser or MongoDBOpsManager resource is invalid under its new schema, including its x-kubernetes-validations
+rules. Removed fields, new required fields, changed types and unknown fields of existing resources that the api server
+would prune are reported as warnings.
+
+The command exits with a non-zero code if any check fails.
+
+Example:
+
+kubectl-mongodb crds check --central-cluster="operator-cluster"
+
+`,
+	Run: func(cmd *cobra.Command, _ []string) {
+		out := newCommandOutput(cmd, "crds check", "")
+		clientMap, crds := prepareCRDsCommand(cmd, out)
+		report := common.CheckCRDs(cmd.Context(), crdsFlags, clientMap, crds)
+		report.Print(out.progress)
+		if report.Failed() {
+			out.fail(xerrors.Errorf("the CRDs are not compatible with the existing resources"))
+		}
+		out.done()
+	},
+}
+
+var (
+	crdsFlags      = common.Flags{}
+	crdsConfigFile string
+	crdsForce      bool
+)
+
+// prepareCRDsCommand parses the flags and returns the clients of the clusters and the embedded CRDs, or fails the
+// command.
+func prepareCRDsCommand(cmd *cobra.Command, out *commandOutput) (map[string]common.KubeClient, []*unstructured.Unstructured) {
+	if err := parseCRDsFlags(cmd); err != nil {
+		out.fail(xerrors.Errorf("error parsing flags: %w", err))
+	}
+
+	crds, err := common.EmbeddedCRDs()
+	if err != nil {
+		out.fail(err)
+	}
+
+	clientMap, err := common.CreateClientMap(crdsFlags.MemberClusters, crdsFlags.CentralCluster, common.LoadKubeConfigFilePath(), crdsFlags.ClientGetter(common.GetKubernetesClient))
+	if err != nil {
+		out.fail(xerrors.Errorf("failed to create clientset map: %w", err))
+	}
+	return clientMap, crds
+}
+
+func parseCRDsFlags(cmd *cobra.Command) error {
+	if crdsConfigFile != "" {
+		return applyTopologyConfig(cmd, crdsConfigFile, &crdsFlags)
+	}
+
+	if crdsFlags.CentralCluster == "" {
+		return xerrors.Errorf("non empty values are required for [central-cluster]")
+	}
+	crdsFlags.MemberClusters = nil
+	if common.MemberClusters != "" {
+		crdsFlags.MemberClusters = strings.Split(common.MemberClusters, ",")
+	}
+	return nil
+}
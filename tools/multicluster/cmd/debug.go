@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"fmt"
-	"os"
 	"strings"
 
 	"k8s.io/client-go/tools/clientcmd"
@@ -18,7 +17,11 @@ type Flags struct {
 	UseOwnerRef bool
 }
 
-func (f *Flags) ParseDebugFlags() error {
+func (f *Flags) ParseDebugFlags(cmd *cobra.Command) error {
+	if debugConfigFile != "" {
+		return applyTopologyConfig(cmd, debugConfigFile, &f.Flags)
+	}
+
 	if len(common.MemberClusters) > 0 {
 		f.MemberClusters = strings.Split(common.MemberClusters, ",")
 	}
@@ -36,7 +39,11 @@ func (f *Flags) ParseDebugFlags() error {
 	return nil
 }
 
-var debugFlags = &Flags{}
+var (
+	debugFlags      = &Flags{}
+	debugConfigFile string
+	debugOutput     string
+)
 
 func init() {
 	rootCmd.AddCommand(debugCmd)
@@ -46,8 +53,10 @@ func init() {
 	debugCmd.Flags().StringVar(&debugFlags.MemberClusterNamespace, "member-cluster-namespace", "", "The namespace the member cluster resources will be deployed to. [optional]")
 	debugCmd.Flags().StringVar(&debugFlags.CentralClusterNamespace, "central-cluster-namespace", "", "The namespace the Operator will be deployed to. [optional]")
 	debugCmd.Flags().StringVar(&common.MemberClustersApiServers, "member-clusters-api-servers", "", "Comma separated list of api servers addresses. [optional, default will take addresses from KUBECONFIG env var]")
+	debugCmd.Flags().StringVar(&debugConfigFile, "config", "", "Path to a topology file describing the central and member clusters, used instead of the individual topology flags. [optional]")
 	debugCmd.Flags().BoolVar(&debugFlags.Anonymize, "anonymize", true, "True if anonymization should be turned on")
 	debugCmd.Flags().BoolVar(&debugFlags.UseOwnerRef, "ownerRef", false, "True if the collection should be made with owner references (consider turning it on after CLOUDP-176772 is fixed)")
+	debugCmd.Flags().StringVar(&debugOutput, "output", "", "Write a report of the collection errors in every cluster and the paths of the debug bundle to stdout once the data is collected, in json or yaml. The progress is printed to stderr instead. [optional]")
 }
 
 var debugCmd = &cobra.Command{
@@ -58,19 +67,20 @@ var debugCmd = &cobra.Command{
 Example:
 
 kubectl-mongodb debug
+kubectl-mongodb debug --config=topology.yaml --output=json
 kubectl-mongodb debug setup --central-cluster="operator-cluster" --member-clusters="cluster-1,cluster-2,cluster-3" --member-cluster-namespace=mongodb --central-cluster-namespace=mongodb
 
 `,
 	Run: func(cmd *cobra.Command, args []string) {
-		err := debugFlags.ParseDebugFlags()
+		out := newCommandOutput(cmd, "debug", debugOutput)
+		err := debugFlags.ParseDebugFlags(cmd)
 		if err != nil {
-			fmt.Printf("error parsing flags: %s\n", err)
-			os.Exit(1)
+			out.fail(fmt.Errorf("error parsing flags: %w", err))
 		}
-		clientMap, err := common.CreateClientMap(debugFlags.MemberClusters, debugFlags.CentralCluster, common.LoadKubeConfigFilePath(), common.GetKubernetesClient)
+		out.report.SetClusters(debugFlags.Flags)
+		clientMap, err := common.CreateClientMap(debugFlags.MemberClusters, debugFlags.CentralCluster, common.LoadKubeConfigFilePath(), debugFlags.ClientGetter(common.GetKubernetesClient))
 		if err != nil {
-			fmt.Printf("failed to create clientset map: %s", err)
-			os.Exit(1)
+			out.fail(fmt.Errorf("failed to create clientset map: %w", err))
 		}
 
 		var collectors []debug.Collector
@@ -114,25 +124,34 @@ kubectl-mongodb debug setup --central-cluster="operator-cluster" --member-cluste
 			}
 		}
 
-		fmt.Printf("==== Report ====\n\n")
-		fmt.Printf("Anonymisation: %v\n", debugFlags.Anonymize)
-		fmt.Printf("Following owner refs: %v\n", debugFlags.UseOwnerRef)
-		fmt.Printf("Collected data from %d clusters\n", len(collectionResults))
-		fmt.Printf("\n\n==== Collected Data ====\n\n")
+		// a failed collector doesn't fail the command, the data of the other collectors is still written
+		for _, result := range collectionResults {
+			for _, collectorErr := range result.Errors() {
+				out.report.AddClusterError(result.Cluster(), collectorErr)
+			}
+		}
+
+		fmt.Fprintf(out.progress, "==== Report ====\n\n")
+		fmt.Fprintf(out.progress, "Anonymisation: %v\n", debugFlags.Anonymize)
+		fmt.Fprintf(out.progress, "Following owner refs: %v\n", debugFlags.UseOwnerRef)
+		fmt.Fprintf(out.progress, "Collected data from %d clusters\n", len(collectionResults))
+		fmt.Fprintf(out.progress, "\n\n==== Collected Data ====\n\n")
 
 		storeDirectory, err := debug.DebugDirectory()
 		if err != nil {
-			fmt.Printf("failed to obtain directory for collecting the results: %v", err)
-			os.Exit(1)
+			out.fail(fmt.Errorf("failed to obtain directory for collecting the results: %w", err))
 		}
 
 		if len(collectionResults) > 0 {
 			directoryName, compressedFileName, err := debug.WriteToFile(storeDirectory, collectionResults...)
 			if err != nil {
-				panic(err)
+				out.fail(fmt.Errorf("failed to write the collected data: %w", err))
 			}
-			fmt.Printf("Debug data file (compressed): %v\n", compressedFileName)
-			fmt.Printf("Debug data directory: %v\n", directoryName)
+			fmt.Fprintf(out.progress, "Debug data file (compressed): %v\n", compressedFileName)
+			fmt.Fprintf(out.progress, "Debug data directory: %v\n", directoryName)
+			out.report.AddArtifact(common.Artifact{Type: common.ArtifactDebugBundle, Path: compressedFileName})
+			out.report.AddArtifact(common.Artifact{Type: common.ArtifactDebugDirectory, Path: directoryName})
 		}
+		out.done()
 	},
 }
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/10gen/ops-manager-kubernetes/multi/pkg/common"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+)
+
+func init() {
+	multiclusterCmd.AddCommand(helmValuesCmd)
+
+	helmValuesCmd.Flags().StringVar(&common.MemberClusters, "member-clusters", "", "Comma separated list of member clusters. [required]")
+	helmValuesCmd.Flags().StringVar(&helmValuesFlags.ServiceAccount, "service-account", "mongodb-enterprise-operator-multi-cluster", "Name of the service account which should be used for the Operator to communicate with the member clusters. [optional, default: mongodb-enterprise-operator-multi-cluster]")
+	helmValuesCmd.Flags().StringVar(&helmValuesFlags.CentralCluster, "central-cluster", "", "The central cluster the operator is deployed in. [required]")
+	helmValuesCmd.Flags().StringVar(&helmValuesFlags.MemberClusterNamespace, "member-cluster-namespace", "", "The namespace the member cluster resources are deployed to. [required]")
+	helmValuesCmd.Flags().StringSliceVar(&helmValuesFlags.MemberClusterNamespaces, "member-cluster-namespaces", nil, "Comma separated list of additional namespaces watched by the operator in every member cluster. [optional]")
+	helmValuesCmd.Flags().StringVar(&helmValuesFlags.CentralClusterNamespace, "central-cluster-namespace", "", "The namespace the Operator is deployed to. [required]")
+	helmValuesCmd.Flags().BoolVar(&helmValuesFlags.ClusterScoped, "cluster-scoped", false, "The operator watches all namespaces. [optional default: false]")
+	helmValuesCmd.Flags().StringVar(&helmValuesConfigFile, "config", "", "Path to a topology file describing the central and member clusters, used instead of the individual topology flags. [optional]")
+	helmValuesCmd.Flags().StringVar(&helmValuesOutput, "output", "values.yaml", "Path the Helm values are written to. [optional default: values.yaml]")
+	helmValuesCmd.Flags().StringVar(&helmValuesOperatorManifest, "operator-manifest", "", "Path to the operator manifest, e.g. mongodb-enterprise-multi-cluster.yaml, checked against the Helm values. [optional]")
+}
+
+// helmValuesCmd represents the helm-values command
+var helmValuesCmd = &cobra.Command{
+	Use:   "helm-values",
+	Short: "Write the Helm values installing the operator for a multicluster environment",
+	Long: `'helm-values' writes the values of the enterprise-operator Helm chart that match the objects created by setup
+with the same flags: the member clusters, the KubeConfig secret, the namespace and ServiceAccount of the operator and
+the namespaces it watches. It doesn't connect to any cluster.
+
+If --operator-manifest is given, the operator Deployment in it is checked against the values and every mismatch is
+reported. The command exits with a non-zero code if there are any.
+
+Example:
+
+kubectl-mongodb multicluster helm-values --central-cluster="operator-cluster" --member-clusters="cluster-1,cluster-2,cluster-3" --member-cluster-namespace=mongodb --central-cluster-namespace=mongodb --output=values.yaml
+kubectl-mongodb multicluster helm-values --config=topology.yaml --operator-manifest=mongodb-enterprise-multi-cluster.yaml
+
+`,
+	Run: func(cmd *cobra.Command, _ []string) {
+		if err := parseHelmValuesFlags(cmd); err != nil {
+			fmt.Printf("error parsing flags: %s\n", err)
+			os.Exit(1)
+		}
+
+		if err := writeHelmValues(cmd.OutOrStdout(), helmValuesOutput, helmValuesOperatorManifest, helmValuesFlags); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+var (
+	helmValuesFlags            = common.Flags{}
+	helmValuesConfigFile       string
+	helmValuesOutput           string
+	helmValuesOperatorManifest string
+)
+
+// writeHelmValues writes the Helm values of the flags to path, printing where to w, and returns an error if they don't
+// match the operator manifest.
+func writeHelmValues(w io.Writer, path, operatorManifest string, flags common.Flags) error {
+	problems, err := common.WriteHelmValues(path, operatorManifest, flags)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Wrote Helm values to %s\n", path)
+	if len(problems) > 0 {
+		return xerrors.Errorf("the operator manifest %s doesn't match the Helm values:\n  - %s", operatorManifest, strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+func parseHelmValuesFlags(cmd *cobra.Command) error {
+	if helmValuesConfigFile != "" {
+		if err := applyTopologyConfig(cmd, helmValuesConfigFile, &helmValuesFlags); err != nil {
+			return err
+		}
+	} else {
+		if common.AnyAreEmpty(common.MemberClusters, helmValuesFlags.ServiceAccount, helmValuesFlags.CentralCluster, helmValuesFlags.MemberClusterNamespace, helmValuesFlags.CentralClusterNamespace) {
+			return xerrors.Errorf("non empty values are required for [service-account, member-clusters, central-cluster, member-cluster-namespace, central-cluster-namespace]")
+		}
+		helmValuesFlags.MemberClusters = strings.Split(common.MemberClusters, ",")
+	}
+
+	if helmValuesFlags.MemberNamespaceSelector != "" {
+		return xerrors.Errorf("member-namespace-selector is matched against the clusters and cannot be used with helm-values, list the namespaces with member-cluster-namespaces instead")
+	}
+	return nil
+}
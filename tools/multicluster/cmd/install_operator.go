@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/10gen/ops-manager-kubernetes/multi/pkg/common"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+)
+
+func init() {
+	multiclusterCmd.AddCommand(installOperatorCmd)
+
+	installOperatorCmd.Flags().StringVar(&common.MemberClusters, "member-clusters", "", "Comma separated list of member clusters. [required]")
+	installOperatorCmd.Flags().StringVar(&installOperatorFlags.ServiceAccount, "service-account", "mongodb-enterprise-operator-multi-cluster", "Name of the service account which should be used for the Operator to communicate with the member clusters. [optional, default: mongodb-enterprise-operator-multi-cluster]")
+	installOperatorCmd.Flags().StringVar(&installOperatorFlags.CentralCluster, "central-cluster", "", "The central cluster the operator is deployed in. [required]")
+	installOperatorCmd.Flags().StringVar(&installOperatorFlags.MemberClusterNamespace, "member-cluster-namespace", "", "The namespace the member cluster resources are deployed to. [required]")
+	installOperatorCmd.Flags().StringSliceVar(&installOperatorFlags.MemberClusterNamespaces, "member-cluster-namespaces", nil, "Comma separated list of additional namespaces watched by the operator in every member cluster. [optional]")
+	installOperatorCmd.Flags().StringVar(&installOperatorFlags.MemberNamespaceSelector, "member-namespace-selector", "", "Label selector of additional namespaces watched by the operator, matched in every cluster. [optional]")
+	installOperatorCmd.Flags().StringVar(&installOperatorFlags.CentralClusterNamespace, "central-cluster-namespace", "", "The namespace the Operator is deployed to. [required]")
+	installOperatorCmd.Flags().BoolVar(&installOperatorFlags.ClusterScoped, "cluster-scoped", false, "The operator watches all namespaces. [optional default: false]")
+	installOperatorCmd.Flags().StringVar(&installOperatorConfigFile, "config", "", "Path to a topology file describing the central and member clusters, used instead of the individual topology flags. [optional]")
+	installOperatorCmd.Flags().StringVar(&installOperatorImage, "operator-image", "", "Image of the operator. [optional, default: the image of mongodb-enterprise-multi-cluster.yaml]")
+	installOperatorCmd.Flags().DurationVar(&installOperatorTimeout, "timeout", common.DefaultOperatorReadyTimeout, "How long to wait for the operator to become ready. [optional default: 5m]")
+}
+
+// installOperatorCmd represents the install-operator command
+var installOperatorCmd = &cobra.Command{
+	Use:   "install-operator",
+	Short: "Install the multi-cluster operator in the central cluster",
+	Long: `'install-operator' applies the CRDs, the webhook ClusterRole and the operator Deployment of the
+mongodb-enterprise-multi-cluster.yaml and crds.yaml manifests embedded in this tool to the central cluster. CRDs that
+are already installed are left untouched, use 'crds upgrade' to update them. The Deployment is changed to match the
+objects created by setup with the same flags: its namespace, ServiceAccount, watched namespaces and KubeConfig secret.
+Run setup first, it creates the operator's ServiceAccount, Roles, KubeConfig secret and member list ConfigMap.
+
+The command waits for the rollout of the operator to complete, like 'kubectl rollout status': all its replicas run
+the new version and are available. If it doesn't, the state of its pods and the first errors they logged are printed
+and the command exits with a non-zero code.
+
+Example:
+
+kubectl-mongodb multicluster install-operator --central-cluster="operator-cluster" --member-clusters="cluster-1,cluster-2,cluster-3" --member-cluster-namespace=mongodb --central-cluster-namespace=mongodb
+kubectl-mongodb multicluster install-operator --config=topology.yaml --operator-image=quay.io/mongodb/mongodb-enterprise-operator-ubi:1.33.0
+
+`,
+	Run: func(cmd *cobra.Command, _ []string) {
+		if err := parseInstallOperatorFlags(cmd); err != nil {
+			fmt.Printf("error parsing flags: %s\n", err)
+			os.Exit(1)
+		}
+
+		clientMap, err := common.CreateClientMap(installOperatorFlags.MemberClusters, installOperatorFlags.CentralCluster, common.LoadKubeConfigFilePath(), installOperatorFlags.ClientGetter(common.GetKubernetesClient))
+		if err != nil {
+			fmt.Printf("failed to create clientset map: %s", err)
+			os.Exit(1)
+		}
+		if err := common.SelectMemberNamespaces(cmd.Context(), clientMap, &installOperatorFlags); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		if err := common.InstallOperator(cmd.Context(), installOperatorFlags, clientMap[installOperatorFlags.CentralCluster], installOperatorImage, installOperatorTimeout); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+var (
+	installOperatorFlags      = common.Flags{}
+	installOperatorConfigFile string
+	installOperatorImage      string
+	installOperatorTimeout    time.Duration
+)
+
+func parseInstallOperatorFlags(cmd *cobra.Command) error {
+	if installOperatorConfigFile != "" {
+		return applyTopologyConfig(cmd, installOperatorConfigFile, &installOperatorFlags)
+	}
+
+	if common.AnyAreEmpty(common.MemberClusters, installOperatorFlags.ServiceAccount, installOperatorFlags.CentralCluster, installOperatorFlags.MemberClusterNamespace, installOperatorFlags.CentralClusterNamespace) {
+		return xerrors.Errorf("non empty values are required for [service-account, member-clusters, central-cluster, member-cluster-namespace, central-cluster-namespace]")
+	}
+
+	installOperatorFlags.MemberClusters = strings.Split(common.MemberClusters, ",")
+	return nil
+}
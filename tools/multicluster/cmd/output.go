@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/10gen/ops-manager-kubernetes/multi/pkg/common"
+
+	"github.com/spf13/cobra"
+)
+
+// commandOutput reports the outcome of a command in the format selected with --output. With a structured format,
+// the progress and the log messages go to stderr so that stdout only holds the report, written once the command is
+// done.
+type commandOutput struct {
+	format   common.OutputFormat
+	report   *common.RunReport
+	plan     *common.Plan
+	progress io.Writer
+	stdout   io.Writer
+}
+
+// newCommandOutput starts reporting the command, or exits if the output format is unknown.
+func newCommandOutput(cmd *cobra.Command, command, format string) *commandOutput {
+	outputFormat, err := common.ParseOutputFormat(format)
+	if err != nil {
+		fmt.Fprintf(cmd.ErrOrStderr(), "error parsing flags: %s\n", err)
+		os.Exit(1)
+	}
+
+	o := &commandOutput{format: outputFormat, report: common.NewRunReport(command), progress: cmd.OutOrStdout(), stdout: cmd.OutOrStdout()}
+	if outputFormat != common.OutputText {
+		o.progress = cmd.ErrOrStderr()
+		if err := common.ConfigureLogging(o.progress, o.progress, logOptions); err != nil {
+			o.fail(err)
+		}
+	}
+	return o
+}
+
+// recordActions wraps the clients so that the actions performed through them are reported. In dry-run mode the
+// actions are planned instead of performed.
+func (o *commandOutput) recordActions(clientMap map[string]common.KubeClient, dryRun bool) map[string]common.KubeClient {
+	o.plan = common.NewPlan()
+	o.report.DryRun = dryRun
+	if dryRun {
+		return common.NewDryRunClientMap(clientMap, o.plan)
+	}
+	return common.NewRecordingClientMap(clientMap, o.plan)
+}
+
+// fail reports the error and exits with a non-zero code. Without a structured format, the error is logged.
+func (o *commandOutput) fail(err error) {
+	if o.format == common.OutputText {
+		common.Logger().Error(err.Error())
+	} else {
+		o.report.Fail(err)
+		o.write()
+	}
+	os.Exit(1)
+}
+
+// done reports the successful end of the command.
+func (o *commandOutput) done() {
+	if o.format != common.OutputText {
+		o.write()
+	}
+}
+
+func (o *commandOutput) write() {
+	if o.plan != nil {
+		o.report.AddActions(o.plan)
+	}
+	o.report.Finish()
+	if err := o.report.Write(o.stdout, o.format); err != nil {
+		fmt.Fprintln(o.progress, err)
+		os.Exit(1)
+	}
+}
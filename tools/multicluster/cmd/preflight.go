@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/10gen/ops-manager-kubernetes/multi/pkg/common"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+func init() {
+	multiclusterCmd.AddCommand(preflightCmd)
+
+	preflightCmd.Flags().StringVar(&common.MemberClusters, "member-clusters", "", "Comma separated list of member clusters. [required]")
+	preflightCmd.Flags().StringVar(&preflightFlags.ServiceAccount, "service-account", "mongodb-enterprise-operator-multi-cluster", "Name of the service account which should be used for the Operator to communicate with the member clusters. [optional, default: mongodb-enterprise-operator-multi-cluster]")
+	preflightCmd.Flags().StringVar(&preflightFlags.CentralCluster, "central-cluster", "", "The central cluster the operator will be deployed in. [required]")
+	preflightCmd.Flags().StringVar(&preflightFlags.MemberClusterNamespace, "member-cluster-namespace", "", "The namespace the member cluster resources will be deployed to. [required]")
+	preflightCmd.Flags().StringSliceVar(&preflightFlags.MemberClusterNamespaces, "member-cluster-namespaces", nil, "Comma separated list of additional namespaces watched by the operator in every member cluster. The operator's Roles will be created in each of them. [optional]")
+	preflightCmd.Flags().StringVar(&preflightFlags.MemberNamespaceSelector, "member-namespace-selector", "", "Label selector of additional namespaces watched by the operator, matched in every cluster. [optional]")
+	preflightCmd.Flags().StringVar(&preflightFlags.CentralClusterNamespace, "central-cluster-namespace", "", "The namespace the Operator will be deployed to. [required]")
+	preflightCmd.Flags().BoolVar(&preflightFlags.Cleanup, "cleanup", false, "Check the permissions for deleting the resources created by previous runs of setup. [optional default: false]")
+	preflightCmd.Flags().BoolVar(&preflightFlags.ClusterScoped, "cluster-scoped", false, "Check the permissions for creating ClusterRole and ClusterRoleBindings for member clusters. [optional default: false]")
+	preflightCmd.Flags().BoolVar(&preflightFlags.CreateTelemetryClusterRoles, "create-telemetry-roles", true, "Check the permissions for creating ClusterRole and ClusterRoleBindings for telemetry. [optional default: true]")
+	preflightCmd.Flags().BoolVar(&preflightFlags.InstallDatabaseRoles, "install-database-roles", false, "Check the permissions for installing the database ServiceAccounts and Roles in the member clusters. [optional default: false]")
+	preflightCmd.Flags().BoolVar(&preflightFlags.CreateServiceAccountSecrets, "create-service-account-secrets", true, "Check the permissions for creating service account token secrets. [optional default: true]")
+	preflightCmd.Flags().DurationVar(&preflightFlags.TokenExpiry, "token-expiry", 0, "Check the permissions for minting ServiceAccount tokens through the TokenRequest API. [optional]")
+	preflightCmd.Flags().BoolVar(&preflightFlags.ClientCertificateAuth, "client-certificate-auth", false, "Check the permissions for requesting client certificates through the CertificateSigningRequest API. [optional default: false]")
+	preflightCmd.Flags().BoolVar(&preflightFlags.ApproveCSR, "approve-csr", false, "Check the permissions for approving CertificateSigningRequests. [optional default: false]")
+	preflightCmd.Flags().StringVar(&common.MemberClustersApiServers, "member-clusters-api-servers", "", "Comma separated list of api servers addresses. [optional, default will take addresses from KUBECONFIG env var]")
+	preflightCmd.Flags().StringVar(&preflightConfigFile, "config", "", "Path to a topology file describing the central and member clusters, used instead of the individual topology flags. [optional]")
+	preflightCmd.Flags().IntVar(&preflightFlags.Parallelism, "parallelism", common.DefaultParallelism, "Number of clusters to check concurrently. [optional default: 5]")
+}
+
+// preflightCmd represents the preflight command
+var preflightCmd = &cobra.Command{
+	Use:   "preflight",
+	Short: "Check that the multicluster environment can be set up",
+	Long: `'preflight' validates the central and member clusters before running setup. For every cluster it checks
+the local kubeconfig context, that the api server is reachable at the address that will be written to the
+operator's kubeconfig, and that the current user has all the permissions setup needs. It also checks that
+the MongoDB CRDs are installed in the central cluster.
+
+The command exits with a non-zero code if any check fails.
+
+Example:
+
+kubectl-mongodb multicluster preflight --central-cluster="operator-cluster" --member-clusters="cluster-1,cluster-2,cluster-3" --member-cluster-namespace=mongodb --central-cluster-namespace=mongodb
+kubectl-mongodb multicluster preflight --config=topology.yaml
+
+`,
+	Run: func(cmd *cobra.Command, _ []string) {
+		if err := parsePreflightFlags(cmd); err != nil {
+			fmt.Printf("error parsing flags: %s\n", err)
+			os.Exit(1)
+		}
+
+		configFilePath := common.LoadKubeConfigFilePath()
+		kubeconfig, err := clientcmd.LoadFromFile(configFilePath)
+		if err != nil {
+			fmt.Printf("error loading kubeconfig file '%s': %s\n", configFilePath, err)
+			os.Exit(1)
+		}
+
+		clientMap, err := common.CreateClientMap(preflightFlags.MemberClusters, preflightFlags.CentralCluster, configFilePath, preflightFlags.ClientGetter(common.GetKubernetesClient))
+		if err != nil {
+			fmt.Printf("failed to create clientset map: %s", err)
+			os.Exit(1)
+		}
+		if err := common.SelectMemberNamespaces(cmd.Context(), clientMap, &preflightFlags); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		report := common.RunPreflightChecks(cmd.Context(), preflightFlags, clientMap, kubeconfig)
+		report.Print(os.Stdout)
+		if report.Failed() {
+			os.Exit(1)
+		}
+	},
+}
+
+var (
+	preflightFlags      = common.Flags{}
+	preflightConfigFile string
+)
+
+func parsePreflightFlags(cmd *cobra.Command) error {
+	if preflightFlags.TokenExpiry != 0 && preflightFlags.TokenExpiry < common.MinTokenExpiry {
+		return xerrors.Errorf("token-expiry must be at least %s", common.MinTokenExpiry)
+	}
+	if preflightFlags.ClientCertificateAuth && preflightFlags.TokenExpiry != 0 {
+		return xerrors.Errorf("token-expiry cannot be used together with client-certificate-auth")
+	}
+
+	if preflightConfigFile != "" {
+		return applyTopologyConfig(cmd, preflightConfigFile, &preflightFlags)
+	}
+
+	if common.AnyAreEmpty(common.MemberClusters, preflightFlags.ServiceAccount, preflightFlags.CentralCluster, preflightFlags.MemberClusterNamespace, preflightFlags.CentralClusterNamespace) {
+		return xerrors.Errorf("non empty values are required for [service-account, member-clusters, central-cluster, member-cluster-namespace, central-cluster-namespace]")
+	}
+
+	preflightFlags.MemberClusters = strings.Split(common.MemberClusters, ",")
+
+	if strings.TrimSpace(common.MemberClustersApiServers) != "" {
+		preflightFlags.MemberClusterApiServerUrls = strings.Split(common.MemberClustersApiServers, ",")
+		if len(preflightFlags.MemberClusterApiServerUrls) != len(preflightFlags.MemberClusters) {
+			return xerrors.Errorf("expected %d addresses in member-clusters-api-servers parameter but got %d", len(preflightFlags.MemberClusters), len(preflightFlags.MemberClusterApiServerUrls))
+		}
+	}
+
+	if len(preflightFlags.MemberClusterApiServerUrls) == 0 {
+		configFilePath := common.LoadKubeConfigFilePath()
+		kubeconfig, err := clientcmd.LoadFromFile(configFilePath)
+		if err != nil {
+			return xerrors.Errorf("error loading kubeconfig file '%s': %w", configFilePath, err)
+		}
+		// setup takes the api servers from the kubeconfig clusters named like the member clusters, clusters that
+		// can't be found are reported by the checks instead of failing here
+		for _, cluster := range preflightFlags.MemberClusters {
+			url := ""
+			if kubeConfigCluster := kubeconfig.Clusters[cluster]; kubeConfigCluster != nil {
+				url = kubeConfigCluster.Server
+			}
+			preflightFlags.MemberClusterApiServerUrls = append(preflightFlags.MemberClusterApiServerUrls, url)
+		}
+	}
+	return nil
+}
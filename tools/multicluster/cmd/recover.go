@@ -2,8 +2,8 @@ package cmd
 
 import (
 	"fmt"
-	"os"
 	"strings"
+	"time"
 
 	"github.com/10gen/ops-manager-kubernetes/multi/pkg/common"
 
@@ -19,14 +19,38 @@ func init() {
 	recoverCmd.Flags().StringVar(&RecoverFlags.ServiceAccount, "service-account", "mongodb-enterprise-operator-multi-cluster", "Name of the service account which should be used for the Operator to communicate with the member clusters. [optional, default: mongodb-enterprise-operator-multi-cluster]")
 	recoverCmd.Flags().StringVar(&RecoverFlags.CentralCluster, "central-cluster", "", "The central cluster the operator will be deployed in. [required]")
 	recoverCmd.Flags().StringVar(&RecoverFlags.MemberClusterNamespace, "member-cluster-namespace", "", "The namespace the member cluster resources will be deployed to. [required]")
+	recoverCmd.Flags().StringSliceVar(&RecoverFlags.MemberClusterNamespaces, "member-cluster-namespaces", nil, "Comma separated list of additional namespaces watched by the operator in every member cluster. The operator's Roles will be created in each of them. [optional]")
+	recoverCmd.Flags().StringVar(&RecoverFlags.MemberNamespaceSelector, "member-namespace-selector", "", "Label selector of additional namespaces watched by the operator, matched in every cluster. [optional]")
 	recoverCmd.Flags().StringVar(&RecoverFlags.CentralClusterNamespace, "central-cluster-namespace", "", "The namespace the Operator will be deployed to. [required]")
-	recoverCmd.Flags().BoolVar(&RecoverFlags.Cleanup, "cleanup", false, "Delete all previously created resources except for namespaces. [optional default: false]")
+	recoverCmd.Flags().BoolVar(&RecoverFlags.Cleanup, "cleanup", false, "Delete all previously created resources of this installation except for namespaces. [optional default: false]")
+	recoverCmd.Flags().BoolVar(&RecoverFlags.AdoptLegacyObjects, "adopt-legacy-objects", false, "Label the objects created by older versions of this tool, which only carry the multi-cluster=true label, as part of this installation, so that they are managed and cleaned up with it. Their ClusterRoles and ClusterRoleBindings are deleted once the installation's own ones exist. [optional default: false]")
 	recoverCmd.Flags().BoolVar(&RecoverFlags.ClusterScoped, "cluster-scoped", false, "Create ClusterRole and ClusterRoleBindings for member clusters. [optional default: false]")
 	recoverCmd.Flags().StringVar(&RecoverFlags.OperatorName, "operator-name", common.DefaultOperatorName, "Name used to identify the deployment of the operator. [optional, default: mongodb-enterprise-operator]")
+	recoverCmd.Flags().StringVar(&RecoverFlags.InstallationID, "installation-id", "", "Identifies the installation in the labels and in the names of the cluster scoped objects created for it. Pass the same value to every command managing the installation. [optional, default: derived from the UID of the kube-system namespace of the central cluster, the central namespace and the operator name]")
 	recoverCmd.Flags().BoolVar(&RecoverFlags.InstallDatabaseRoles, "install-database-roles", false, "Install the ServiceAccounts and Roles required for running database workloads in the member clusters. [optional default: false]")
 	recoverCmd.Flags().StringVar(&RecoverFlags.SourceCluster, "source-cluster", "", "The source cluster for recovery. This has to be one of the healthy member cluster that is the source of truth for new cluster configuration. [required]")
 	recoverCmd.Flags().BoolVar(&RecoverFlags.CreateServiceAccountSecrets, "create-service-account-secrets", true, "Create service account token secrets. [optional default: true]")
 	recoverCmd.Flags().StringVar(&common.MemberClustersApiServers, "member-clusters-api-servers", "", "Comma separated list of api servers addresses. [optional, default will take addresses from KUBECONFIG env var]")
+	recoverCmd.Flags().StringVar(&RecoverFlags.ProxyURL, "proxy-url", "", "Proxy the operator connects to the api servers of the member clusters through, unless set per cluster in the topology file. [optional]")
+	recoverCmd.Flags().BoolVar(&RecoverFlags.DisableCompression, "disable-compression", false, "Disable the compression of the responses of the api servers of the member clusters. [optional default: false]")
+	recoverCmd.Flags().BoolVar(&RecoverFlags.CheckKubeConfig, "check-kubeconfig", true, "Connect to every member cluster with the generated kubeconfig before writing it. Api servers found by --api-server-discovery were already probed from the central cluster and are skipped. [optional default: true]")
+	recoverCmd.Flags().StringSliceVar(&RecoverFlags.ApiServerDiscovery, "api-server-discovery", nil, "Comma separated list of strategies tried in order to find api servers of the member clusters reachable from the central cluster: mapping, cluster-info, endpoints, kind, kubeconfig. Each address is probed from a pod in the central cluster. Api servers set explicitly are kept. [optional, default: the api servers of the local kubeconfig]")
+	recoverCmd.Flags().StringToStringVar(&RecoverFlags.ApiServerMapping, "api-server-mapping", nil, "Comma separated list of cluster=address pairs tried by the mapping discovery strategy. [optional]")
+	recoverCmd.Flags().StringVar(&RecoverFlags.ApiServerProbeImage, "api-server-probe-image", common.DefaultApiServerProbeImage, "Image of the pods probing the discovered api servers, it must provide curl. [optional default: curlimages/curl:8.10.1]")
+	recoverCmd.Flags().StringVar(&RecoverFlags.ApiServerProbeNamespace, "api-server-probe-namespace", common.DefaultApiServerProbeNamespace, "Namespace of the central cluster the probe pods are run in. [optional default: default]")
+	recoverCmd.Flags().StringVar(&recoverConfigFile, "config", "", "Path to a topology file describing the central and member clusters, used instead of the individual topology flags. [optional]")
+	recoverCmd.Flags().StringVar(&recoverRBACProfile, "rbac-profile", "", "Path to a file customizing the rules of the operator's Roles and ClusterRoles, see the RBACProfile documentation. [optional]")
+	recoverCmd.Flags().StringSliceVar(&RecoverFlags.ManagedKinds, "managed-kinds", nil, "Comma separated list of the custom resource kinds the operator manages (MongoDB, MongoDBMultiCluster, MongoDBUser, MongoDBOpsManager). The operator is only granted the minimal rules for these kinds, without wildcard verbs. [optional, default: all kinds with all verbs]")
+	recoverCmd.Flags().DurationVar(&RecoverFlags.TokenExpiry, "token-expiry", 0, "Mint ServiceAccount tokens with the given expiry through the TokenRequest API instead of using non-expiring token secrets. Rotate them with rotate-credentials before they expire. [optional]")
+	recoverCmd.Flags().BoolVar(&RecoverFlags.ClientCertificateAuth, "client-certificate-auth", false, "Authenticate the operator to the member clusters with client certificates issued through the CertificateSigningRequest API instead of ServiceAccount tokens. [optional default: false]")
+	recoverCmd.Flags().StringVar(&RecoverFlags.ClientCertificateUser, "client-certificate-user", "", "User the client certificates are issued for. [optional, default: the name of the service account]")
+	recoverCmd.Flags().StringVar(&RecoverFlags.ClientCertificateGroup, "client-certificate-group", "", "Group the client certificates are issued for. When set, the operator's roles in the member clusters are bound to the group instead of the user. [optional]")
+	recoverCmd.Flags().DurationVar(&RecoverFlags.ClientCertificateExpiry, "client-certificate-expiry", common.DefaultClientCertificateExpiry, "Lifetime requested for the client certificates. The signers of the clusters may shorten it. [optional default: 8760h]")
+	recoverCmd.Flags().BoolVar(&RecoverFlags.ApproveCSR, "approve-csr", false, "Approve the CertificateSigningRequests with the current credentials instead of waiting for an administrator to approve them. [optional default: false]")
+	recoverCmd.Flags().DurationVar(&RecoverFlags.CSRApprovalTimeout, "csr-approval-timeout", 10*time.Minute, "How long to wait for each CertificateSigningRequest to be approved and signed. [optional default: 10m]")
+	recoverCmd.Flags().IntVar(&RecoverFlags.Parallelism, "parallelism", common.DefaultParallelism, "Number of clusters to configure concurrently. [optional default: 5]")
+	recoverCmd.Flags().BoolVar(&RecoverFlags.DryRun, "dry-run", false, "Print the changes that would be made to every cluster, without making them. [optional default: false]")
+	recoverCmd.Flags().StringVar(&recoverOutput, "output", "", "Write a report of the actions performed in every cluster, the warnings, the errors and the generated artifacts to stdout once recover is done, in json or yaml. The progress is printed to stderr instead. [optional]")
 }
 
 // recoverCmd represents the recover command
@@ -36,38 +60,98 @@ var recoverCmd = &cobra.Command{
 	Long: `'recover' re-configures a failed multicluster environment to a enable the shuffling of dataplane
 resources to a new healthy topology.
 
+With --client-certificate-auth, a CertificateSigningRequest is submitted in every member cluster and the command
+waits for an administrator to approve it, printing the command to run, e.g.:
+
+kubectl --context cluster-1 certificate approve kubectl-mongodb-abcd1234
+
+Pass --approve-csr to approve them with the current credentials instead.
+
 Example:
 
 kubectl-mongodb multicluster recover --central-cluster="operator-cluster" --member-clusters="cluster-1,cluster-3,cluster-4" --member-cluster-namespace="mongodb-fresh" --central-cluster-namespace="mongodb" --operator-name=mongodb-enterprise-operator-multi-cluster --source-cluster="cluster-1"
+kubectl-mongodb multicluster recover --config=topology.yaml --source-cluster="cluster-1"
+kubectl-mongodb multicluster recover --config=topology.yaml --source-cluster="cluster-1" --output=yaml
 
 `,
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := parseRecoverFlags(args); err != nil {
-			fmt.Printf("error parsing flags: %s\n", err)
-			os.Exit(1)
+		out := newCommandOutput(cmd, "recover", recoverOutput)
+		if err := parseRecoverFlags(cmd, args); err != nil {
+			out.fail(xerrors.Errorf("error parsing flags: %w", err))
 		}
+		out.report.SetClusters(RecoverFlags)
 
-		clientMap, err := common.CreateClientMap(RecoverFlags.MemberClusters, RecoverFlags.CentralCluster, common.LoadKubeConfigFilePath(), common.GetKubernetesClient)
+		clientMap, err := common.CreateClientMap(RecoverFlags.MemberClusters, RecoverFlags.CentralCluster, common.LoadKubeConfigFilePath(), RecoverFlags.ClientGetter(common.GetKubernetesClient))
 		if err != nil {
-			fmt.Printf("failed to create clientset map: %s", err)
-			os.Exit(1)
+			out.fail(xerrors.Errorf("failed to create clientset map: %w", err))
+		}
+		if err := common.SelectMemberNamespaces(cmd.Context(), clientMap, &RecoverFlags); err != nil {
+			out.fail(err)
+		}
+		if err := common.ResolveInstallationID(cmd.Context(), clientMap[RecoverFlags.CentralCluster], &RecoverFlags); err != nil {
+			out.fail(err)
+		}
+		if err := discoverApiServers(cmd.Context(), &RecoverFlags, clientMap); err != nil {
+			out.fail(err)
 		}
 
+		clientMap = out.recordActions(clientMap, RecoverFlags.DryRun)
+
 		if err := common.EnsureMultiClusterResources(cmd.Context(), RecoverFlags, clientMap); err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+			out.fail(err)
 		}
 
 		if err := common.ReplaceClusterMembersConfigMap(cmd.Context(), clientMap[RecoverFlags.CentralCluster], RecoverFlags); err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+			out.fail(err)
+		}
+
+		if RecoverFlags.DryRun {
+			fmt.Fprintf(out.progress, "\n==== Dry run, no changes were made ====\n\n")
+			out.plan.Print(out.progress)
+		} else {
+			out.report.AddArtifact(common.Artifact{Type: common.ArtifactKubeConfigSecret, Cluster: RecoverFlags.CentralCluster, Namespace: RecoverFlags.CentralClusterNamespace, Name: common.KubeConfigSecretName})
 		}
+		out.done()
 	},
 }
 
-var RecoverFlags = common.Flags{}
+var (
+	RecoverFlags       = common.Flags{}
+	recoverConfigFile  string
+	recoverRBACProfile string
+	recoverOutput      string
+)
+
+func parseRecoverFlags(cmd *cobra.Command, args []string) error {
+	if err := loadRBACProfile(recoverRBACProfile, &RecoverFlags); err != nil {
+		return err
+	}
+	if RecoverFlags.TokenExpiry != 0 && RecoverFlags.TokenExpiry < common.MinTokenExpiry {
+		return xerrors.Errorf("token-expiry must be at least %s", common.MinTokenExpiry)
+	}
+	if RecoverFlags.ClientCertificateAuth && RecoverFlags.TokenExpiry != 0 {
+		return xerrors.Errorf("token-expiry cannot be used together with client-certificate-auth")
+	}
+	if RecoverFlags.ClientCertificateAuth && RecoverFlags.ClientCertificateExpiry < common.MinClientCertificateExpiry {
+		return xerrors.Errorf("client-certificate-expiry must be at least %s", common.MinClientCertificateExpiry)
+	}
+	if err := common.ValidateApiServerDiscovery(RecoverFlags.ApiServerDiscovery); err != nil {
+		return err
+	}
+	if err := (common.ClusterConnection{ProxyURL: RecoverFlags.ProxyURL}).Validate(); err != nil {
+		return err
+	}
+
+	if recoverConfigFile != "" {
+		if err := applyTopologyConfig(cmd, recoverConfigFile, &RecoverFlags); err != nil {
+			return err
+		}
+		if !common.Contains(RecoverFlags.MemberClusters, RecoverFlags.SourceCluster) {
+			return xerrors.Errorf("source-cluster has to be one of the healthy member clusters: %s", strings.Join(RecoverFlags.MemberClusters, ","))
+		}
+		return nil
+	}
 
-func parseRecoverFlags(args []string) error {
 	if common.AnyAreEmpty(common.MemberClusters, RecoverFlags.ServiceAccount, RecoverFlags.CentralCluster, RecoverFlags.MemberClusterNamespace, RecoverFlags.CentralClusterNamespace, RecoverFlags.SourceCluster) {
 		return xerrors.Errorf("non empty values are required for [service-account, member-clusters, central-cluster, member-cluster-namespace, central-cluster-namespace, source-cluster]")
 	}
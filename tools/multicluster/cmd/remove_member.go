@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/10gen/ops-manager-kubernetes/multi/pkg/common"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+)
+
+func init() {
+	multiclusterCmd.AddCommand(removeMemberCmd)
+
+	removeMemberCmd.Flags().StringVar(&removeMemberFlags.CentralCluster, "central-cluster", "", "The central cluster the operator is deployed in. [required]")
+	removeMemberCmd.Flags().StringVar(&removeMemberFlags.MemberClusterNamespace, "member-cluster-namespace", "", "The namespace the member cluster resources are deployed to. [required]")
+	removeMemberCmd.Flags().StringSliceVar(&removeMemberFlags.MemberClusterNamespaces, "member-cluster-namespaces", nil, "Comma separated list of additional namespaces watched by the operator in every member cluster. The operator's Roles are created in each of them. [optional]")
+	removeMemberCmd.Flags().StringVar(&removeMemberFlags.MemberNamespaceSelector, "member-namespace-selector", "", "Label selector of additional namespaces watched by the operator, matched in every cluster. [optional]")
+	removeMemberCmd.Flags().StringVar(&removeMemberFlags.CentralClusterNamespace, "central-cluster-namespace", "", "The namespace the Operator is deployed to. [required]")
+	removeMemberCmd.Flags().StringVar(&removeMemberFlags.OperatorName, "operator-name", common.DefaultOperatorName, "Name used to identify the deployment of the operator. [optional, default: mongodb-enterprise-operator]")
+	removeMemberCmd.Flags().StringVar(&removeMemberFlags.InstallationID, "installation-id", "", "Identifies the installation in the labels and in the names of the cluster scoped objects created for it. Pass the same value to every command managing the installation. [optional, default: derived from the UID of the kube-system namespace of the central cluster, the central namespace and the operator name]")
+	removeMemberCmd.Flags().StringVar(&removeMemberConfigFile, "config", "", "Path to a topology file describing the central cluster and namespaces, used instead of the individual topology flags. [optional]")
+	removeMemberCmd.Flags().BoolVar(&removeMemberForce, "force", false, "Remove the member cluster even if MongoDBMultiCluster resources still reference it. [optional default: false]")
+	removeMemberCmd.Flags().BoolVar(&removeMemberFlags.DryRun, "dry-run", false, "Print the changes that would be made, without making them. [optional default: false]")
+}
+
+// removeMemberCmd represents the remove-member command
+var removeMemberCmd = &cobra.Command{
+	Use:   "remove-member <cluster>",
+	Short: "Remove a member cluster from a multicluster environment",
+	Long: `'remove-member' removes a member cluster from the KubeConfig secret and the member list ConfigMap in the central
+cluster, and deletes the resources created by this tool in the member cluster if it can still be reached.
+The command refuses to remove a cluster that is referenced in the clusterSpecList of any MongoDBMultiCluster
+resource, unless --force is passed.
+
+Example:
+
+kubectl-mongodb multicluster remove-member cluster-4 --central-cluster="operator-cluster" --member-cluster-namespace=mongodb --central-cluster-namespace=mongodb
+kubectl-mongodb multicluster remove-member cluster-4 --config=topology.yaml --force
+
+`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		out := newCommandOutput(cmd, "remove-member", "")
+		if err := parseRemoveMemberFlags(cmd); err != nil {
+			out.fail(xerrors.Errorf("error parsing flags: %w", err))
+		}
+		cluster := args[0]
+
+		getClient := removeMemberFlags.ClientGetter(common.GetKubernetesClient)
+		kubeConfigPath := common.LoadKubeConfigFilePath()
+		centralClusterClient, err := getClient(removeMemberFlags.CentralCluster, kubeConfigPath)
+		if err != nil {
+			out.fail(xerrors.Errorf("failed to create clientset for the central cluster: %w", err))
+		}
+		if err := common.ResolveInstallationID(cmd.Context(), centralClusterClient, &removeMemberFlags); err != nil {
+			out.fail(err)
+		}
+		clientMap := map[string]common.KubeClient{removeMemberFlags.CentralCluster: centralClusterClient}
+		if memberClusterClient, err := getClient(cluster, kubeConfigPath); err != nil {
+			common.Warnf("the resources in cluster %s won't be cleaned up: %s", cluster, err)
+		} else if err := common.CheckClusterReachable(cmd.Context(), memberClusterClient, cluster); err != nil {
+			common.Warnf("the resources in cluster %s won't be cleaned up: %s", cluster, err)
+		} else {
+			clientMap[cluster] = memberClusterClient
+		}
+		if err := selectRemovedMemberNamespaces(cmd.Context(), clientMap, cluster); err != nil {
+			out.fail(err)
+		}
+
+		clientMap = out.recordActions(clientMap, removeMemberFlags.DryRun)
+
+		if err := common.RemoveMemberCluster(cmd.Context(), removeMemberFlags, clientMap, cluster, removeMemberForce); err != nil {
+			out.fail(err)
+		}
+
+		if removeMemberFlags.DryRun {
+			fmt.Fprintf(out.progress, "\n==== Dry run, no changes were made ====\n\n")
+			out.plan.Print(out.progress)
+			out.done()
+			return
+		}
+		common.Logger().Info("Removed member cluster", "cluster", cluster)
+		out.done()
+	},
+}
+
+var (
+	removeMemberFlags      = common.Flags{}
+	removeMemberConfigFile string
+	removeMemberForce      bool
+)
+
+// selectRemovedMemberNamespaces selects the namespaces matching --member-namespace-selector. The removed member
+// cluster may be unreachable, so failing to list its namespaces only prints a warning, like failing to clean it up.
+func selectRemovedMemberNamespaces(ctx context.Context, clientMap map[string]common.KubeClient, cluster string) error {
+	err := common.SelectMemberNamespaces(ctx, clientMap, &removeMemberFlags)
+	if err == nil || clientMap[cluster] == nil {
+		return err
+	}
+	common.Warnf("the namespaces of cluster %s matching %s won't be cleaned up: %s", cluster, removeMemberFlags.MemberNamespaceSelector, err)
+
+	reachable := map[string]common.KubeClient{}
+	for name, c := range clientMap {
+		if name != cluster {
+			reachable[name] = c
+		}
+	}
+	return common.SelectMemberNamespaces(ctx, reachable, &removeMemberFlags)
+}
+
+func parseRemoveMemberFlags(cmd *cobra.Command) error {
+	if removeMemberConfigFile != "" {
+		return applyTopologyConfig(cmd, removeMemberConfigFile, &removeMemberFlags)
+	}
+
+	if common.AnyAreEmpty(removeMemberFlags.CentralCluster, removeMemberFlags.MemberClusterNamespace, removeMemberFlags.CentralClusterNamespace) {
+		return xerrors.Errorf("non empty values are required for [central-cluster, member-cluster-namespace, central-cluster-namespace]")
+	}
+	return nil
+}
@@ -8,6 +8,8 @@ import (
 	"runtime/debug"
 	"syscall"
 
+	"github.com/10gen/ops-manager-kubernetes/multi/pkg/common"
+
 	"github.com/spf13/cobra"
 )
 
@@ -18,6 +20,29 @@ var rootCmd = &cobra.Command{
 	Long: `This application is a tool to simplify maintenance tasks
 of MongoDB resources in your kubernetes cluster.
 	`,
+	PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
+		if err := common.ConfigureLogging(cmd.OutOrStdout(), cmd.ErrOrStderr(), logOptions); err != nil {
+			return err
+		}
+		return common.ConfigureClients(clientOptions)
+	},
+}
+
+var (
+	logOptions    = common.LogOptions{}
+	clientOptions = common.ClientOptions{}
+)
+
+func init() {
+	rootCmd.PersistentFlags().CountVarP(&logOptions.Verbosity, "verbose", "v", "Log debug messages, repeat (-vv) to also log the requests sent to the api servers and their responses, with the contents of secrets, tokens and certificates redacted. [optional]")
+	rootCmd.PersistentFlags().BoolVar(&logOptions.Quiet, "quiet", false, "Only log warnings and errors. [optional default: false]")
+	rootCmd.PersistentFlags().StringVar((*string)(&logOptions.Format), "log-format", string(common.LogFormatText), "Format of the log messages: text or json. Colors are only used in text messages written to a terminal. [optional default: text]")
+	rootCmd.PersistentFlags().DurationVar(&common.PollingTimeout, "operation-timeout", common.PollingTimeout, "How long to wait for operations the clusters complete asynchronously, such as populating ServiceAccount token secrets. [optional default: 1m]")
+	rootCmd.PersistentFlags().DurationVar(&clientOptions.RequestTimeout, "request-timeout", 0, "How long to wait for the response to a single request to an api server, 0 waits forever. [optional]")
+	rootCmd.PersistentFlags().IntVar(&clientOptions.Retries, "retries", common.DefaultRetries, "How many times requests failing because of server errors, throttling or connection resets are retried, and how many times updates failing because of conflicts are recomputed. JSON patches are never retried. [optional default: 5]")
+	rootCmd.PersistentFlags().DurationVar(&clientOptions.RetryBackoff, "retry-backoff", common.DefaultRetryBackoff, "Delay before the first retry of a request, doubled for every following retry. [optional default: 500ms]")
+	rootCmd.PersistentFlags().Float32Var(&clientOptions.QPS, "qps", common.DefaultQPS, "Maximum number of requests per second sent to each api server. [optional default: 50]")
+	rootCmd.PersistentFlags().IntVar(&clientOptions.Burst, "burst", common.DefaultBurst, "Maximum burst of requests sent to each api server above the qps. [optional default: 100]")
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
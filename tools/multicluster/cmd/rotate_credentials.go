@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/10gen/ops-manager-kubernetes/multi/pkg/common"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+)
+
+func init() {
+	multiclusterCmd.AddCommand(rotateCredentialsCmd)
+
+	rotateCredentialsCmd.Flags().StringVar(&common.MemberClusters, "member-clusters", "", "Comma separated list of member clusters. [required]")
+	rotateCredentialsCmd.Flags().StringVar(&rotateCredentialsFlags.ServiceAccount, "service-account", "mongodb-enterprise-operator-multi-cluster", "Name of the service account which should be used for the Operator to communicate with the member clusters. [optional, default: mongodb-enterprise-operator-multi-cluster]")
+	rotateCredentialsCmd.Flags().StringVar(&rotateCredentialsFlags.CentralCluster, "central-cluster", "", "The central cluster the operator is deployed in. [required]")
+	rotateCredentialsCmd.Flags().StringVar(&rotateCredentialsFlags.MemberClusterNamespace, "member-cluster-namespace", "", "The namespace the member cluster resources are deployed to. [required]")
+	rotateCredentialsCmd.Flags().StringSliceVar(&rotateCredentialsFlags.MemberClusterNamespaces, "member-cluster-namespaces", nil, "Comma separated list of additional namespaces watched by the operator in every member cluster. The contexts of the kubeconfig have no default namespace when the operator watches more than one. [optional]")
+	rotateCredentialsCmd.Flags().StringVar(&rotateCredentialsFlags.MemberNamespaceSelector, "member-namespace-selector", "", "Label selector of additional namespaces watched by the operator, matched in every cluster. [optional]")
+	rotateCredentialsCmd.Flags().StringVar(&rotateCredentialsFlags.CentralClusterNamespace, "central-cluster-namespace", "", "The namespace the Operator is deployed to. [required]")
+	rotateCredentialsCmd.Flags().BoolVar(&rotateCredentialsFlags.ClusterScoped, "cluster-scoped", false, "The Operator watches all namespaces of the member clusters. [optional default: false]")
+	rotateCredentialsCmd.Flags().StringVar(&common.MemberClustersApiServers, "member-clusters-api-servers", "", "Comma separated list of api servers addresses. [optional, default will keep the addresses in the KubeConfig secret]")
+	rotateCredentialsCmd.Flags().StringVar(&rotateCredentialsFlags.OperatorName, "operator-name", common.DefaultOperatorName, "Name used to identify the deployment of the operator. [optional, default: mongodb-enterprise-operator]")
+	rotateCredentialsCmd.Flags().StringVar(&rotateCredentialsFlags.InstallationID, "installation-id", "", "Identifies the installation in the labels and in the names of the cluster scoped objects created for it. Pass the same value to every command managing the installation. [optional, default: derived from the UID of the kube-system namespace of the central cluster, the central namespace and the operator name]")
+	rotateCredentialsCmd.Flags().StringVar(&rotateCredentialsConfigFile, "config", "", "Path to a topology file describing the central and member clusters, used instead of the individual topology flags. [optional]")
+	rotateCredentialsCmd.Flags().DurationVar(&rotateCredentialsFlags.TokenExpiry, "token-expiry", 24*time.Hour, "Expiry of the minted ServiceAccount tokens. The API server may shorten it. [optional default: 24h]")
+	rotateCredentialsCmd.Flags().BoolVar(&rotateCredentialsFlags.CheckKubeConfig, "check-kubeconfig", true, "Connect to every member cluster with the new kubeconfig before writing it. [optional default: true]")
+	rotateCredentialsCmd.Flags().IntVar(&rotateCredentialsFlags.Parallelism, "parallelism", common.DefaultParallelism, "Number of clusters to configure concurrently. [optional default: 5]")
+}
+
+// rotateCredentialsCmd represents the rotate-credentials command
+var rotateCredentialsCmd = &cobra.Command{
+	Use:   "rotate-credentials",
+	Short: "Mint new ServiceAccount tokens for the operator in all member clusters",
+	Long: `'rotate-credentials' mints new short-lived tokens for the operator's ServiceAccount in every member cluster
+using the TokenRequest API, and replaces the KubeConfig secret in the central cluster with a single update.
+The secret is not changed if a token can't be minted in any of the member clusters. The api servers, CAs and
+connection settings of the member clusters are kept from the secret unless they are set with flags.
+Installations authenticating with --client-certificate-auth can't be rotated, run recover instead.
+
+Example:
+
+kubectl-mongodb multicluster rotate-credentials --central-cluster="operator-cluster" --member-clusters="cluster-1,cluster-2,cluster-3" --member-cluster-namespace=mongodb --central-cluster-namespace=mongodb --token-expiry=12h
+kubectl-mongodb multicluster rotate-credentials --central-cluster="operator-cluster" --member-clusters="cluster-1,cluster-2" --member-cluster-namespace=mongodb --member-cluster-namespaces=team-a,team-b --central-cluster-namespace=mongodb
+
+`,
+	Run: func(cmd *cobra.Command, _ []string) {
+		out := newCommandOutput(cmd, "rotate-credentials", "")
+		if err := parseRotateCredentialsFlags(cmd); err != nil {
+			out.fail(xerrors.Errorf("error parsing flags: %w", err))
+		}
+
+		clientMap, err := common.CreateClientMap(rotateCredentialsFlags.MemberClusters, rotateCredentialsFlags.CentralCluster, common.LoadKubeConfigFilePath(), rotateCredentialsFlags.ClientGetter(common.GetKubernetesClient))
+		if err != nil {
+			out.fail(xerrors.Errorf("failed to create clientset map: %w", err))
+		}
+
+		if err := common.SelectMemberNamespaces(cmd.Context(), clientMap, &rotateCredentialsFlags); err != nil {
+			out.fail(err)
+		}
+		if err := common.ResolveInstallationID(cmd.Context(), clientMap[rotateCredentialsFlags.CentralCluster], &rotateCredentialsFlags); err != nil {
+			out.fail(err)
+		}
+
+		expiries, err := common.RotateCredentials(cmd.Context(), rotateCredentialsFlags, clientMap)
+		if err != nil {
+			out.fail(err)
+		}
+
+		fmt.Fprintf(out.progress, "Rotated credentials in KubeConfig secret %s/%s:\n", rotateCredentialsFlags.CentralClusterNamespace, common.KubeConfigSecretName)
+		expiries.Print(out.progress)
+		out.done()
+	},
+}
+
+var (
+	rotateCredentialsFlags      = common.Flags{}
+	rotateCredentialsConfigFile string
+)
+
+func parseRotateCredentialsFlags(cmd *cobra.Command) error {
+	if rotateCredentialsFlags.TokenExpiry < common.MinTokenExpiry {
+		return xerrors.Errorf("token-expiry must be at least %s", common.MinTokenExpiry)
+	}
+
+	if rotateCredentialsConfigFile != "" {
+		// the api servers the topology doesn't set are kept from the KubeConfig secret
+		return loadTopologyConfig(cmd, rotateCredentialsConfigFile, &rotateCredentialsFlags)
+	}
+
+	if common.AnyAreEmpty(common.MemberClusters, rotateCredentialsFlags.ServiceAccount, rotateCredentialsFlags.CentralCluster, rotateCredentialsFlags.MemberClusterNamespace, rotateCredentialsFlags.CentralClusterNamespace) {
+		return xerrors.Errorf("non empty values are required for [service-account, member-clusters, central-cluster, member-cluster-namespace, central-cluster-namespace]")
+	}
+
+	rotateCredentialsFlags.MemberClusters = strings.Split(common.MemberClusters, ",")
+
+	if strings.TrimSpace(common.MemberClustersApiServers) != "" {
+		rotateCredentialsFlags.MemberClusterApiServerUrls = strings.Split(common.MemberClustersApiServers, ",")
+		if len(rotateCredentialsFlags.MemberClusterApiServerUrls) != len(rotateCredentialsFlags.MemberClusters) {
+			return xerrors.Errorf("expected %d addresses in member-clusters-api-servers parameter but got %d", len(rotateCredentialsFlags.MemberClusters), len(rotateCredentialsFlags.MemberClusterApiServerUrls))
+		}
+	}
+	return nil
+}
@@ -1,10 +1,11 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
-	"os"
 	"runtime/debug"
 	"strings"
+	"time"
 
 	"github.com/10gen/ops-manager-kubernetes/multi/pkg/common"
 
@@ -20,14 +21,47 @@ func init() {
 	setupCmd.Flags().StringVar(&setupFlags.ServiceAccount, "service-account", "mongodb-enterprise-operator-multi-cluster", "Name of the service account which should be used for the Operator to communicate with the member clusters. [optional, default: mongodb-enterprise-operator-multi-cluster]")
 	setupCmd.Flags().StringVar(&setupFlags.CentralCluster, "central-cluster", "", "The central cluster the operator will be deployed in. [required]")
 	setupCmd.Flags().StringVar(&setupFlags.MemberClusterNamespace, "member-cluster-namespace", "", "The namespace the member cluster resources will be deployed to. [required]")
+	setupCmd.Flags().StringSliceVar(&setupFlags.MemberClusterNamespaces, "member-cluster-namespaces", nil, "Comma separated list of additional namespaces watched by the operator in every member cluster. The operator's Roles will be created in each of them. [optional]")
+	setupCmd.Flags().StringVar(&setupFlags.MemberNamespaceSelector, "member-namespace-selector", "", "Label selector of additional namespaces watched by the operator, matched in every cluster. [optional]")
 	setupCmd.Flags().StringVar(&setupFlags.CentralClusterNamespace, "central-cluster-namespace", "", "The namespace the Operator will be deployed to. [required]")
-	setupCmd.Flags().BoolVar(&setupFlags.Cleanup, "cleanup", false, "Delete all previously created resources except for namespaces. [optional default: false]")
+	setupCmd.Flags().BoolVar(&setupFlags.Cleanup, "cleanup", false, "Delete all previously created resources of this installation except for namespaces. [optional default: false]")
+	setupCmd.Flags().BoolVar(&setupFlags.AdoptLegacyObjects, "adopt-legacy-objects", false, "Label the objects created by older versions of this tool, which only carry the multi-cluster=true label, as part of this installation, so that they are managed and cleaned up with it. Their ClusterRoles and ClusterRoleBindings are deleted once the installation's own ones exist. [optional default: false]")
+	setupCmd.Flags().StringVar(&setupFlags.OperatorName, "operator-name", common.DefaultOperatorName, "Name used to identify the deployment of the operator. [optional, default: mongodb-enterprise-operator]")
+	setupCmd.Flags().StringVar(&setupFlags.InstallationID, "installation-id", "", "Identifies the installation in the labels and in the names of the cluster scoped objects created for it. Pass the same value to every command managing the installation. [optional, default: derived from the UID of the kube-system namespace of the central cluster, the central namespace and the operator name]")
 	setupCmd.Flags().BoolVar(&setupFlags.ClusterScoped, "cluster-scoped", false, "Create ClusterRole and ClusterRoleBindings for member clusters. [optional default: false]")
 	setupCmd.Flags().BoolVar(&setupFlags.CreateTelemetryClusterRoles, "create-telemetry-roles", true, "Create ClusterRole and ClusterRoleBindings for member clusters for telemetry. [optional default: true]")
 	setupCmd.Flags().BoolVar(&setupFlags.InstallDatabaseRoles, "install-database-roles", false, "Install the ServiceAccounts and Roles required for running database workloads in the member clusters. [optional default: false]")
 	setupCmd.Flags().BoolVar(&setupFlags.CreateServiceAccountSecrets, "create-service-account-secrets", true, "Create service account token secrets. [optional default: true]")
-	setupCmd.Flags().StringVar(&setupFlags.ImagePullSecrets, "image-pull-secrets", "", "Name of the secret for imagePullSecrets to set in created service accounts")
+	setupCmd.Flags().StringVar(&setupFlags.ImagePullSecrets, "image-pull-secrets", "", "Name of the secret for imagePullSecrets to set in created service accounts and the api server probe pods. It is created from --image-pull-secret-docker-config or the registry credentials if given, otherwise it must already exist. [optional]")
+	setupCmd.Flags().StringVar(&setupDockerConfig, "image-pull-secret-docker-config", "", "Path to a docker config file, like the ~/.docker/config.json written by docker login, the image pull secret is created with in every namespace holding the created service accounts. [optional]")
+	setupCmd.Flags().StringVar(&setupRegistry.Server, "registry-server", "", "Registry the image pull secret is created for. [optional]")
+	setupCmd.Flags().StringVar(&setupRegistry.Username, "registry-username", "", "Username of the registry the image pull secret is created for. [optional]")
+	setupCmd.Flags().StringVar(&setupRegistryPasswordFile, "registry-password-file", "", "Path to a file holding the password of the registry the image pull secret is created for. Prefer --image-pull-secret-docker-config. [optional, default: the MDB_REGISTRY_PASSWORD environment variable]")
+	setupCmd.Flags().StringVar(&setupFlags.ProxyURL, "proxy-url", "", "Proxy the operator connects to the api servers of the member clusters through, unless set per cluster in the topology file. [optional]")
+	setupCmd.Flags().BoolVar(&setupFlags.DisableCompression, "disable-compression", false, "Disable the compression of the responses of the api servers of the member clusters. [optional default: false]")
+	setupCmd.Flags().BoolVar(&setupFlags.CheckKubeConfig, "check-kubeconfig", true, "Connect to every member cluster with the generated kubeconfig before writing it. Api servers found by --api-server-discovery were already probed from the central cluster and are skipped. [optional default: true]")
+	setupCmd.Flags().StringSliceVar(&setupFlags.ApiServerDiscovery, "api-server-discovery", nil, "Comma separated list of strategies tried in order to find api servers of the member clusters reachable from the central cluster: mapping, cluster-info, endpoints, kind, kubeconfig. Each address is probed from a pod in the central cluster. Api servers set explicitly are kept. [optional, default: the api servers of the local kubeconfig]")
+	setupCmd.Flags().StringToStringVar(&setupFlags.ApiServerMapping, "api-server-mapping", nil, "Comma separated list of cluster=address pairs tried by the mapping discovery strategy. [optional]")
+	setupCmd.Flags().StringVar(&setupFlags.ApiServerProbeImage, "api-server-probe-image", common.DefaultApiServerProbeImage, "Image of the pods probing the discovered api servers, it must provide curl. [optional default: curlimages/curl:8.10.1]")
+	setupCmd.Flags().StringVar(&setupFlags.ApiServerProbeNamespace, "api-server-probe-namespace", common.DefaultApiServerProbeNamespace, "Namespace of the central cluster the probe pods are run in. They pull their image with the --image-pull-secrets secret, if it exists in it. [optional default: default]")
 	setupCmd.Flags().StringVar(&common.MemberClustersApiServers, "member-clusters-api-servers", "", "Comma separated list of api servers addresses. [optional, default will take addresses from KUBECONFIG env var]")
+	setupCmd.Flags().StringVar(&setupHelmValues, "emit-helm-values", "", "Path the Helm values installing the operator are written to once setup is done, see the helm-values command. [optional]")
+	setupCmd.Flags().StringVar(&setupOperatorManifest, "operator-manifest", "", "Path to the operator manifest, e.g. mongodb-enterprise-multi-cluster.yaml, checked against the Helm values written with --emit-helm-values. [optional]")
+	setupCmd.Flags().StringVar(&setupConfigFile, "config", "", "Path to a topology file describing the central and member clusters, used instead of the individual topology flags. [optional]")
+	setupCmd.Flags().StringVar(&setupRBACProfile, "rbac-profile", "", "Path to a file customizing the rules of the operator's Roles and ClusterRoles, see the RBACProfile documentation. [optional]")
+	setupCmd.Flags().StringSliceVar(&setupFlags.ManagedKinds, "managed-kinds", nil, "Comma separated list of the custom resource kinds the operator manages (MongoDB, MongoDBMultiCluster, MongoDBUser, MongoDBOpsManager). The operator is only granted the minimal rules for these kinds, without wildcard verbs. [optional, default: all kinds with all verbs]")
+	setupCmd.Flags().StringVar(&setupRenderDir, "render", "", "Write the manifests of all objects that would be created to one YAML file per cluster in the given directory, instead of applying them. The KubeConfig secret only contains placeholders for the service account tokens. Requires --installation-id. [optional]")
+	setupCmd.Flags().DurationVar(&setupFlags.TokenExpiry, "token-expiry", 0, "Mint ServiceAccount tokens with the given expiry through the TokenRequest API instead of using non-expiring token secrets. Rotate them with rotate-credentials before they expire. [optional]")
+	setupCmd.Flags().BoolVar(&setupFlags.ClientCertificateAuth, "client-certificate-auth", false, "Authenticate the operator to the member clusters with client certificates issued through the CertificateSigningRequest API instead of ServiceAccount tokens. [optional default: false]")
+	setupCmd.Flags().StringVar(&setupFlags.ClientCertificateUser, "client-certificate-user", "", "User the client certificates are issued for. [optional, default: the name of the service account]")
+	setupCmd.Flags().StringVar(&setupFlags.ClientCertificateGroup, "client-certificate-group", "", "Group the client certificates are issued for. When set, the operator's roles in the member clusters are bound to the group instead of the user. [optional]")
+	setupCmd.Flags().DurationVar(&setupFlags.ClientCertificateExpiry, "client-certificate-expiry", common.DefaultClientCertificateExpiry, "Lifetime requested for the client certificates. The signers of the clusters may shorten it. [optional default: 8760h]")
+	setupCmd.Flags().BoolVar(&setupFlags.ApproveCSR, "approve-csr", false, "Approve the CertificateSigningRequests with the current credentials instead of waiting for an administrator to approve them. [optional default: false]")
+	setupCmd.Flags().DurationVar(&setupFlags.CSRApprovalTimeout, "csr-approval-timeout", 10*time.Minute, "How long to wait for each CertificateSigningRequest to be approved and signed. [optional default: 10m]")
+	setupCmd.Flags().IntVar(&setupFlags.Parallelism, "parallelism", common.DefaultParallelism, "Number of clusters to configure concurrently. [optional default: 5]")
+	setupCmd.Flags().BoolVar(&setupVerify, "verify", true, "Verify that the operator's credentials work in all clusters once setup is done. [optional default: true]")
+	setupCmd.Flags().BoolVar(&setupFlags.DryRun, "dry-run", false, "Print the changes that would be made to every cluster, without making them. [optional default: false]")
+	setupCmd.Flags().StringVar(&setupOutput, "output", "", "Write a report of the actions performed in every cluster, the warnings, the errors and the generated artifacts to stdout once setup is done, in json or yaml. The progress is printed to stderr instead. [optional]")
 }
 
 // setupCmd represents the setup command
@@ -36,43 +70,184 @@ var setupCmd = &cobra.Command{
 	Short: "Setup the multicluster environment for MongoDB resources",
 	Long: `'setup' configures the central and member clusters in preparation for a MongoDBMultiCluster deployment.
 
+With --client-certificate-auth, a CertificateSigningRequest is submitted in every member cluster and the command
+waits for an administrator to approve it, printing the command to run, e.g.:
+
+kubectl --context cluster-1 certificate approve kubectl-mongodb-abcd1234
+
+Pass --approve-csr to approve them with the current credentials instead.
+
 Example:
 
 kubectl-mongodb multicluster setup --central-cluster="operator-cluster" --member-clusters="cluster-1,cluster-2,cluster-3" --member-cluster-namespace=mongodb --central-cluster-namespace=mongodb --create-service-account-secrets --install-database-roles
+kubectl-mongodb multicluster setup --central-cluster="operator-cluster" --member-clusters="cluster-1,cluster-2,cluster-3" --member-cluster-namespace=mongodb --central-cluster-namespace=mongodb --installation-id=mongodb-prod --render=./manifests
+kubectl-mongodb multicluster setup --config=topology.yaml
+kubectl-mongodb multicluster setup --config=topology.yaml --token-expiry=24h
+kubectl-mongodb multicluster setup --config=topology.yaml --proxy-url=http://proxy.example.com:3128
+kubectl-mongodb multicluster setup --config=topology.yaml --api-server-discovery=cluster-info,endpoints,kind
+kubectl-mongodb multicluster setup --config=topology.yaml --emit-helm-values=values.yaml --operator-manifest=mongodb-enterprise-multi-cluster.yaml
+kubectl-mongodb multicluster setup --config=topology.yaml --image-pull-secrets=registry-credentials --image-pull-secret-docker-config=$HOME/.docker/config.json
+kubectl-mongodb multicluster setup --config=topology.yaml --client-certificate-auth --client-certificate-group=mongodb-operators
+kubectl-mongodb multicluster setup --config=topology.yaml --cleanup --adopt-legacy-objects
+kubectl-mongodb multicluster setup --config=topology.yaml --rbac-profile=rbac-profile.yaml --dry-run
+kubectl-mongodb multicluster setup --config=topology.yaml --output=json > setup-report.json
+kubectl-mongodb multicluster setup --config=topology.yaml --managed-kinds=MongoDBMultiCluster,MongoDBUser
+kubectl-mongodb multicluster setup --central-cluster="operator-cluster" --member-clusters="cluster-1,cluster-2" --member-cluster-namespace=mongodb --member-cluster-namespaces=team-a,team-b --central-cluster-namespace=mongodb-operator
 
 `,
 	Run: func(cmd *cobra.Command, _ []string) {
-		if err := parseSetupFlags(); err != nil {
-			fmt.Printf("error parsing flags: %s\n", err)
-			os.Exit(1)
+		out := newCommandOutput(cmd, "setup", setupOutput)
+		if err := parseSetupFlags(cmd); err != nil {
+			out.fail(xerrors.Errorf("error parsing flags: %w", err))
 		}
+		out.report.SetClusters(setupFlags)
 
 		buildInfo, ok := debug.ReadBuildInfo()
 		if ok {
-			fmt.Println(getBuildInfoString(buildInfo))
+			fmt.Fprintln(out.progress, getBuildInfoString(buildInfo))
 		}
 
-		clientMap, err := common.CreateClientMap(setupFlags.MemberClusters, setupFlags.CentralCluster, common.LoadKubeConfigFilePath(), common.GetKubernetesClient)
+		if setupRenderDir != "" {
+			if err := renderSetupManifests(cmd.Context(), out); err != nil {
+				out.fail(err)
+			}
+			out.done()
+			return
+		}
+
+		clientMap, err := common.CreateClientMap(setupFlags.MemberClusters, setupFlags.CentralCluster, common.LoadKubeConfigFilePath(), setupFlags.ClientGetter(common.GetKubernetesClient))
 		if err != nil {
-			fmt.Printf("failed to create clientset map: %s", err)
-			os.Exit(1)
+			out.fail(xerrors.Errorf("failed to create clientset map: %w", err))
+		}
+		if err := common.SelectMemberNamespaces(cmd.Context(), clientMap, &setupFlags); err != nil {
+			out.fail(err)
 		}
+		if err := common.ResolveInstallationID(cmd.Context(), clientMap[setupFlags.CentralCluster], &setupFlags); err != nil {
+			out.fail(err)
+		}
+		if err := discoverApiServers(cmd.Context(), &setupFlags, clientMap); err != nil {
+			out.fail(err)
+		}
+
+		clientMap = out.recordActions(clientMap, setupFlags.DryRun)
 
 		if err := common.EnsureMultiClusterResources(cmd.Context(), setupFlags, clientMap); err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+			out.fail(err)
 		}
 
 		if err := common.ReplaceClusterMembersConfigMap(cmd.Context(), clientMap[setupFlags.CentralCluster], setupFlags); err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+			out.fail(err)
+		}
+		if !setupFlags.DryRun {
+			out.report.AddArtifact(common.Artifact{Type: common.ArtifactKubeConfigSecret, Cluster: setupFlags.CentralCluster, Namespace: setupFlags.CentralClusterNamespace, Name: common.KubeConfigSecretName})
+		}
+
+		if setupHelmValues != "" {
+			if err := writeHelmValues(out.progress, setupHelmValues, setupOperatorManifest, setupFlags); err != nil {
+				out.fail(err)
+			}
+			out.report.AddArtifact(common.Artifact{Type: common.ArtifactHelmValues, Path: setupHelmValues})
 		}
+
+		if setupFlags.DryRun {
+			fmt.Fprintf(out.progress, "\n==== Dry run, no changes were made ====\n\n")
+			out.plan.Print(out.progress)
+			out.done()
+			return
+		}
+
+		if setupVerify {
+			fmt.Fprintf(out.progress, "\nVerifying the operator's credentials\n")
+			if err := verifyOperatorCredentials(cmd.Context(), out.progress, setupFlags, clientMap); err != nil {
+				out.fail(err)
+			}
+		}
+		out.done()
 	},
 }
 
-var setupFlags = common.Flags{}
+var (
+	setupFlags                = common.Flags{}
+	setupConfigFile           string
+	setupRBACProfile          string
+	setupDockerConfig         string
+	setupRegistry             common.RegistryCredentials
+	setupRegistryPasswordFile string
+	setupRenderDir            string
+	setupVerify               bool
+	setupOutput               string
+
+	setupHelmValues       string
+	setupOperatorManifest string
+)
+
+// renderSetupManifests writes all the objects setup would create to disk without connecting to any cluster.
+func renderSetupManifests(ctx context.Context, out *commandOutput) error {
+	if setupFlags.MemberNamespaceSelector != "" {
+		return xerrors.Errorf("member-namespace-selector is matched against the clusters and cannot be used together with render, list the namespaces with member-cluster-namespaces instead")
+	}
+	if setupFlags.InstallationID == "" {
+		return xerrors.Errorf("installation-id is read from the central cluster by default and must be given together with render")
+	}
+	flags := setupFlags
+	flags.DryRun = true
+
+	plan := common.NewPlan()
+	clientMap := common.NewRenderClientMap(append([]string{flags.CentralCluster}, flags.MemberClusters...), plan)
+	if err := common.ResolveInstallationID(ctx, clientMap[flags.CentralCluster], &flags); err != nil {
+		return err
+	}
+	if err := common.EnsureMultiClusterResources(ctx, flags, clientMap); err != nil {
+		return err
+	}
+	if err := common.ReplaceClusterMembersConfigMap(ctx, clientMap[flags.CentralCluster], flags); err != nil {
+		return err
+	}
+
+	files, err := common.WriteRenderedManifests(setupRenderDir, plan)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		fmt.Fprintf(out.progress, "Wrote %s\n", f)
+		out.report.AddArtifact(common.Artifact{Type: common.ArtifactManifest, Path: f})
+	}
+	if setupHelmValues != "" {
+		if err := writeHelmValues(out.progress, setupHelmValues, setupOperatorManifest, flags); err != nil {
+			return err
+		}
+		out.report.AddArtifact(common.Artifact{Type: common.ArtifactHelmValues, Path: setupHelmValues})
+	}
+	return nil
+}
+
+func parseSetupFlags(cmd *cobra.Command) error {
+	if err := loadRBACProfile(setupRBACProfile, &setupFlags); err != nil {
+		return err
+	}
+	if err := loadImagePullSecret(setupDockerConfig, setupRegistry, setupRegistryPasswordFile, &setupFlags); err != nil {
+		return err
+	}
+	if setupFlags.TokenExpiry != 0 && setupFlags.TokenExpiry < common.MinTokenExpiry {
+		return xerrors.Errorf("token-expiry must be at least %s", common.MinTokenExpiry)
+	}
+	if setupFlags.ClientCertificateAuth && setupFlags.TokenExpiry != 0 {
+		return xerrors.Errorf("token-expiry cannot be used together with client-certificate-auth")
+	}
+	if setupFlags.ClientCertificateAuth && setupFlags.ClientCertificateExpiry < common.MinClientCertificateExpiry {
+		return xerrors.Errorf("client-certificate-expiry must be at least %s", common.MinClientCertificateExpiry)
+	}
+	if err := common.ValidateApiServerDiscovery(setupFlags.ApiServerDiscovery); err != nil {
+		return err
+	}
+	if err := (common.ClusterConnection{ProxyURL: setupFlags.ProxyURL}).Validate(); err != nil {
+		return err
+	}
+
+	if setupConfigFile != "" {
+		return applyTopologyConfig(cmd, setupConfigFile, &setupFlags)
+	}
 
-func parseSetupFlags() error {
 	if common.AnyAreEmpty(common.MemberClusters, setupFlags.ServiceAccount, setupFlags.CentralCluster, setupFlags.MemberClusterNamespace, setupFlags.CentralClusterNamespace) {
 		return xerrors.Errorf("non empty values are required for [service-account, member-clusters, central-cluster, member-cluster-namespace, central-cluster-namespace]")
 	}
@@ -86,12 +261,12 @@ func parseSetupFlags() error {
 		}
 	}
 
-	configFilePath := common.LoadKubeConfigFilePath()
-	kubeconfig, err := clientcmd.LoadFromFile(configFilePath)
-	if err != nil {
-		return xerrors.Errorf("error loading kubeconfig file '%s': %w", configFilePath, err)
-	}
 	if len(setupFlags.MemberClusterApiServerUrls) == 0 {
+		configFilePath := common.LoadKubeConfigFilePath()
+		kubeconfig, err := clientcmd.LoadFromFile(configFilePath)
+		if err != nil {
+			return xerrors.Errorf("error loading kubeconfig file '%s': %w", configFilePath, err)
+		}
 		if setupFlags.MemberClusterApiServerUrls, err = common.GetMemberClusterApiServerUrls(kubeconfig, setupFlags.MemberClusters); err != nil {
 			return err
 		}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/10gen/ops-manager-kubernetes/multi/pkg/common"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+)
+
+func init() {
+	multiclusterCmd.AddCommand(teardownCmd)
+
+	teardownCmd.Flags().StringVar(&common.MemberClusters, "member-clusters", "", "Comma separated list of member clusters. [required]")
+	teardownCmd.Flags().StringVar(&teardownFlags.CentralCluster, "central-cluster", "", "The central cluster the operator is deployed in. [required]")
+	teardownCmd.Flags().StringVar(&teardownFlags.MemberClusterNamespace, "member-cluster-namespace", "", "The namespace the member cluster resources are deployed to. [required]")
+	teardownCmd.Flags().StringSliceVar(&teardownFlags.MemberClusterNamespaces, "member-cluster-namespaces", nil, "Comma separated list of additional namespaces watched by the operator in every member cluster. The operator's Roles are created in each of them. [optional]")
+	teardownCmd.Flags().StringVar(&teardownFlags.MemberNamespaceSelector, "member-namespace-selector", "", "Label selector of additional namespaces watched by the operator, matched in every cluster. [optional]")
+	teardownCmd.Flags().StringVar(&teardownFlags.CentralClusterNamespace, "central-cluster-namespace", "", "The namespace the Operator is deployed to. [required]")
+	teardownCmd.Flags().StringVar(&teardownFlags.OperatorName, "operator-name", common.DefaultOperatorName, "Name used to identify the deployment of the operator. [optional, default: mongodb-enterprise-operator]")
+	teardownCmd.Flags().StringVar(&teardownFlags.InstallationID, "installation-id", "", "Identifies the installation in the labels and in the names of the cluster scoped objects created for it. Pass the same value to every command managing the installation. [optional, default: derived from the UID of the kube-system namespace of the central cluster, the central namespace and the operator name]")
+	teardownCmd.Flags().StringVar(&teardownConfigFile, "config", "", "Path to a topology file describing the central and member clusters, used instead of the individual topology flags. [optional]")
+	teardownCmd.Flags().BoolVar(&teardownDeleteNamespaces, "delete-namespaces", false, "Also delete the namespaces created by setup for this installation. [optional default: false]")
+	teardownCmd.Flags().BoolVar(&teardownFlags.AdoptLegacyObjects, "adopt-legacy-objects", false, "Also delete the objects created by older versions of this tool, which only carry the multi-cluster=true label. [optional default: false]")
+	teardownCmd.Flags().IntVar(&teardownFlags.Parallelism, "parallelism", common.DefaultParallelism, "Number of clusters to tear down concurrently. [optional default: 5]")
+	teardownCmd.Flags().BoolVar(&teardownYes, "yes", false, "Do not ask for confirmation before deleting. [optional default: false]")
+	teardownCmd.Flags().BoolVar(&teardownFlags.DryRun, "dry-run", false, "Print the objects that would be deleted in every cluster, without deleting them. [optional default: false]")
+}
+
+// teardownCmd represents the teardown command
+var teardownCmd = &cobra.Command{
+	Use:   "teardown",
+	Short: "Remove everything setup created in the multicluster environment",
+	Long: `'teardown' deletes everything setup created in the central and member clusters: the operator's ServiceAccounts,
+Roles and ClusterRoles with their bindings, the database ServiceAccounts and Roles, the KubeConfig secret and the
+member list ConfigMap. With --delete-namespaces, the namespaces created by setup are deleted too.
+Only the objects of the installation identified by the central cluster, its namespace and the operator name are
+deleted. The command refuses to run while MongoDB, MongoDBMultiCluster or MongoDBOpsManager resources still exist
+in the installation's namespaces, and asks for confirmation after listing the objects it is going to delete.
+
+Example:
+
+kubectl-mongodb multicluster teardown --central-cluster="operator-cluster" --member-clusters="cluster-1,cluster-2,cluster-3" --member-cluster-namespace=mongodb --central-cluster-namespace=mongodb
+kubectl-mongodb multicluster teardown --config=topology.yaml --delete-namespaces --dry-run
+kubectl-mongodb multicluster teardown --config=topology.yaml --delete-namespaces --yes
+
+`,
+	Run: func(cmd *cobra.Command, _ []string) {
+		out := newCommandOutput(cmd, "teardown", "")
+		if err := parseTeardownFlags(cmd); err != nil {
+			out.fail(xerrors.Errorf("error parsing flags: %w", err))
+		}
+
+		clientMap, err := common.CreateClientMap(teardownFlags.MemberClusters, teardownFlags.CentralCluster, common.LoadKubeConfigFilePath(), teardownFlags.ClientGetter(common.GetKubernetesClient))
+		if err != nil {
+			out.fail(xerrors.Errorf("failed to create clientset map: %w", err))
+		}
+		if err := common.SelectMemberNamespaces(cmd.Context(), clientMap, &teardownFlags); err != nil {
+			out.fail(err)
+		}
+		if err := common.ResolveInstallationID(cmd.Context(), clientMap[teardownFlags.CentralCluster], &teardownFlags); err != nil {
+			out.fail(err)
+		}
+
+		// the deletions are always planned first, to be confirmed or printed for --dry-run
+		plan := common.NewPlan()
+		if err := common.TeardownMultiCluster(cmd.Context(), teardownFlags, common.NewDryRunClientMap(clientMap, plan), teardownDeleteNamespaces); err != nil {
+			out.fail(err)
+		}
+		if len(plan.Actions()) == 0 {
+			common.Logger().Info("Nothing to tear down")
+			out.done()
+			return
+		}
+
+		fmt.Fprintf(out.progress, "\n==== The following objects will be deleted ====\n\n")
+		plan.Print(out.progress)
+		if teardownFlags.DryRun {
+			fmt.Fprintf(out.progress, "==== Dry run, no changes were made ====\n")
+			out.done()
+			return
+		}
+		if !teardownYes && !confirm(cmd.InOrStdin(), out.progress, "Delete these objects?") {
+			common.Logger().Info("Teardown cancelled")
+			out.done()
+			return
+		}
+
+		if err := common.TeardownMultiCluster(cmd.Context(), teardownFlags, clientMap, teardownDeleteNamespaces); err != nil {
+			out.fail(err)
+		}
+		common.Logger().Info("Teardown complete")
+		out.done()
+	},
+}
+
+var (
+	teardownFlags            = common.Flags{}
+	teardownConfigFile       string
+	teardownDeleteNamespaces bool
+	teardownYes              bool
+)
+
+func parseTeardownFlags(cmd *cobra.Command) error {
+	if teardownConfigFile != "" {
+		return applyTopologyConfig(cmd, teardownConfigFile, &teardownFlags)
+	}
+
+	if common.AnyAreEmpty(common.MemberClusters, teardownFlags.CentralCluster, teardownFlags.MemberClusterNamespace, teardownFlags.CentralClusterNamespace) {
+		return xerrors.Errorf("non empty values are required for [member-clusters, central-cluster, member-cluster-namespace, central-cluster-namespace]")
+	}
+	teardownFlags.MemberClusters = strings.Split(common.MemberClusters, ",")
+	return nil
+}
+
+// confirm asks the question on w and returns true if the user answers yes.
+func confirm(in io.Reader, w io.Writer, question string) bool {
+	fmt.Fprintf(w, "%s Type 'yes' to continue: ", question)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	return strings.EqualFold(strings.TrimSpace(answer), "yes")
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/10gen/ops-manager-kubernetes/multi/pkg/common"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+)
+
+func init() {
+	multiclusterCmd.AddCommand(verifyCmd)
+
+	verifyCmd.Flags().StringVar(&common.MemberClusters, "member-clusters", "", "Comma separated list of member clusters. [required]")
+	verifyCmd.Flags().StringVar(&verifyFlags.ServiceAccount, "service-account", "mongodb-enterprise-operator-multi-cluster", "Name of the service account which should be used for the Operator to communicate with the member clusters. [optional, default: mongodb-enterprise-operator-multi-cluster]")
+	verifyCmd.Flags().StringVar(&verifyFlags.CentralCluster, "central-cluster", "", "The central cluster the operator is deployed in. [required]")
+	verifyCmd.Flags().StringVar(&verifyFlags.MemberClusterNamespace, "member-cluster-namespace", "", "The namespace the member cluster resources are deployed to. [required]")
+	verifyCmd.Flags().StringSliceVar(&verifyFlags.MemberClusterNamespaces, "member-cluster-namespaces", nil, "Comma separated list of additional namespaces watched by the operator in every member cluster. The operator's Roles are created in each of them. [optional]")
+	verifyCmd.Flags().StringVar(&verifyFlags.MemberNamespaceSelector, "member-namespace-selector", "", "Label selector of additional namespaces watched by the operator, matched in every cluster. [optional]")
+	verifyCmd.Flags().StringVar(&verifyFlags.CentralClusterNamespace, "central-cluster-namespace", "", "The namespace the Operator is deployed to. [required]")
+	verifyCmd.Flags().StringVar(&verifyConfigFile, "config", "", "Path to a topology file describing the central and member clusters, used instead of the individual topology flags. [optional]")
+	verifyCmd.Flags().StringVar(&verifyRBACProfile, "rbac-profile", "", "Path to the file customizing the rules of the operator's Roles and ClusterRoles passed to setup. [optional]")
+	verifyCmd.Flags().StringSliceVar(&verifyFlags.ManagedKinds, "managed-kinds", nil, "Comma separated list of the custom resource kinds the operator manages, passed to setup. [optional]")
+	verifyCmd.Flags().StringVar(&verifyFlags.ApiServerProbeImage, "api-server-probe-image", common.DefaultApiServerProbeImage, "Image of the pods probing the api servers of the member clusters from the central cluster, it must provide curl. [optional default: curlimages/curl:8.10.1]")
+	verifyCmd.Flags().StringVar(&verifyFlags.ApiServerProbeNamespace, "api-server-probe-namespace", common.DefaultApiServerProbeNamespace, "Namespace of the central cluster the probe pods are run in. They pull their image with the --image-pull-secrets secret, if it exists in it. [optional default: default]")
+	verifyCmd.Flags().StringVar(&verifyFlags.ImagePullSecrets, "image-pull-secrets", "", "Name of the image pull secret the probe pods pull their image with, passed to setup. [optional]")
+	verifyCmd.Flags().IntVar(&verifyFlags.Parallelism, "parallelism", common.DefaultParallelism, "Number of clusters to verify concurrently. [optional default: 5]")
+}
+
+// verifyCmd represents the verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify that the operator's credentials work in all clusters",
+	Long: `'verify' checks that the operator can reach and manage every cluster with the credentials created by setup.
+It connects to the member clusters with the kubeconfig stored in the central cluster, and to the central cluster by
+impersonating the operator's ServiceAccount. In every cluster, it checks that the operator has all the rules it
+needs in the right namespaces. The api servers of the member clusters are also probed from a pod in the central
+cluster, as the operator may not reach the addresses this machine can.
+
+The command exits with a non-zero code if any check fails. It also runs at the end of setup, unless --verify=false
+is passed.
+
+Example:
+
+kubectl-mongodb multicluster verify --central-cluster="operator-cluster" --member-clusters="cluster-1,cluster-2,cluster-3" --member-cluster-namespace=mongodb --central-cluster-namespace=mongodb
+kubectl-mongodb multicluster verify --config=topology.yaml
+
+`,
+	Run: func(cmd *cobra.Command, _ []string) {
+		if err := parseVerifyFlags(cmd); err != nil {
+			fmt.Printf("error parsing flags: %s\n", err)
+			os.Exit(1)
+		}
+
+		clientMap, err := common.CreateClientMap(verifyFlags.MemberClusters, verifyFlags.CentralCluster, common.LoadKubeConfigFilePath(), verifyFlags.ClientGetter(common.GetKubernetesClient))
+		if err != nil {
+			fmt.Printf("failed to create clientset map: %s", err)
+			os.Exit(1)
+		}
+		if err := common.SelectMemberNamespaces(cmd.Context(), clientMap, &verifyFlags); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		if err := verifyOperatorCredentials(cmd.Context(), cmd.OutOrStdout(), verifyFlags, clientMap); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+var (
+	verifyFlags       = common.Flags{}
+	verifyConfigFile  string
+	verifyRBACProfile string
+)
+
+// verifyOperatorCredentials prints the result of verifying the operator's credentials to w and returns an error if
+// any of the checks failed.
+func verifyOperatorCredentials(ctx context.Context, w io.Writer, flags common.Flags, clientMap map[string]common.KubeClient) error {
+	probe := common.NewPodApiServerProbe(clientMap[flags.CentralCluster], flags)
+	report, err := common.VerifyOperatorCredentials(ctx, flags, clientMap, common.NewKubeClientForConfig, probe)
+	if err != nil {
+		return xerrors.Errorf("failed verifying the operator's credentials: %w", err)
+	}
+	report.Print(w)
+	if report.Failed() {
+		return xerrors.Errorf("the operator's credentials don't work in all clusters")
+	}
+	return nil
+}
+
+func parseVerifyFlags(cmd *cobra.Command) error {
+	if err := loadRBACProfile(verifyRBACProfile, &verifyFlags); err != nil {
+		return err
+	}
+	if verifyConfigFile != "" {
+		return applyTopologyConfig(cmd, verifyConfigFile, &verifyFlags)
+	}
+
+	if common.AnyAreEmpty(common.MemberClusters, verifyFlags.ServiceAccount, verifyFlags.CentralCluster, verifyFlags.MemberClusterNamespace, verifyFlags.CentralClusterNamespace) {
+		return xerrors.Errorf("non empty values are required for [service-account, member-clusters, central-cluster, member-cluster-namespace, central-cluster-namespace]")
+	}
+
+	verifyFlags.MemberClusters = strings.Split(common.MemberClusters, ",")
+	return nil
+}
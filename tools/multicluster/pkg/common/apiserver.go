@@ -0,0 +1,329 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// ApiServerDiscoveryMapping takes the api server from the user supplied mapping of cluster names to addresses.
+	ApiServerDiscoveryMapping = "mapping"
+	// ApiServerDiscoveryClusterInfo takes the api server from the kubeconfig in the kube-public/cluster-info ConfigMap
+	// of the member cluster.
+	ApiServerDiscoveryClusterInfo = "cluster-info"
+	// ApiServerDiscoveryEndpoints takes the api servers from the endpoints of the default/kubernetes Service of the
+	// member cluster.
+	ApiServerDiscoveryEndpoints = "endpoints"
+	// ApiServerDiscoveryKind takes the address of the control plane container of a kind cluster on the kind docker
+	// network.
+	ApiServerDiscoveryKind = "kind"
+	// ApiServerDiscoveryKubeConfig takes the api server from the local kubeconfig.
+	ApiServerDiscoveryKubeConfig = "kubeconfig"
+
+	// DefaultApiServerProbeImage is the image of the pod probing the api servers from the central cluster.
+	DefaultApiServerProbeImage = "curlimages/curl:8.10.1"
+	// DefaultApiServerProbeNamespace is the namespace of the central cluster the probe pods are run in.
+	DefaultApiServerProbeNamespace = "default"
+
+	apiServerProbeTimeout = 2 * time.Minute
+	// apiServerProbeUser is the nobody user the probe pods run as.
+	apiServerProbeUser = 65534
+	kindContextPrefix  = "kind-"
+	kindApiServerPort  = 6443
+)
+
+// ApiServerDiscoveryStrategies are the supported strategies, in the order they are tried by default.
+var ApiServerDiscoveryStrategies = []string{ApiServerDiscoveryMapping, ApiServerDiscoveryClusterInfo, ApiServerDiscoveryEndpoints, ApiServerDiscoveryKind, ApiServerDiscoveryKubeConfig}
+
+// probePodWaitingFailures are the reasons of waiting containers that keep the probe pod from ever completing.
+var probePodWaitingFailures = []string{"ErrImagePull", "ImagePullBackOff", "InvalidImageName", "CreateContainerConfigError", "CreateContainerError"}
+
+// ApiServerProbe returns an error if the api server at the given url can't be reached from the central cluster.
+type ApiServerProbe func(ctx context.Context, url string) error
+
+// ValidateApiServerDiscovery returns an error if any of the strategies is unknown.
+func ValidateApiServerDiscovery(strategies []string) error {
+	for _, strategy := range strategies {
+		if !Contains(ApiServerDiscoveryStrategies, strategy) {
+			return xerrors.Errorf("unknown api server discovery strategy %q, expected one of %s", strategy, strings.Join(ApiServerDiscoveryStrategies, ", "))
+		}
+	}
+	return nil
+}
+
+// DiscoverApiServers replaces the api servers of the member clusters that were taken from the local kubeconfig with
+// the first address found by flags.ApiServerDiscovery that is reachable with probe. Api servers set explicitly with
+// --member-clusters-api-servers or in the topology file are kept, but a warning is printed when they are
+// unreachable. When no probe is given, as in dry runs, the first address found is used without checking it.
+func DiscoverApiServers(ctx context.Context, flags *Flags, clientMap map[string]KubeClient, kubeconfig *clientcmdapi.Config, probe ApiServerProbe) error {
+	if len(flags.ApiServerDiscovery) == 0 {
+		return nil
+	}
+
+	urls := map[string]string{}
+	probed := map[string]string{}
+	mu := sync.Mutex{}
+	err := forEachCluster(ctx, flags.MemberClusters, flags.Parallelism, func(ctx context.Context, cluster string) error {
+		url, reachable := discoverApiServer(ctx, *flags, clientMap[cluster], cluster, kubeconfig, probe)
+
+		mu.Lock()
+		defer mu.Unlock()
+		urls[cluster] = url
+		if reachable {
+			probed[cluster] = url
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, cluster := range flags.MemberClusters {
+		for len(flags.MemberClusterApiServerUrls) <= i {
+			flags.MemberClusterApiServerUrls = append(flags.MemberClusterApiServerUrls, "")
+		}
+		flags.MemberClusterApiServerUrls[i] = urls[cluster]
+	}
+	flags.ProbedApiServers = probed
+	return nil
+}
+
+// discoverApiServer returns the api server of the cluster, and whether the probe reached it from the central cluster.
+func discoverApiServer(ctx context.Context, flags Flags, c KubeClient, cluster string, kubeconfig *clientcmdapi.Config, probe ApiServerProbe) (string, bool) {
+	current := memberClusterApiServerUrl(flags, cluster)
+	if current != "" && current != kubeConfigApiServer(flags, cluster, kubeconfig) {
+		if probe == nil {
+			return current, false
+		}
+		if err := probe(ctx, current); err != nil {
+			Warnf("api server %s of cluster %s is not reachable from the central cluster: %s", current, cluster, err)
+			return current, false
+		}
+		return current, true
+	}
+
+	var tried []string
+	for _, candidate := range apiServerCandidates(ctx, flags, c, cluster, kubeconfig) {
+		if probe == nil {
+			logger.Info("Using discovered api server", "cluster", cluster, "url", candidate.url, "strategy", candidate.strategy)
+			return candidate.url, false
+		}
+		if err := probe(ctx, candidate.url); err != nil {
+			tried = append(tried, fmt.Sprintf("%s (%s): %s", candidate.url, candidate.strategy, err))
+			continue
+		}
+		logger.Info("Using discovered api server", "cluster", cluster, "url", candidate.url, "strategy", candidate.strategy)
+		return candidate.url, true
+	}
+
+	if len(tried) == 0 {
+		Warnf("no api server of cluster %s found with %s discovery", cluster, strings.Join(flags.ApiServerDiscovery, ", "))
+	} else {
+		Warnf("none of the api servers of cluster %s is reachable from the central cluster:\n  - %s", cluster, strings.Join(tried, "\n  - "))
+	}
+	return current, false
+}
+
+type apiServerCandidate struct {
+	url      string
+	strategy string
+}
+
+// apiServerCandidates returns the addresses of the api server of the cluster found by each of the strategies, in
+// order and without duplicates. Strategies that fail, e.g. because the ConfigMap doesn't exist, are skipped.
+func apiServerCandidates(ctx context.Context, flags Flags, c KubeClient, cluster string, kubeconfig *clientcmdapi.Config) []apiServerCandidate {
+	var candidates []apiServerCandidate
+	seen := map[string]bool{}
+	for _, strategy := range flags.ApiServerDiscovery {
+		var urls []string
+		switch strategy {
+		case ApiServerDiscoveryMapping:
+			if url, ok := flags.ApiServerMapping[cluster]; ok {
+				urls = []string{url}
+			}
+		case ApiServerDiscoveryClusterInfo:
+			urls = clusterInfoApiServers(ctx, c)
+		case ApiServerDiscoveryEndpoints:
+			urls = endpointsApiServers(ctx, c)
+		case ApiServerDiscoveryKind:
+			if name, ok := strings.CutPrefix(flags.ClusterContext(cluster), kindContextPrefix); ok {
+				urls = []string{fmt.Sprintf("https://%s-control-plane:%d", name, kindApiServerPort)}
+			}
+		case ApiServerDiscoveryKubeConfig:
+			if url := kubeConfigApiServer(flags, cluster, kubeconfig); url != "" {
+				urls = []string{url}
+			}
+		}
+
+		for _, url := range urls {
+			if !seen[url] {
+				seen[url] = true
+				candidates = append(candidates, apiServerCandidate{url: url, strategy: strategy})
+			}
+		}
+	}
+	return candidates
+}
+
+// clusterInfoApiServers returns the api servers of the kubeconfig published in the kube-public/cluster-info
+// ConfigMap by kubeadm based clusters.
+func clusterInfoApiServers(ctx context.Context, c KubeClient) []string {
+	cm, err := c.CoreV1().ConfigMaps("kube-public").Get(ctx, "cluster-info", metav1.GetOptions{})
+	if err != nil {
+		return nil
+	}
+	config, err := clientcmd.Load([]byte(cm.Data["kubeconfig"]))
+	if err != nil {
+		return nil
+	}
+	var urls []string
+	for _, cluster := range config.Clusters {
+		urls = append(urls, cluster.Server)
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+// endpointsApiServers returns the addresses the api servers advertise in the endpoints of the default/kubernetes
+// Service.
+func endpointsApiServers(ctx context.Context, c KubeClient) []string {
+	endpoints, err := c.CoreV1().Endpoints(metav1.NamespaceDefault).Get(ctx, "kubernetes", metav1.GetOptions{})
+	if err != nil {
+		return nil
+	}
+	var urls []string
+	for _, subset := range endpoints.Subsets {
+		for _, port := range subset.Ports {
+			if port.Name != "https" {
+				continue
+			}
+			for _, address := range subset.Addresses {
+				urls = append(urls, "https://"+net.JoinHostPort(address.IP, fmt.Sprint(port.Port)))
+			}
+		}
+	}
+	return urls
+}
+
+// kubeConfigApiServer returns the server of the cluster's context in the local kubeconfig, or an empty string if it
+// isn't known.
+func kubeConfigApiServer(flags Flags, cluster string, kubeconfig *clientcmdapi.Config) string {
+	if kubeconfig == nil {
+		return ""
+	}
+	kubeConfigClusterName := flags.ClusterContext(cluster)
+	if c := kubeconfig.Contexts[kubeConfigClusterName]; c != nil {
+		kubeConfigClusterName = c.Cluster
+	}
+	if c := kubeconfig.Clusters[kubeConfigClusterName]; c != nil {
+		return c.Server
+	}
+	return ""
+}
+
+// IsLoopbackApiServer returns true if the api server is on a loopback address, which the operator can't reach from
+// the central cluster.
+func IsLoopbackApiServer(apiServer string) bool {
+	u, err := url.Parse(apiServer)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// NewPodApiServerProbe returns an ApiServerProbe that runs a pod in the flags.ApiServerProbeNamespace of the central
+// cluster requesting the /version endpoint of the api server, which is readable without credentials. The api server
+// is reachable if it answers with any HTTP status. The pod complies with the restricted Pod Security Standard and
+// pulls flags.ApiServerProbeImage with the flags.ImagePullSecrets.
+func NewPodApiServerProbe(c KubeClient, flags Flags) ApiServerProbe {
+	namespace := flags.ApiServerProbeNamespace
+	return func(ctx context.Context, url string) error {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				GenerateName: "mongodb-api-server-probe-",
+				Namespace:    namespace,
+				Labels:       map[string]string{"app.kubernetes.io/name": "mongodb-api-server-probe"},
+			},
+			Spec: corev1.PodSpec{
+				RestartPolicy:                corev1.RestartPolicyNever,
+				AutomountServiceAccountToken: ptr.To(false),
+				ImagePullSecrets:             flags.imagePullSecretReferences(),
+				SecurityContext: &corev1.PodSecurityContext{
+					// the user of the curl image is named, the kubelet can only check numeric ones are not root
+					RunAsNonRoot:   ptr.To(true),
+					RunAsUser:      ptr.To(int64(apiServerProbeUser)),
+					SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+				},
+				Containers: []corev1.Container{{
+					Name:    "probe",
+					Image:   flags.ApiServerProbeImage,
+					Command: []string{"curl", "--insecure", "--silent", "--output", "/dev/null", "--max-time", "10", strings.TrimSuffix(url, "/") + "/version"},
+					SecurityContext: &corev1.SecurityContext{
+						AllowPrivilegeEscalation: ptr.To(false),
+						Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+					},
+				}},
+			},
+		}
+		pod, err := c.CoreV1().Pods(namespace).Create(ctx, pod, metav1.CreateOptions{})
+		if err != nil {
+			return xerrors.Errorf("failed creating probe pod in namespace %s of the central cluster: %w", namespace, err)
+		}
+		defer func() {
+			_ = c.CoreV1().Pods(namespace).Delete(context.Background(), pod.Name, metav1.DeleteOptions{})
+		}()
+
+		var phase corev1.PodPhase
+		err = wait.PollUntilContextTimeout(ctx, time.Second, apiServerProbeTimeout, true, func(ctx context.Context) (bool, error) {
+			current, err := c.CoreV1().Pods(namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			if err := probePodNotRunnable(current); err != nil {
+				return false, err
+			}
+			phase = current.Status.Phase
+			return phase == corev1.PodSucceeded || phase == corev1.PodFailed, nil
+		})
+		if err != nil {
+			return xerrors.Errorf("probe pod %s/%s did not complete: %w", namespace, pod.Name, err)
+		}
+		if phase == corev1.PodFailed {
+			return xerrors.Errorf("no response from %s", url)
+		}
+		return nil
+	}
+}
+
+// probePodNotRunnable returns an error if the probe pod will never complete on its own: its image can't be pulled,
+// its container can't be created, or the kubelet rejected it before running curl.
+func probePodNotRunnable(pod *corev1.Pod) error {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Waiting != nil && Contains(probePodWaitingFailures, status.State.Waiting.Reason) {
+			return xerrors.Errorf("container %s is waiting: %s %s", status.Name, status.State.Waiting.Reason, status.State.Waiting.Message)
+		}
+	}
+	if pod.Status.Phase == corev1.PodFailed && pod.Status.Reason != "" {
+		return xerrors.Errorf("rejected by the kubelet: %s %s", pod.Status.Reason, pod.Status.Message)
+	}
+	return nil
+}
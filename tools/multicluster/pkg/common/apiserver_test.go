@@ -0,0 +1,148 @@
+package common
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+func TestDiscoverApiServers(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	flags.ApiServerDiscovery = []string{ApiServerDiscoveryClusterInfo, ApiServerDiscoveryEndpoints, ApiServerDiscoveryKubeConfig}
+	flags.MemberClusterApiServerUrls[2] = "https://explicit.member-cluster-2"
+	kubeconfig, err := clientcmd.Load([]byte(testKubeconfig))
+	require.NoError(t, err)
+
+	clusterInfo := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster-info", Namespace: "kube-public"},
+		Data: map[string]string{"kubeconfig": `apiVersion: v1
+kind: Config
+clusters:
+- name: ""
+  cluster:
+    server: https://member-cluster-0.internal:6443
+`},
+	}
+	endpoints := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "kubernetes", Namespace: metav1.NamespaceDefault},
+		Subsets: []corev1.EndpointSubset{{
+			Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}},
+			Ports:     []corev1.EndpointPort{{Name: "https", Port: 6443}},
+		}},
+	}
+	clientMap := map[string]KubeClient{
+		"member-cluster-0": NewKubeClientContainer(nil, newFakeClientset(ctx, "member-cluster-0", []runtime.Object{clusterInfo}), nil),
+		"member-cluster-1": NewKubeClientContainer(nil, newFakeClientset(ctx, "member-cluster-1", []runtime.Object{endpoints}), nil),
+		"member-cluster-2": NewKubeClientContainer(nil, newFakeClientset(ctx, "member-cluster-2", nil), nil),
+	}
+
+	reachable := map[string]bool{
+		"https://member-cluster-0.internal:6443": true,
+		"https://api.member-cluster-1":           true,
+	}
+	var probed []string
+	probe := func(ctx context.Context, url string) error {
+		probed = append(probed, url)
+		if !reachable[url] {
+			return xerrors.Errorf("no response from %s", url)
+		}
+		return nil
+	}
+	flags.Parallelism = 1
+
+	require.NoError(t, DiscoverApiServers(ctx, &flags, clientMap, kubeconfig, probe))
+	assert.Equal(t, []string{"https://member-cluster-0.internal:6443", "https://api.member-cluster-1", "https://explicit.member-cluster-2"}, flags.MemberClusterApiServerUrls)
+	assert.Equal(t, []string{"https://member-cluster-0.internal:6443", "https://10.0.0.1:6443", "https://api.member-cluster-1", "https://explicit.member-cluster-2"}, probed)
+}
+
+func TestPodApiServerProbe(t *testing.T) {
+	ctx := context.Background()
+	clientset := newFakeClientset(ctx, "central-cluster", nil)
+	var created *corev1.Pod
+	clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		created = action.(k8stesting.CreateAction).GetObject().(*corev1.Pod)
+		created.Name = created.GenerateName + "x7k2p"
+		return false, nil, nil
+	})
+	waiting := corev1.ContainerStateWaiting{Reason: "ImagePullBackOff", Message: `Back-off pulling image "registry.example.com/curl:8.10.1"`}
+	clientset.PrependReactor("get", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		pod := created.DeepCopy()
+		pod.Status = corev1.PodStatus{Phase: corev1.PodPending, ContainerStatuses: []corev1.ContainerStatus{{Name: "probe", State: corev1.ContainerState{Waiting: &waiting}}}}
+		return true, pod, nil
+	})
+	flags := Flags{ApiServerProbeNamespace: "probes", ApiServerProbeImage: "registry.example.com/curl:8.10.1", ImagePullSecrets: "registry-credentials"}
+	probe := NewPodApiServerProbe(NewKubeClientContainer(nil, clientset, nil), flags)
+
+	start := time.Now()
+	err := probe(ctx, "https://cluster-1.internal:6443")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "probe pod probes/mongodb-api-server-probe-x7k2p did not complete: container probe is waiting: ImagePullBackOff")
+	assert.Less(t, time.Since(start), apiServerProbeTimeout, "a pod that can't pull its image is not waited for")
+
+	spec := created.Spec
+	assert.Equal(t, []corev1.LocalObjectReference{{Name: "registry-credentials"}}, spec.ImagePullSecrets)
+	assert.True(t, *spec.SecurityContext.RunAsNonRoot)
+	assert.Equal(t, corev1.SeccompProfileTypeRuntimeDefault, spec.SecurityContext.SeccompProfile.Type)
+	assert.False(t, *spec.Containers[0].SecurityContext.AllowPrivilegeEscalation)
+	assert.Equal(t, []corev1.Capability{"ALL"}, spec.Containers[0].SecurityContext.Capabilities.Drop)
+
+	// a pod the kubelet rejected fails without running curl
+	clientset.PrependReactor("get", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		pod := created.DeepCopy()
+		pod.Status = corev1.PodStatus{Phase: corev1.PodFailed, Reason: "OutOfcpu", Message: "Pod was rejected: Node didn't have enough resource: cpu"}
+		return true, pod, nil
+	})
+	err = probe(ctx, "https://cluster-1.internal:6443")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "rejected by the kubelet: OutOfcpu Pod was rejected")
+}
+
+func TestApiServerCandidates(t *testing.T) {
+	flags := Flags{
+		ApiServerDiscovery: []string{ApiServerDiscoveryMapping, ApiServerDiscoveryKind, ApiServerDiscoveryKubeConfig},
+		ApiServerMapping:   map[string]string{"cluster-1": "https://cluster-1.example.com"},
+		ClusterContexts:    map[string]string{"cluster-1": "kind-cluster-1"},
+	}
+	kubeconfig, err := clientcmd.Load([]byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: kind-cluster-1
+  cluster:
+    server: https://127.0.0.1:40123
+contexts:
+- name: kind-cluster-1
+  context:
+    cluster: kind-cluster-1
+`))
+	require.NoError(t, err)
+
+	candidates := apiServerCandidates(context.Background(), flags, nil, "cluster-1", kubeconfig)
+	assert.Equal(t, []apiServerCandidate{
+		{url: "https://cluster-1.example.com", strategy: ApiServerDiscoveryMapping},
+		{url: "https://cluster-1-control-plane:6443", strategy: ApiServerDiscoveryKind},
+		{url: "https://127.0.0.1:40123", strategy: ApiServerDiscoveryKubeConfig},
+	}, candidates)
+}
+
+func TestValidateApiServerDiscovery(t *testing.T) {
+	require.NoError(t, ValidateApiServerDiscovery([]string{ApiServerDiscoveryKind, ApiServerDiscoveryKubeConfig}))
+	assert.EqualError(t, ValidateApiServerDiscovery([]string{"dns"}), `unknown api server discovery strategy "dns", expected one of mapping, cluster-info, endpoints, kind, kubeconfig`)
+}
+
+func TestIsLoopbackApiServer(t *testing.T) {
+	assert.True(t, IsLoopbackApiServer("https://127.0.0.1:40123"))
+	assert.True(t, IsLoopbackApiServer("https://localhost:6443"))
+	assert.True(t, IsLoopbackApiServer("https://[::1]:6443"))
+	assert.False(t, IsLoopbackApiServer("https://172.18.0.2:6443"))
+	assert.False(t, IsLoopbackApiServer("https://api.example.com"))
+}
@@ -0,0 +1,70 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+
+	"golang.org/x/xerrors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+)
+
+// FieldManager is the field manager of all the objects applied by this tool.
+const FieldManager = "kubectl-mongodb"
+
+// applyClient is implemented by the typed clients of all the objects applied by this tool.
+type applyClient[T runtime.Object] interface {
+	Get(ctx context.Context, name string, opts metav1.GetOptions) (T, error)
+	Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (T, error)
+}
+
+// applyObject server-side applies the object, creating it if it doesn't exist. Only the fields set in obj are owned
+// by this tool: they are taken over from other field managers if needed, while fields owned by other controllers
+// are left untouched. Fields previously applied by this tool that are no longer set in obj are removed. The creation
+// time recorded on the live object is kept.
+func applyObject[T plannedObject](ctx context.Context, client applyClient[T], obj T) (T, error) {
+	if _, ok := obj.GetAnnotations()[CreatedAtAnnotation]; ok {
+		if live, err := client.Get(ctx, obj.GetName(), metav1.GetOptions{}); err == nil {
+			keepCreatedAt(obj, live)
+		}
+	}
+	data, err := applyConfiguration(obj)
+	if err != nil {
+		var zero T
+		return zero, xerrors.Errorf("failed to build apply configuration of %s: %w", obj.GetName(), err)
+	}
+	return client.Patch(ctx, obj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{FieldManager: FieldManager, Force: ptr.To(true)})
+}
+
+// applyConfiguration returns the object as a JSON apply configuration.
+func applyConfiguration(obj runtime.Object) ([]byte, error) {
+	content, err := manifestContent(obj)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(content)
+}
+
+// manifestContent returns the object including its apiVersion and kind, without the fields that are only ever set
+// by the API server.
+func manifestContent(obj runtime.Object) (map[string]interface{}, error) {
+	obj = obj.DeepCopyObject()
+	gvks, _, err := scheme.Scheme.ObjectKinds(obj)
+	if err != nil {
+		return nil, err
+	}
+	obj.GetObjectKind().SetGroupVersionKind(gvks[0])
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	delete(content, "status")
+	if metadata, ok := content["metadata"].(map[string]interface{}); ok {
+		delete(metadata, "creationTimestamp")
+	}
+	return content, nil
+}
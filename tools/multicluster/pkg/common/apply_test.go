@@ -0,0 +1,83 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// recordingApplyClient records the patches it receives.
+type recordingApplyClient struct {
+	name      string
+	patchType types.PatchType
+	data      []byte
+	opts      metav1.PatchOptions
+}
+
+func (c *recordingApplyClient) Get(_ context.Context, name string, _ metav1.GetOptions) (*rbacv1.Role, error) {
+	return nil, errors.NewNotFound(rbacv1.Resource("roles"), name)
+}
+
+func (c *recordingApplyClient) Patch(_ context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, _ ...string) (*rbacv1.Role, error) {
+	c.name, c.patchType, c.data, c.opts = name, pt, data, opts
+	return &rbacv1.Role{}, nil
+}
+
+func TestApplyObject_UsesFieldManager(t *testing.T) {
+	client := &recordingApplyClient{}
+	role := buildMemberEntityRole(Flags{}, "member-namespace")
+
+	_, err := applyObject[*rbacv1.Role](context.Background(), client, &role)
+	require.NoError(t, err)
+
+	assert.Equal(t, role.Name, client.name)
+	assert.Equal(t, types.ApplyPatchType, client.patchType)
+	assert.Equal(t, FieldManager, client.opts.FieldManager)
+	require.NotNil(t, client.opts.Force)
+	assert.True(t, *client.opts.Force)
+
+	applied := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(client.data, &applied))
+	assert.Equal(t, "rbac.authorization.k8s.io/v1", applied["apiVersion"])
+	assert.Equal(t, "Role", applied["kind"])
+	assert.NotContains(t, applied["metadata"], "creationTimestamp")
+}
+
+func TestCreateRoles_ConvergesOutdatedRbac(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	cluster := flags.MemberClusters[0]
+
+	outdatedRole := buildMemberEntityRole(flags, flags.MemberClusterNamespace)
+	outdatedRole.Rules = outdatedRole.Rules[:1]
+	outdatedClusterRole := buildMemberEntityClusterRole(flags)
+	outdatedClusterRole.Rules = outdatedClusterRole.Rules[:1]
+	outdatedTelemetryRole := buildClusterRoleTelemetry(flags)
+	outdatedTelemetryRole.Rules = nil
+	client := NewKubeClientContainer(nil, newFakeClientset(ctx, cluster, []runtime.Object{&outdatedRole, &outdatedClusterRole, &outdatedTelemetryRole}), nil)
+
+	flags.CreateTelemetryClusterRoles = true
+	require.NoError(t, createRoles(ctx, client, flags, operatorSubjects(flags, cluster), flags.MemberClusterNamespace, clusterTypeMember))
+	flags.ClusterScoped = true
+	require.NoError(t, createRoles(ctx, client, flags, operatorSubjects(flags, cluster), flags.MemberClusterNamespace, clusterTypeMember))
+
+	role, err := client.RbacV1().Roles(flags.MemberClusterNamespace).Get(ctx, outdatedRole.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, buildMemberEntityRole(flags, flags.MemberClusterNamespace).Rules, role.Rules)
+
+	clusterRole, err := client.RbacV1().ClusterRoles().Get(ctx, outdatedClusterRole.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, buildMemberEntityClusterRole(flags).Rules, clusterRole.Rules)
+
+	telemetryRole, err := client.RbacV1().ClusterRoles().Get(ctx, outdatedTelemetryRole.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, buildClusterRoleTelemetry(flags).Rules, telemetryRole.Rules)
+}
@@ -0,0 +1,215 @@
+package common
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// DefaultClientCertificateExpiry is the lifetime requested for the client certificates. Signers may issue
+	// certificates with a shorter lifetime, e.g. the one set by --cluster-signing-duration.
+	DefaultClientCertificateExpiry = 365 * 24 * time.Hour
+
+	// MinClientCertificateExpiry is the shortest lifetime accepted by the CertificateSigningRequest API.
+	MinClientCertificateExpiry = 10 * time.Minute
+)
+
+// clientCertificateUser returns the user the client certificate of the cluster is issued for.
+func (f Flags) clientCertificateUser(cluster string) string {
+	if f.ClientCertificateUser != "" {
+		return f.ClientCertificateUser
+	}
+	_, serviceAccount := f.serviceAccountFor(cluster)
+	return serviceAccount
+}
+
+// clientCertificateExpiry returns the lifetime requested for the client certificates.
+func (f Flags) clientCertificateExpiry() time.Duration {
+	if f.ClientCertificateExpiry != 0 {
+		return f.ClientCertificateExpiry
+	}
+	return DefaultClientCertificateExpiry
+}
+
+// operatorSubjects returns the subjects the operator's roles are bound to in the given cluster. The operator always
+// runs as its ServiceAccount in the central cluster. With client certificate authentication, it connects to the
+// member clusters as the user or group of its certificate instead.
+func operatorSubjects(f Flags, cluster string) []rbacv1.Subject {
+	var subjects []rbacv1.Subject
+	if !f.ClientCertificateAuth || cluster == f.CentralCluster {
+		namespace, name := f.serviceAccountFor(cluster)
+		subjects = append(subjects, rbacv1.Subject{
+			Kind:      rbacv1.ServiceAccountKind,
+			Name:      name,
+			Namespace: namespace,
+		})
+	}
+	if f.ClientCertificateAuth && Contains(f.MemberClusters, cluster) {
+		if f.ClientCertificateGroup != "" {
+			subjects = append(subjects, rbacv1.Subject{Kind: rbacv1.GroupKind, APIGroup: rbacv1.GroupName, Name: f.ClientCertificateGroup})
+		} else {
+			subjects = append(subjects, rbacv1.Subject{Kind: rbacv1.UserKind, APIGroup: rbacv1.GroupName, Name: f.clientCertificateUser(cluster)})
+		}
+	}
+	return subjects
+}
+
+// requestAllMemberClusterClientCertificates obtains a client certificate for the operator in every member cluster.
+// The certificates are returned as TLS Secrets including the CA of the cluster, so they can be passed to
+// createKubeConfigFromServiceAccountTokens.
+func requestAllMemberClusterClientCertificates(ctx context.Context, clientSetMap map[string]KubeClient, flags Flags) (map[string]corev1.Secret, error) {
+	allSecrets := map[string]corev1.Secret{}
+	mu := sync.Mutex{}
+
+	err := forEachCluster(ctx, flags.MemberClusters, flags.Parallelism, func(ctx context.Context, cluster string) error {
+		secret, err := requestClientCertificate(ctx, clientSetMap[cluster], cluster, flags)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		allSecrets[cluster] = secret
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return allSecrets, nil
+}
+
+// requestClientCertificate generates a key pair and submits a CertificateSigningRequest for it to the cluster.
+// It waits for the request to be approved and signed, and returns the certificate together with its key.
+func requestClientCertificate(ctx context.Context, c KubeClient, cluster string, flags Flags) (corev1.Secret, error) {
+	if flags.DryRun {
+		return corev1.Secret{
+			Type: corev1.SecretTypeTLS,
+			Data: map[string][]byte{
+				"ca.crt":                []byte("<ca.crt of the cluster>"),
+				corev1.TLSCertKey:       []byte("<client certificate>"),
+				corev1.TLSPrivateKeyKey: []byte("<client key>"),
+			},
+		}, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return corev1.Secret{}, xerrors.Errorf("failed generating private key: %w", err)
+	}
+	subject := pkix.Name{CommonName: flags.clientCertificateUser(cluster)}
+	if flags.ClientCertificateGroup != "" {
+		subject.Organization = []string{flags.ClientCertificateGroup}
+	}
+	request, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: subject}, key)
+	if err != nil {
+		return corev1.Secret{}, xerrors.Errorf("failed creating certificate request: %w", err)
+	}
+
+	csr := &certificatesv1.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        fmt.Sprintf("%s-%s", FieldManager, utilrand.String(8)),
+			Labels:      multiClusterLabels(flags),
+			Annotations: multiClusterAnnotations(flags),
+		},
+		Spec: certificatesv1.CertificateSigningRequestSpec{
+			Request:           pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: request}),
+			SignerName:        certificatesv1.KubeAPIServerClientSignerName,
+			ExpirationSeconds: ptr.To(int32(flags.clientCertificateExpiry().Seconds())),
+			Usages:            []certificatesv1.KeyUsage{certificatesv1.UsageDigitalSignature, certificatesv1.UsageClientAuth},
+		},
+	}
+	csr, err = c.CertificatesV1().CertificateSigningRequests().Create(ctx, csr, metav1.CreateOptions{})
+	if err != nil {
+		return corev1.Secret{}, xerrors.Errorf("failed creating CertificateSigningRequest: %w", err)
+	}
+
+	if flags.ApproveCSR {
+		if err := approveCSR(ctx, c, csr); err != nil {
+			return corev1.Secret{}, xerrors.Errorf("failed approving CertificateSigningRequest %s: %w", csr.Name, err)
+		}
+	} else {
+		logger.Info(fmt.Sprintf("Waiting for CertificateSigningRequest to be approved, run: kubectl --context %s certificate approve %s", flags.ClusterContext(cluster), csr.Name), "cluster", cluster, "name", csr.Name)
+	}
+
+	timeout := flags.CSRApprovalTimeout
+	if timeout == 0 {
+		timeout = PollingTimeout
+	}
+	var certificate []byte
+	if err := wait.PollWithContext(ctx, PollingInterval, timeout, func(ctx context.Context) (done bool, err error) {
+		current, err := c.CertificatesV1().CertificateSigningRequests().Get(ctx, csr.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		for _, condition := range current.Status.Conditions {
+			if condition.Type == certificatesv1.CertificateDenied || condition.Type == certificatesv1.CertificateFailed {
+				return false, xerrors.Errorf("CertificateSigningRequest %s is %s: %s", csr.Name, condition.Type, condition.Message)
+			}
+		}
+		certificate = current.Status.Certificate
+		return len(certificate) > 0, nil
+	}); err != nil {
+		return corev1.Secret{}, xerrors.Errorf("failed waiting for CertificateSigningRequest %s to be signed: %w", csr.Name, err)
+	}
+
+	namespace, _ := flags.serviceAccountFor(cluster)
+	ca, err := getClusterCA(ctx, c, namespace)
+	if err != nil {
+		return corev1.Secret{}, err
+	}
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return corev1.Secret{}, xerrors.Errorf("failed marshalling private key: %w", err)
+	}
+
+	return corev1.Secret{
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			"ca.crt":                ca,
+			corev1.TLSCertKey:       certificate,
+			corev1.TLSPrivateKeyKey: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}),
+		},
+	}, nil
+}
+
+// approveCSR adds the approved condition to the CertificateSigningRequest. The request is read again after a conflict,
+// e.g. with a controller updating its status at the same time.
+func approveCSR(ctx context.Context, c KubeClient, csr *certificatesv1.CertificateSigningRequest) error {
+	csrs := c.CertificatesV1().CertificateSigningRequests()
+	created := true
+	return retryOnConflict(func() error {
+		if !created {
+			latest, err := csrs.Get(ctx, csr.Name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			csr = latest
+		}
+		created = false
+		csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{
+			Type:    certificatesv1.CertificateApproved,
+			Status:  corev1.ConditionTrue,
+			Reason:  "KubectlMongodbApprove",
+			Message: "Approved by kubectl-mongodb multicluster setup",
+		})
+		_, err := csrs.UpdateApproval(ctx, csr.Name, csr, metav1.UpdateOptions{})
+		return err
+	})
+}
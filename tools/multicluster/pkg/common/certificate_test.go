@@ -0,0 +1,110 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestOperatorSubjects(t *testing.T) {
+	flags := testFlags(t, false)
+	serviceAccount := rbacv1.Subject{Kind: "ServiceAccount", Name: flags.ServiceAccount, Namespace: flags.CentralClusterNamespace}
+
+	assert.Equal(t, []rbacv1.Subject{serviceAccount}, operatorSubjects(flags, flags.MemberClusters[0]))
+
+	flags.ClientCertificateAuth = true
+	user := rbacv1.Subject{Kind: "User", APIGroup: "rbac.authorization.k8s.io", Name: flags.ServiceAccount}
+	assert.Equal(t, []rbacv1.Subject{user}, operatorSubjects(flags, flags.MemberClusters[0]))
+	assert.Equal(t, []rbacv1.Subject{serviceAccount}, operatorSubjects(flags, flags.CentralCluster))
+
+	flags.CentralCluster = flags.MemberClusters[0]
+	assert.Equal(t, []rbacv1.Subject{serviceAccount, user}, operatorSubjects(flags, flags.CentralCluster), "the central cluster is also a member cluster")
+
+	flags.ClientCertificateGroup = "mongodb-operators"
+	group := rbacv1.Subject{Kind: "Group", APIGroup: "rbac.authorization.k8s.io", Name: "mongodb-operators"}
+	assert.Equal(t, []rbacv1.Subject{group}, operatorSubjects(flags, flags.MemberClusters[1]))
+}
+
+func TestEnsureMultiClusterResources_WithClientCertificates(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	flags.ClientCertificateAuth = true
+	flags.ApproveCSR = true
+	flags.ClientCertificateExpiry = 30 * 24 * time.Hour
+	clientMap := getClientResources(ctx, flags)
+	addRootCAConfigMaps(ctx, t, clientMap, flags)
+	addCSRSigner(clientMap)
+
+	require.NoError(t, EnsureMultiClusterResources(ctx, flags, clientMap))
+
+	for _, cluster := range flags.MemberClusters {
+		csrs, err := clientMap[cluster].CertificatesV1().CertificateSigningRequests().List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		require.Len(t, csrs.Items, 1)
+		assert.Equal(t, int32(30*24*60*60), *csrs.Items[0].Spec.ExpirationSeconds)
+	}
+
+	kubeConfig, err := readKubeConfig(ctx, clientMap[flags.CentralCluster], flags.CentralClusterNamespace)
+	require.NoError(t, err)
+	for i, cluster := range flags.MemberClusters {
+		user := kubeConfig.Users[i].User
+		assert.Empty(t, user.Token)
+		assert.Equal(t, fmt.Sprintf("certificate signed by %s", cluster), string(user.ClientCertificateData))
+		assert.Contains(t, string(user.ClientKeyData), "BEGIN EC PRIVATE KEY")
+		assert.Equal(t, fmt.Sprintf("ca.crt: %s", cluster), string(kubeConfig.Clusters[i].Cluster.CertificateAuthorityData))
+
+		roleBinding, err := clientMap[cluster].RbacV1().RoleBindings(flags.MemberClusterNamespace).Get(ctx, "mongodb-enterprise-operator-multi-role-binding", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, []rbacv1.Subject{{Kind: "User", APIGroup: "rbac.authorization.k8s.io", Name: flags.ServiceAccount}}, roleBinding.Subjects)
+
+		_, err = clientMap[cluster].CoreV1().Secrets(flags.CentralClusterNamespace).Get(ctx, fmt.Sprintf("%s-token-secret", flags.ServiceAccount), metav1.GetOptions{})
+		assert.Error(t, err, "no token secret should be created in cluster %s", cluster)
+	}
+}
+
+func TestRequestClientCertificate_FailsWhenDenied(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	flags.ClientCertificateAuth = true
+	cluster := flags.MemberClusters[0]
+	clientset := newFakeClientset(ctx, cluster, nil)
+	clientset.PrependReactor("create", "certificatesigningrequests", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		csr := action.(k8stesting.CreateAction).GetObject().(*certificatesv1.CertificateSigningRequest)
+		csr.Status.Conditions = []certificatesv1.CertificateSigningRequestCondition{{Type: certificatesv1.CertificateDenied, Status: corev1.ConditionTrue, Message: "not allowed"}}
+		return false, nil, nil
+	})
+
+	_, err := requestClientCertificate(ctx, NewKubeClientContainer(nil, clientset, nil), cluster, flags)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Denied: not allowed")
+}
+
+// addCSRSigner makes the fake clientsets sign approved CertificateSigningRequests, like the kube-controller-manager.
+func addCSRSigner(clientMap map[string]KubeClient) {
+	for cluster, c := range clientMap {
+		clientset := c.(*KubeClientContainer).staticClient.(*fake.Clientset)
+		clientset.PrependReactor("update", "certificatesigningrequests", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if action.GetSubresource() != "approval" {
+				return false, nil, nil
+			}
+			csr := action.(k8stesting.UpdateAction).GetObject().(*certificatesv1.CertificateSigningRequest).DeepCopy()
+			for _, condition := range csr.Status.Conditions {
+				if condition.Type == certificatesv1.CertificateApproved {
+					csr.Status.Certificate = []byte(fmt.Sprintf("certificate signed by %s", cluster))
+				}
+			}
+			return true, csr, clientset.Tracker().Update(action.GetResource(), csr, "")
+		})
+	}
+}
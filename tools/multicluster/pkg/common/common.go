@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -32,7 +33,9 @@ var (
 
 var (
 	PollingInterval = time.Millisecond * 100
-	PollingTimeout  = time.Second * 5
+	// PollingTimeout is how long to wait for an operation completed asynchronously by the clusters, such as the
+	// population of ServiceAccount token secrets.
+	PollingTimeout = time.Minute
 )
 
 const (
@@ -42,11 +45,20 @@ const (
 
 // Flags holds all the fields provided by the user.
 type Flags struct {
-	MemberClusters              []string
-	MemberClusterApiServerUrls  []string
-	ServiceAccount              string
-	CentralCluster              string
-	MemberClusterNamespace      string
+	MemberClusters             []string
+	MemberClusterApiServerUrls []string
+	ServiceAccount             string
+	CentralCluster             string
+	MemberClusterNamespace     string
+	// MemberClusterNamespaces are additional namespaces watched by the operator in every member cluster. The
+	// operator's Roles are created in each of them, like in MemberClusterNamespace.
+	MemberClusterNamespaces []string
+	// MemberNamespaceSelector selects more namespaces watched by the operator by their labels, see
+	// SelectMemberNamespaces.
+	MemberNamespaceSelector string
+	// ClusterOverrides maps the name of a member cluster to the namespaces and ServiceAccount used in it, when
+	// they differ from the global flags.
+	ClusterOverrides            map[string]ClusterOverrides
 	CentralClusterNamespace     string
 	Cleanup                     bool
 	ClusterScoped               bool
@@ -55,7 +67,92 @@ type Flags struct {
 	OperatorName                string
 	SourceCluster               string
 	CreateServiceAccountSecrets bool
-	ImagePullSecrets            string
+	// ClusterConnections maps the name of a member cluster to the settings the operator connects to it with.
+	ClusterConnections map[string]ClusterConnection
+	// ProxyURL is the proxy the operator connects to the member clusters through, unless they set their own.
+	ProxyURL string
+	// DisableCompression disables the compression of the responses of the API servers of all member clusters.
+	DisableCompression bool
+	// CheckKubeConfig connects to the member clusters with the generated kubeconfig before writing the KubeConfig
+	// secret, and fails if any of them can't be reached.
+	CheckKubeConfig bool
+	// ApiServerDiscovery are the strategies tried in order to find api servers of the member clusters that are
+	// reachable from the central cluster, see DiscoverApiServers. Discovery is disabled when empty.
+	ApiServerDiscovery []string
+	// ApiServerMapping maps the name of a member cluster to the api server tried by the mapping discovery strategy.
+	ApiServerMapping map[string]string
+	// ApiServerProbeImage is the image of the pods probing the discovered api servers from the central cluster.
+	ApiServerProbeImage string
+	// ApiServerProbeNamespace is the namespace of the central cluster the probe pods are run in.
+	ApiServerProbeNamespace string
+	// ProbedApiServers maps the name of a member cluster to its api server that DiscoverApiServers reached from the
+	// central cluster. These are often only reachable inside the clusters, so the CheckKubeConfig connections to
+	// them are skipped.
+	ProbedApiServers map[string]string
+	// ImagePullSecrets is the name of the image pull secret set in the ServiceAccounts created by this tool.
+	ImagePullSecrets string
+	// ImagePullSecretDockerConfig is the docker config the ImagePullSecrets secret is created with in every namespace
+	// holding the ServiceAccounts. When empty, the secret has to be created outside of this tool.
+	ImagePullSecretDockerConfig []byte
+	DryRun                      bool
+	// Parallelism is the number of clusters that are processed concurrently.
+	Parallelism int
+	// TokenExpiry enables minting short-lived tokens through the TokenRequest API with the given expiry,
+	// instead of using non-expiring ServiceAccount token Secrets.
+	TokenExpiry time.Duration
+	// ClientCertificateAuth makes the operator authenticate to the member clusters with client certificates issued
+	// through the CertificateSigningRequest API, instead of ServiceAccount tokens.
+	ClientCertificateAuth bool
+	// ClientCertificateUser is the user the client certificates are issued for. It defaults to the ServiceAccount name.
+	ClientCertificateUser string
+	// ClientCertificateGroup is the group the client certificates are issued for. When set, the operator's roles
+	// are bound to the group instead of the user.
+	ClientCertificateGroup string
+	// ClientCertificateExpiry is the lifetime requested for the client certificates, DefaultClientCertificateExpiry
+	// when 0.
+	ClientCertificateExpiry time.Duration
+	// ApproveCSR approves the CertificateSigningRequests submitted by this tool instead of waiting for an
+	// administrator to approve them. It is disabled by default, as clusters forbidding ServiceAccount tokens usually
+	// require a human to approve the certificates.
+	ApproveCSR bool
+	// CSRApprovalTimeout is how long to wait for a CertificateSigningRequest to be approved and signed.
+	CSRApprovalTimeout time.Duration
+	// ClusterContexts maps the name of a cluster to the kubeconfig context used to connect to it.
+	// Clusters that are not in the map use their name as the context.
+	ClusterContexts map[string]string
+	// InstallationID identifies the installation in InstallationLabel and in the names of its cluster scoped objects.
+	// Unless it is given explicitly, it is set by ResolveInstallationID.
+	InstallationID string
+	// AdoptLegacyObjects labels the objects created by older versions of this tool, which only carry the
+	// multi-cluster=true label, as part of the installation before setting it up or cleaning it up.
+	AdoptLegacyObjects bool
+	// RBACProfile customizes the rules of the Roles and ClusterRoles created for the operator.
+	RBACProfile *RBACProfile
+	// ManagedKinds are the kinds of custom resources the operator manages. When set, the operator is only granted
+	// the minimal rules for these kinds instead of all verbs on every MongoDB resource.
+	ManagedKinds []string
+}
+
+// createsServiceAccountTokenSecrets returns true if the operator authenticates with non-expiring ServiceAccount
+// tokens stored in Secrets.
+func (f Flags) createsServiceAccountTokenSecrets() bool {
+	return f.CreateServiceAccountSecrets && f.TokenExpiry == 0 && !f.ClientCertificateAuth
+}
+
+// ClusterContext returns the kubeconfig context used to connect to the given cluster.
+func (f Flags) ClusterContext(cluster string) string {
+	if context, ok := f.ClusterContexts[cluster]; ok {
+		return context
+	}
+	return cluster
+}
+
+// ClientGetter wraps getClient, which creates a client for a kubeconfig context, into a function that creates a
+// client for a cluster name, as expected by CreateClientMap.
+func (f Flags) ClientGetter(getClient func(context, kubeConfigPath string) (KubeClient, error)) func(string, string) (KubeClient, error) {
+	return func(cluster, kubeConfigPath string) (KubeClient, error) {
+		return getClient(f.ClusterContext(cluster), kubeConfigPath)
+	}
 }
 
 const (
@@ -87,6 +184,9 @@ type KubeConfigClusterItem struct {
 type KubeConfigCluster struct {
 	CertificateAuthorityData []byte `json:"certificate-authority-data"`
 	Server                   string `json:"server"`
+	TLSServerName            string `json:"tls-server-name,omitempty"`
+	ProxyURL                 string `json:"proxy-url,omitempty"`
+	DisableCompression       bool   `json:"disable-compression,omitempty"`
 }
 
 type KubeConfigContextItem struct {
@@ -106,35 +206,51 @@ type KubeConfigUserItem struct {
 }
 
 type KubeConfigUser struct {
-	Token string `json:"token"`
-}
-
-// multiClusterLabels the labels that will be applied to every resource created by this tool.
-func multiClusterLabels() map[string]string {
-	return map[string]string{
-		"multi-cluster": "true",
-	}
+	Token                 string `json:"token,omitempty"`
+	ClientCertificateData []byte `json:"client-certificate-data,omitempty"`
+	ClientKeyData         []byte `json:"client-key-data,omitempty"`
 }
 
-// performCleanup cleans up all of the resources that were created by this script in the past.
+// performCleanup cleans up all of the resources that were created by this script in the past for the installation.
+// Objects created by older versions of this tool are only cleaned up with flags.AdoptLegacyObjects.
 func performCleanup(ctx context.Context, clientMap map[string]KubeClient, flags Flags) error {
-	for _, cluster := range flags.MemberClusters {
-		c := clientMap[cluster]
-		if err := cleanupClusterResources(ctx, c, cluster, flags.MemberClusterNamespace); err != nil {
-			return xerrors.Errorf("failed cleaning up cluster %s namespace %s: %w", cluster, flags.MemberClusterNamespace, err)
+	return forEachCluster(ctx, allClusters(flags), flags.Parallelism, func(ctx context.Context, cluster string) error {
+		namespaces := flags.clusterNamespaces(cluster)
+		for _, namespace := range namespaces {
+			for _, selector := range cleanupSelectors(flags) {
+				if err := cleanupClusterResources(ctx, clientMap[cluster], cluster, namespace, selector); err != nil {
+					return xerrors.Errorf("failed cleaning up namespace %s: %w", namespace, err)
+				}
+			}
 		}
-	}
-	c := clientMap[flags.CentralCluster]
-	if err := cleanupClusterResources(ctx, c, flags.CentralCluster, flags.CentralClusterNamespace); err != nil {
-		return xerrors.Errorf("failed cleaning up cluster %s namespace %s: %w", flags.CentralCluster, flags.CentralClusterNamespace, err)
-	}
-	return nil
+		if flags.AdoptLegacyObjects {
+			return nil
+		}
+
+		legacyObjects, err := countLegacyObjects(ctx, clientMap[cluster], namespaces)
+		if err != nil {
+			return xerrors.Errorf("failed listing objects created by older versions: %w", err)
+		}
+		if legacyObjects > 0 {
+			Warnf("skipped %d objects in cluster %s labelled multi-cluster=true without an installation, pass --adopt-legacy-objects to clean them up as part of this installation", legacyObjects, cluster)
+		}
+		return nil
+	})
+}
+
+// adoptAllLegacyObjects labels the objects created by older versions of this tool in all clusters as part of the
+// installation, see adoptLegacyObjects.
+func adoptAllLegacyObjects(ctx context.Context, clientMap map[string]KubeClient, flags Flags) error {
+	return forEachCluster(ctx, allClusters(flags), flags.Parallelism, func(ctx context.Context, cluster string) error {
+		return adoptLegacyObjects(ctx, clientMap[cluster], flags, cluster, flags.clusterNamespaces(cluster))
+	})
 }
 
-// cleanupClusterResources cleans up all the resources created by this tool in a given namespace.
-func cleanupClusterResources(ctx context.Context, clientset KubeClient, clusterName, namespace string) error {
+// cleanupClusterResources cleans up all the resources created by this tool in a given namespace that match the
+// label selector.
+func cleanupClusterResources(ctx context.Context, clientset KubeClient, clusterName, namespace, selector string) error {
 	listOpts := metav1.ListOptions{
-		LabelSelector: "multi-cluster=true",
+		LabelSelector: selector,
 	}
 
 	// clean up secrets
@@ -145,7 +261,7 @@ func cleanupClusterResources(ctx context.Context, clientset KubeClient, clusterN
 
 	if secretList != nil {
 		for _, s := range secretList.Items {
-			fmt.Printf("Deleting Secret: %s in cluster %s\n", s.Name, clusterName)
+			logger.Info("Deleting Secret", "cluster", clusterName, "namespace", namespace, "name", s.Name)
 			if err := clientset.CoreV1().Secrets(namespace).Delete(ctx, s.Name, metav1.DeleteOptions{}); err != nil {
 				return err
 			}
@@ -160,7 +276,7 @@ func cleanupClusterResources(ctx context.Context, clientset KubeClient, clusterN
 
 	if serviceAccountList != nil {
 		for _, sa := range serviceAccountList.Items {
-			fmt.Printf("Deleting ServiceAccount: %s in cluster %s\n", sa.Name, clusterName)
+			logger.Info("Deleting ServiceAccount", "cluster", clusterName, "namespace", namespace, "name", sa.Name)
 			if err := clientset.CoreV1().ServiceAccounts(namespace).Delete(ctx, sa.Name, metav1.DeleteOptions{}); err != nil {
 				return err
 			}
@@ -174,7 +290,7 @@ func cleanupClusterResources(ctx context.Context, clientset KubeClient, clusterN
 	}
 
 	for _, r := range roleList.Items {
-		fmt.Printf("Deleting Role: %s in cluster %s\n", r.Name, clusterName)
+		logger.Info("Deleting Role", "cluster", clusterName, "namespace", namespace, "name", r.Name)
 		if err := clientset.RbacV1().Roles(namespace).Delete(ctx, r.Name, metav1.DeleteOptions{}); err != nil {
 			return err
 		}
@@ -188,7 +304,7 @@ func cleanupClusterResources(ctx context.Context, clientset KubeClient, clusterN
 
 	if roles != nil {
 		for _, r := range roles.Items {
-			fmt.Printf("Deleting Role: %s in cluster %s\n", r.Name, clusterName)
+			logger.Info("Deleting Role", "cluster", clusterName, "namespace", namespace, "name", r.Name)
 			if err := clientset.RbacV1().Roles(namespace).Delete(ctx, r.Name, metav1.DeleteOptions{}); err != nil {
 				return err
 			}
@@ -203,7 +319,7 @@ func cleanupClusterResources(ctx context.Context, clientset KubeClient, clusterN
 
 	if roleBindings != nil {
 		for _, crb := range roleBindings.Items {
-			fmt.Printf("Deleting RoleBinding: %s in cluster %s\n", crb.Name, clusterName)
+			logger.Info("Deleting RoleBinding", "cluster", clusterName, "namespace", namespace, "name", crb.Name)
 			if err := clientset.RbacV1().RoleBindings(namespace).Delete(ctx, crb.Name, metav1.DeleteOptions{}); err != nil {
 				return err
 			}
@@ -218,7 +334,7 @@ func cleanupClusterResources(ctx context.Context, clientset KubeClient, clusterN
 
 	if clusterRoleBindings != nil {
 		for _, crb := range clusterRoleBindings.Items {
-			fmt.Printf("Deleting ClusterRoleBinding: %s in cluster %s\n", crb.Name, clusterName)
+			logger.Info("Deleting ClusterRoleBinding", "cluster", clusterName, "name", crb.Name)
 			if err := clientset.RbacV1().ClusterRoleBindings().Delete(ctx, crb.Name, metav1.DeleteOptions{}); err != nil {
 				return err
 			}
@@ -233,7 +349,7 @@ func cleanupClusterResources(ctx context.Context, clientset KubeClient, clusterN
 
 	if clusterRoles != nil {
 		for _, cr := range clusterRoles.Items {
-			fmt.Printf("Deleting ClusterRole: %s in cluster %s\n", cr.Name, clusterName)
+			logger.Info("Deleting ClusterRole", "cluster", clusterName, "name", cr.Name)
 			if err := clientset.RbacV1().ClusterRoles().Delete(ctx, cr.Name, metav1.DeleteOptions{}); err != nil {
 				return err
 			}
@@ -244,11 +360,12 @@ func cleanupClusterResources(ctx context.Context, clientset KubeClient, clusterN
 }
 
 // ensureNamespace creates the namespace with the given clientset.
-func ensureNamespace(ctx context.Context, clientSet KubeClient, nsName string) error {
+func ensureNamespace(ctx context.Context, clientSet KubeClient, f Flags, nsName string) error {
 	ns := corev1.Namespace{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:   nsName,
-			Labels: multiClusterLabels(),
+			Name:        nsName,
+			Labels:      multiClusterLabels(f),
+			Annotations: multiClusterAnnotations(f),
 		},
 	}
 	_, err := clientSet.CoreV1().Namespaces().Create(ctx, &ns, metav1.CreateOptions{})
@@ -261,20 +378,15 @@ func ensureNamespace(ctx context.Context, clientSet KubeClient, nsName string) e
 
 // ensureAllClusterNamespacesExist makes sure the namespace we will be creating exists in all clusters.
 func ensureAllClusterNamespacesExist(ctx context.Context, clientSets map[string]KubeClient, f Flags) error {
-	for _, clusterName := range f.MemberClusters {
-		if err := ensureNamespace(ctx, clientSets[clusterName], f.MemberClusterNamespace); err != nil {
-			return xerrors.Errorf("failed to ensure namespace %s in member cluster %s: %w", f.MemberClusterNamespace, clusterName, err)
-		}
-		if f.CentralClusterNamespace != f.MemberClusterNamespace {
-			if err := ensureNamespace(ctx, clientSets[clusterName], f.CentralClusterNamespace); err != nil {
-				return xerrors.Errorf("failed to ensure namespace %s in member cluster %s: %w", f.CentralClusterNamespace, clusterName, err)
+	return forEachCluster(ctx, allClusters(f), f.Parallelism, func(ctx context.Context, clusterName string) error {
+		// the member namespaces are only created in member clusters
+		for _, namespace := range f.serviceAccountNamespaces(clusterName) {
+			if err := ensureNamespace(ctx, clientSets[clusterName], f, namespace); err != nil {
+				return xerrors.Errorf("failed to ensure namespace %s in cluster %s: %w", namespace, clusterName, err)
 			}
 		}
-	}
-	if err := ensureNamespace(ctx, clientSets[f.CentralCluster], f.CentralClusterNamespace); err != nil {
-		return xerrors.Errorf("failed to ensure namespace %s in central cluster %s: %w", f.CentralClusterNamespace, f.CentralCluster, err)
-	}
-	return nil
+		return nil
+	})
 }
 
 // EnsureMultiClusterResources copies the ServiceAccount Secret tokens from the specified
@@ -287,19 +399,32 @@ func EnsureMultiClusterResources(ctx context.Context, flags Flags, clientMap map
 		}
 	}
 
+	if flags.AdoptLegacyObjects {
+		if err := adoptAllLegacyObjects(ctx, clientMap, flags); err != nil {
+			return xerrors.Errorf("failed adopting resources created by older versions: %w", err)
+		}
+	}
+
 	if err := ensureAllClusterNamespacesExist(ctx, clientMap, flags); err != nil {
 		return xerrors.Errorf("failed ensuring namespaces: %w", err)
 	}
-	fmt.Println("Ensured namespaces exist in all clusters.")
+	logger.Info("Ensured namespaces exist in all clusters")
 
 	if err := createOperatorServiceAccountsAndRoles(ctx, clientMap, flags); err != nil {
 		return xerrors.Errorf("failed creating service accounts and roles in all clusters: %w", err)
 	}
-	fmt.Println("Ensured ServiceAccounts and Roles.")
+	logger.Info("Ensured ServiceAccounts and Roles")
+
+	err := forEachCluster(ctx, allClusters(flags), flags.Parallelism, func(ctx context.Context, cluster string) error {
+		return replaceLegacyClusterObjects(ctx, clientMap[cluster], flags, cluster)
+	})
+	if err != nil {
+		return xerrors.Errorf("failed replacing cluster roles created by older versions: %w", err)
+	}
 
-	secrets, err := getAllMemberClusterServiceAccountSecretTokens(ctx, clientMap, flags)
+	secrets, err := getMemberClusterCredentials(ctx, clientMap, flags)
 	if err != nil {
-		return xerrors.Errorf("failed to get service account secret tokens: %w", err)
+		return err
 	}
 
 	if len(secrets) != len(flags.MemberClusters) {
@@ -311,6 +436,12 @@ func EnsureMultiClusterResources(ctx context.Context, flags Flags, clientMap map
 		return xerrors.Errorf("failed to create kube config from service account tokens: %w", err)
 	}
 
+	if flags.CheckKubeConfig && !flags.DryRun {
+		if err := checkKubeConfigConnections(ctx, kubeConfig, flags.MemberClusters, flags, NewKubeClientForConfig); err != nil {
+			return err
+		}
+	}
+
 	kubeConfigBytes, err := yaml.Marshal(kubeConfig)
 	if err != nil {
 		return xerrors.Errorf("failed to marshal kubeconfig: %w", err)
@@ -329,32 +460,61 @@ func EnsureMultiClusterResources(ctx context.Context, flags Flags, clientMap map
 		if err := setupDatabaseRoles(ctx, clientMap, flags); err != nil {
 			return xerrors.Errorf("failed setting up database roles: %w", err)
 		}
-		fmt.Println("Ensured database Roles in member clusters.")
+		logger.Info("Ensured database Roles in member clusters")
 	} else if flags.InstallDatabaseRoles {
 		if err := installDatabaseRoles(ctx, clientMap, flags); err != nil {
 			return xerrors.Errorf("failed installing database roles: %w", err)
 		}
-		fmt.Println("Ensured database Roles in member clusters.")
+		logger.Info("Ensured database Roles in member clusters")
 	}
 
 	return nil
 }
 
+// getMemberClusterCredentials returns the credentials of the operator in every member cluster as Secrets holding the
+// CA of the cluster and either a token or a client certificate.
+func getMemberClusterCredentials(ctx context.Context, clientMap map[string]KubeClient, flags Flags) (map[string]corev1.Secret, error) {
+	var secrets map[string]corev1.Secret
+	var err error
+	if flags.ClientCertificateAuth {
+		secrets, err = requestAllMemberClusterClientCertificates(ctx, clientMap, flags)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to request client certificates: %w", err)
+		}
+	} else if flags.TokenExpiry > 0 {
+		var expiries TokenExpiries
+		secrets, expiries, err = requestAllMemberClusterServiceAccountTokens(ctx, clientMap, flags)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to request service account tokens: %w", err)
+		}
+		for _, cluster := range flags.MemberClusters {
+			logger.Info("Requested ServiceAccount token", "cluster", cluster, "expiresAt", expiries[cluster].Format(time.RFC3339))
+		}
+	} else {
+		secrets, err = getAllMemberClusterServiceAccountSecretTokens(ctx, clientMap, flags)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to get service account secret tokens: %w", err)
+		}
+	}
+	return secrets, nil
+}
+
 // createKubeConfigSecret creates the secret containing the KubeConfig file made from the various
 // service account tokens in the member clusters.
 func createKubeConfigSecret(ctx context.Context, centralClusterClient kubernetes.Interface, kubeConfigBytes []byte, flags Flags) error {
 	kubeConfigSecret := corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      KubeConfigSecretName,
-			Namespace: flags.CentralClusterNamespace,
-			Labels:    multiClusterLabels(),
+			Name:        KubeConfigSecretName,
+			Namespace:   flags.CentralClusterNamespace,
+			Labels:      multiClusterLabels(flags),
+			Annotations: multiClusterAnnotations(flags),
 		},
 		Data: map[string][]byte{
 			KubeConfigSecretKey: kubeConfigBytes,
 		},
 	}
 
-	fmt.Printf("Creating KubeConfig secret %s/%s in cluster %s\n", flags.CentralClusterNamespace, kubeConfigSecret.Name, flags.CentralCluster)
+	logger.Info("Creating KubeConfig secret", "cluster", flags.CentralCluster, "namespace", flags.CentralClusterNamespace, "name", kubeConfigSecret.Name)
 	_, err := centralClusterClient.CoreV1().Secrets(flags.CentralClusterNamespace).Create(ctx, &kubeConfigSecret, metav1.CreateOptions{})
 
 	if !errors.IsAlreadyExists(err) && err != nil {
@@ -362,7 +522,17 @@ func createKubeConfigSecret(ctx context.Context, centralClusterClient kubernetes
 	}
 
 	if errors.IsAlreadyExists(err) {
-		_, err = centralClusterClient.CoreV1().Secrets(flags.CentralClusterNamespace).Update(ctx, &kubeConfigSecret, metav1.UpdateOptions{})
+		secrets := centralClusterClient.CoreV1().Secrets(flags.CentralClusterNamespace)
+		err = retryOnConflict(func() error {
+			existing, err := secrets.Get(ctx, kubeConfigSecret.Name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			keepCreatedAt(&kubeConfigSecret, existing)
+			kubeConfigSecret.ResourceVersion = existing.ResourceVersion
+			_, err = secrets.Update(ctx, &kubeConfigSecret, metav1.UpdateOptions{})
+			return err
+		})
 		if err != nil {
 			return xerrors.Errorf("failed updating existing secret: %w", err)
 		}
@@ -386,20 +556,21 @@ func getCentralRules() []rbacv1.PolicyRule {
 	}
 }
 
-func buildCentralEntityRole(namespace string) rbacv1.Role {
-	rules := append(getCentralRules(), getMemberRules()...)
+func buildCentralEntityRole(f Flags, namespace string) rbacv1.Role {
+	rules := append(f.centralRules(), f.memberRules()...)
 	return rbacv1.Role{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "mongodb-enterprise-operator-multi-role",
-			Namespace: namespace,
-			Labels:    multiClusterLabels(),
+			Name:        "mongodb-enterprise-operator-multi-role",
+			Namespace:   namespace,
+			Labels:      multiClusterLabels(f),
+			Annotations: multiClusterAnnotations(f),
 		},
 		Rules: rules,
 	}
 }
 
-func buildCentralEntityClusterRole() rbacv1.ClusterRole {
-	rules := append(getCentralRules(), getMemberRules()...)
+func buildCentralEntityClusterRole(f Flags) rbacv1.ClusterRole {
+	rules := append(f.centralRules(), f.memberRules()...)
 	rules = append(rules, rbacv1.PolicyRule{
 		Verbs:     []string{"list", "watch"},
 		Resources: []string{"namespaces"},
@@ -408,8 +579,9 @@ func buildCentralEntityClusterRole() rbacv1.ClusterRole {
 
 	return rbacv1.ClusterRole{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:   "mongodb-enterprise-operator-multi-cluster-role",
-			Labels: multiClusterLabels(),
+			Name:        f.clusterScopedName("mongodb-enterprise-operator-multi-cluster-role"),
+			Labels:      multiClusterLabels(f),
+			Annotations: multiClusterAnnotations(f),
 		},
 		Rules: rules,
 	}
@@ -440,26 +612,27 @@ func getMemberRules() []rbacv1.PolicyRule {
 	}
 }
 
-func buildMemberEntityRole(namespace string) rbacv1.Role {
+func buildMemberEntityRole(f Flags, namespace string) rbacv1.Role {
 	return rbacv1.Role{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "mongodb-enterprise-operator-multi-role",
-			Namespace: namespace,
-			Labels:    multiClusterLabels(),
+			Name:        "mongodb-enterprise-operator-multi-role",
+			Namespace:   namespace,
+			Labels:      multiClusterLabels(f),
+			Annotations: multiClusterAnnotations(f),
 		},
-		Rules: getMemberRules(),
+		Rules: f.memberRules(),
 	}
 }
 
-func buildMemberEntityClusterRole() rbacv1.ClusterRole {
-	rules := append(getMemberRules(), rbacv1.PolicyRule{
+func buildMemberEntityClusterRole(f Flags) rbacv1.ClusterRole {
+	rules := append(f.memberRules(), rbacv1.PolicyRule{
 		Verbs:     []string{"list", "watch"},
 		Resources: []string{"namespaces"},
 		APIGroups: []string{""},
 	})
 
 	rules = append(rules, rbacv1.PolicyRule{
-		Verbs: []string{"get"},
+		Verbs:     []string{"get"},
 		Resources: []string{"nodes"},
 		APIGroups: []string{""},
 	})
@@ -476,17 +649,18 @@ func buildMemberEntityClusterRole() rbacv1.ClusterRole {
 
 	return rbacv1.ClusterRole{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:   "mongodb-enterprise-operator-multi-cluster-role",
-			Labels: multiClusterLabels(),
+			Name:        f.clusterScopedName("mongodb-enterprise-operator-multi-cluster-role"),
+			Labels:      multiClusterLabels(f),
+			Annotations: multiClusterAnnotations(f),
 		},
 		Rules: rules,
 	}
 }
 
-func buildClusterRoleTelemetry() rbacv1.ClusterRole {
+func getTelemetryRules() []rbacv1.PolicyRule {
 	var rules []rbacv1.PolicyRule
 	rules = append(rules, rbacv1.PolicyRule{
-		Verbs: []string{"list"},
+		Verbs:     []string{"list"},
 		Resources: []string{"nodes"},
 		APIGroups: []string{""},
 	})
@@ -500,31 +674,32 @@ func buildClusterRoleTelemetry() rbacv1.ClusterRole {
 		Verbs:           []string{"get"},
 		NonResourceURLs: []string{"/version"},
 	})
+	return rules
+}
+
+func buildClusterRoleTelemetry(f Flags) rbacv1.ClusterRole {
+	rules := f.telemetryRules()
 
 	return rbacv1.ClusterRole{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:   "mongodb-enterprise-operator-multi-cluster-role-telemetry",
-			Labels: multiClusterLabels(),
+			Name:        f.clusterScopedName("mongodb-enterprise-operator-multi-cluster-role-telemetry"),
+			Labels:      multiClusterLabels(f),
+			Annotations: multiClusterAnnotations(f),
 		},
 		Rules: rules,
 	}
 }
 
-// buildRoleBinding creates the RoleBinding which binds the Role to the given ServiceAccount.
-func buildRoleBinding(role rbacv1.Role, serviceAccount string, serviceAccountNamespace string) rbacv1.RoleBinding {
+// buildRoleBinding creates the RoleBinding which binds the Role to the given subjects.
+func buildRoleBinding(f Flags, role rbacv1.Role, subjects []rbacv1.Subject) rbacv1.RoleBinding {
 	return rbacv1.RoleBinding{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "mongodb-enterprise-operator-multi-role-binding",
-			Labels:    multiClusterLabels(),
-			Namespace: role.Namespace,
-		},
-		Subjects: []rbacv1.Subject{
-			{
-				Kind:      "ServiceAccount",
-				Name:      serviceAccount,
-				Namespace: serviceAccountNamespace,
-			},
+			Name:        "mongodb-enterprise-operator-multi-role-binding",
+			Labels:      multiClusterLabels(f),
+			Annotations: multiClusterAnnotations(f),
+			Namespace:   role.Namespace,
 		},
+		Subjects: subjects,
 		RoleRef: rbacv1.RoleRef{
 			Kind:     "Role",
 			Name:     role.Name,
@@ -533,20 +708,15 @@ func buildRoleBinding(role rbacv1.Role, serviceAccount string, serviceAccountNam
 	}
 }
 
-// buildClusterRoleBinding creates the ClusterRoleBinding which binds the ClusterRole to the given ServiceAccount.
-func buildClusterRoleBinding(clusterRole rbacv1.ClusterRole, serviceAccountName, serviceAccountNamespace, clusterRoleBindingName string) rbacv1.ClusterRoleBinding {
+// buildClusterRoleBinding creates the ClusterRoleBinding which binds the ClusterRole to the given subjects.
+func buildClusterRoleBinding(f Flags, clusterRole rbacv1.ClusterRole, subjects []rbacv1.Subject, clusterRoleBindingName string) rbacv1.ClusterRoleBinding {
 	return rbacv1.ClusterRoleBinding{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: clusterRoleBindingName,
-			Labels: multiClusterLabels(),
-		},
-		Subjects: []rbacv1.Subject{
-			{
-				Kind:      "ServiceAccount",
-				Name:      serviceAccountName,
-				Namespace: serviceAccountNamespace,
-			},
+			Name:        clusterRoleBindingName,
+			Labels:      multiClusterLabels(f),
+			Annotations: multiClusterAnnotations(f),
 		},
+		Subjects: subjects,
 		RoleRef: rbacv1.RoleRef{
 			Kind:     "ClusterRole",
 			Name:     clusterRole.Name,
@@ -556,51 +726,36 @@ func buildClusterRoleBinding(clusterRole rbacv1.ClusterRole, serviceAccountName,
 }
 
 // createRoles creates the ServiceAccount and Roles, RoleBindings, ClusterRoles and ClusterRoleBindings required.
-func createRoles(ctx context.Context, c KubeClient, serviceAccountName, serviceAccountNamespace, namespace string, clusterScoped, telemetryClusterRoles bool, clusterType clusterType) error {
+func createRoles(ctx context.Context, c KubeClient, f Flags, subjects []rbacv1.Subject, namespace string, clusterType clusterType) error {
 	var err error
 
-	if telemetryClusterRoles {
-		clusterRoleTelemetry := buildClusterRoleTelemetry()
-		_, err = c.RbacV1().ClusterRoles().Create(ctx, &clusterRoleTelemetry, metav1.CreateOptions{})
-		if !errors.IsAlreadyExists(err) && err != nil {
-			return xerrors.Errorf("error creating cluster role: %w", err)
+	if f.CreateTelemetryClusterRoles {
+		clusterRoleTelemetry := buildClusterRoleTelemetry(f)
+		if _, err = applyObject(ctx, c.RbacV1().ClusterRoles(), &clusterRoleTelemetry); err != nil {
+			return xerrors.Errorf("error applying cluster role: %w", err)
 		}
-		fmt.Printf("created clusterrole: %s\n", clusterRoleTelemetry.Name)
-		if err = createClusterRoleBinding(ctx, c, serviceAccountName, serviceAccountNamespace, "mongodb-enterprise-operator-multi-telemetry-cluster-role-binding", clusterRoleTelemetry); err != nil {
+		logger.Debug("Applied ClusterRole", "name", clusterRoleTelemetry.Name)
+		if err = createClusterRoleBinding(ctx, c, f, subjects, f.clusterScopedName("mongodb-enterprise-operator-multi-telemetry-cluster-role-binding"), clusterRoleTelemetry); err != nil {
 			return err
 		}
 
 	}
 
-	if !clusterScoped {
+	if !f.ClusterScoped {
 		var role rbacv1.Role
 		if clusterType == clusterTypeCentral {
-			role = buildCentralEntityRole(namespace)
+			role = buildCentralEntityRole(f, namespace)
 		} else {
-			role = buildMemberEntityRole(namespace)
+			role = buildMemberEntityRole(f, namespace)
 		}
 
-		_, err = c.RbacV1().Roles(namespace).Create(ctx, &role, metav1.CreateOptions{})
-		if !errors.IsAlreadyExists(err) && err != nil {
-			if errors.IsAlreadyExists(err) {
-				if _, err := c.RbacV1().Roles(namespace).Update(ctx, &role, metav1.UpdateOptions{}); err != nil {
-					return xerrors.Errorf("error updating role: %w", err)
-				}
-			} else {
-				return xerrors.Errorf("error creating role: %w", err)
-			}
+		if _, err = applyObject(ctx, c.RbacV1().Roles(namespace), &role); err != nil {
+			return xerrors.Errorf("error applying role: %w", err)
 		}
 
-		roleBinding := buildRoleBinding(role, serviceAccountName, serviceAccountNamespace)
-		_, err = c.RbacV1().RoleBindings(namespace).Create(ctx, &roleBinding, metav1.CreateOptions{})
-		if err != nil {
-			if errors.IsAlreadyExists(err) {
-				if _, err := c.RbacV1().RoleBindings(namespace).Update(ctx, &roleBinding, metav1.UpdateOptions{}); err != nil {
-					return xerrors.Errorf("error updating role binding: %w", err)
-				}
-			} else {
-				return xerrors.Errorf("error creating role binding: %w", err)
-			}
+		roleBinding := buildRoleBinding(f, role, subjects)
+		if _, err = applyObject(ctx, c.RbacV1().RoleBindings(namespace), &roleBinding); err != nil {
+			return xerrors.Errorf("error applying role binding: %w", err)
 		}
 
 		return nil
@@ -608,89 +763,101 @@ func createRoles(ctx context.Context, c KubeClient, serviceAccountName, serviceA
 
 	var clusterRole rbacv1.ClusterRole
 	if clusterType == clusterTypeCentral {
-		clusterRole = buildCentralEntityClusterRole()
+		clusterRole = buildCentralEntityClusterRole(f)
 	} else {
-		clusterRole = buildMemberEntityClusterRole()
+		clusterRole = buildMemberEntityClusterRole(f)
 	}
 
-	_, err = c.RbacV1().ClusterRoles().Create(ctx, &clusterRole, metav1.CreateOptions{})
-	if !errors.IsAlreadyExists(err) && err != nil {
-		return xerrors.Errorf("error creating cluster role: %w", err)
+	if _, err = applyObject(ctx, c.RbacV1().ClusterRoles(), &clusterRole); err != nil {
+		return xerrors.Errorf("error applying cluster role: %w", err)
 	}
-	fmt.Printf("created clusterrole: %s\n", clusterRole.Name)
+	logger.Debug("Applied ClusterRole", "name", clusterRole.Name)
 
-	if err = createClusterRoleBinding(ctx, c, serviceAccountName, serviceAccountNamespace, "mongodb-enterprise-operator-multi-cluster-role-binding", clusterRole); err != nil {
+	if err = createClusterRoleBinding(ctx, c, f, subjects, f.clusterScopedName("mongodb-enterprise-operator-multi-cluster-role-binding"), clusterRole); err != nil {
 		return err
 	}
 	return nil
 }
 
-func createClusterRoleBinding(ctx context.Context, c KubeClient, serviceAccountName string, serviceAccountNamespace string, clusterRoleBindingName string, clusterRole rbacv1.ClusterRole) error {
-	clusterRoleBinding := buildClusterRoleBinding(clusterRole, serviceAccountName, serviceAccountNamespace, clusterRoleBindingName)
-	_, err := c.RbacV1().ClusterRoleBindings().Create(ctx, &clusterRoleBinding, metav1.CreateOptions{})
-	if !errors.IsAlreadyExists(err) && err != nil {
-		return xerrors.Errorf("error creating cluster role binding: %w", err)
+func createClusterRoleBinding(ctx context.Context, c KubeClient, f Flags, subjects []rbacv1.Subject, clusterRoleBindingName string, clusterRole rbacv1.ClusterRole) error {
+	clusterRoleBinding := buildClusterRoleBinding(f, clusterRole, subjects, clusterRoleBindingName)
+	if _, err := applyObject(ctx, c.RbacV1().ClusterRoleBindings(), &clusterRoleBinding); err != nil {
+		return xerrors.Errorf("error applying cluster role binding: %w", err)
 	}
-	fmt.Printf("created clusterrolebinding: %s\n", clusterRoleBinding.Name)
+	logger.Debug("Applied ClusterRoleBinding", "name", clusterRoleBinding.Name)
 	return nil
 }
 
 // createOperatorServiceAccountsAndRoles creates the required ServiceAccounts in all member clusters.
 func createOperatorServiceAccountsAndRoles(ctx context.Context, clientMap map[string]KubeClient, f Flags) error {
-	fmt.Printf("creating central cluster roles in cluster: %s\n", f.CentralCluster)
-	centralClusterClient := clientMap[f.CentralCluster]
-	_, err := createServiceAccount(ctx, centralClusterClient, f.ServiceAccount, f.CentralClusterNamespace, f.ImagePullSecrets)
+	return forEachCluster(ctx, allClusters(f), f.Parallelism, func(ctx context.Context, cluster string) error {
+		if cluster == f.CentralCluster {
+			return createCentralClusterServiceAccountAndRoles(ctx, clientMap[cluster], f)
+		}
+		return createMemberClusterServiceAccountAndRoles(ctx, clientMap[cluster], cluster, f)
+	})
+}
+
+// createCentralClusterServiceAccountAndRoles creates the operator's ServiceAccount and Roles in the central cluster.
+func createCentralClusterServiceAccountAndRoles(ctx context.Context, centralClusterClient KubeClient, f Flags) error {
+	logger.Info("Creating central cluster roles", "cluster", f.CentralCluster)
+	if err := ensureImagePullSecret(ctx, centralClusterClient, f, f.CentralCluster); err != nil {
+		return err
+	}
+	_, err := createServiceAccount(ctx, centralClusterClient, f, f.ServiceAccount, f.CentralClusterNamespace)
 	if err != nil {
 		return xerrors.Errorf("error creating service account: %w", err)
 	}
-	if f.CreateServiceAccountSecrets {
-		if err := createServiceAccountTokenSecret(ctx, centralClusterClient, f.CentralClusterNamespace, f.ServiceAccount); err != nil {
+	if f.createsServiceAccountTokenSecrets() {
+		if err := createServiceAccountTokenSecret(ctx, centralClusterClient, f, f.CentralClusterNamespace, f.ServiceAccount); err != nil {
 			return err
 		}
 	}
 
-	if err := createRoles(ctx, centralClusterClient, f.ServiceAccount, f.CentralClusterNamespace, f.CentralClusterNamespace, f.ClusterScoped, f.CreateTelemetryClusterRoles, clusterTypeCentral); err != nil {
+	if err := createRoles(ctx, centralClusterClient, f, operatorSubjects(f, f.CentralCluster), f.CentralClusterNamespace, clusterTypeCentral); err != nil {
 		return err
 	}
 
-	// in case the operator namespace (CentralClusterNamespace) is different from member cluster namespace we need
-	// to provide roles and role binding to the operator's SA in member namespace
-	if f.CentralClusterNamespace != f.MemberClusterNamespace {
-		if err := createRoles(ctx, centralClusterClient, f.ServiceAccount, f.CentralClusterNamespace, f.MemberClusterNamespace, f.ClusterScoped, f.CreateTelemetryClusterRoles, clusterTypeCentral); err != nil {
-			return err
-		}
-	}
-
-	for _, memberCluster := range f.MemberClusters {
-		if memberCluster == f.CentralCluster {
-			// we've already done that for central cluster
+	// in case the operator namespace (CentralClusterNamespace) is different from the member cluster namespaces we
+	// need to provide roles and role bindings to the operator's SA in each member namespace
+	for _, namespace := range f.memberNamespaces() {
+		if namespace == f.CentralClusterNamespace {
 			continue
 		}
-		fmt.Printf("creating member roles in cluster: %s\n", memberCluster)
-		memberClusterClient := clientMap[memberCluster]
-		_, err := createServiceAccount(ctx, memberClusterClient, f.ServiceAccount, f.CentralClusterNamespace, f.ImagePullSecrets)
-		if err != nil {
-			return xerrors.Errorf("error creating service account: %w", err)
+		if err := createRoles(ctx, centralClusterClient, f, operatorSubjects(f, f.CentralCluster), namespace, clusterTypeCentral); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		if f.CreateServiceAccountSecrets {
-			if err := createServiceAccountTokenSecret(ctx, memberClusterClient, f.CentralClusterNamespace, f.ServiceAccount); err != nil {
-				return err
-			}
-		}
+// createMemberClusterServiceAccountAndRoles creates the operator's ServiceAccount and Roles in a member cluster.
+func createMemberClusterServiceAccountAndRoles(ctx context.Context, memberClusterClient KubeClient, memberCluster string, f Flags) error {
+	logger.Info("Creating member roles", "cluster", memberCluster)
+	if err := ensureImagePullSecret(ctx, memberClusterClient, f, memberCluster); err != nil {
+		return err
+	}
+	serviceAccountNamespace, serviceAccount := f.serviceAccountFor(memberCluster)
+	_, err := createServiceAccount(ctx, memberClusterClient, f, serviceAccount, serviceAccountNamespace)
+	if err != nil {
+		return xerrors.Errorf("error creating service account: %w", err)
+	}
 
-		if err := createRoles(ctx, memberClusterClient, f.ServiceAccount, f.CentralClusterNamespace, f.MemberClusterNamespace, f.ClusterScoped, f.CreateTelemetryClusterRoles, clusterTypeMember); err != nil {
+	if f.createsServiceAccountTokenSecrets() {
+		if err := createServiceAccountTokenSecret(ctx, memberClusterClient, f, serviceAccountNamespace, serviceAccount); err != nil {
 			return err
 		}
-		if err := createRoles(ctx, memberClusterClient, f.ServiceAccount, f.CentralClusterNamespace, f.CentralClusterNamespace, f.ClusterScoped, f.CreateTelemetryClusterRoles, clusterTypeMember); err != nil {
+	}
+
+	for _, namespace := range f.clusterNamespaces(memberCluster) {
+		if err := createRoles(ctx, memberClusterClient, f, operatorSubjects(f, memberCluster), namespace, clusterTypeMember); err != nil {
 			return err
 		}
 	}
-
 	return nil
 }
 
-func createServiceAccountTokenSecret(ctx context.Context, c kubernetes.Interface, namespace string, serviceAccountName string) error {
+func createServiceAccountTokenSecret(ctx context.Context, c kubernetes.Interface, f Flags, namespace string, serviceAccountName string) error {
 	secret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      fmt.Sprintf("%s-token-secret", serviceAccountName),
@@ -701,10 +868,10 @@ func createServiceAccountTokenSecret(ctx context.Context, c kubernetes.Interface
 		},
 		Type: corev1.SecretTypeServiceAccountToken,
 	}
+	setOwnership(secret, f)
 
-	_, err := c.CoreV1().Secrets(namespace).Create(ctx, secret, metav1.CreateOptions{})
-	if !errors.IsAlreadyExists(err) && err != nil {
-		return xerrors.Errorf("cannot create secret %+v: %w", *secret, err)
+	if _, err := applyObject(ctx, c.CoreV1().Secrets(namespace), secret); err != nil {
+		return xerrors.Errorf("cannot apply secret %s/%s: %w", namespace, secret.Name, err)
 	}
 
 	return nil
@@ -719,14 +886,29 @@ func createKubeConfigFromServiceAccountTokens(serviceAccountTokens map[string]co
 
 	for i, clusterName := range flags.MemberClusters {
 		tokenSecret := serviceAccountTokens[clusterName]
-		ca, ok := tokenSecret.Data["ca.crt"]
-		if !ok {
-			return KubeConfigFile{}, xerrors.Errorf("key 'ca.crt' missing from token secret %s", tokenSecret.Name)
+		connection := flags.connectionFor(clusterName)
+		ca := connection.CertificateAuthorityData
+		if len(ca) == 0 {
+			var ok bool
+			if ca, ok = tokenSecret.Data["ca.crt"]; !ok {
+				return KubeConfigFile{}, xerrors.Errorf("key 'ca.crt' missing from token secret %s", tokenSecret.Name)
+			}
 		}
 
-		token, ok := tokenSecret.Data["token"]
-		if !ok {
-			return KubeConfigFile{}, xerrors.Errorf("key 'token' missing from token secret %s", tokenSecret.Name)
+		if IsLoopbackApiServer(flags.MemberClusterApiServerUrls[i]) {
+			Warnf("the api server %s of cluster %s is a loopback address the operator can't reach, set it with --member-clusters-api-servers or find one with --api-server-discovery", flags.MemberClusterApiServerUrls[i], clusterName)
+		}
+
+		user := KubeConfigUser{}
+		if cert, ok := tokenSecret.Data[corev1.TLSCertKey]; ok {
+			user.ClientCertificateData = cert
+			user.ClientKeyData = tokenSecret.Data[corev1.TLSPrivateKeyKey]
+		} else {
+			token, ok := tokenSecret.Data["token"]
+			if !ok {
+				return KubeConfigFile{}, xerrors.Errorf("key 'token' missing from token secret %s", tokenSecret.Name)
+			}
+			user.Token = string(token)
 		}
 
 		config.Clusters = append(config.Clusters, KubeConfigClusterItem{
@@ -734,11 +916,15 @@ func createKubeConfigFromServiceAccountTokens(serviceAccountTokens map[string]co
 			Cluster: KubeConfigCluster{
 				CertificateAuthorityData: ca,
 				Server:                   flags.MemberClusterApiServerUrls[i],
+				TLSServerName:            connection.TLSServerName,
+				ProxyURL:                 connection.ProxyURL,
+				DisableCompression:       connection.DisableCompression,
 			},
 		})
 
-		ns := flags.MemberClusterNamespace
-		if flags.ClusterScoped {
+		// the context has no default namespace when the operator watches more than one namespace
+		ns := flags.memberNamespaceFor(clusterName)
+		if flags.ClusterScoped || flags.watchesMultipleNamespaces() {
 			ns = ""
 		}
 
@@ -753,9 +939,7 @@ func createKubeConfigFromServiceAccountTokens(serviceAccountTokens map[string]co
 
 		config.Users = append(config.Users, KubeConfigUserItem{
 			Name: clusterName,
-			User: KubeConfigUser{
-				Token: string(token),
-			},
+			User: user,
 		})
 	}
 	return *config, nil
@@ -765,13 +949,21 @@ func createKubeConfigFromServiceAccountTokens(serviceAccountTokens map[string]co
 // copied in the central cluster for the operator to use.
 func getAllMemberClusterServiceAccountSecretTokens(ctx context.Context, clientSetMap map[string]KubeClient, flags Flags) (map[string]corev1.Secret, error) {
 	allSecrets := map[string]corev1.Secret{}
+	mu := sync.Mutex{}
 
-	for _, cluster := range flags.MemberClusters {
+	err := forEachCluster(ctx, flags.MemberClusters, flags.Parallelism, func(ctx context.Context, cluster string) error {
 		c := clientSetMap[cluster]
-		serviceAccountNamespace := flags.CentralClusterNamespace
-		sa, err := getServiceAccount(ctx, c, serviceAccountNamespace, flags.ServiceAccount, cluster)
+		serviceAccountNamespace, serviceAccount := flags.serviceAccountFor(cluster)
+		sa, err := getServiceAccount(ctx, c, serviceAccountNamespace, serviceAccount, cluster)
 		if err != nil {
-			return nil, xerrors.Errorf("failed getting service account: %w", err)
+			return xerrors.Errorf("failed getting service account: %w", err)
+		}
+
+		if flags.DryRun {
+			mu.Lock()
+			defer mu.Unlock()
+			allSecrets[cluster] = plannedServiceAccountToken(ctx, c, *sa)
+			return nil
 		}
 
 		// Wait for the token secret to be created and populated with service account token data
@@ -795,14 +987,39 @@ func getAllMemberClusterServiceAccountSecretTokens(ctx context.Context, clientSe
 
 			return true, nil
 		}); err != nil {
-			return nil, xerrors.Errorf("failed getting service account token secret: %w", err)
+			return xerrors.Errorf("failed getting service account token secret: %w", err)
 		}
 
+		mu.Lock()
+		defer mu.Unlock()
 		allSecrets[cluster] = *tokenSecret
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	return allSecrets, nil
 }
 
+// plannedServiceAccountToken returns the existing token secret of the ServiceAccount, or a placeholder if the token
+// hasn't been populated yet. It is used in dry-run mode, where nothing would populate the token.
+func plannedServiceAccountToken(ctx context.Context, c KubeClient, sa corev1.ServiceAccount) corev1.Secret {
+	tokenSecret, err := getServiceAccountToken(ctx, c, sa)
+	if err == nil && len(tokenSecret.Data["ca.crt"]) > 0 && len(tokenSecret.Data["token"]) > 0 {
+		return *tokenSecret
+	}
+	return corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-token-secret", sa.Name),
+			Namespace: sa.Namespace,
+		},
+		Data: map[string][]byte{
+			"ca.crt": []byte("<ca.crt of the service account token>"),
+			"token":  []byte("<service account token>"),
+		},
+	}
+}
+
 func getServiceAccount(ctx context.Context, lister kubernetes.Interface, namespace string, name string, memberClusterName string) (*corev1.ServiceAccount, error) {
 	sa, err := lister.CoreV1().ServiceAccounts(namespace).Get(ctx, name, metav1.GetOptions{})
 	if err != nil {
@@ -827,56 +1044,47 @@ func getServiceAccountToken(ctx context.Context, secretLister KubeClient, sa cor
 }
 
 // copySecret copies a Secret from a source cluster to a target cluster
-func copySecret(ctx context.Context, src, dst KubeClient, namespace, name string) error {
-	secret, err := src.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+func copySecret(ctx context.Context, src, dst KubeClient, srcNamespace, namespace, name string) error {
+	secret, err := src.CoreV1().Secrets(srcNamespace).Get(ctx, name, metav1.GetOptions{})
 	if err != nil {
 		return xerrors.Errorf("failed retrieving secret: %s from source cluster: %w", name, err)
 	}
-	_, err = dst.CoreV1().Secrets(namespace).Create(ctx, &corev1.Secret{
+	_, err = applyObject(ctx, dst.CoreV1().Secrets(namespace), &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      name,
 			Namespace: namespace,
 			Labels:    secret.Labels,
 		},
+		Type: secret.Type,
 		Data: secret.Data,
-	}, metav1.CreateOptions{})
-	if !errors.IsAlreadyExists(err) && err != nil {
-		return err
-	}
-	return nil
+	})
+	return err
 }
 
-func createServiceAccount(ctx context.Context, c KubeClient, serviceAccountName, namespace string, imagePullSecrets string) (corev1.ServiceAccount, error) {
+func createServiceAccount(ctx context.Context, c KubeClient, f Flags, serviceAccountName, namespace string) (corev1.ServiceAccount, error) {
 	sa := corev1.ServiceAccount{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      serviceAccountName,
-			Namespace: namespace,
-			Labels:    multiClusterLabels(),
+			Name:        serviceAccountName,
+			Namespace:   namespace,
+			Labels:      multiClusterLabels(f),
+			Annotations: multiClusterAnnotations(f),
 		},
+		ImagePullSecrets: f.imagePullSecretReferences(),
 	}
 
-	if imagePullSecrets != "" {
-		sa.ImagePullSecrets = []corev1.LocalObjectReference{
-			{Name: "image-registries-secret"},
-		}
-	}
-
-	_, err := c.CoreV1().ServiceAccounts(sa.Namespace).Create(ctx, &sa, metav1.CreateOptions{})
-	if errors.IsAlreadyExists(err) {
-		_, err = c.CoreV1().ServiceAccounts(sa.Namespace).Update(ctx, &sa, metav1.UpdateOptions{})
-	}
-	if err != nil {
-		return corev1.ServiceAccount{}, xerrors.Errorf("error creating/updating service account: %w", err)
+	if _, err := applyObject(ctx, c.CoreV1().ServiceAccounts(sa.Namespace), &sa); err != nil {
+		return corev1.ServiceAccount{}, xerrors.Errorf("error applying service account: %w", err)
 	}
 	return sa, nil
 }
 
-func createDatabaseRole(ctx context.Context, c KubeClient, roleName, namespace string) error {
+func createDatabaseRole(ctx context.Context, c KubeClient, f Flags, roleName, namespace string) error {
 	role := rbacv1.Role{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      roleName,
-			Namespace: namespace,
-			Labels:    multiClusterLabels(),
+			Name:        roleName,
+			Namespace:   namespace,
+			Labels:      multiClusterLabels(f),
+			Annotations: multiClusterAnnotations(f),
 		},
 		Rules: []rbacv1.PolicyRule{
 			{
@@ -893,9 +1101,10 @@ func createDatabaseRole(ctx context.Context, c KubeClient, roleName, namespace s
 	}
 	roleBinding := rbacv1.RoleBinding{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      roleName,
-			Namespace: namespace,
-			Labels:    multiClusterLabels(),
+			Name:        roleName,
+			Namespace:   namespace,
+			Labels:      multiClusterLabels(f),
+			Annotations: multiClusterAnnotations(f),
 		},
 		RoleRef: rbacv1.RoleRef{
 			Kind: "Role",
@@ -908,154 +1117,177 @@ func createDatabaseRole(ctx context.Context, c KubeClient, roleName, namespace s
 			},
 		},
 	}
-	_, err := c.RbacV1().Roles(role.Namespace).Create(ctx, &role, metav1.CreateOptions{})
-	if !errors.IsAlreadyExists(err) && err != nil {
-		return xerrors.Errorf("error creating role: %w", err)
+	if _, err := applyObject(ctx, c.RbacV1().Roles(role.Namespace), &role); err != nil {
+		return xerrors.Errorf("error applying role: %w", err)
 	}
 
-	_, err = c.RbacV1().RoleBindings(roleBinding.Namespace).Create(ctx, &roleBinding, metav1.CreateOptions{})
-	if !errors.IsAlreadyExists(err) && err != nil {
-		return xerrors.Errorf("error creating role binding: %w", err)
+	if _, err := applyObject(ctx, c.RbacV1().RoleBindings(roleBinding.Namespace), &roleBinding); err != nil {
+		return xerrors.Errorf("error applying role binding: %w", err)
 	}
 	return nil
 }
 
 // createDatabaseRoles creates the default ServiceAccounts, Roles and RoleBindings required for running database
-// instances in a member cluster.
-func createDatabaseRoles(ctx context.Context, client KubeClient, f Flags) error {
-	if _, err := createServiceAccount(ctx, client, AppdbServiceAccount, f.MemberClusterNamespace, f.ImagePullSecrets); err != nil {
-		return err
-	}
-	if _, err := createServiceAccount(ctx, client, DatabasePodsServiceAccount, f.MemberClusterNamespace, f.ImagePullSecrets); err != nil {
-		return err
-	}
-	if _, err := createServiceAccount(ctx, client, OpsManagerServiceAccount, f.MemberClusterNamespace, f.ImagePullSecrets); err != nil {
-		return err
-	}
-	if err := createDatabaseRole(ctx, client, AppdbRole, f.MemberClusterNamespace); err != nil {
-		return err
+// instances in every member namespace of a member cluster.
+func createDatabaseRoles(ctx context.Context, client KubeClient, f Flags, cluster string) error {
+	for _, namespace := range f.memberNamespacesFor(cluster) {
+		if _, err := createServiceAccount(ctx, client, f, AppdbServiceAccount, namespace); err != nil {
+			return err
+		}
+		if _, err := createServiceAccount(ctx, client, f, DatabasePodsServiceAccount, namespace); err != nil {
+			return err
+		}
+		if _, err := createServiceAccount(ctx, client, f, OpsManagerServiceAccount, namespace); err != nil {
+			return err
+		}
+		if err := createDatabaseRole(ctx, client, f, AppdbRole, namespace); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
 // copyDatabaseRoles copies the ServiceAccounts, Roles and RoleBindings required for running database instances
 // in a member cluster. This is used for adding new member clusters by copying over the configuration of a healthy
-// source cluster.
-func copyDatabaseRoles(ctx context.Context, src, dst KubeClient, namespace string) error {
-	appdbSA, err := src.CoreV1().ServiceAccounts(namespace).Get(ctx, AppdbServiceAccount, metav1.GetOptions{})
+// source cluster. The objects are copied from srcNamespace in the source cluster to namespace in the destination.
+func copyDatabaseRoles(ctx context.Context, src, dst KubeClient, srcNamespace, namespace string) error {
+	appdbSA, err := src.CoreV1().ServiceAccounts(srcNamespace).Get(ctx, AppdbServiceAccount, metav1.GetOptions{})
 	if err != nil {
 		return xerrors.Errorf("failed retrieving service account %s from source cluster: %w", AppdbServiceAccount, err)
 	}
-	dbpodsSA, err := src.CoreV1().ServiceAccounts(namespace).Get(ctx, DatabasePodsServiceAccount, metav1.GetOptions{})
+	dbpodsSA, err := src.CoreV1().ServiceAccounts(srcNamespace).Get(ctx, DatabasePodsServiceAccount, metav1.GetOptions{})
 	if err != nil {
 		return xerrors.Errorf("failed retrieving service account %s from source cluster: %w", DatabasePodsServiceAccount, err)
 	}
-	opsManagerSA, err := src.CoreV1().ServiceAccounts(namespace).Get(ctx, OpsManagerServiceAccount, metav1.GetOptions{})
+	opsManagerSA, err := src.CoreV1().ServiceAccounts(srcNamespace).Get(ctx, OpsManagerServiceAccount, metav1.GetOptions{})
 	if err != nil {
 		return xerrors.Errorf("failed retrieving service account %s from source cluster: %w", OpsManagerServiceAccount, err)
 	}
-	appdbR, err := src.RbacV1().Roles(namespace).Get(ctx, AppdbRole, metav1.GetOptions{})
+	appdbR, err := src.RbacV1().Roles(srcNamespace).Get(ctx, AppdbRole, metav1.GetOptions{})
 	if err != nil {
 		return xerrors.Errorf("failed retrieving role %s from source cluster: %w", AppdbRole, err)
 	}
-	appdbRB, err := src.RbacV1().RoleBindings(namespace).Get(ctx, AppdbRoleBinding, metav1.GetOptions{})
+	appdbRB, err := src.RbacV1().RoleBindings(srcNamespace).Get(ctx, AppdbRoleBinding, metav1.GetOptions{})
 	if err != nil {
 		return xerrors.Errorf("failed retrieving role binding %s from source cluster: %w", AppdbRoleBinding, err)
 	}
-	if len(appdbSA.ImagePullSecrets) > 0 {
-		if err := copySecret(ctx, src, dst, namespace, appdbSA.ImagePullSecrets[0].Name); err != nil {
-			fmt.Printf("failed creating image pull secret %s: %s\n", appdbSA.ImagePullSecrets[0].Name, err)
-		}
-	}
-	if len(dbpodsSA.ImagePullSecrets) > 0 {
-		if err := copySecret(ctx, src, dst, namespace, dbpodsSA.ImagePullSecrets[0].Name); err != nil {
-			fmt.Printf("failed creating image pull secret %s: %s\n", dbpodsSA.ImagePullSecrets[0].Name, err)
+	var pullSecrets []string
+	for _, sa := range []*corev1.ServiceAccount{appdbSA, dbpodsSA, opsManagerSA} {
+		for _, ref := range sa.ImagePullSecrets {
+			if !Contains(pullSecrets, ref.Name) {
+				pullSecrets = append(pullSecrets, ref.Name)
+			}
 		}
 	}
-	if len(opsManagerSA.ImagePullSecrets) > 0 {
-		if err := copySecret(ctx, src, dst, namespace, opsManagerSA.ImagePullSecrets[0].Name); err != nil {
-			fmt.Printf("failed creating image pull secret %s: %s\n", opsManagerSA.ImagePullSecrets[0].Name, err)
+	for _, name := range pullSecrets {
+		if err := copySecret(ctx, src, dst, srcNamespace, namespace, name); err != nil {
+			logger.Error("Failed creating image pull secret", "namespace", namespace, "name", name, "error", err)
 		}
 	}
-	_, err = dst.CoreV1().ServiceAccounts(namespace).Create(ctx, &corev1.ServiceAccount{
+	_, err = applyObject(ctx, dst.CoreV1().ServiceAccounts(namespace), &corev1.ServiceAccount{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:   appdbSA.Name,
-			Labels: appdbSA.Labels,
+			Name:      appdbSA.Name,
+			Namespace: namespace,
+			Labels:    appdbSA.Labels,
 		},
 		ImagePullSecrets: appdbSA.DeepCopy().ImagePullSecrets,
-	}, metav1.CreateOptions{})
-	if !errors.IsAlreadyExists(err) && err != nil {
-		return xerrors.Errorf("error creating service account: %w", err)
+	})
+	if err != nil {
+		return xerrors.Errorf("error applying service account: %w", err)
 	}
-	_, err = dst.CoreV1().ServiceAccounts(namespace).Create(ctx, &corev1.ServiceAccount{
+	_, err = applyObject(ctx, dst.CoreV1().ServiceAccounts(namespace), &corev1.ServiceAccount{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:   dbpodsSA.Name,
-			Labels: dbpodsSA.Labels,
+			Name:      dbpodsSA.Name,
+			Namespace: namespace,
+			Labels:    dbpodsSA.Labels,
 		},
 		ImagePullSecrets: dbpodsSA.DeepCopy().ImagePullSecrets,
-	}, metav1.CreateOptions{})
-	if !errors.IsAlreadyExists(err) && err != nil {
-		return xerrors.Errorf("error creating service account: %w", err)
+	})
+	if err != nil {
+		return xerrors.Errorf("error applying service account: %w", err)
 	}
-	_, err = dst.CoreV1().ServiceAccounts(namespace).Create(ctx, &corev1.ServiceAccount{
+	_, err = applyObject(ctx, dst.CoreV1().ServiceAccounts(namespace), &corev1.ServiceAccount{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:   opsManagerSA.Name,
-			Labels: opsManagerSA.Labels,
+			Name:      opsManagerSA.Name,
+			Namespace: namespace,
+			Labels:    opsManagerSA.Labels,
 		},
 		ImagePullSecrets: opsManagerSA.DeepCopy().ImagePullSecrets,
-	}, metav1.CreateOptions{})
-	if !errors.IsAlreadyExists(err) && err != nil {
-		return xerrors.Errorf("error creating service account: %w", err)
+	})
+	if err != nil {
+		return xerrors.Errorf("error applying service account: %w", err)
 	}
 
-	_, err = dst.RbacV1().Roles(namespace).Create(ctx, &rbacv1.Role{
+	_, err = applyObject(ctx, dst.RbacV1().Roles(namespace), &rbacv1.Role{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:   appdbR.Name,
-			Labels: appdbR.Labels,
+			Name:      appdbR.Name,
+			Namespace: namespace,
+			Labels:    appdbR.Labels,
 		},
 		Rules: appdbR.DeepCopy().Rules,
-	}, metav1.CreateOptions{})
-	if !errors.IsAlreadyExists(err) && err != nil {
-		return xerrors.Errorf("error creating role: %w", err)
+	})
+	if err != nil {
+		return xerrors.Errorf("error applying role: %w", err)
 	}
-	_, err = dst.RbacV1().RoleBindings(namespace).Create(ctx, &rbacv1.RoleBinding{
+	_, err = applyObject(ctx, dst.RbacV1().RoleBindings(namespace), &rbacv1.RoleBinding{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:   appdbRB.Name,
-			Labels: appdbRB.Labels,
+			Name:      appdbRB.Name,
+			Namespace: namespace,
+			Labels:    appdbRB.Labels,
 		},
-		Subjects: appdbRB.DeepCopy().Subjects,
+		Subjects: copySubjects(appdbRB.Subjects, srcNamespace, namespace),
 		RoleRef:  appdbRB.DeepCopy().RoleRef,
-	}, metav1.CreateOptions{})
-	if !errors.IsAlreadyExists(err) && err != nil {
-		return xerrors.Errorf("error creating role binding: %w", err)
+	})
+	if err != nil {
+		return xerrors.Errorf("error applying role binding: %w", err)
 	}
 
 	return nil
 }
 
-func installDatabaseRoles(ctx context.Context, clientSet map[string]KubeClient, f Flags) error {
-	for _, clusterName := range f.MemberClusters {
-		if err := createDatabaseRoles(ctx, clientSet[clusterName], f); err != nil {
-			return err
+// copySubjects returns a copy of the subjects, with the ServiceAccounts of the source namespace moved to the
+// destination namespace.
+func copySubjects(subjects []rbacv1.Subject, srcNamespace, namespace string) []rbacv1.Subject {
+	copied := make([]rbacv1.Subject, 0, len(subjects))
+	for _, subject := range subjects {
+		if subject.Kind == rbacv1.ServiceAccountKind && subject.Namespace == srcNamespace {
+			subject.Namespace = namespace
 		}
+		copied = append(copied, subject)
 	}
+	return copied
+}
 
-	return nil
+func installDatabaseRoles(ctx context.Context, clientSet map[string]KubeClient, f Flags) error {
+	return forEachCluster(ctx, f.MemberClusters, f.Parallelism, func(ctx context.Context, clusterName string) error {
+		return createDatabaseRoles(ctx, clientSet[clusterName], f, clusterName)
+	})
 }
 
 // setupDatabaseRoles installs the required database roles in the member clusters.
 // The CommonFlags passed to the CLI must contain a healthy source member cluster which will be treated as
 // the source of truth for all the member clusters.
 func setupDatabaseRoles(ctx context.Context, clientSet map[string]KubeClient, f Flags) error {
+	var clusters []string
 	for _, clusterName := range f.MemberClusters {
 		if clusterName != f.SourceCluster {
-			if err := copyDatabaseRoles(ctx, clientSet[f.SourceCluster], clientSet[clusterName], f.MemberClusterNamespace); err != nil {
-				return err
-			}
+			clusters = append(clusters, clusterName)
 		}
 	}
 
-	return nil
+	return forEachCluster(ctx, clusters, f.Parallelism, func(ctx context.Context, clusterName string) error {
+		for i, namespace := range f.memberNamespacesFor(clusterName) {
+			// the main member namespaces can differ between the clusters, the additional ones can't
+			sourceNamespace := namespace
+			if i == 0 {
+				sourceNamespace = f.memberNamespaceFor(f.SourceCluster)
+			}
+			if err := copyDatabaseRoles(ctx, clientSet[f.SourceCluster], clientSet[clusterName], sourceNamespace, namespace); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 // ReplaceClusterMembersConfigMap creates the configmap used by the operator to know which clusters are members of the multi-cluster setup.
@@ -1064,16 +1296,17 @@ func setupDatabaseRoles(ctx context.Context, clientSet map[string]KubeClient, f
 func ReplaceClusterMembersConfigMap(ctx context.Context, centralClusterClient KubeClient, flags Flags) error {
 	members := corev1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      DefaultOperatorConfigMapName,
-			Namespace: flags.CentralClusterNamespace,
-			Labels:    multiClusterLabels(),
+			Name:        DefaultOperatorConfigMapName,
+			Namespace:   flags.CentralClusterNamespace,
+			Labels:      multiClusterLabels(flags),
+			Annotations: multiClusterAnnotations(flags),
 		},
 		Data: map[string]string{},
 	}
 
 	addToSet(flags.MemberClusters, &members)
 
-	fmt.Printf("Creating Member list Configmap %s/%s in cluster %s\n", flags.CentralClusterNamespace, DefaultOperatorConfigMapName, flags.CentralCluster)
+	logger.Info("Creating Member list ConfigMap", "cluster", flags.CentralCluster, "namespace", flags.CentralClusterNamespace, "name", DefaultOperatorConfigMapName)
 	_, err := centralClusterClient.CoreV1().ConfigMaps(flags.CentralClusterNamespace).Create(ctx, &members, metav1.CreateOptions{})
 
 	if err != nil && !errors.IsAlreadyExists(err) {
@@ -1081,7 +1314,18 @@ func ReplaceClusterMembersConfigMap(ctx context.Context, centralClusterClient Ku
 	}
 
 	if errors.IsAlreadyExists(err) {
-		if _, err := centralClusterClient.CoreV1().ConfigMaps(flags.CentralClusterNamespace).Update(ctx, &members, metav1.UpdateOptions{}); err != nil {
+		configMaps := centralClusterClient.CoreV1().ConfigMaps(flags.CentralClusterNamespace)
+		err = retryOnConflict(func() error {
+			existing, err := configMaps.Get(ctx, members.Name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			keepCreatedAt(&members, existing)
+			members.ResourceVersion = existing.ResourceVersion
+			_, err = configMaps.Update(ctx, &members, metav1.UpdateOptions{})
+			return err
+		})
+		if err != nil {
 			return xerrors.Errorf("error creating configmap: %w", err)
 		}
 	}
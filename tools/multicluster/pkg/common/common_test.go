@@ -3,6 +3,7 @@ package common
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"math/rand"
 	"os"
@@ -21,7 +22,12 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	k8stesting "k8s.io/client-go/testing"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
@@ -90,6 +96,7 @@ func testFlags(t *testing.T, cleanup bool) Flags {
 		ClusterScoped:               false,
 		CreateTelemetryClusterRoles: true,
 		OperatorName:                "mongodb-enterprise-operator",
+		InstallationID:              "5f0c2a9e81d34b76",
 		CreateServiceAccountSecrets: true,
 	}
 }
@@ -611,7 +618,7 @@ func assertMemberClusterNamespacesExist(t *testing.T, ctx context.Context, clien
 		assert.NoError(t, err)
 		assert.NotNil(t, ns)
 		assert.Equal(t, flags.MemberClusterNamespace, ns.Name)
-		assert.Equal(t, ns.Labels, multiClusterLabels())
+		assert.Equal(t, ns.Labels, multiClusterLabels(flags))
 	}
 }
 
@@ -622,7 +629,7 @@ func assertCentralClusterNamespacesExist(t *testing.T, ctx context.Context, clie
 	require.NoError(t, err)
 	assert.NotNil(t, ns)
 	assert.Equal(t, flags.CentralClusterNamespace, ns.Name)
-	assert.Equal(t, ns.Labels, multiClusterLabels())
+	assert.Equal(t, ns.Labels, multiClusterLabels(flags))
 }
 
 // assertServiceAccountsAreCorrect asserts the ServiceAccounts are created as expected.
@@ -633,7 +640,7 @@ func assertServiceAccountsExist(t *testing.T, ctx context.Context, clientMap map
 		require.NoError(t, err)
 		assert.NotNil(t, sa)
 		assert.Equal(t, flags.ServiceAccount, sa.Name)
-		assert.Equal(t, sa.Labels, multiClusterLabels())
+		assert.Equal(t, sa.Labels, multiClusterLabels(flags))
 	}
 
 	client := clientMap[flags.CentralCluster]
@@ -641,7 +648,7 @@ func assertServiceAccountsExist(t *testing.T, ctx context.Context, clientMap map
 	require.NoError(t, err)
 	assert.NotNil(t, sa)
 	assert.Equal(t, flags.ServiceAccount, sa.Name)
-	assert.Equal(t, sa.Labels, multiClusterLabels())
+	assert.Equal(t, sa.Labels, multiClusterLabels(flags))
 }
 
 // assertDatabaseRolesExist asserts the DatabaseRoles are created as expected.
@@ -653,25 +660,25 @@ func assertDatabaseRolesExist(t *testing.T, ctx context.Context, clientMap map[s
 		sa, err := client.CoreV1().ServiceAccounts(flags.MemberClusterNamespace).Get(ctx, AppdbServiceAccount, metav1.GetOptions{})
 		require.NoError(t, err)
 		require.NotNil(t, sa)
-		assert.Equal(t, sa.Labels, multiClusterLabels())
+		assert.Equal(t, sa.Labels, multiClusterLabels(flags))
 
 		// database pods service account
 		sa, err = client.CoreV1().ServiceAccounts(flags.MemberClusterNamespace).Get(ctx, DatabasePodsServiceAccount, metav1.GetOptions{})
 		require.NoError(t, err)
 		require.NotNil(t, sa)
-		assert.Equal(t, sa.Labels, multiClusterLabels())
+		assert.Equal(t, sa.Labels, multiClusterLabels(flags))
 
 		// ops manager service account
 		sa, err = client.CoreV1().ServiceAccounts(flags.MemberClusterNamespace).Get(ctx, OpsManagerServiceAccount, metav1.GetOptions{})
 		require.NoError(t, err)
 		require.NotNil(t, sa)
-		assert.Equal(t, sa.Labels, multiClusterLabels())
+		assert.Equal(t, sa.Labels, multiClusterLabels(flags))
 
 		// appdb role
 		r, err := client.RbacV1().Roles(flags.MemberClusterNamespace).Get(ctx, AppdbRole, metav1.GetOptions{})
 		require.NoError(t, err)
 		require.NotNil(t, r)
-		assert.Equal(t, r.Labels, multiClusterLabels())
+		assert.Equal(t, r.Labels, multiClusterLabels(flags))
 		assert.Equal(t, []rbacv1.PolicyRule{
 			{
 				APIGroups: []string{""},
@@ -689,7 +696,7 @@ func assertDatabaseRolesExist(t *testing.T, ctx context.Context, clientMap map[s
 		rb, err := client.RbacV1().RoleBindings(flags.MemberClusterNamespace).Get(ctx, AppdbRoleBinding, metav1.GetOptions{})
 		require.NoError(t, err)
 		require.NotNil(t, r)
-		assert.Equal(t, rb.Labels, multiClusterLabels())
+		assert.Equal(t, rb.Labels, multiClusterLabels(flags))
 		assert.Equal(t, []rbacv1.Subject{
 			{
 				Kind: "ServiceAccount",
@@ -719,14 +726,14 @@ func assertMemberClusterRolesDoNotExist(t *testing.T, ctx context.Context, clien
 func assertClusterRoles(t *testing.T, ctx context.Context, clientMap map[string]KubeClient, flags Flags, clusterScopeShouldExist bool, telemetryShouldExist bool, clusterType clusterType) {
 	var expectedClusterRole rbacv1.ClusterRole
 	if clusterType == clusterTypeCentral {
-		expectedClusterRole = buildCentralEntityClusterRole()
+		expectedClusterRole = buildCentralEntityClusterRole(flags)
 	} else {
-		expectedClusterRole = buildMemberEntityClusterRole()
+		expectedClusterRole = buildMemberEntityClusterRole(flags)
 	}
 	assertClusterRoleMembers(t, ctx, clientMap, flags, clusterScopeShouldExist, expectedClusterRole)
 	assertClusterRoleCentral(t, ctx, clientMap, flags, clusterScopeShouldExist, expectedClusterRole)
 
-	expectedClusterRoleTelemetry := buildClusterRoleTelemetry()
+	expectedClusterRoleTelemetry := buildClusterRoleTelemetry(flags)
 	assertClusterRoleMembers(t, ctx, clientMap, flags, telemetryShouldExist, expectedClusterRoleTelemetry)
 	assertClusterRoleCentral(t, ctx, clientMap, flags, telemetryShouldExist, expectedClusterRoleTelemetry)
 }
@@ -748,6 +755,7 @@ func assertClusterRoleMembers(t *testing.T, ctx context.Context, clientMap map[s
 		if shouldExist {
 			assert.NoError(t, err)
 			assert.NotNil(t, role)
+			keepCreatedAt(&expectedClusterRole, role)
 			assert.Equal(t, expectedClusterRole, *role)
 		} else {
 			assert.Error(t, err)
@@ -769,7 +777,7 @@ func assertMemberRolesDoNotExist(t *testing.T, ctx context.Context, clientMap ma
 // assertMemberRolesAreCorrect should be used to assert the existence of member cluster roles. The boolean
 // shouldExist should be true for roles existing, and false for roles not existing.
 func assertMemberRolesAreCorrect(t *testing.T, ctx context.Context, clientMap map[string]KubeClient, flags Flags, shouldExist bool) {
-	expectedRole := buildMemberEntityRole(flags.MemberClusterNamespace)
+	expectedRole := buildMemberEntityRole(flags, flags.MemberClusterNamespace)
 
 	for _, clusterName := range flags.MemberClusters {
 		client := clientMap[clusterName]
@@ -777,6 +785,7 @@ func assertMemberRolesAreCorrect(t *testing.T, ctx context.Context, clientMap ma
 		if shouldExist {
 			assert.NoError(t, err)
 			assert.NotNil(t, role)
+			keepCreatedAt(&expectedRole, role)
 			assert.Equal(t, expectedRole, *role)
 		} else {
 			assert.Error(t, err)
@@ -801,18 +810,19 @@ func assertCentralRolesAreCorrect(t *testing.T, ctx context.Context, clientMap m
 	client := clientMap[flags.CentralCluster]
 
 	// should never have a cluster role
-	clusterRole := buildCentralEntityClusterRole()
+	clusterRole := buildCentralEntityClusterRole(flags)
 	cr, err := client.RbacV1().ClusterRoles().Get(ctx, clusterRole.Name, metav1.GetOptions{})
 
 	assert.True(t, errors.IsNotFound(err))
 	assert.Nil(t, cr)
 
-	expectedRole := buildCentralEntityRole(flags.CentralClusterNamespace)
+	expectedRole := buildCentralEntityRole(flags, flags.CentralClusterNamespace)
 	role, err := client.RbacV1().Roles(flags.CentralClusterNamespace).Get(ctx, expectedRole.Name, metav1.GetOptions{})
 
 	if shouldExist {
 		assert.NoError(t, err, "should always create a role for central cluster")
 		assert.NotNil(t, role)
+		keepCreatedAt(&expectedRole, role)
 		assert.Equal(t, expectedRole, *role)
 	} else {
 		assert.Error(t, err)
@@ -847,6 +857,7 @@ func getClientResources(ctx context.Context, flags Flags, resourceTypes ...resou
 
 func newFakeClientset(ctx context.Context, clusterName string, resources []runtime.Object) *fake.Clientset {
 	clientset := fake.NewSimpleClientset(resources...)
+	addApplyReactor(clientset)
 	informerFactory := informers.NewSharedInformerFactory(clientset, time.Second)
 	secretInformer := informerFactory.Core().V1().Secrets().Informer()
 	_, err := secretInformer.AddEventHandler(&cache.ResourceEventHandlerFuncs{
@@ -868,6 +879,51 @@ func newFakeClientset(ctx context.Context, clusterName string, resources []runti
 	return clientset
 }
 
+// addApplyReactor handles server-side apply in the fake clientset. Its object tracker only applies patches to
+// existing objects and keeps the apiVersion and kind of the patch, which a real client never returns.
+func addApplyReactor(clientset *fake.Clientset) {
+	clientset.PrependReactor("patch", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patchAction := action.(k8stesting.PatchAction)
+		if patchAction.GetPatchType() != types.ApplyPatchType {
+			return false, nil, nil
+		}
+
+		obj, _, err := scheme.Codecs.UniversalDeserializer().Decode(patchAction.GetPatch(), nil, nil)
+		if err != nil {
+			return true, nil, err
+		}
+		existing, err := clientset.Tracker().Get(action.GetResource(), action.GetNamespace(), patchAction.GetName())
+		if err != nil && !errors.IsNotFound(err) {
+			return true, nil, err
+		}
+		if err == nil {
+			existingJSON, err := json.Marshal(existing)
+			if err != nil {
+				return true, nil, err
+			}
+			merged, err := strategicpatch.StrategicMergePatch(existingJSON, patchAction.GetPatch(), obj)
+			if err != nil {
+				return true, nil, err
+			}
+			if err := json.Unmarshal(merged, obj); err != nil {
+				return true, nil, err
+			}
+		}
+		obj.GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{})
+		obj.(metav1.Object).SetNamespace(action.GetNamespace())
+
+		if existing != nil {
+			err = clientset.Tracker().Update(action.GetResource(), obj, action.GetNamespace())
+		} else {
+			err = clientset.Tracker().Create(action.GetResource(), obj, action.GetNamespace())
+		}
+		if err != nil {
+			return true, nil, err
+		}
+		return true, obj, nil
+	})
+}
+
 func onSecretCreate(s *corev1.Secret, clusterName string, clientset *fake.Clientset, ctx context.Context) {
 	// simulate populating the service account secret token data into the secret
 	// it's done automatically by k8s
@@ -879,7 +935,8 @@ func onSecretCreate(s *corev1.Secret, clusterName string, clientset *fake.Client
 		}
 		s.Data["ca.crt"] = []byte(fmt.Sprintf("ca.crt: %s", clusterName))
 		s.Data["token"] = []byte(fmt.Sprintf("token: %s", clusterName))
-		if _, err := clientset.CoreV1().Secrets(s.Namespace).Update(ctx, s, metav1.UpdateOptions{}); err != nil {
+		// the secret may have been deleted in the meantime by a test cleaning up
+		if _, err := clientset.CoreV1().Secrets(s.Namespace).Update(ctx, s, metav1.UpdateOptions{}); err != nil && !errors.IsNotFound(err) {
 			panic(err)
 		}
 	}
@@ -0,0 +1,176 @@
+package common
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ghodss/yaml"
+	"golang.org/x/xerrors"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ClusterConnection holds the settings the operator connects to a member cluster with, in addition to its API server
+// and credentials.
+type ClusterConnection struct {
+	// TLSServerName is the name the certificate of the API server is checked against, instead of the host of the API
+	// server, e.g. when it's reached through an SNI-routed load balancer.
+	TLSServerName string
+	// ProxyURL is the http, https or socks5 proxy the operator connects to the API server through.
+	ProxyURL string
+	// DisableCompression disables the compression of the responses of the API server.
+	DisableCompression bool
+	// CertificateAuthorityData is the PEM encoded CA the certificate of the API server is checked against, instead
+	// of the CA of the cluster.
+	CertificateAuthorityData []byte
+}
+
+func (c ClusterConnection) isEmpty() bool {
+	return c.TLSServerName == "" && c.ProxyURL == "" && !c.DisableCompression && len(c.CertificateAuthorityData) == 0
+}
+
+// Validate returns an error if the settings can't be used to connect to an API server.
+func (c ClusterConnection) Validate() error {
+	var problems []string
+	if c.ProxyURL != "" {
+		u, err := url.Parse(c.ProxyURL)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+			problems = append(problems, fmt.Sprintf("proxy url %q must be an http://, https:// or socks5:// URL", c.ProxyURL))
+		}
+	}
+	if len(c.CertificateAuthorityData) > 0 && !x509.NewCertPool().AppendCertsFromPEM(c.CertificateAuthorityData) {
+		problems = append(problems, "certificate authority data contains no PEM encoded certificate")
+	}
+	if strings.Contains(c.TLSServerName, "/") || strings.Contains(c.TLSServerName, ":") {
+		problems = append(problems, fmt.Sprintf("tls server name %q must be a host name without a scheme or port", c.TLSServerName))
+	}
+	if len(problems) > 0 {
+		return xerrors.Errorf("%s", strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// connectionFor returns the connection settings of the member cluster. The global ProxyURL and DisableCompression
+// apply to every cluster that doesn't set its own.
+func (f Flags) connectionFor(cluster string) ClusterConnection {
+	connection := f.ClusterConnections[cluster]
+	if connection.ProxyURL == "" {
+		connection.ProxyURL = f.ProxyURL
+	}
+	connection.DisableCompression = connection.DisableCompression || f.DisableCompression
+	return connection
+}
+
+// ValidateConnections returns an error if the connection settings of any member cluster are invalid.
+func (f Flags) ValidateConnections() error {
+	for _, cluster := range f.MemberClusters {
+		if err := f.connectionFor(cluster).Validate(); err != nil {
+			return xerrors.Errorf("invalid connection settings for cluster %s: %w", cluster, err)
+		}
+	}
+	return nil
+}
+
+// keepConnections sets the connection settings of the clusters in the kubeconfig that have none in the flags, so
+// that regenerating the kubeconfig with new credentials keeps them. The CA of a cluster is kept unless the flags
+// set one, as it may be a custom CA rather than the one published by the cluster.
+func (f *Flags) keepConnections(kubeConfig KubeConfigFile) {
+	for _, item := range kubeConfig.Clusters {
+		if f.ClusterConnections == nil {
+			f.ClusterConnections = map[string]ClusterConnection{}
+		}
+		connection, ok := f.ClusterConnections[item.Name]
+		if !ok {
+			connection = ClusterConnection{
+				TLSServerName:      item.Cluster.TLSServerName,
+				ProxyURL:           item.Cluster.ProxyURL,
+				DisableCompression: item.Cluster.DisableCompression,
+			}
+		}
+		if len(connection.CertificateAuthorityData) == 0 {
+			connection.CertificateAuthorityData = item.Cluster.CertificateAuthorityData
+		}
+		f.ClusterConnections[item.Name] = connection
+	}
+}
+
+// keepApiServers sets the api servers of the member clusters that have none in the flags to the ones in the
+// kubeconfig, which may have been discovered from the central cluster and differ from the local kubeconfig.
+func (f *Flags) keepApiServers(kubeConfig KubeConfigFile) error {
+	servers := map[string]string{}
+	for _, item := range kubeConfig.Clusters {
+		servers[item.Name] = item.Cluster.Server
+	}
+	for len(f.MemberClusterApiServerUrls) < len(f.MemberClusters) {
+		f.MemberClusterApiServerUrls = append(f.MemberClusterApiServerUrls, "")
+	}
+	for i, cluster := range f.MemberClusters {
+		if f.MemberClusterApiServerUrls[i] != "" {
+			continue
+		}
+		server, ok := servers[cluster]
+		if !ok || server == "" {
+			return xerrors.Errorf("member cluster %s is not in the KubeConfig secret, add it with add-member or set its api server with --member-clusters-api-servers", cluster)
+		}
+		f.MemberClusterApiServerUrls[i] = server
+	}
+	return nil
+}
+
+// checkKubeConfigConnections connects to the API server of each of the clusters with the generated kubeconfig, so
+// that a kubeconfig the operator can't use is never written. Api servers in flags.ProbedApiServers were already
+// reached from the central cluster and are skipped. newClient creates a client for the given REST configuration.
+func checkKubeConfigConnections(ctx context.Context, kubeConfig KubeConfigFile, clusters []string, flags Flags, newClient func(config *rest.Config) (KubeClient, error)) error {
+	kubeConfigBytes, err := yaml.Marshal(kubeConfig)
+	if err != nil {
+		return xerrors.Errorf("failed to marshal kubeconfig: %w", err)
+	}
+	config, err := clientcmd.Load(kubeConfigBytes)
+	if err != nil {
+		return xerrors.Errorf("failed parsing the generated kubeconfig: %w", err)
+	}
+
+	var failures []string
+	mu := sync.Mutex{}
+	_ = forEachCluster(ctx, clusters, flags.Parallelism, func(ctx context.Context, cluster string) error {
+		err := checkKubeConfigConnection(ctx, config, cluster, flags.ProbedApiServers[cluster], newClient)
+		if err != nil {
+			mu.Lock()
+			defer mu.Unlock()
+			failures = append(failures, fmt.Sprintf("%s: %s", cluster, err))
+		}
+		return nil
+	})
+	if len(failures) > 0 {
+		sort.Strings(failures)
+		return xerrors.Errorf("the operator can't connect to all member clusters with the generated kubeconfig, it was not written:\n  - %s", strings.Join(failures, "\n  - "))
+	}
+	return nil
+}
+
+// checkKubeConfigConnection connects to the cluster with the kubeconfig, unless its api server is the probed one,
+// which was already reached from the central cluster and is often not reachable from here.
+func checkKubeConfigConnection(ctx context.Context, kubeConfig *clientcmdapi.Config, cluster string, probed string, newClient func(config *rest.Config) (KubeClient, error)) error {
+	config, err := clientcmd.NewNonInteractiveClientConfig(*kubeConfig, cluster, &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+	if err != nil {
+		return err
+	}
+	if probed != "" && config.Host == probed {
+		logger.Info("Skipping the kubeconfig check of an api server reached from the central cluster", "cluster", cluster, "url", probed)
+		return nil
+	}
+	c, err := newClient(config)
+	if err != nil {
+		return err
+	}
+	if _, err := serverVersion(ctx, c.Discovery()); err != nil {
+		return xerrors.Errorf("%s not reachable: %w", config.Host, err)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package common
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+func TestClusterConnection_Validate(t *testing.T) {
+	require.NoError(t, ClusterConnection{TLSServerName: "api.example.com", ProxyURL: "socks5://proxy:1080"}.Validate())
+
+	err := ClusterConnection{TLSServerName: "https://api.example.com", ProxyURL: "proxy:3128", CertificateAuthorityData: []byte("not a certificate")}.Validate()
+	require.Error(t, err)
+	for _, problem := range []string{
+		`proxy url "proxy:3128" must be an http://, https:// or socks5:// URL`,
+		"certificate authority data contains no PEM encoded certificate",
+		`tls server name "https://api.example.com" must be a host name without a scheme or port`,
+	} {
+		assert.Contains(t, err.Error(), problem)
+	}
+}
+
+func TestCreateKubeConfig_WithClusterConnections(t *testing.T) {
+	flags := testFlags(t, false)
+	flags.ProxyURL = "http://proxy.example.com:3128"
+	flags.ClusterConnections = map[string]ClusterConnection{
+		flags.MemberClusters[0]: {TLSServerName: "api.internal", CertificateAuthorityData: []byte("user ca")},
+		flags.MemberClusters[1]: {ProxyURL: "http://other-proxy:3128", DisableCompression: true},
+	}
+	secrets := map[string]corev1.Secret{}
+	for _, cluster := range flags.MemberClusters {
+		secrets[cluster] = corev1.Secret{Data: map[string][]byte{"ca.crt": []byte("ca " + cluster), "token": []byte("token")}}
+	}
+
+	kubeConfig, err := createKubeConfigFromServiceAccountTokens(secrets, flags)
+	require.NoError(t, err)
+	assert.Equal(t, KubeConfigCluster{
+		CertificateAuthorityData: []byte("user ca"),
+		Server:                   flags.MemberClusterApiServerUrls[0],
+		TLSServerName:            "api.internal",
+		ProxyURL:                 "http://proxy.example.com:3128",
+	}, kubeConfig.Clusters[0].Cluster)
+	assert.Equal(t, KubeConfigCluster{
+		CertificateAuthorityData: []byte("ca " + flags.MemberClusters[1]),
+		Server:                   flags.MemberClusterApiServerUrls[1],
+		ProxyURL:                 "http://other-proxy:3128",
+		DisableCompression:       true,
+	}, kubeConfig.Clusters[1].Cluster)
+	assert.Equal(t, "http://proxy.example.com:3128", kubeConfig.Clusters[2].Cluster.ProxyURL)
+}
+
+func TestCheckKubeConfigConnections(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"major":"1","minor":"30","gitVersion":"v1.30.0"}`))
+	}))
+	defer server.Close()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	kubeConfig := func(tlsServerName string) KubeConfigFile {
+		config := KubeConfigFile{Kind: "Config", ApiVersion: "v1"}
+		config.Clusters = append(config.Clusters, KubeConfigClusterItem{Name: "cluster-1", Cluster: KubeConfigCluster{Server: server.URL, CertificateAuthorityData: ca, TLSServerName: tlsServerName}})
+		config.Contexts = append(config.Contexts, KubeConfigContextItem{Name: "cluster-1", Context: KubeConfigContext{Cluster: "cluster-1", User: "cluster-1"}})
+		config.Users = append(config.Users, KubeConfigUserItem{Name: "cluster-1", User: KubeConfigUser{Token: "token"}})
+		return config
+	}
+	ctx := context.Background()
+	flags := Flags{Parallelism: 1}
+
+	// the certificate of the test server is issued for example.com
+	require.NoError(t, checkKubeConfigConnections(ctx, kubeConfig("example.com"), []string{"cluster-1"}, flags, NewKubeClientForConfig))
+
+	err := checkKubeConfigConnections(ctx, kubeConfig("api.other.com"), []string{"cluster-1"}, flags, NewKubeClientForConfig)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "the operator can't connect to all member clusters with the generated kubeconfig, it was not written")
+	assert.Contains(t, err.Error(), "cluster-1: "+server.URL+" not reachable")
+}
+
+func TestCheckKubeConfigConnections_SkipsDiscoveredApiServers(t *testing.T) {
+	ctx := context.Background()
+	flags := Flags{
+		MemberClusters:             []string{"cluster-1", "cluster-2"},
+		MemberClusterApiServerUrls: []string{"", "https://cluster-2.example.com"},
+		ApiServerDiscovery:         []string{ApiServerDiscoveryMapping},
+		ApiServerMapping:           map[string]string{"cluster-1": "https://cluster-1.internal:6443"},
+		CheckKubeConfig:            true,
+		Parallelism:                1,
+	}
+	// only the in-cluster address of cluster-1 is reachable from the central cluster
+	probe := func(ctx context.Context, url string) error {
+		if url != "https://cluster-1.internal:6443" {
+			return xerrors.Errorf("no response from %s", url)
+		}
+		return nil
+	}
+	require.NoError(t, DiscoverApiServers(ctx, &flags, map[string]KubeClient{}, nil, probe))
+	assert.Equal(t, map[string]string{"cluster-1": "https://cluster-1.internal:6443"}, flags.ProbedApiServers)
+
+	kubeConfig := KubeConfigFile{Kind: "Config", ApiVersion: "v1"}
+	for i, cluster := range flags.MemberClusters {
+		kubeConfig.Clusters = append(kubeConfig.Clusters, KubeConfigClusterItem{Name: cluster, Cluster: KubeConfigCluster{Server: flags.MemberClusterApiServerUrls[i]}})
+		kubeConfig.Contexts = append(kubeConfig.Contexts, KubeConfigContextItem{Name: cluster, Context: KubeConfigContext{Cluster: cluster, User: cluster}})
+		kubeConfig.Users = append(kubeConfig.Users, KubeConfigUserItem{Name: cluster, User: KubeConfigUser{Token: "token"}})
+	}
+	// neither api server is reachable from the machine running the tool
+	var connected []string
+	newClient := func(config *rest.Config) (KubeClient, error) {
+		connected = append(connected, config.Host)
+		return nil, xerrors.Errorf("no route to host")
+	}
+
+	err := checkKubeConfigConnections(ctx, kubeConfig, flags.MemberClusters, flags, newClient)
+	require.Error(t, err, "the explicitly set api server of cluster-2 was not reached by the probe")
+	assert.Contains(t, err.Error(), "cluster-2: no route to host")
+	assert.NotContains(t, err.Error(), "cluster-1")
+	assert.Equal(t, []string{"https://cluster-2.example.com"}, connected)
+}
+
+func TestKeepConnections(t *testing.T) {
+	flags := Flags{ClusterConnections: map[string]ClusterConnection{"cluster-1": {ProxyURL: "http://new-proxy:3128"}}}
+	flags.keepConnections(KubeConfigFile{Clusters: []KubeConfigClusterItem{
+		{Name: "cluster-1", Cluster: KubeConfigCluster{ProxyURL: "http://old-proxy:3128"}},
+		{Name: "cluster-2", Cluster: KubeConfigCluster{TLSServerName: "api.internal", CertificateAuthorityData: []byte("ca"), DisableCompression: true}},
+	}})
+
+	assert.Equal(t, map[string]ClusterConnection{
+		"cluster-1": {ProxyURL: "http://new-proxy:3128"},
+		"cluster-2": {TLSServerName: "api.internal", CertificateAuthorityData: []byte("ca"), DisableCompression: true},
+	}, flags.ClusterConnections)
+}
+
+func TestKeepApiServers(t *testing.T) {
+	kubeConfig := KubeConfigFile{Clusters: []KubeConfigClusterItem{
+		{Name: "cluster-1", Cluster: KubeConfigCluster{Server: "https://cluster-1.internal:6443"}},
+		{Name: "cluster-2", Cluster: KubeConfigCluster{Server: "https://cluster-2.internal:6443"}},
+	}}
+
+	flags := Flags{MemberClusters: []string{"cluster-1", "cluster-2"}, MemberClusterApiServerUrls: []string{"", "https://override:6443"}}
+	require.NoError(t, flags.keepApiServers(kubeConfig))
+	assert.Equal(t, []string{"https://cluster-1.internal:6443", "https://override:6443"}, flags.MemberClusterApiServerUrls)
+
+	flags = Flags{MemberClusters: []string{"cluster-1", "cluster-3"}}
+	err := flags.keepApiServers(kubeConfig)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "member cluster cluster-3 is not in the KubeConfig secret")
+}
@@ -0,0 +1,336 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/10gen/ops-manager-kubernetes/multi/pkg/common/manifests"
+	"github.com/ghodss/yaml"
+	"golang.org/x/xerrors"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	structuralschema "k8s.io/apiextensions-apiserver/pkg/apiserver/schema"
+	"k8s.io/apiextensions-apiserver/pkg/apiserver/schema/cel"
+	structuraldefaulting "k8s.io/apiextensions-apiserver/pkg/apiserver/schema/defaulting"
+	"k8s.io/apiextensions-apiserver/pkg/apiserver/schema/listtype"
+	"k8s.io/apiextensions-apiserver/pkg/apiserver/schema/pruning"
+	apiservervalidation "k8s.io/apiextensions-apiserver/pkg/apiserver/validation"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	celconfig "k8s.io/apiserver/pkg/apis/cel"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// maxReportedCRDProblems bounds the schema changes and invalid objects reported for a single CRD.
+	maxReportedCRDProblems = 10
+)
+
+var crdResource = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+
+// EmbeddedCRDs returns the CustomResourceDefinitions of the crds.yaml embedded in this tool.
+func EmbeddedCRDs() ([]*unstructured.Unstructured, error) {
+	docs, err := readManifestDocuments(manifests.CRDs)
+	if err != nil {
+		return nil, err
+	}
+	var crds []*unstructured.Unstructured
+	for _, doc := range docs {
+		crd := &unstructured.Unstructured{}
+		if err := yaml.Unmarshal(doc, &crd.Object); err != nil {
+			return nil, xerrors.Errorf("failed parsing CRD: %w", err)
+		}
+		if crd.GetKind() == "CustomResourceDefinition" {
+			crds = append(crds, crd)
+		}
+	}
+	return crds, nil
+}
+
+// CheckCRDs compares the CRDs with the live ones in every cluster of the flags. The check of a CRD fails if the new
+// CRD doesn't serve a version objects are stored in, or if any existing object is invalid under the new schema. It
+// warns about schema changes, like removed fields or new required fields, about unknown fields of existing objects that
+// the API server would prune, and about CRDs that are not installed.
+func CheckCRDs(ctx context.Context, f Flags, clientMap map[string]KubeClient, crds []*unstructured.Unstructured) CheckReport {
+	return checkClusters(ctx, allClusters(f), f.Parallelism, func(ctx context.Context, cluster string) []CheckResult {
+		var checks []CheckResult
+		for _, crd := range crds {
+			checks = append(checks, checkCRD(ctx, clientMap[cluster], cluster, crd))
+		}
+		return checks
+	})
+}
+
+func checkCRD(ctx context.Context, c KubeClient, cluster string, crd *unstructured.Unstructured) CheckResult {
+	check := CheckResult{Cluster: cluster, Check: crd.GetName()}
+	live, err := c.Resource(crdResource).Get(ctx, crd.GetName(), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		check.Status, check.Message = CheckWarn, "not installed"
+		return check
+	}
+	if err != nil {
+		check.Status, check.Message = CheckFail, fmt.Sprintf("failed getting the live CRD: %s", err)
+		return check
+	}
+
+	newVersions := crdVersionSchemas(crd)
+	liveVersions := crdVersionSchemas(live)
+	storedVersions, _, _ := unstructured.NestedStringSlice(live.Object, "status", "storedVersions")
+	var missing []string
+	for _, version := range storedVersions {
+		if _, ok := newVersions[version]; !ok {
+			missing = append(missing, version)
+		}
+	}
+	if len(missing) > 0 {
+		check.Status, check.Message = CheckFail, fmt.Sprintf("objects are stored in versions %s that the new CRD doesn't serve, migrate them first", strings.Join(missing, ", "))
+		return check
+	}
+
+	var invalid, pruned []string
+	for version, newSchema := range newVersions {
+		if _, ok := liveVersions[version]; !ok {
+			continue
+		}
+		problems, prunedFields, err := validateCRDObjects(ctx, c, crd, version, newSchema)
+		if err != nil {
+			check.Status, check.Message = CheckFail, err.Error()
+			return check
+		}
+		invalid = append(invalid, problems...)
+		pruned = append(pruned, prunedFields...)
+	}
+	if len(invalid) > 0 {
+		sort.Strings(invalid)
+		check.Status, check.Message = CheckFail, fmt.Sprintf("%d objects are invalid under the new schema: %s", len(invalid), joinLimited(invalid))
+		return check
+	}
+
+	var changes []string
+	for version, newSchema := range newVersions {
+		if liveSchema, ok := liveVersions[version]; ok {
+			changes = append(changes, compareSchemas(liveSchema, newSchema, version)...)
+		}
+	}
+	var warnings []string
+	if len(changes) > 0 {
+		sort.Strings(changes)
+		warnings = append(warnings, fmt.Sprintf("%d schema changes: %s", len(changes), joinLimited(changes)))
+	}
+	if len(pruned) > 0 {
+		sort.Strings(pruned)
+		warnings = append(warnings, fmt.Sprintf("%d unknown fields of existing objects would be pruned: %s", len(pruned), joinLimited(pruned)))
+	}
+	if len(warnings) > 0 {
+		check.Status, check.Message = CheckWarn, strings.Join(warnings, ". ")
+		return check
+	}
+	check.Status, check.Message = CheckPass, "compatible"
+	return check
+}
+
+// crdVersionSchemas returns the openAPIV3Schema of every version of the CRD.
+func crdVersionSchemas(crd *unstructured.Unstructured) map[string]map[string]interface{} {
+	schemas := map[string]map[string]interface{}{}
+	versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+	for _, v := range versions {
+		version, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(version, "name")
+		openAPISchema, _, _ := unstructured.NestedMap(version, "schema", "openAPIV3Schema")
+		schemas[name] = openAPISchema
+	}
+	return schemas
+}
+
+// validateCRDObjects validates every object of the CRD in the given version the way the API server does when the
+// object is next written: unknown fields are pruned, defaults are applied and the object is validated against the
+// OpenAPI schema, the list types and the x-kubernetes-validations rules. It returns the problems and the pruned fields
+// as namespace/name: problem.
+func validateCRDObjects(ctx context.Context, c KubeClient, crd *unstructured.Unstructured, version string, openAPISchema map[string]interface{}) (problems []string, pruned []string, err error) {
+	validator, err := newCRDSchemaValidator(openAPISchema)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed reading the %s schema: %w", version, err)
+	}
+
+	group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+	plural, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "plural")
+	list, err := c.Resource(schema.GroupVersionResource{Group: group, Version: version, Resource: plural}).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed listing %s objects: %w", version, err)
+	}
+
+	for _, item := range list.Items {
+		ref := objectRef(item.GetNamespace(), item.GetName())
+		errs, prunedFields := validator.validate(ctx, item.Object)
+		for _, err := range errs {
+			problems = append(problems, fmt.Sprintf("%s: %s", ref, err))
+		}
+		for _, path := range prunedFields {
+			pruned = append(pruned, fmt.Sprintf("%s: %s", ref, path))
+		}
+	}
+	return problems, pruned, nil
+}
+
+// crdSchemaValidator validates custom objects with the schema packages of the apiextensions API server.
+type crdSchemaValidator struct {
+	structural *structuralschema.Structural
+	schema     apiservervalidation.SchemaValidator
+	rules      *cel.Validator
+}
+
+func newCRDSchemaValidator(openAPISchema map[string]interface{}) (*crdSchemaValidator, error) {
+	data, err := json.Marshal(openAPISchema)
+	if err != nil {
+		return nil, err
+	}
+	v1Props := &apiextensionsv1.JSONSchemaProps{}
+	if err := json.Unmarshal(data, v1Props); err != nil {
+		return nil, err
+	}
+	props := &apiextensions.JSONSchemaProps{}
+	if err := apiextensionsv1.Convert_v1_JSONSchemaProps_To_apiextensions_JSONSchemaProps(v1Props, props, nil); err != nil {
+		return nil, err
+	}
+
+	structural, err := structuralschema.NewStructural(props)
+	if err != nil {
+		return nil, err
+	}
+	schemaValidator, _, err := apiservervalidation.NewSchemaValidator(props)
+	if err != nil {
+		return nil, err
+	}
+	return &crdSchemaValidator{
+		structural: structural,
+		schema:     schemaValidator,
+		rules:      cel.NewValidator(structural, true, celconfig.PerCallLimit),
+	}, nil
+}
+
+// validate returns the errors the API server would reject the object with, and the paths of the fields it would
+// prune. The object is not modified.
+func (v *crdSchemaValidator) validate(ctx context.Context, obj map[string]interface{}) (field.ErrorList, []string) {
+	obj = runtime.DeepCopyJSON(obj)
+	pruned := pruning.PruneWithOptions(obj, v.structural, true, structuralschema.UnknownFieldPathOptions{TrackUnknownFieldPaths: true})
+	structuraldefaulting.Default(obj, v.structural)
+
+	errs := apiservervalidation.ValidateCustomResource(nil, obj, v.schema)
+	errs = append(errs, listtype.ValidateListSetsAndMaps(nil, v.structural, obj)...)
+	if v.rules != nil {
+		ruleErrs, _ := v.rules.Validate(ctx, nil, v.structural, obj, nil, celconfig.RuntimeCELCostBudget)
+		errs = append(errs, ruleErrs...)
+	}
+	return errs, pruned
+}
+
+// compareSchemas returns the changes of newSchema that may break objects valid under oldSchema: removed fields, new
+// required fields and changed types.
+func compareSchemas(oldSchema, newSchema map[string]interface{}, path string) []string {
+	var changes []string
+	oldType, _ := oldSchema["type"].(string)
+	newType, _ := newSchema["type"].(string)
+	if oldType != newType {
+		return []string{fmt.Sprintf("%s type changed from %q to %q", path, oldType, newType)}
+	}
+
+	oldProperties, _ := oldSchema["properties"].(map[string]interface{})
+	newProperties, _ := newSchema["properties"].(map[string]interface{})
+	preserveUnknown, _ := newSchema["x-kubernetes-preserve-unknown-fields"].(bool)
+	for name, oldProperty := range oldProperties {
+		newProperty, ok := newProperties[name].(map[string]interface{})
+		if !ok {
+			if !preserveUnknown {
+				changes = append(changes, fmt.Sprintf("%s.%s removed", path, name))
+			}
+			continue
+		}
+		if oldProperty, ok := oldProperty.(map[string]interface{}); ok {
+			changes = append(changes, compareSchemas(oldProperty, newProperty, path+"."+name)...)
+		}
+	}
+
+	oldRequired, _ := oldSchema["required"].([]interface{})
+	newRequired, _ := newSchema["required"].([]interface{})
+	for _, name := range newRequired {
+		if !containsValue(oldRequired, name) {
+			changes = append(changes, fmt.Sprintf("%s.%v newly required", path, name))
+		}
+	}
+
+	oldItems, _ := oldSchema["items"].(map[string]interface{})
+	newItems, _ := newSchema["items"].(map[string]interface{})
+	if oldItems != nil && newItems != nil {
+		changes = append(changes, compareSchemas(oldItems, newItems, path+"[]")...)
+	}
+	return changes
+}
+
+// InstallCRDs applies the CRDs to every cluster of the flags. Unless upgrade is set, CRDs that are already installed
+// are left untouched.
+func InstallCRDs(ctx context.Context, f Flags, clientMap map[string]KubeClient, crds []*unstructured.Unstructured, upgrade bool) error {
+	return forEachCluster(ctx, allClusters(f), f.Parallelism, func(ctx context.Context, cluster string) error {
+		return installClusterCRDs(ctx, clientMap[cluster], cluster, crds, upgrade)
+	})
+}
+
+// installClusterCRDs applies the CRDs to a single cluster, see InstallCRDs.
+func installClusterCRDs(ctx context.Context, c KubeClient, cluster string, crds []*unstructured.Unstructured, upgrade bool) error {
+	for _, crd := range crds {
+		if !upgrade {
+			_, err := c.Resource(crdResource).Get(ctx, crd.GetName(), metav1.GetOptions{})
+			if err == nil {
+				logger.Info("CustomResourceDefinition is already installed, run crds upgrade to update it", "cluster", cluster, "name", crd.GetName())
+				continue
+			}
+			if !errors.IsNotFound(err) {
+				return xerrors.Errorf("failed getting CustomResourceDefinition %s: %w", crd.GetName(), err)
+			}
+		}
+		logger.Info("Applying CustomResourceDefinition", "cluster", cluster, "name", crd.GetName())
+		if err := applyCRD(ctx, c, crd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyCRD server-side applies the CustomResourceDefinition.
+func applyCRD(ctx context.Context, c KubeClient, crd *unstructured.Unstructured) error {
+	data, err := json.Marshal(crd.Object)
+	if err != nil {
+		return xerrors.Errorf("failed to marshal CustomResourceDefinition %s: %w", crd.GetName(), err)
+	}
+	if _, err := c.Resource(crdResource).Patch(ctx, crd.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{FieldManager: FieldManager, Force: ptr.To(true)}); err != nil {
+		return xerrors.Errorf("failed applying CustomResourceDefinition %s: %w", crd.GetName(), err)
+	}
+	return nil
+}
+
+func joinLimited(items []string) string {
+	if len(items) > maxReportedCRDProblems {
+		return strings.Join(items[:maxReportedCRDProblems], "; ") + fmt.Sprintf("; and %d more", len(items)-maxReportedCRDProblems)
+	}
+	return strings.Join(items, "; ")
+}
+
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if reflect.DeepEqual(v, value) {
+			return true
+		}
+	}
+	return false
+}
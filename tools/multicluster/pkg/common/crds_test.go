@@ -0,0 +1,230 @@
+package common
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+const testCRD = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.mongodb.com
+spec:
+  group: mongodb.com
+  names:
+    kind: Widget
+    plural: widgets
+  scope: Namespaced
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          apiVersion:
+            type: string
+          kind:
+            type: string
+          metadata:
+            type: object
+          spec:
+            type: object
+            required: [members]
+            x-kubernetes-validations:
+            - rule: '!has(self.members) || self.members <= 50'
+              message: members must be at most 50
+            properties:
+              members:
+                type: integer
+                minimum: 1
+              type:
+                type: string
+                enum: [ReplicaSet, ShardedCluster]
+              labels:
+                type: object
+                additionalProperties:
+                  type: string
+              extra:
+                type: object
+                x-kubernetes-preserve-unknown-fields: true
+              ports:
+                type: array
+                items:
+                  x-kubernetes-int-or-string: true
+              name:
+                type: string
+                maxLength: 3
+              uid:
+                type: string
+                format: uuid
+              backup:
+                type: object
+                nullable: true
+              replicas:
+                x-kubernetes-int-or-string: true
+                anyOf:
+                - type: integer
+                - type: string
+                  pattern: '^[0-9]+%$'
+`
+
+func loadTestCRD(t *testing.T, modify func(crd *unstructured.Unstructured)) *unstructured.Unstructured {
+	crd := &unstructured.Unstructured{}
+	require.NoError(t, yaml.Unmarshal([]byte(testCRD), &crd.Object))
+	if modify != nil {
+		modify(crd)
+	}
+	return crd
+}
+
+// testCRDSpecSchema returns the schema of the spec of the test CRD, which can be modified in place.
+func testCRDSpecSchema(crd *unstructured.Unstructured) map[string]interface{} {
+	version := crd.Object["spec"].(map[string]interface{})["versions"].([]interface{})[0].(map[string]interface{})
+	openAPISchema := version["schema"].(map[string]interface{})["openAPIV3Schema"].(map[string]interface{})
+	return openAPISchema["properties"].(map[string]interface{})["spec"].(map[string]interface{})
+}
+
+func TestEmbeddedCRDs(t *testing.T) {
+	crds, err := EmbeddedCRDs()
+	require.NoError(t, err)
+
+	var names []string
+	for _, crd := range crds {
+		names = append(names, crd.GetName())
+		assert.NotEmpty(t, crdVersionSchemas(crd), crd.GetName())
+	}
+	assert.ElementsMatch(t, []string{"mongodb.mongodb.com", "mongodbmulticluster.mongodb.com", "mongodbusers.mongodb.com", "opsmanagers.mongodb.com"}, names)
+}
+
+func TestCRDSchemaValidator(t *testing.T) {
+	ctx := context.Background()
+	crd := loadTestCRD(t, nil)
+	validator, err := newCRDSchemaValidator(crdVersionSchemas(crd)["v1"])
+	require.NoError(t, err)
+
+	validate := func(spec map[string]interface{}) ([]string, []string) {
+		errs, pruned := validator.validate(ctx, widget("widget", spec).Object)
+		var problems []string
+		for _, err := range errs {
+			problems = append(problems, err.Error())
+		}
+		return problems, pruned
+	}
+
+	problems, pruned := validate(map[string]interface{}{
+		"members":  int64(3),
+		"type":     "ReplicaSet",
+		"labels":   map[string]interface{}{"team": "a"},
+		"extra":    map[string]interface{}{"anything": []interface{}{1.5}},
+		"ports":    []interface{}{int64(27017), "mongodb"},
+		"name":     "äöü",
+		"uid":      "6f1c1fb6-3a4e-4c38-9d6e-8f4b5e2a1c3d",
+		"backup":   nil,
+		"replicas": "50%",
+	})
+	assert.Empty(t, problems)
+	assert.Empty(t, pruned)
+
+	problems, _ = validate(map[string]interface{}{
+		"type":     "Standalone",
+		"labels":   map[string]interface{}{"team": true},
+		"name":     "abcd",
+		"uid":      "not-a-uuid",
+		"replicas": "half",
+	})
+	for _, field := range []string{"spec.labels.team", "spec.members", "spec.name", "spec.replicas", "spec.type", "spec.uid"} {
+		assert.Contains(t, problems, findProblem(problems, field))
+	}
+
+	problems, _ = validate(map[string]interface{}{"members": int64(51)})
+	assert.Equal(t, []string{"spec: Invalid value: \"object\": members must be at most 50"}, problems)
+
+	problems, pruned = validate(map[string]interface{}{"members": int64(3), "unknown": "field"})
+	assert.Empty(t, problems)
+	assert.Equal(t, []string{"spec.unknown"}, pruned)
+}
+
+// findProblem returns the problem reported for the field, or the field itself so the assertion fails with it.
+func findProblem(problems []string, field string) string {
+	for _, problem := range problems {
+		if strings.HasPrefix(problem, field+":") {
+			return problem
+		}
+	}
+	return field
+}
+
+func TestCompareSchemas(t *testing.T) {
+	oldCRD := loadTestCRD(t, nil)
+	newCRD := loadTestCRD(t, func(crd *unstructured.Unstructured) {
+		spec := testCRDSpecSchema(crd)
+		properties := spec["properties"].(map[string]interface{})
+		delete(properties, "labels")
+		properties["members"] = map[string]interface{}{"type": "string"}
+		spec["required"] = []interface{}{"members", "type"}
+	})
+
+	changes := compareSchemas(crdVersionSchemas(oldCRD)["v1"], crdVersionSchemas(newCRD)["v1"], "v1")
+	assert.ElementsMatch(t, []string{
+		"v1.spec.labels removed",
+		`v1.spec.members type changed from "integer" to "string"`,
+		"v1.spec.type newly required",
+	}, changes)
+}
+
+func TestCheckCRDs(t *testing.T) {
+	ctx := context.Background()
+	flags := Flags{CentralCluster: "central", Parallelism: 1}
+	newCRD := loadTestCRD(t, nil)
+
+	live := loadTestCRD(t, nil)
+	require.NoError(t, unstructured.SetNestedStringSlice(live.Object, []string{"v1"}, "status", "storedVersions"))
+	valid := widget("valid", map[string]interface{}{"members": int64(3)})
+	invalid := widget("invalid", map[string]interface{}{"members": int64(0)})
+
+	newClient := func(objects ...runtime.Object) map[string]KubeClient {
+		listKinds := map[schema.GroupVersionResource]string{
+			crdResource: "CustomResourceDefinitionList",
+			{Group: "mongodb.com", Version: "v1", Resource: "widgets"}: "WidgetList",
+		}
+		dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, objects...)
+		return map[string]KubeClient{"central": NewKubeClientContainer(nil, newFakeClientset(ctx, "central", nil), dynamicClient)}
+	}
+
+	report := CheckCRDs(ctx, flags, newClient(), []*unstructured.Unstructured{newCRD})
+	assert.Equal(t, CheckReport{{Cluster: "central", Check: "widgets.mongodb.com", Status: CheckWarn, Message: "not installed"}}, report)
+
+	report = CheckCRDs(ctx, flags, newClient(live, valid), []*unstructured.Unstructured{newCRD})
+	assert.Equal(t, CheckReport{{Cluster: "central", Check: "widgets.mongodb.com", Status: CheckPass, Message: "compatible"}}, report)
+
+	report = CheckCRDs(ctx, flags, newClient(live, valid, invalid), []*unstructured.Unstructured{newCRD})
+	assert.Equal(t, CheckReport{{Cluster: "central", Check: "widgets.mongodb.com", Status: CheckFail, Message: "1 objects are invalid under the new schema: mongodb/invalid: spec.members: Invalid value: 0: spec.members in body should be greater than or equal to 1"}}, report)
+
+	unknown := widget("unknown", map[string]interface{}{"members": int64(3), "unknown": "field"})
+	report = CheckCRDs(ctx, flags, newClient(live, unknown), []*unstructured.Unstructured{newCRD})
+	assert.Equal(t, CheckReport{{Cluster: "central", Check: "widgets.mongodb.com", Status: CheckWarn, Message: "1 unknown fields of existing objects would be pruned: mongodb/unknown: spec.unknown"}}, report)
+
+	require.NoError(t, unstructured.SetNestedStringSlice(live.Object, []string{"v1beta1", "v1"}, "status", "storedVersions"))
+	report = CheckCRDs(ctx, flags, newClient(live), []*unstructured.Unstructured{newCRD})
+	assert.Equal(t, CheckReport{{Cluster: "central", Check: "widgets.mongodb.com", Status: CheckFail, Message: "objects are stored in versions v1beta1 that the new CRD doesn't serve, migrate them first"}}, report)
+}
+
+func widget(name string, spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "mongodb.com/v1",
+		"kind":       "Widget",
+		"metadata":   map[string]interface{}{"name": name, "namespace": "mongodb"},
+		"spec":       spec,
+	}}
+}
@@ -0,0 +1,778 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	rbacv1client "k8s.io/client-go/kubernetes/typed/rbac/v1"
+)
+
+// ActionType describes what happens to an object managed by this tool.
+type ActionType string
+
+const (
+	ActionCreate    ActionType = "create"
+	ActionUpdate    ActionType = "update"
+	ActionUnchanged ActionType = "unchanged"
+	ActionDelete    ActionType = "delete"
+)
+
+// sensitiveValue is shown in place of the contents of Secret data in diffs.
+const sensitiveValue = "(sensitive value)"
+
+// FieldDiff is a single field that differs between the live and the desired object.
+type FieldDiff struct {
+	Path    string
+	Live    string
+	Desired string
+}
+
+// PlannedAction is the action that would be performed on a single object in a cluster.
+type PlannedAction struct {
+	Cluster   string
+	Kind      string
+	Namespace string
+	Name      string
+	Action    ActionType
+	Diff      []FieldDiff
+	// Object is the desired state of the object, nil for deletions.
+	Object runtime.Object
+}
+
+// Plan collects the actions that would be performed against all clusters when running in dry-run mode.
+// It is safe for concurrent use.
+type Plan struct {
+	mu      sync.Mutex
+	actions []*PlannedAction
+	index   map[string]*PlannedAction
+}
+
+func NewPlan() *Plan {
+	return &Plan{index: map[string]*PlannedAction{}}
+}
+
+// Actions returns a copy of all the recorded actions in the order they were first recorded.
+func (p *Plan) Actions() []PlannedAction {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	actions := make([]PlannedAction, 0, len(p.actions))
+	for _, a := range p.actions {
+		actions = append(actions, *a)
+	}
+	return actions
+}
+
+// record stores the action, replacing any previous action recorded for the same object.
+func (p *Plan) record(action PlannedAction) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := planKey(action.Cluster, action.Kind, action.Namespace, action.Name)
+	if existing, ok := p.index[key]; ok {
+		*existing = action
+		return
+	}
+	p.index[key] = &action
+	p.actions = append(p.actions, &action)
+}
+
+// lookup returns the action previously recorded for the given object, if any.
+func (p *Plan) lookup(cluster, kind, namespace, name string) (PlannedAction, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if a, ok := p.index[planKey(cluster, kind, namespace, name)]; ok {
+		return *a, true
+	}
+	return PlannedAction{}, false
+}
+
+func planKey(cluster, kind, namespace, name string) string {
+	return strings.Join([]string{cluster, kind, namespace, name}, "/")
+}
+
+// Print writes a human-readable summary of the plan, grouped by cluster.
+func (p *Plan) Print(w io.Writer) {
+	actions := p.Actions()
+	if len(actions) == 0 {
+		_, _ = fmt.Fprintln(w, "No changes.")
+		return
+	}
+
+	var clusters []string
+	byCluster := map[string][]PlannedAction{}
+	for _, a := range actions {
+		if _, ok := byCluster[a.Cluster]; !ok {
+			clusters = append(clusters, a.Cluster)
+		}
+		byCluster[a.Cluster] = append(byCluster[a.Cluster], a)
+	}
+
+	for _, cluster := range clusters {
+		_, _ = fmt.Fprintf(w, "Cluster %s:\n", cluster)
+		for _, a := range byCluster[cluster] {
+			_, _ = fmt.Fprintf(w, "  %-10s %s %s\n", a.Action, a.Kind, objectRef(a.Namespace, a.Name))
+			for _, d := range a.Diff {
+				_, _ = fmt.Fprintf(w, "      %s: %s -> %s\n", d.Path, d.Live, d.Desired)
+			}
+			printRules(w, a)
+		}
+		_, _ = fmt.Fprintln(w)
+	}
+}
+
+// printRules writes the effective rules of the Roles and ClusterRoles that would be created or updated.
+func printRules(w io.Writer, a PlannedAction) {
+	if a.Action != ActionCreate && a.Action != ActionUpdate {
+		return
+	}
+	var rules []rbacv1.PolicyRule
+	switch obj := a.Object.(type) {
+	case *rbacv1.Role:
+		rules = obj.Rules
+	case *rbacv1.ClusterRole:
+		rules = obj.Rules
+	default:
+		return
+	}
+	_, _ = fmt.Fprintf(w, "      rules:\n")
+	for _, rule := range rules {
+		_, _ = fmt.Fprintf(w, "        - %s\n", formatRule(rule))
+	}
+}
+
+func objectRef(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "/" + name
+}
+
+// NewDryRunClientMap wraps every client in the map with a client that records the changes in the plan instead of
+// applying them. Read operations are still performed against the live clusters.
+func NewDryRunClientMap(clientMap map[string]KubeClient, plan *Plan) map[string]KubeClient {
+	dryRunMap := map[string]KubeClient{}
+	for cluster, c := range clientMap {
+		dryRunMap[cluster] = NewDryRunKubeClient(cluster, c, plan)
+	}
+	return dryRunMap
+}
+
+// NewDryRunKubeClient returns a KubeClient that records all writes to the objects managed by this tool in the plan.
+func NewDryRunKubeClient(cluster string, client KubeClient, plan *Plan) KubeClient {
+	return &dryRunKubeClient{KubeClient: client, planner: &planner{cluster: cluster, plan: plan}}
+}
+
+type dryRunKubeClient struct {
+	KubeClient
+	*planner
+}
+
+func (c *dryRunKubeClient) CoreV1() corev1client.CoreV1Interface {
+	return &dryRunCoreV1{CoreV1Interface: c.KubeClient.CoreV1(), planner: c.planner}
+}
+
+func (c *dryRunKubeClient) RbacV1() rbacv1client.RbacV1Interface {
+	return &dryRunRbacV1{RbacV1Interface: c.KubeClient.RbacV1(), planner: c.planner}
+}
+
+// planner records the planned actions for a single cluster.
+type planner struct {
+	cluster string
+	plan    *Plan
+}
+
+// plannedObject is implemented by all the Kubernetes objects managed by this tool.
+type plannedObject interface {
+	metav1.Object
+	runtime.Object
+}
+
+// getter reads the live state of an object.
+type getter[T plannedObject] func(ctx context.Context, name string, opts metav1.GetOptions) (T, error)
+
+// planGet returns the planned state of the object if there is one, otherwise the live state.
+func planGet[T plannedObject](ctx context.Context, p *planner, kind, namespace, name string, get getter[T]) (T, error) {
+	var zero T
+	if a, ok := p.plan.lookup(p.cluster, kind, namespace, name); ok {
+		if a.Action == ActionDelete {
+			return zero, errors.NewNotFound(schema.GroupResource{Resource: kind}, name)
+		}
+		return a.Object.DeepCopyObject().(T), nil
+	}
+	return get(ctx, name, metav1.GetOptions{})
+}
+
+// planCreate records the creation of the object if it doesn't exist yet. Mirroring the API server, it returns an
+// AlreadyExists error if it does, in which case the object is recorded as unchanged.
+func planCreate[T plannedObject](ctx context.Context, p *planner, kind string, desired T, get getter[T]) (T, error) {
+	live, err := planGet(ctx, p, kind, desired.GetNamespace(), desired.GetName(), get)
+	if errors.IsNotFound(err) {
+		p.plan.record(p.action(kind, desired, ActionCreate, nil))
+		return desired, nil
+	}
+	if err != nil {
+		return desired, err
+	}
+
+	if _, ok := p.plan.lookup(p.cluster, kind, desired.GetNamespace(), desired.GetName()); !ok {
+		p.plan.record(p.action(kind, live, ActionUnchanged, nil))
+	}
+	return desired, errors.NewAlreadyExists(schema.GroupResource{Resource: kind}, desired.GetName())
+}
+
+// planUpdate records the update of the object together with the fields that would change.
+func planUpdate[T plannedObject](ctx context.Context, p *planner, kind string, desired T, get getter[T]) (T, error) {
+	live, err := planGet(ctx, p, kind, desired.GetNamespace(), desired.GetName(), get)
+	if err != nil {
+		return desired, err
+	}
+
+	if a, ok := p.plan.lookup(p.cluster, kind, desired.GetNamespace(), desired.GetName()); ok && a.Action == ActionCreate {
+		p.plan.record(p.action(kind, desired, ActionCreate, nil))
+		return desired, nil
+	}
+
+	diff, err := diffObjects(kind, live, desired)
+	if err != nil {
+		return desired, err
+	}
+	action := ActionUpdate
+	if len(diff) == 0 {
+		action = ActionUnchanged
+	}
+	p.plan.record(p.action(kind, desired, action, diff))
+	return desired, nil
+}
+
+// planApply records the server-side apply of the object. The applied fields are merged into the live object, which
+// approximates the result of the apply for fields owned by this tool, and recorded like an update.
+func planApply[T plannedObject](ctx context.Context, p *planner, kind, namespace, name string, pt types.PatchType, patch []byte, into T, get getter[T]) (T, error) {
+	if pt != types.ApplyPatchType {
+		return into, xerrors.Errorf("patch type %s is not supported in dry-run mode", pt)
+	}
+
+	live, err := planGet(ctx, p, kind, namespace, name, get)
+	if errors.IsNotFound(err) {
+		if err := json.Unmarshal(patch, into); err != nil {
+			return into, err
+		}
+		into = withNamespace(into, namespace)
+		p.plan.record(p.action(kind, into, ActionCreate, nil))
+		return into, nil
+	}
+	if err != nil {
+		return into, err
+	}
+
+	liveJSON, err := json.Marshal(live)
+	if err != nil {
+		return into, err
+	}
+	merged, err := strategicpatch.StrategicMergePatch(liveJSON, patch, into)
+	if err != nil {
+		return into, err
+	}
+	if err := json.Unmarshal(merged, into); err != nil {
+		return into, err
+	}
+	return planUpdate(ctx, p, kind, withNamespace(into, namespace), get)
+}
+
+// planDelete records the deletion of the object.
+func planDelete[T plannedObject](ctx context.Context, p *planner, kind, namespace, name string, get getter[T]) error {
+	live, err := planGet(ctx, p, kind, namespace, name, get)
+	if err != nil {
+		return err
+	}
+	a := p.action(kind, live, ActionDelete, nil)
+	a.Object = nil
+	p.plan.record(a)
+	return nil
+}
+
+// isDeleted returns true if the object has been planned to be deleted.
+func (p *planner) isDeleted(kind, namespace, name string) bool {
+	a, ok := p.plan.lookup(p.cluster, kind, namespace, name)
+	return ok && a.Action == ActionDelete
+}
+
+func (p *planner) action(kind string, obj plannedObject, action ActionType, diff []FieldDiff) PlannedAction {
+	return PlannedAction{
+		Cluster:   p.cluster,
+		Kind:      kind,
+		Namespace: obj.GetNamespace(),
+		Name:      obj.GetName(),
+		Action:    action,
+		Diff:      diff,
+		Object:    obj.DeepCopyObject(),
+	}
+}
+
+// diffObjects returns the fields that differ between the live and the desired object. Fields that are set by the
+// API server are ignored, and the contents of Secrets are never shown.
+func diffObjects(kind string, live, desired runtime.Object) ([]FieldDiff, error) {
+	liveFields, err := flattenObject(live)
+	if err != nil {
+		return nil, err
+	}
+	desiredFields, err := flattenObject(desired)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := map[string]struct{}{}
+	for path := range liveFields {
+		paths[path] = struct{}{}
+	}
+	for path := range desiredFields {
+		paths[path] = struct{}{}
+	}
+
+	var diff []FieldDiff
+	for path := range paths {
+		liveValue, inLive := liveFields[path]
+		desiredValue, inDesired := desiredFields[path]
+		if inLive && inDesired && reflect.DeepEqual(liveValue, desiredValue) {
+			continue
+		}
+		d := FieldDiff{Path: path, Live: formatValue(liveValue, inLive), Desired: formatValue(desiredValue, inDesired)}
+		if kind == "Secret" && (strings.HasPrefix(path, "data.") || strings.HasPrefix(path, "stringData.")) {
+			d.Live, d.Desired = maskValue(inLive), maskValue(inDesired)
+		}
+		diff = append(diff, d)
+	}
+	sort.Slice(diff, func(i, j int) bool { return diff[i].Path < diff[j].Path })
+	return diff, nil
+}
+
+// ignoredFields are the fields that are managed by the API server and are never set by this tool.
+var ignoredFields = []string{"apiVersion", "kind", "status", "metadata.resourceVersion", "metadata.uid", "metadata.creationTimestamp", "metadata.generation", "metadata.managedFields", "metadata.selfLink"}
+
+// flattenObject converts the object to a map of field paths to leaf values.
+func flattenObject(obj runtime.Object) (map[string]interface{}, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{}
+	flatten("", content, fields)
+	for path := range fields {
+		for _, ignored := range ignoredFields {
+			if path == ignored || strings.HasPrefix(path, ignored+".") || strings.HasPrefix(path, ignored+"[") {
+				delete(fields, path)
+			}
+		}
+	}
+	return fields, nil
+}
+
+func flatten(prefix string, value interface{}, into map[string]interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			path := k
+			if prefix != "" {
+				path = prefix + "." + k
+			}
+			flatten(path, child, into)
+		}
+	case []interface{}:
+		for i, child := range v {
+			flatten(fmt.Sprintf("%s[%d]", prefix, i), child, into)
+		}
+	default:
+		into[prefix] = v
+	}
+}
+
+func formatValue(value interface{}, present bool) string {
+	if !present {
+		return "<none>"
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(b)
+}
+
+func maskValue(present bool) string {
+	if !present {
+		return "<none>"
+	}
+	return sensitiveValue
+}
+
+type dryRunCoreV1 struct {
+	corev1client.CoreV1Interface
+	*planner
+}
+
+func (c *dryRunCoreV1) Namespaces() corev1client.NamespaceInterface {
+	return &dryRunNamespaces{NamespaceInterface: c.CoreV1Interface.Namespaces(), planner: c.planner}
+}
+
+func (c *dryRunCoreV1) ServiceAccounts(namespace string) corev1client.ServiceAccountInterface {
+	return &dryRunServiceAccounts{ServiceAccountInterface: c.CoreV1Interface.ServiceAccounts(namespace), planner: c.planner, namespace: namespace}
+}
+
+func (c *dryRunCoreV1) Secrets(namespace string) corev1client.SecretInterface {
+	return &dryRunSecrets{SecretInterface: c.CoreV1Interface.Secrets(namespace), planner: c.planner, namespace: namespace}
+}
+
+func (c *dryRunCoreV1) ConfigMaps(namespace string) corev1client.ConfigMapInterface {
+	return &dryRunConfigMaps{ConfigMapInterface: c.CoreV1Interface.ConfigMaps(namespace), planner: c.planner, namespace: namespace}
+}
+
+type dryRunRbacV1 struct {
+	rbacv1client.RbacV1Interface
+	*planner
+}
+
+func (c *dryRunRbacV1) Roles(namespace string) rbacv1client.RoleInterface {
+	return &dryRunRoles{RoleInterface: c.RbacV1Interface.Roles(namespace), planner: c.planner, namespace: namespace}
+}
+
+func (c *dryRunRbacV1) RoleBindings(namespace string) rbacv1client.RoleBindingInterface {
+	return &dryRunRoleBindings{RoleBindingInterface: c.RbacV1Interface.RoleBindings(namespace), planner: c.planner, namespace: namespace}
+}
+
+func (c *dryRunRbacV1) ClusterRoles() rbacv1client.ClusterRoleInterface {
+	return &dryRunClusterRoles{ClusterRoleInterface: c.RbacV1Interface.ClusterRoles(), planner: c.planner}
+}
+
+func (c *dryRunRbacV1) ClusterRoleBindings() rbacv1client.ClusterRoleBindingInterface {
+	return &dryRunClusterRoleBindings{ClusterRoleBindingInterface: c.RbacV1Interface.ClusterRoleBindings(), planner: c.planner}
+}
+
+type dryRunNamespaces struct {
+	corev1client.NamespaceInterface
+	*planner
+}
+
+func (c *dryRunNamespaces) Get(ctx context.Context, name string, _ metav1.GetOptions) (*corev1.Namespace, error) {
+	return planGet(ctx, c.planner, "Namespace", "", name, c.NamespaceInterface.Get)
+}
+
+func (c *dryRunNamespaces) Create(ctx context.Context, ns *corev1.Namespace, _ metav1.CreateOptions) (*corev1.Namespace, error) {
+	return planCreate(ctx, c.planner, "Namespace", ns, c.NamespaceInterface.Get)
+}
+
+func (c *dryRunNamespaces) Update(ctx context.Context, ns *corev1.Namespace, _ metav1.UpdateOptions) (*corev1.Namespace, error) {
+	return planUpdate(ctx, c.planner, "Namespace", ns, c.NamespaceInterface.Get)
+}
+
+func (c *dryRunNamespaces) Delete(ctx context.Context, name string, _ metav1.DeleteOptions) error {
+	return planDelete(ctx, c.planner, "Namespace", "", name, c.NamespaceInterface.Get)
+}
+
+type dryRunServiceAccounts struct {
+	corev1client.ServiceAccountInterface
+	*planner
+	namespace string
+}
+
+func (c *dryRunServiceAccounts) Get(ctx context.Context, name string, _ metav1.GetOptions) (*corev1.ServiceAccount, error) {
+	return planGet(ctx, c.planner, "ServiceAccount", c.namespace, name, c.ServiceAccountInterface.Get)
+}
+
+func (c *dryRunServiceAccounts) Create(ctx context.Context, sa *corev1.ServiceAccount, _ metav1.CreateOptions) (*corev1.ServiceAccount, error) {
+	return planCreate(ctx, c.planner, "ServiceAccount", withNamespace(sa, c.namespace), c.ServiceAccountInterface.Get)
+}
+
+func (c *dryRunServiceAccounts) Update(ctx context.Context, sa *corev1.ServiceAccount, _ metav1.UpdateOptions) (*corev1.ServiceAccount, error) {
+	return planUpdate(ctx, c.planner, "ServiceAccount", withNamespace(sa, c.namespace), c.ServiceAccountInterface.Get)
+}
+
+func (c *dryRunServiceAccounts) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, _ metav1.PatchOptions, _ ...string) (*corev1.ServiceAccount, error) {
+	return planApply(ctx, c.planner, "ServiceAccount", c.namespace, name, pt, data, &corev1.ServiceAccount{}, c.ServiceAccountInterface.Get)
+}
+
+func (c *dryRunServiceAccounts) Delete(ctx context.Context, name string, _ metav1.DeleteOptions) error {
+	return planDelete(ctx, c.planner, "ServiceAccount", c.namespace, name, c.ServiceAccountInterface.Get)
+}
+
+// CreateToken returns a placeholder token, as minting a real token for a ServiceAccount that might not exist yet
+// is not possible in dry-run mode.
+func (c *dryRunServiceAccounts) CreateToken(ctx context.Context, name string, tr *authenticationv1.TokenRequest, _ metav1.CreateOptions) (*authenticationv1.TokenRequest, error) {
+	if _, err := c.Get(ctx, name, metav1.GetOptions{}); err != nil {
+		return nil, err
+	}
+	tr = tr.DeepCopy()
+	tr.Status.Token = "<service account token>"
+	if tr.Spec.ExpirationSeconds != nil {
+		tr.Status.ExpirationTimestamp = metav1.NewTime(time.Now().Add(time.Duration(*tr.Spec.ExpirationSeconds) * time.Second))
+	}
+	return tr, nil
+}
+
+func (c *dryRunServiceAccounts) List(ctx context.Context, opts metav1.ListOptions) (*corev1.ServiceAccountList, error) {
+	list, err := c.ServiceAccountInterface.List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	items := list.Items[:0]
+	for _, item := range list.Items {
+		if !c.isDeleted("ServiceAccount", c.namespace, item.Name) {
+			items = append(items, item)
+		}
+	}
+	list.Items = items
+	return list, nil
+}
+
+type dryRunSecrets struct {
+	corev1client.SecretInterface
+	*planner
+	namespace string
+}
+
+func (c *dryRunSecrets) Get(ctx context.Context, name string, _ metav1.GetOptions) (*corev1.Secret, error) {
+	return planGet(ctx, c.planner, "Secret", c.namespace, name, c.SecretInterface.Get)
+}
+
+func (c *dryRunSecrets) Create(ctx context.Context, secret *corev1.Secret, _ metav1.CreateOptions) (*corev1.Secret, error) {
+	return planCreate(ctx, c.planner, "Secret", withNamespace(secret, c.namespace), c.SecretInterface.Get)
+}
+
+func (c *dryRunSecrets) Update(ctx context.Context, secret *corev1.Secret, _ metav1.UpdateOptions) (*corev1.Secret, error) {
+	return planUpdate(ctx, c.planner, "Secret", withNamespace(secret, c.namespace), c.SecretInterface.Get)
+}
+
+func (c *dryRunSecrets) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, _ metav1.PatchOptions, _ ...string) (*corev1.Secret, error) {
+	return planApply(ctx, c.planner, "Secret", c.namespace, name, pt, data, &corev1.Secret{}, c.SecretInterface.Get)
+}
+
+func (c *dryRunSecrets) Delete(ctx context.Context, name string, _ metav1.DeleteOptions) error {
+	return planDelete(ctx, c.planner, "Secret", c.namespace, name, c.SecretInterface.Get)
+}
+
+func (c *dryRunSecrets) List(ctx context.Context, opts metav1.ListOptions) (*corev1.SecretList, error) {
+	list, err := c.SecretInterface.List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	items := list.Items[:0]
+	for _, item := range list.Items {
+		if !c.isDeleted("Secret", c.namespace, item.Name) {
+			items = append(items, item)
+		}
+	}
+	list.Items = items
+	return list, nil
+}
+
+type dryRunConfigMaps struct {
+	corev1client.ConfigMapInterface
+	*planner
+	namespace string
+}
+
+func (c *dryRunConfigMaps) Get(ctx context.Context, name string, _ metav1.GetOptions) (*corev1.ConfigMap, error) {
+	return planGet(ctx, c.planner, "ConfigMap", c.namespace, name, c.ConfigMapInterface.Get)
+}
+
+func (c *dryRunConfigMaps) Create(ctx context.Context, cm *corev1.ConfigMap, _ metav1.CreateOptions) (*corev1.ConfigMap, error) {
+	return planCreate(ctx, c.planner, "ConfigMap", withNamespace(cm, c.namespace), c.ConfigMapInterface.Get)
+}
+
+func (c *dryRunConfigMaps) Update(ctx context.Context, cm *corev1.ConfigMap, _ metav1.UpdateOptions) (*corev1.ConfigMap, error) {
+	return planUpdate(ctx, c.planner, "ConfigMap", withNamespace(cm, c.namespace), c.ConfigMapInterface.Get)
+}
+
+func (c *dryRunConfigMaps) Delete(ctx context.Context, name string, _ metav1.DeleteOptions) error {
+	return planDelete(ctx, c.planner, "ConfigMap", c.namespace, name, c.ConfigMapInterface.Get)
+}
+
+type dryRunRoles struct {
+	rbacv1client.RoleInterface
+	*planner
+	namespace string
+}
+
+func (c *dryRunRoles) Get(ctx context.Context, name string, _ metav1.GetOptions) (*rbacv1.Role, error) {
+	return planGet(ctx, c.planner, "Role", c.namespace, name, c.RoleInterface.Get)
+}
+
+func (c *dryRunRoles) Create(ctx context.Context, role *rbacv1.Role, _ metav1.CreateOptions) (*rbacv1.Role, error) {
+	return planCreate(ctx, c.planner, "Role", withNamespace(role, c.namespace), c.RoleInterface.Get)
+}
+
+func (c *dryRunRoles) Update(ctx context.Context, role *rbacv1.Role, _ metav1.UpdateOptions) (*rbacv1.Role, error) {
+	return planUpdate(ctx, c.planner, "Role", withNamespace(role, c.namespace), c.RoleInterface.Get)
+}
+
+func (c *dryRunRoles) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, _ metav1.PatchOptions, _ ...string) (*rbacv1.Role, error) {
+	return planApply(ctx, c.planner, "Role", c.namespace, name, pt, data, &rbacv1.Role{}, c.RoleInterface.Get)
+}
+
+func (c *dryRunRoles) Delete(ctx context.Context, name string, _ metav1.DeleteOptions) error {
+	return planDelete(ctx, c.planner, "Role", c.namespace, name, c.RoleInterface.Get)
+}
+
+func (c *dryRunRoles) List(ctx context.Context, opts metav1.ListOptions) (*rbacv1.RoleList, error) {
+	list, err := c.RoleInterface.List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	items := list.Items[:0]
+	for _, item := range list.Items {
+		if !c.isDeleted("Role", c.namespace, item.Name) {
+			items = append(items, item)
+		}
+	}
+	list.Items = items
+	return list, nil
+}
+
+type dryRunRoleBindings struct {
+	rbacv1client.RoleBindingInterface
+	*planner
+	namespace string
+}
+
+func (c *dryRunRoleBindings) Get(ctx context.Context, name string, _ metav1.GetOptions) (*rbacv1.RoleBinding, error) {
+	return planGet(ctx, c.planner, "RoleBinding", c.namespace, name, c.RoleBindingInterface.Get)
+}
+
+func (c *dryRunRoleBindings) Create(ctx context.Context, rb *rbacv1.RoleBinding, _ metav1.CreateOptions) (*rbacv1.RoleBinding, error) {
+	return planCreate(ctx, c.planner, "RoleBinding", withNamespace(rb, c.namespace), c.RoleBindingInterface.Get)
+}
+
+func (c *dryRunRoleBindings) Update(ctx context.Context, rb *rbacv1.RoleBinding, _ metav1.UpdateOptions) (*rbacv1.RoleBinding, error) {
+	return planUpdate(ctx, c.planner, "RoleBinding", withNamespace(rb, c.namespace), c.RoleBindingInterface.Get)
+}
+
+func (c *dryRunRoleBindings) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, _ metav1.PatchOptions, _ ...string) (*rbacv1.RoleBinding, error) {
+	return planApply(ctx, c.planner, "RoleBinding", c.namespace, name, pt, data, &rbacv1.RoleBinding{}, c.RoleBindingInterface.Get)
+}
+
+func (c *dryRunRoleBindings) Delete(ctx context.Context, name string, _ metav1.DeleteOptions) error {
+	return planDelete(ctx, c.planner, "RoleBinding", c.namespace, name, c.RoleBindingInterface.Get)
+}
+
+func (c *dryRunRoleBindings) List(ctx context.Context, opts metav1.ListOptions) (*rbacv1.RoleBindingList, error) {
+	list, err := c.RoleBindingInterface.List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	items := list.Items[:0]
+	for _, item := range list.Items {
+		if !c.isDeleted("RoleBinding", c.namespace, item.Name) {
+			items = append(items, item)
+		}
+	}
+	list.Items = items
+	return list, nil
+}
+
+type dryRunClusterRoles struct {
+	rbacv1client.ClusterRoleInterface
+	*planner
+}
+
+func (c *dryRunClusterRoles) Get(ctx context.Context, name string, _ metav1.GetOptions) (*rbacv1.ClusterRole, error) {
+	return planGet(ctx, c.planner, "ClusterRole", "", name, c.ClusterRoleInterface.Get)
+}
+
+func (c *dryRunClusterRoles) Create(ctx context.Context, cr *rbacv1.ClusterRole, _ metav1.CreateOptions) (*rbacv1.ClusterRole, error) {
+	return planCreate(ctx, c.planner, "ClusterRole", cr, c.ClusterRoleInterface.Get)
+}
+
+func (c *dryRunClusterRoles) Update(ctx context.Context, cr *rbacv1.ClusterRole, _ metav1.UpdateOptions) (*rbacv1.ClusterRole, error) {
+	return planUpdate(ctx, c.planner, "ClusterRole", cr, c.ClusterRoleInterface.Get)
+}
+
+func (c *dryRunClusterRoles) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, _ metav1.PatchOptions, _ ...string) (*rbacv1.ClusterRole, error) {
+	return planApply(ctx, c.planner, "ClusterRole", "", name, pt, data, &rbacv1.ClusterRole{}, c.ClusterRoleInterface.Get)
+}
+
+func (c *dryRunClusterRoles) Delete(ctx context.Context, name string, _ metav1.DeleteOptions) error {
+	return planDelete(ctx, c.planner, "ClusterRole", "", name, c.ClusterRoleInterface.Get)
+}
+
+func (c *dryRunClusterRoles) List(ctx context.Context, opts metav1.ListOptions) (*rbacv1.ClusterRoleList, error) {
+	list, err := c.ClusterRoleInterface.List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	items := list.Items[:0]
+	for _, item := range list.Items {
+		if !c.isDeleted("ClusterRole", "", item.Name) {
+			items = append(items, item)
+		}
+	}
+	list.Items = items
+	return list, nil
+}
+
+type dryRunClusterRoleBindings struct {
+	rbacv1client.ClusterRoleBindingInterface
+	*planner
+}
+
+func (c *dryRunClusterRoleBindings) Get(ctx context.Context, name string, _ metav1.GetOptions) (*rbacv1.ClusterRoleBinding, error) {
+	return planGet(ctx, c.planner, "ClusterRoleBinding", "", name, c.ClusterRoleBindingInterface.Get)
+}
+
+func (c *dryRunClusterRoleBindings) Create(ctx context.Context, crb *rbacv1.ClusterRoleBinding, _ metav1.CreateOptions) (*rbacv1.ClusterRoleBinding, error) {
+	return planCreate(ctx, c.planner, "ClusterRoleBinding", crb, c.ClusterRoleBindingInterface.Get)
+}
+
+func (c *dryRunClusterRoleBindings) Update(ctx context.Context, crb *rbacv1.ClusterRoleBinding, _ metav1.UpdateOptions) (*rbacv1.ClusterRoleBinding, error) {
+	return planUpdate(ctx, c.planner, "ClusterRoleBinding", crb, c.ClusterRoleBindingInterface.Get)
+}
+
+func (c *dryRunClusterRoleBindings) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, _ metav1.PatchOptions, _ ...string) (*rbacv1.ClusterRoleBinding, error) {
+	return planApply(ctx, c.planner, "ClusterRoleBinding", "", name, pt, data, &rbacv1.ClusterRoleBinding{}, c.ClusterRoleBindingInterface.Get)
+}
+
+func (c *dryRunClusterRoleBindings) Delete(ctx context.Context, name string, _ metav1.DeleteOptions) error {
+	return planDelete(ctx, c.planner, "ClusterRoleBinding", "", name, c.ClusterRoleBindingInterface.Get)
+}
+
+func (c *dryRunClusterRoleBindings) List(ctx context.Context, opts metav1.ListOptions) (*rbacv1.ClusterRoleBindingList, error) {
+	list, err := c.ClusterRoleBindingInterface.List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	items := list.Items[:0]
+	for _, item := range list.Items {
+		if !c.isDeleted("ClusterRoleBinding", "", item.Name) {
+			items = append(items, item)
+		}
+	}
+	list.Items = items
+	return list, nil
+}
+
+// withNamespace returns a copy of the object with the namespace of the client it is written with, the same way the
+// API server defaults it.
+func withNamespace[T plannedObject](obj T, namespace string) T {
+	if obj.GetNamespace() != "" {
+		return obj
+	}
+	c := obj.DeepCopyObject().(T)
+	c.SetNamespace(namespace)
+	return c
+}
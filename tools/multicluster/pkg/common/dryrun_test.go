@@ -0,0 +1,152 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDryRun_MakesNoChanges(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	flags.DryRun = true
+	flags.InstallDatabaseRoles = true
+	clientMap := getClientResources(ctx, flags)
+
+	plan := NewPlan()
+	dryRunClientMap := NewDryRunClientMap(clientMap, plan)
+	require.NoError(t, EnsureMultiClusterResources(ctx, flags, dryRunClientMap))
+	require.NoError(t, ReplaceClusterMembersConfigMap(ctx, dryRunClientMap[flags.CentralCluster], flags))
+
+	for cluster, c := range clientMap {
+		namespaces, err := c.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, namespaces.Items, "no namespaces should be created in cluster %s", cluster)
+
+		roles, err := c.RbacV1().ClusterRoles().List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, roles.Items, "no cluster roles should be created in cluster %s", cluster)
+	}
+
+	planned := plannedActions(plan)
+	for _, a := range plan.Actions() {
+		assert.Equal(t, ActionCreate, a.Action, "%s %s/%s should be created", a.Kind, a.Namespace, a.Name)
+	}
+
+	for _, cluster := range flags.MemberClusters {
+		assert.Contains(t, planned, planKey(cluster, "Namespace", "", flags.MemberClusterNamespace))
+		assert.Contains(t, planned, planKey(cluster, "ServiceAccount", flags.CentralClusterNamespace, flags.ServiceAccount))
+		assert.Contains(t, planned, planKey(cluster, "Role", flags.MemberClusterNamespace, buildMemberEntityRole(flags, flags.MemberClusterNamespace).Name))
+		assert.Contains(t, planned, planKey(cluster, "ServiceAccount", flags.MemberClusterNamespace, AppdbServiceAccount))
+	}
+	assert.Contains(t, planned, planKey(flags.CentralCluster, "Secret", flags.CentralClusterNamespace, KubeConfigSecretName))
+	assert.Contains(t, planned, planKey(flags.CentralCluster, "ConfigMap", flags.CentralClusterNamespace, DefaultOperatorConfigMapName))
+}
+
+func TestDryRun_ReportsNoChanges_AfterSetup(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	clientMap := getClientResources(ctx, flags)
+	require.NoError(t, EnsureMultiClusterResources(ctx, flags, clientMap))
+	require.NoError(t, ReplaceClusterMembersConfigMap(ctx, clientMap[flags.CentralCluster], flags))
+
+	flags.DryRun = true
+	plan := NewPlan()
+	dryRunClientMap := NewDryRunClientMap(clientMap, plan)
+	require.NoError(t, EnsureMultiClusterResources(ctx, flags, dryRunClientMap))
+	require.NoError(t, ReplaceClusterMembersConfigMap(ctx, dryRunClientMap[flags.CentralCluster], flags))
+
+	require.NotEmpty(t, plan.Actions())
+	for _, a := range plan.Actions() {
+		assert.Equal(t, ActionUnchanged, a.Action, "%s %s/%s should be unchanged: %v", a.Kind, a.Namespace, a.Name, a.Diff)
+	}
+}
+
+func TestDryRun_ReportsFieldDiff(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	clientMap := getClientResources(ctx, flags)
+	require.NoError(t, ReplaceClusterMembersConfigMap(ctx, clientMap[flags.CentralCluster], flags))
+
+	plan := NewPlan()
+	flags.MemberClusters = append(flags.MemberClusters, "member-cluster-3")
+	require.NoError(t, ReplaceClusterMembersConfigMap(ctx, NewDryRunKubeClient(flags.CentralCluster, clientMap[flags.CentralCluster], plan), flags))
+
+	actions := plan.Actions()
+	require.Len(t, actions, 1)
+	assert.Equal(t, ActionUpdate, actions[0].Action)
+	assert.Equal(t, []FieldDiff{{Path: "data.member-cluster-3", Live: "<none>", Desired: `""`}}, actions[0].Diff)
+
+	cm, err := clientMap[flags.CentralCluster].CoreV1().ConfigMaps(flags.CentralClusterNamespace).Get(ctx, DefaultOperatorConfigMapName, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.NotContains(t, cm.Data, "member-cluster-3")
+}
+
+func TestDryRun_DeletedObjects_AreCreatedAgain(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, true)
+	clientMap := getClientResources(ctx, flags)
+	require.NoError(t, EnsureMultiClusterResources(ctx, flags, clientMap))
+
+	flags.DryRun = true
+	plan := NewPlan()
+	require.NoError(t, EnsureMultiClusterResources(ctx, flags, NewDryRunClientMap(clientMap, plan)))
+
+	planned := plannedActions(plan)
+	role := buildMemberEntityRole(flags, flags.MemberClusterNamespace)
+	assert.Equal(t, ActionCreate, planned[planKey(flags.MemberClusters[0], "Role", role.Namespace, role.Name)].Action)
+
+	_, err := clientMap[flags.MemberClusters[0]].RbacV1().Roles(role.Namespace).Get(ctx, role.Name, metav1.GetOptions{})
+	assert.NoError(t, err, "role should not have been deleted")
+}
+
+func TestDiffObjects_MasksSecretData(t *testing.T) {
+	live := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "s", Namespace: "ns", ResourceVersion: "12"},
+		Data:       map[string][]byte{"kubeconfig": []byte("old")},
+	}
+	desired := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "s", Namespace: "ns", Labels: map[string]string{"multi-cluster": "true"}},
+		Data:       map[string][]byte{"kubeconfig": []byte("new")},
+	}
+
+	diff, err := diffObjects("Secret", live, desired)
+	require.NoError(t, err)
+	assert.Equal(t, []FieldDiff{
+		{Path: "data.kubeconfig", Live: sensitiveValue, Desired: sensitiveValue},
+		{Path: "metadata.labels.multi-cluster", Live: "<none>", Desired: `"true"`},
+	}, diff)
+}
+
+func TestPlan_Print(t *testing.T) {
+	plan := NewPlan()
+	plan.record(PlannedAction{Cluster: "cluster-1", Kind: "Namespace", Name: "mongodb", Action: ActionCreate})
+	plan.record(PlannedAction{Cluster: "cluster-1", Kind: "ConfigMap", Namespace: "mongodb", Name: "members", Action: ActionUpdate, Diff: []FieldDiff{{Path: "data.cluster-2", Live: "<none>", Desired: `""`}}})
+	plan.record(PlannedAction{Cluster: "cluster-2", Kind: "Namespace", Name: "mongodb", Action: ActionUnchanged})
+
+	buf := &bytes.Buffer{}
+	plan.Print(buf)
+
+	assert.Equal(t, `Cluster cluster-1:
+  create     Namespace mongodb
+  update     ConfigMap mongodb/members
+      data.cluster-2: <none> -> ""
+
+Cluster cluster-2:
+  unchanged  Namespace mongodb
+
+`, buf.String())
+}
+
+func plannedActions(plan *Plan) map[string]PlannedAction {
+	planned := map[string]PlannedAction{}
+	for _, a := range plan.Actions() {
+		planned[planKey(a.Cluster, a.Kind, a.Namespace, a.Name)] = a
+	}
+	return planned
+}
@@ -0,0 +1,179 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"golang.org/x/xerrors"
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+// HelmValues are the values of the enterprise-operator Helm chart that have to match the objects created by setup.
+type HelmValues struct {
+	Namespace    string                 `json:"namespace"`
+	Operator     HelmOperatorValues     `json:"operator"`
+	MultiCluster HelmMultiClusterValues `json:"multiCluster"`
+}
+
+type HelmOperatorValues struct {
+	// Name is the name of the operator's Deployment and ServiceAccount.
+	Name string `json:"name"`
+	// WatchNamespace is the comma separated list of namespaces watched by the operator, or * for all namespaces.
+	WatchNamespace string `json:"watchNamespace"`
+	// CreateOperatorServiceAccount is false, the ServiceAccount is created by setup.
+	CreateOperatorServiceAccount bool `json:"createOperatorServiceAccount"`
+}
+
+type HelmMultiClusterValues struct {
+	// Clusters are the member clusters, as named in the KubeConfig secret.
+	Clusters []string `json:"clusters"`
+	// KubeConfigSecretName is the secret holding the kubeconfig of the member clusters.
+	KubeConfigSecretName string `json:"kubeConfigSecretName"`
+}
+
+// NewHelmValues returns the Helm values of the operator installation described by the flags.
+func NewHelmValues(f Flags) HelmValues {
+	_, serviceAccount := f.serviceAccountFor(f.CentralCluster)
+	watchNamespace := "*"
+	if !f.ClusterScoped {
+		watchNamespace = strings.Join(f.clusterNamespaces(f.CentralCluster), ",")
+	}
+	return HelmValues{
+		Namespace: f.CentralClusterNamespace,
+		Operator: HelmOperatorValues{
+			Name:                         serviceAccount,
+			WatchNamespace:               watchNamespace,
+			CreateOperatorServiceAccount: false,
+		},
+		MultiCluster: HelmMultiClusterValues{
+			Clusters:             f.MemberClusters,
+			KubeConfigSecretName: KubeConfigSecretName,
+		},
+	}
+}
+
+// Marshal returns the values as a values.yaml file.
+func (v HelmValues) Marshal() ([]byte, error) {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to marshal helm values: %w", err)
+	}
+	header := fmt.Sprintf("# Generated by kubectl-mongodb multicluster. The operator reads the member clusters from the ConfigMap %s/%s.\n", v.Namespace, DefaultOperatorConfigMapName)
+	return append([]byte(header), data...), nil
+}
+
+// CheckOperatorManifest returns the differences between the values and the operator Deployment in the manifest,
+// e.g. mongodb-enterprise-multi-cluster.yaml. An empty result means the manifest matches the objects created by
+// setup.
+func (v HelmValues) CheckOperatorManifest(manifest []byte) ([]string, error) {
+	deployment, err := findOperatorDeployment(manifest)
+	if err != nil {
+		return nil, err
+	}
+	if deployment == nil {
+		return []string{"no operator Deployment found in the manifest"}, nil
+	}
+	return v.checkOperatorDeployment(deployment), nil
+}
+
+// checkOperatorDeployment returns the differences between the values and the operator Deployment.
+func (v HelmValues) checkOperatorDeployment(deployment *appsv1.Deployment) []string {
+	var problems []string
+	addProblem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if deployment.Name != v.Operator.Name {
+		addProblem("Deployment name %s differs from operator.name %s", deployment.Name, v.Operator.Name)
+	}
+	if deployment.Namespace != v.Namespace {
+		addProblem("Deployment namespace %s differs from namespace %s", deployment.Namespace, v.Namespace)
+	}
+	podSpec := deployment.Spec.Template.Spec
+	if podSpec.ServiceAccountName != v.Operator.Name {
+		addProblem("Deployment serviceAccountName %s differs from the ServiceAccount %s created by setup", podSpec.ServiceAccountName, v.Operator.Name)
+	}
+
+	kubeConfigSecret := ""
+	for _, volume := range podSpec.Volumes {
+		if volume.Secret != nil && volume.Name == "kube-config-volume" {
+			kubeConfigSecret = volume.Secret.SecretName
+		}
+	}
+	if kubeConfigSecret != v.MultiCluster.KubeConfigSecretName {
+		addProblem("Deployment mounts kubeconfig secret %q instead of %s", kubeConfigSecret, v.MultiCluster.KubeConfigSecretName)
+	}
+
+	for _, container := range podSpec.Containers {
+		for _, env := range container.Env {
+			if env.Name != "WATCH_NAMESPACE" {
+				continue
+			}
+			watchNamespace := env.Value
+			if env.ValueFrom != nil && env.ValueFrom.FieldRef != nil && env.ValueFrom.FieldRef.FieldPath == "metadata.namespace" {
+				watchNamespace = deployment.Namespace
+			}
+			if !sameNamespaces(watchNamespace, v.Operator.WatchNamespace) {
+				addProblem("container %s watches namespaces %q instead of %q", container.Name, watchNamespace, v.Operator.WatchNamespace)
+			}
+		}
+	}
+	return problems
+}
+
+// findOperatorDeployment returns the first Deployment of the multi document manifest, or nil if there is none.
+func findOperatorDeployment(manifest []byte) (*appsv1.Deployment, error) {
+	docs, err := readManifestDocuments(manifest)
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range docs {
+		deployment := appsv1.Deployment{}
+		if err := yaml.Unmarshal(doc, &deployment); err != nil {
+			return nil, xerrors.Errorf("failed parsing manifest: %w", err)
+		}
+		if deployment.Kind == "Deployment" {
+			return &deployment, nil
+		}
+	}
+	return nil, nil
+}
+
+func sameNamespaces(a, b string) bool {
+	split := func(namespaces string) []string {
+		var result []string
+		for _, namespace := range strings.Split(namespaces, ",") {
+			if namespace = strings.TrimSpace(namespace); namespace != "" {
+				result = append(result, namespace)
+			}
+		}
+		sort.Strings(result)
+		return result
+	}
+	return strings.Join(split(a), ",") == strings.Join(split(b), ",")
+}
+
+// WriteHelmValues writes the Helm values of the flags to path. If operatorManifest is set, the values are checked
+// against the operator Deployment in it and the differences are returned.
+func WriteHelmValues(path, operatorManifest string, f Flags) ([]string, error) {
+	values := NewHelmValues(f)
+	data, err := values.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return nil, xerrors.Errorf("failed writing helm values to %s: %w", path, err)
+	}
+	if operatorManifest == "" {
+		return nil, nil
+	}
+
+	manifest, err := os.ReadFile(operatorManifest)
+	if err != nil {
+		return nil, xerrors.Errorf("failed reading operator manifest %s: %w", operatorManifest, err)
+	}
+	return values.CheckOperatorManifest(manifest)
+}
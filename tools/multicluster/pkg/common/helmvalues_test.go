@@ -0,0 +1,76 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHelmValues(t *testing.T) {
+	flags := testFlags(t, false)
+	flags.MemberClusterNamespaces = []string{"team-a"}
+
+	values := NewHelmValues(flags)
+	assert.Equal(t, HelmValues{
+		Namespace: "central-namespace",
+		Operator: HelmOperatorValues{
+			Name:           "mongodb-enterprise-operator-multicluster",
+			WatchNamespace: "central-namespace,member-namespace,team-a",
+		},
+		MultiCluster: HelmMultiClusterValues{
+			Clusters:             []string{"member-cluster-0", "member-cluster-1", "member-cluster-2"},
+			KubeConfigSecretName: KubeConfigSecretName,
+		},
+	}, values)
+
+	flags.ClusterScoped = true
+	assert.Equal(t, "*", NewHelmValues(flags).Operator.WatchNamespace)
+}
+
+func TestHelmValues_Marshal(t *testing.T) {
+	data, err := NewHelmValues(testFlags(t, false)).Marshal()
+	require.NoError(t, err)
+	assert.Equal(t, `# Generated by kubectl-mongodb multicluster. The operator reads the member clusters from the ConfigMap central-namespace/mongodb-enterprise-operator-member-list.
+multiCluster:
+  clusters:
+  - member-cluster-0
+  - member-cluster-1
+  - member-cluster-2
+  kubeConfigSecretName: mongodb-enterprise-operator-multi-cluster-kubeconfig
+namespace: central-namespace
+operator:
+  createOperatorServiceAccount: false
+  name: mongodb-enterprise-operator-multicluster
+  watchNamespace: central-namespace,member-namespace
+`, string(data))
+}
+
+func TestHelmValues_CheckOperatorManifest(t *testing.T) {
+	manifest, err := os.ReadFile(filepath.Join("..", "..", "..", "..", "mongodb-enterprise-multi-cluster.yaml"))
+	require.NoError(t, err)
+
+	flags := Flags{
+		MemberClusters:          []string{"cluster-1", "cluster-2"},
+		CentralCluster:          "operator",
+		CentralClusterNamespace: "mongodb",
+		MemberClusterNamespace:  "mongodb",
+		ServiceAccount:          "mongodb-enterprise-operator-multi-cluster",
+	}
+	problems, err := NewHelmValues(flags).CheckOperatorManifest(manifest)
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+
+	flags.CentralClusterNamespace = "mongodb-operator"
+	flags.ServiceAccount = "operator"
+	problems, err = NewHelmValues(flags).CheckOperatorManifest(manifest)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"Deployment name mongodb-enterprise-operator-multi-cluster differs from operator.name operator",
+		"Deployment namespace mongodb differs from namespace mongodb-operator",
+		"Deployment serviceAccountName mongodb-enterprise-operator-multi-cluster differs from the ServiceAccount operator created by setup",
+		`container mongodb-enterprise-operator-multi-cluster watches namespaces "mongodb" instead of "mongodb-operator,mongodb"`,
+	}, problems)
+}
@@ -0,0 +1,279 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/10gen/ops-manager-kubernetes/multi/pkg/common/manifests"
+	"github.com/ghodss/yaml"
+	"golang.org/x/xerrors"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// DefaultOperatorReadyTimeout is how long install-operator waits for the operator to become ready.
+	DefaultOperatorReadyTimeout = 5 * time.Minute
+
+	operatorKubeConfigVolume = "kube-config-volume"
+	operatorLogTailLines     = 200
+	operatorLogErrorLines    = 10
+)
+
+var operatorLogError = regexp.MustCompile(`(?i)\berror\b`)
+
+// OperatorManifests are the objects install-operator applies to the central cluster. The operator's ServiceAccount,
+// Roles and the objects of the member clusters are created by setup instead.
+type OperatorManifests struct {
+	CRDs                []*unstructured.Unstructured
+	ClusterRoles        []*rbacv1.ClusterRole
+	ClusterRoleBindings []*rbacv1.ClusterRoleBinding
+	Deployment          *appsv1.Deployment
+}
+
+// RenderOperatorManifests returns the CRDs, the webhook ClusterRole and ClusterRoleBinding and the operator
+// Deployment of the embedded manifests, changed to match the objects created by setup with the same flags. The image
+// of the operator is replaced if image is set.
+func RenderOperatorManifests(f Flags, image string) (OperatorManifests, error) {
+	var result OperatorManifests
+	crds, err := EmbeddedCRDs()
+	if err != nil {
+		return result, err
+	}
+	result.CRDs = crds
+
+	operator, err := readManifestDocuments(manifests.MultiClusterOperator)
+	if err != nil {
+		return result, err
+	}
+	values := NewHelmValues(f)
+	for _, doc := range operator {
+		typeMeta := metav1.TypeMeta{}
+		if err := yaml.Unmarshal(doc, &typeMeta); err != nil {
+			return result, xerrors.Errorf("failed parsing operator manifest: %w", err)
+		}
+
+		switch typeMeta.Kind {
+		case "ClusterRole":
+			clusterRole := &rbacv1.ClusterRole{}
+			if err := yaml.Unmarshal(doc, clusterRole); err != nil {
+				return result, xerrors.Errorf("failed parsing operator manifest: %w", err)
+			}
+			if isWebhookObject(clusterRole.Name) {
+				result.ClusterRoles = append(result.ClusterRoles, clusterRole)
+			}
+		case "ClusterRoleBinding":
+			binding := &rbacv1.ClusterRoleBinding{}
+			if err := yaml.Unmarshal(doc, binding); err != nil {
+				return result, xerrors.Errorf("failed parsing operator manifest: %w", err)
+			}
+			if isWebhookObject(binding.Name) {
+				for i := range binding.Subjects {
+					binding.Subjects[i].Name = values.Operator.Name
+					binding.Subjects[i].Namespace = values.Namespace
+				}
+				result.ClusterRoleBindings = append(result.ClusterRoleBindings, binding)
+			}
+		case "Deployment":
+			deployment := &appsv1.Deployment{}
+			if err := yaml.Unmarshal(doc, deployment); err != nil {
+				return result, xerrors.Errorf("failed parsing operator manifest: %w", err)
+			}
+			templateOperatorDeployment(deployment, values, image)
+			result.Deployment = deployment
+		}
+	}
+	if result.Deployment == nil {
+		return result, xerrors.Errorf("no operator Deployment found in the embedded manifests")
+	}
+	return result, nil
+}
+
+func isWebhookObject(name string) bool {
+	return strings.Contains(name, "webhook")
+}
+
+// templateOperatorDeployment sets the name, namespace, ServiceAccount, watched namespaces and kubeconfig secret of
+// the operator Deployment to the ones of the Helm values.
+func templateOperatorDeployment(deployment *appsv1.Deployment, values HelmValues, image string) {
+	deployment.Name = values.Operator.Name
+	deployment.Namespace = values.Namespace
+	for _, l := range []map[string]string{deployment.Spec.Selector.MatchLabels, deployment.Spec.Template.Labels} {
+		for _, key := range []string{"app.kubernetes.io/name", "app.kubernetes.io/instance"} {
+			if _, ok := l[key]; ok {
+				l[key] = values.Operator.Name
+			}
+		}
+	}
+
+	podSpec := &deployment.Spec.Template.Spec
+	podSpec.ServiceAccountName = values.Operator.Name
+	for i := range podSpec.Volumes {
+		if podSpec.Volumes[i].Name == operatorKubeConfigVolume && podSpec.Volumes[i].Secret != nil {
+			podSpec.Volumes[i].Secret.SecretName = values.MultiCluster.KubeConfigSecretName
+		}
+	}
+	for i := range podSpec.Containers {
+		container := &podSpec.Containers[i]
+		if image != "" {
+			container.Image = image
+		}
+		for j := range container.Env {
+			if container.Env[j].Name == "WATCH_NAMESPACE" {
+				container.Env[j] = corev1.EnvVar{Name: "WATCH_NAMESPACE", Value: values.Operator.WatchNamespace}
+			}
+		}
+	}
+}
+
+// InstallOperator applies the operator manifests to the central cluster and waits for the operator to become ready.
+// CRDs that are already installed are left untouched. The member list ConfigMap and KubeConfig secret have to be
+// created by setup first. If the operator doesn't become ready within timeout, the returned error includes the state
+// of its pods and the errors they logged.
+func InstallOperator(ctx context.Context, f Flags, c KubeClient, image string, timeout time.Duration) error {
+	if _, err := c.CoreV1().ConfigMaps(f.CentralClusterNamespace).Get(ctx, DefaultOperatorConfigMapName, metav1.GetOptions{}); err != nil {
+		return xerrors.Errorf("failed getting the member list ConfigMap %s/%s in cluster %s, run setup first: %w", f.CentralClusterNamespace, DefaultOperatorConfigMapName, f.CentralCluster, err)
+	}
+	if _, err := c.CoreV1().Secrets(f.CentralClusterNamespace).Get(ctx, KubeConfigSecretName, metav1.GetOptions{}); err != nil {
+		return xerrors.Errorf("failed getting the KubeConfig secret %s/%s in cluster %s, run setup first: %w", f.CentralClusterNamespace, KubeConfigSecretName, f.CentralCluster, err)
+	}
+
+	operator, err := RenderOperatorManifests(f, image)
+	if err != nil {
+		return err
+	}
+
+	// installed CRDs are only changed by crds upgrade, which checks that the existing resources stay valid first
+	if err := installClusterCRDs(ctx, c, f.CentralCluster, operator.CRDs, false); err != nil {
+		return err
+	}
+	for _, clusterRole := range operator.ClusterRoles {
+		logger.Info("Applying ClusterRole", "cluster", f.CentralCluster, "name", clusterRole.Name)
+		if _, err := applyObject(ctx, c.RbacV1().ClusterRoles(), clusterRole); err != nil {
+			return xerrors.Errorf("failed applying ClusterRole %s: %w", clusterRole.Name, err)
+		}
+	}
+	for _, binding := range operator.ClusterRoleBindings {
+		logger.Info("Applying ClusterRoleBinding", "cluster", f.CentralCluster, "name", binding.Name)
+		if _, err := applyObject(ctx, c.RbacV1().ClusterRoleBindings(), binding); err != nil {
+			return xerrors.Errorf("failed applying ClusterRoleBinding %s: %w", binding.Name, err)
+		}
+	}
+
+	deployment := operator.Deployment
+	logger.Info("Applying Deployment", "cluster", f.CentralCluster, "namespace", deployment.Namespace, "name", deployment.Name)
+	applied, err := applyObject(ctx, c.AppsV1().Deployments(deployment.Namespace), deployment)
+	if err != nil {
+		return xerrors.Errorf("failed applying Deployment %s/%s: %w", deployment.Namespace, deployment.Name, err)
+	}
+
+	logger.Info("Waiting for the operator to become ready", "cluster", f.CentralCluster, "namespace", deployment.Namespace, "name", deployment.Name)
+	if err := waitForOperator(ctx, c, applied, timeout); err != nil {
+		diagnostics := operatorDiagnostics(ctx, c, applied)
+		if len(diagnostics) == 0 {
+			return err
+		}
+		return xerrors.Errorf("%w:\n  - %s", err, strings.Join(diagnostics, "\n  - "))
+	}
+	logger.Info("The operator is ready", "cluster", f.CentralCluster, "namespace", deployment.Namespace, "name", deployment.Name)
+	return nil
+}
+
+// waitForOperator waits until the rollout of the operator Deployment is complete, see deploymentRolledOut.
+func waitForOperator(ctx context.Context, c KubeClient, deployment *appsv1.Deployment, timeout time.Duration) error {
+	err := wait.PollUntilContextTimeout(ctx, time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+		current, err := c.AppsV1().Deployments(deployment.Namespace).Get(ctx, deployment.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return deploymentRolledOut(current)
+	})
+	if err != nil {
+		return xerrors.Errorf("the operator %s/%s did not become ready: %w", deployment.Namespace, deployment.Name, err)
+	}
+	return nil
+}
+
+// deploymentRolledOut returns true once all the replicas of the Deployment are updated and available, and the old
+// ones are gone, like kubectl rollout status. During an upgrade the old replica stays available until the new one is
+// ready, so an available replica alone doesn't mean the new version works.
+func deploymentRolledOut(deployment *appsv1.Deployment) (bool, error) {
+	if deployment.Status.ObservedGeneration < deployment.Generation {
+		return false, nil
+	}
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == appsv1.DeploymentProgressing && condition.Reason == "ProgressDeadlineExceeded" {
+			return false, xerrors.Errorf("the rollout exceeded its progress deadline: %s", condition.Message)
+		}
+	}
+	replicas := ptr.Deref(deployment.Spec.Replicas, 1)
+	status := deployment.Status
+	return status.UpdatedReplicas == replicas && status.Replicas == status.UpdatedReplicas && status.AvailableReplicas == status.UpdatedReplicas, nil
+}
+
+// operatorDiagnostics returns why the containers of the operator pods are not ready and the first errors they
+// logged.
+func operatorDiagnostics(ctx context.Context, c KubeClient, deployment *appsv1.Deployment) []string {
+	selector := labels.SelectorFromSet(deployment.Spec.Selector.MatchLabels).String()
+	pods, err := c.CoreV1().Pods(deployment.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return []string{fmt.Sprintf("failed listing the operator pods: %s", err)}
+	}
+
+	var diagnostics []string
+	for _, pod := range pods.Items {
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.State.Waiting != nil {
+				diagnostics = append(diagnostics, fmt.Sprintf("pod %s container %s is waiting: %s %s", pod.Name, status.Name, status.State.Waiting.Reason, status.State.Waiting.Message))
+			}
+			if status.LastTerminationState.Terminated != nil {
+				terminated := status.LastTerminationState.Terminated
+				diagnostics = append(diagnostics, fmt.Sprintf("pod %s container %s terminated with exit code %d: %s %s", pod.Name, status.Name, terminated.ExitCode, terminated.Reason, terminated.Message))
+			}
+		}
+
+		logs, err := c.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{TailLines: ptr.To(int64(operatorLogTailLines))}).DoRaw(ctx)
+		if err != nil {
+			continue
+		}
+		errorLines := 0
+		for _, line := range strings.Split(string(logs), "\n") {
+			if errorLines < operatorLogErrorLines && operatorLogError.MatchString(line) {
+				diagnostics = append(diagnostics, fmt.Sprintf("pod %s logged: %s", pod.Name, strings.TrimSpace(line)))
+				errorLines++
+			}
+		}
+	}
+	return diagnostics
+}
+
+// readManifestDocuments splits a multi document YAML manifest into its non-empty documents.
+func readManifestDocuments(manifest []byte) ([][]byte, error) {
+	var docs [][]byte
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(manifest)))
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, xerrors.Errorf("failed reading manifest: %w", err)
+		}
+		if len(bytes.TrimSpace(doc)) > 0 {
+			docs = append(docs, doc)
+		}
+	}
+}
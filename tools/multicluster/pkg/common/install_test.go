@@ -0,0 +1,154 @@
+package common
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/utils/ptr"
+)
+
+func TestRenderOperatorManifests(t *testing.T) {
+	flags := testFlags(t, false)
+	flags.MemberClusterNamespaces = []string{"team-a"}
+
+	operator, err := RenderOperatorManifests(flags, "quay.io/mongodb/mongodb-enterprise-operator-ubi:1.34.0")
+	require.NoError(t, err)
+
+	var crds []string
+	for _, crd := range operator.CRDs {
+		crds = append(crds, crd.GetName())
+	}
+	assert.ElementsMatch(t, []string{"mongodb.mongodb.com", "mongodbmulticluster.mongodb.com", "mongodbusers.mongodb.com", "opsmanagers.mongodb.com"}, crds)
+
+	require.Len(t, operator.ClusterRoles, 1)
+	assert.Equal(t, "mongodb-enterprise-operator-mongodb-webhook", operator.ClusterRoles[0].Name)
+	require.Len(t, operator.ClusterRoleBindings, 1)
+	assert.Equal(t, "mongodb-enterprise-operator-multicluster", operator.ClusterRoleBindings[0].Subjects[0].Name)
+	assert.Equal(t, "central-namespace", operator.ClusterRoleBindings[0].Subjects[0].Namespace)
+
+	deployment := operator.Deployment
+	assert.Equal(t, "mongodb-enterprise-operator-multicluster", deployment.Name)
+	assert.Equal(t, "central-namespace", deployment.Namespace)
+	assert.Equal(t, "mongodb-enterprise-operator-multicluster", deployment.Spec.Selector.MatchLabels["app.kubernetes.io/name"])
+	assert.Equal(t, "mongodb-enterprise-operator-multicluster", deployment.Spec.Template.Labels["app.kubernetes.io/name"])
+	assert.Equal(t, "mongodb-enterprise-operator-multicluster", deployment.Spec.Template.Spec.ServiceAccountName)
+	assert.Equal(t, "quay.io/mongodb/mongodb-enterprise-operator-ubi:1.34.0", deployment.Spec.Template.Spec.Containers[0].Image)
+	assert.Contains(t, deployment.Spec.Template.Spec.Containers[0].Env, corev1.EnvVar{Name: "WATCH_NAMESPACE", Value: "central-namespace,member-namespace,team-a"})
+	assert.Equal(t, KubeConfigSecretName, deployment.Spec.Template.Spec.Volumes[0].Secret.SecretName)
+
+	// the rendered Deployment matches the Helm values of the same flags
+	problems := NewHelmValues(flags).checkOperatorDeployment(deployment)
+	assert.Empty(t, problems)
+}
+
+func TestInstallOperator_RequiresSetup(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	client := NewKubeClientContainer(nil, newFakeClientset(ctx, flags.CentralCluster, nil), nil)
+
+	err := InstallOperator(ctx, flags, client, "", time.Second)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed getting the member list ConfigMap central-namespace/mongodb-enterprise-operator-member-list in cluster central-cluster, run setup first")
+}
+
+func TestInstallOperator_LeavesInstalledCRDsUntouched(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	crds, err := EmbeddedCRDs()
+	require.NoError(t, err)
+	var installed []runtime.Object
+	for _, crd := range crds {
+		installed = append(installed, crd.DeepCopy())
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{crdResource: "CustomResourceDefinitionList"}, installed...)
+	setupObjects := []runtime.Object{
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: DefaultOperatorConfigMapName, Namespace: flags.CentralClusterNamespace}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: KubeConfigSecretName, Namespace: flags.CentralClusterNamespace}},
+	}
+	client := NewKubeClientContainer(nil, newFakeClientset(ctx, flags.CentralCluster, setupObjects), dynamicClient)
+
+	err = InstallOperator(ctx, flags, client, "", time.Millisecond)
+	require.Error(t, err, "the fake operator never becomes ready")
+
+	for _, action := range dynamicClient.Actions() {
+		assert.NotEqual(t, "patch", action.GetVerb(), "installed CRDs must only be changed by crds upgrade")
+	}
+}
+
+func TestWaitForOperator(t *testing.T) {
+	ctx := context.Background()
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "operator", Namespace: "mongodb", Generation: 2},
+		Status:     appsv1.DeploymentStatus{ObservedGeneration: 1, Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1},
+	}
+	client := NewKubeClientContainer(nil, newFakeClientset(ctx, "central", []runtime.Object{deployment}), nil)
+
+	err := waitForOperator(ctx, client, deployment, 1500*time.Millisecond)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "the operator mongodb/operator did not become ready")
+
+	deployment.Status.ObservedGeneration = 2
+	_, err = client.AppsV1().Deployments("mongodb").UpdateStatus(ctx, deployment, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	require.NoError(t, waitForOperator(ctx, client, deployment, 1500*time.Millisecond))
+}
+
+func TestWaitForOperator_WaitsForTheOldReplicaToBeReplaced(t *testing.T) {
+	ctx := context.Background()
+	// the new replica is updated but not ready, the old one is still available
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "operator", Namespace: "mongodb", Generation: 2},
+		Spec:       appsv1.DeploymentSpec{Replicas: ptr.To(int32(1))},
+		Status:     appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 1, AvailableReplicas: 1},
+	}
+	client := NewKubeClientContainer(nil, newFakeClientset(ctx, "central", []runtime.Object{deployment}), nil)
+
+	err := waitForOperator(ctx, client, deployment, 1500*time.Millisecond)
+	require.Error(t, err, "the old replica being available doesn't make the new version ready")
+
+	deployment.Status = appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1}
+	_, err = client.AppsV1().Deployments("mongodb").UpdateStatus(ctx, deployment, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	require.NoError(t, waitForOperator(ctx, client, deployment, 1500*time.Millisecond))
+
+	deployment.Generation = 3
+	deployment.Status = appsv1.DeploymentStatus{
+		ObservedGeneration: 3, Replicas: 2, UpdatedReplicas: 1, AvailableReplicas: 1,
+		Conditions: []appsv1.DeploymentCondition{{Type: appsv1.DeploymentProgressing, Reason: "ProgressDeadlineExceeded", Message: `ReplicaSet "operator-7d4b9c" has timed out progressing.`}},
+	}
+	_, err = client.AppsV1().Deployments("mongodb").Update(ctx, deployment, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	err = waitForOperator(ctx, client, deployment, time.Minute)
+	assert.ErrorContains(t, err, "the rollout exceeded its progress deadline")
+}
+
+func TestOperatorDiagnostics(t *testing.T) {
+	ctx := context.Background()
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "operator", Namespace: "mongodb"},
+		Spec:       appsv1.DeploymentSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app.kubernetes.io/name": "operator"}}},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "operator-abc", Namespace: "mongodb", Labels: map[string]string{"app.kubernetes.io/name": "operator"}},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+			Name:                 "operator",
+			State:                corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff", Message: "back-off restarting failed container"}},
+			LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Reason: "Error"}},
+		}}},
+	}
+	client := NewKubeClientContainer(nil, newFakeClientset(ctx, "central", []runtime.Object{pod}), nil)
+
+	assert.Equal(t, []string{
+		"pod operator-abc container operator is waiting: CrashLoopBackOff back-off restarting failed container",
+		"pod operator-abc container operator terminated with exit code 1: Error ",
+	}, operatorDiagnostics(ctx, client, deployment))
+}
@@ -7,6 +7,7 @@ import (
 	"golang.org/x/xerrors"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 	"k8s.io/client-go/util/homedir"
@@ -38,6 +39,32 @@ func GetMemberClusterApiServerUrls(kubeconfig *clientcmdapi.Config, clusterNames
 	return urls, nil
 }
 
+// FillMemberClusterApiServerUrls sets the api server urls of the member clusters that don't have one yet to the
+// server of their context's cluster in the given kubeconfig.
+func FillMemberClusterApiServerUrls(kubeconfig *clientcmdapi.Config, flags *Flags) error {
+	for i, cluster := range flags.MemberClusters {
+		if i < len(flags.MemberClusterApiServerUrls) && flags.MemberClusterApiServerUrls[i] != "" {
+			continue
+		}
+
+		context := flags.ClusterContext(cluster)
+		kubeConfigClusterName := context
+		if c := kubeconfig.Contexts[context]; c != nil {
+			kubeConfigClusterName = c.Cluster
+		}
+		urls, err := GetMemberClusterApiServerUrls(kubeconfig, []string{kubeConfigClusterName})
+		if err != nil {
+			return xerrors.Errorf("failed to find the api server of member cluster %s: %w", cluster, err)
+		}
+
+		for len(flags.MemberClusterApiServerUrls) <= i {
+			flags.MemberClusterApiServerUrls = append(flags.MemberClusterApiServerUrls, "")
+		}
+		flags.MemberClusterApiServerUrls[i] = urls[0]
+	}
+	return nil
+}
+
 // CreateClientMap crates a map of all MultiClusterClient for every member cluster, and the operator cluster.
 func CreateClientMap(memberClusters []string, operatorCluster, kubeConfigPath string, getClient func(clusterName string, kubeConfigPath string) (KubeClient, error)) (map[string]KubeClient, error) {
 	clientMap := map[string]KubeClient{}
@@ -69,6 +96,23 @@ func GetKubernetesClient(context, kubeConfigPath string) (KubeClient, error) {
 		return nil, xerrors.Errorf("failed to create client config: %w", err)
 	}
 
+	client, err := newKubeClientForConfig(configureRestConfig(config, context))
+	if err != nil {
+		return nil, err
+	}
+	return NewRetryingKubeClient(context, client), nil
+}
+
+// NewKubeClientForConfig returns a KubeClient with static and dynamic clients for the given REST configuration.
+func NewKubeClientForConfig(config *rest.Config) (KubeClient, error) {
+	client, err := newKubeClientForConfig(configureRestConfig(config, config.Host))
+	if err != nil {
+		return nil, err
+	}
+	return NewRetryingKubeClient(config.Host, client), nil
+}
+
+func newKubeClientForConfig(config *rest.Config) (KubeClient, error) {
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
 		return nil, xerrors.Errorf("failed to create kubernetes clientset: %w", err)
@@ -0,0 +1,141 @@
+package common
+
+import (
+	"strings"
+
+	"golang.org/x/xerrors"
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+const (
+	MongoDBKind             = "MongoDB"
+	MongoDBMultiClusterKind = "MongoDBMultiCluster"
+	MongoDBUserKind         = "MongoDBUser"
+	MongoDBOpsManagerKind   = "MongoDBOpsManager"
+)
+
+// ManagedKinds are the kinds of custom resources that can be passed with --managed-kinds, in the order their rules
+// are generated.
+var ManagedKinds = []string{MongoDBKind, MongoDBMultiClusterKind, MongoDBUserKind, MongoDBOpsManagerKind}
+
+// managedKindResources maps each managed kind to its resource, and whether it has a finalizers subresource.
+var managedKindResources = map[string]struct {
+	resource   string
+	finalizers bool
+}{
+	MongoDBKind:             {"mongodb", true},
+	MongoDBMultiClusterKind: {"mongodbmulticluster", true},
+	MongoDBUserKind:         {"mongodbusers", false},
+	MongoDBOpsManagerKind:   {"opsmanagers", true},
+}
+
+func validateManagedKinds(kinds []string) error {
+	for _, kind := range kinds {
+		if _, ok := managedKindResources[kind]; !ok {
+			return xerrors.Errorf("unknown managed kind %s, supported kinds are %s", kind, strings.Join(ManagedKinds, ", "))
+		}
+	}
+	return nil
+}
+
+// manages returns true if the operator manages the kind.
+func (f Flags) manages(kind string) bool {
+	return Contains(f.ManagedKinds, kind)
+}
+
+// baseCentralRules returns the rules on the MongoDB custom resources: all verbs on every resource by default, or
+// only the verbs the operator needs on the resources of the managed kinds.
+func (f Flags) baseCentralRules() []rbacv1.PolicyRule {
+	if len(f.ManagedKinds) == 0 {
+		return getCentralRules()
+	}
+
+	var rules []rbacv1.PolicyRule
+	for _, kind := range ManagedKinds {
+		if !f.manages(kind) {
+			continue
+		}
+		r := managedKindResources[kind]
+		rules = append(rules,
+			rbacv1.PolicyRule{APIGroups: []string{MongoDBGroup}, Resources: []string{r.resource}, Verbs: []string{"get", "list", "watch", "update", "patch"}},
+			rbacv1.PolicyRule{APIGroups: []string{MongoDBGroup}, Resources: []string{r.resource + "/status"}, Verbs: []string{"get", "update", "patch"}},
+		)
+		if r.finalizers {
+			rules = append(rules, rbacv1.PolicyRule{APIGroups: []string{MongoDBGroup}, Resources: []string{r.resource + "/finalizers"}, Verbs: []string{"update"}})
+		}
+	}
+	return mergeRules(rules)
+}
+
+// baseMemberRules returns the rules on the resources the operator creates in every cluster: the default rules, or
+// only the rules needed by the managed kinds, without deletecollection.
+func (f Flags) baseMemberRules() []rbacv1.PolicyRule {
+	if len(f.ManagedKinds) == 0 {
+		return getMemberRules()
+	}
+
+	var rules []rbacv1.PolicyRule
+	if f.manages(MongoDBKind) || f.manages(MongoDBMultiClusterKind) || f.manages(MongoDBOpsManagerKind) {
+		rules = append(rules,
+			rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"secrets", "configmaps", "services"}, Verbs: []string{"get", "list", "watch", "create", "update", "delete"}},
+			rbacv1.PolicyRule{APIGroups: []string{"apps"}, Resources: []string{"statefulsets"}, Verbs: []string{"get", "list", "watch", "create", "update", "delete"}},
+			rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"persistentvolumeclaims"}, Verbs: []string{"get", "list", "watch", "create", "update", "patch"}},
+			rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list", "watch", "delete"}},
+		)
+	}
+	if f.manages(MongoDBUserKind) {
+		// the passwords of the users are read from secrets
+		rules = append(rules, rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get", "list", "watch"}})
+	}
+	return mergeRules(rules)
+}
+
+// mergeRules merges the rules granting the same verbs in the same API groups, and drops the resources that are
+// already granted a superset of the verbs by another rule.
+func mergeRules(rules []rbacv1.PolicyRule) []rbacv1.PolicyRule {
+	var merged []rbacv1.PolicyRule
+	index := map[string]int{}
+	for _, rule := range rules {
+		key := strings.Join(rule.APIGroups, ",") + "/" + strings.Join(rule.Verbs, ",")
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(merged)
+			merged = append(merged, *rule.DeepCopy())
+			continue
+		}
+		for _, resource := range rule.Resources {
+			if !Contains(merged[i].Resources, resource) {
+				merged[i].Resources = append(merged[i].Resources, resource)
+			}
+		}
+	}
+
+	var result []rbacv1.PolicyRule
+	for i, rule := range merged {
+		var resources []string
+		for _, resource := range rule.Resources {
+			if !grantedByOtherRule(merged, i, resource) {
+				resources = append(resources, resource)
+			}
+		}
+		if len(resources) > 0 {
+			rule.Resources = resources
+			result = append(result, rule)
+		}
+	}
+	return result
+}
+
+// grantedByOtherRule returns true if a rule other than rules[i] grants more verbs, including all the verbs of rules[i],
+// on the resource.
+func grantedByOtherRule(rules []rbacv1.PolicyRule, i int, resource string) bool {
+	for j, other := range rules {
+		if j == i || strings.Join(other.APIGroups, ",") != strings.Join(rules[i].APIGroups, ",") || !Contains(other.Resources, resource) {
+			continue
+		}
+		if len(other.Verbs) > len(rules[i].Verbs) && allMatch(rules[i].Verbs, other.Verbs) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package common
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestManagedKinds_GenerateMinimalRules(t *testing.T) {
+	flags := Flags{ManagedKinds: []string{MongoDBUserKind, MongoDBMultiClusterKind}}
+	require.NoError(t, flags.ValidateRBAC())
+
+	assert.Equal(t, []rbacv1.PolicyRule{
+		{APIGroups: []string{MongoDBGroup}, Resources: []string{"mongodbmulticluster", "mongodbusers"}, Verbs: []string{"get", "list", "watch", "update", "patch"}},
+		{APIGroups: []string{MongoDBGroup}, Resources: []string{"mongodbmulticluster/status", "mongodbusers/status"}, Verbs: []string{"get", "update", "patch"}},
+		{APIGroups: []string{MongoDBGroup}, Resources: []string{"mongodbmulticluster/finalizers"}, Verbs: []string{"update"}},
+	}, flags.centralRules())
+
+	// the read only rule on the secrets is dropped, as all read verbs are already granted on them
+	assert.Equal(t, []rbacv1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"secrets", "configmaps", "services"}, Verbs: []string{"get", "list", "watch", "create", "update", "delete"}},
+		{APIGroups: []string{"apps"}, Resources: []string{"statefulsets"}, Verbs: []string{"get", "list", "watch", "create", "update", "delete"}},
+		{APIGroups: []string{""}, Resources: []string{"persistentvolumeclaims"}, Verbs: []string{"get", "list", "watch", "create", "update", "patch"}},
+		{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list", "watch", "delete"}},
+	}, flags.memberRules())
+
+	for _, rule := range append(flags.centralRules(), flags.memberRules()...) {
+		assert.NotContains(t, rule.Verbs, rbacv1.VerbAll)
+		assert.NotContains(t, rule.Verbs, "deletecollection")
+	}
+}
+
+func TestManagedKinds_UsersOnly(t *testing.T) {
+	flags := Flags{ManagedKinds: []string{MongoDBUserKind}}
+
+	assert.Equal(t, []rbacv1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get", "list", "watch"}},
+	}, flags.memberRules())
+	assert.NotContains(t, buildCentralEntityRole(flags, "ns").Rules, rbacv1.PolicyRule{APIGroups: []string{MongoDBGroup}, Resources: []string{"opsmanagers"}, Verbs: []string{"get", "list", "watch", "update", "patch"}})
+}
+
+func TestValidateRBAC(t *testing.T) {
+	assert.ErrorContains(t, Flags{ManagedKinds: []string{"OpsManager"}}.ValidateRBAC(), "unknown managed kind OpsManager, supported kinds are MongoDB, MongoDBMultiCluster, MongoDBUser, MongoDBOpsManager")
+
+	removePatch := &RBACProfile{ApiVersion: TopologyApiVersion, Kind: RBACProfileKind, Central: RBACRuleSet{Remove: []rbacv1.PolicyRule{
+		{APIGroups: []string{MongoDBGroup}, Resources: []string{"mongodb"}, Verbs: []string{"patch"}},
+	}}}
+	require.NoError(t, removePatch.Validate())
+	assert.ErrorContains(t, Flags{RBACProfile: removePatch}.ValidateRBAC(), "central: cannot remove verbs patch")
+
+	flags := Flags{RBACProfile: removePatch, ManagedKinds: []string{MongoDBKind}}
+	require.NoError(t, flags.ValidateRBAC(), "the generated rules don't grant all verbs")
+	assert.Contains(t, flags.centralRules(), rbacv1.PolicyRule{APIGroups: []string{MongoDBGroup}, Resources: []string{"mongodb"}, Verbs: []string{"get", "list", "watch", "update"}})
+}
+
+func TestTelemetryRules(t *testing.T) {
+	for _, rule := range (Flags{}).telemetryRules() {
+		for _, verb := range rule.Verbs {
+			assert.Contains(t, []string{"get", "list", "watch"}, verb, "the default telemetry rules only read")
+		}
+	}
+
+	// the telemetry verbs are only changed by the RBAC profile
+	flags := Flags{RBACProfile: &RBACProfile{Telemetry: RBACRuleSet{Remove: []rbacv1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"nodes"}},
+	}}}}
+	assert.Equal(t, []rbacv1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"namespaces"}, ResourceNames: []string{"kube-system"}, Verbs: []string{"get"}},
+		{NonResourceURLs: []string{"/version"}, Verbs: []string{"get"}},
+	}, flags.telemetryRules())
+}
+
+func TestEnsureMultiClusterResources_WithManagedKinds(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	flags.ClusterScoped = true
+	flags.ManagedKinds = []string{MongoDBMultiClusterKind}
+	clientMap := getClientResources(ctx, flags)
+	require.NoError(t, EnsureMultiClusterResources(ctx, flags, clientMap))
+
+	for _, cluster := range flags.MemberClusters {
+		cr, err := clientMap[cluster].RbacV1().ClusterRoles().Get(ctx, buildMemberEntityClusterRole(flags).Name, metav1.GetOptions{})
+		require.NoError(t, err)
+		for _, rule := range cr.Rules {
+			assert.NotContains(t, rule.Verbs, rbacv1.VerbAll, "cluster %s", cluster)
+			assert.NotContains(t, rule.Verbs, "deletecollection", "cluster %s", cluster)
+		}
+	}
+	cr, err := clientMap[flags.CentralCluster].RbacV1().ClusterRoles().Get(ctx, buildCentralEntityClusterRole(flags).Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, buildCentralEntityClusterRole(flags).Rules, cr.Rules)
+	for _, rule := range cr.Rules {
+		assert.NotContains(t, rule.Verbs, rbacv1.VerbAll)
+	}
+}
@@ -0,0 +1,342 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+	"k8s.io/client-go/rest"
+)
+
+// LevelTrace is the level of the requests sent to the api servers and of their responses.
+const LevelTrace = slog.Level(-8)
+
+// LogFormat is the format of the log lines.
+type LogFormat string
+
+const (
+	LogFormatText LogFormat = "text"
+	LogFormatJSON LogFormat = "json"
+)
+
+// LogOptions configure the logger of this tool.
+type LogOptions struct {
+	// Verbosity 1 adds debug messages, 2 and above also the requests to the api servers and their responses.
+	Verbosity int
+	// Quiet only keeps warnings and errors.
+	Quiet  bool
+	Format LogFormat
+}
+
+// level returns the minimum level of the messages that are logged.
+func (o LogOptions) level() slog.Level {
+	switch {
+	case o.Quiet:
+		return slog.LevelWarn
+	case o.Verbosity >= 2:
+		return LevelTrace
+	case o.Verbosity == 1:
+		return slog.LevelDebug
+	default:
+		return slog.LevelInfo
+	}
+}
+
+var logger = slog.New(newTextHandler(os.Stdout, slog.LevelInfo))
+
+// Logger returns the logger of this tool. Messages are written to stdout until ConfigureLogging is called, which
+// writes the errors to stderr.
+func Logger() *slog.Logger {
+	return logger
+}
+
+// ConfigureLogging replaces the logger of this tool with one writing the errors to errW and all other messages to w.
+// It must be called before any command runs.
+func ConfigureLogging(w, errW io.Writer, opts LogOptions) error {
+	if opts.Quiet && opts.Verbosity > 0 {
+		return xerrors.Errorf("quiet cannot be used together with verbose")
+	}
+	var newHandler func(w io.Writer) slog.Handler
+	switch opts.Format {
+	case LogFormatText, "":
+		newHandler = func(w io.Writer) slog.Handler { return newTextHandler(w, opts.level()) }
+	case LogFormatJSON:
+		newHandler = func(w io.Writer) slog.Handler {
+			return slog.NewJSONHandler(w, &slog.HandlerOptions{Level: opts.level(), ReplaceAttr: replaceLevelName})
+		}
+	default:
+		return xerrors.Errorf("unknown log format %q, expected one of text, json", opts.Format)
+	}
+	if w == errW {
+		logger = slog.New(newHandler(w))
+	} else {
+		logger = slog.New(&errorSplitHandler{Handler: newHandler(w), errors: newHandler(errW)})
+	}
+	return nil
+}
+
+// errorSplitHandler handles the errors with a handler of their own.
+type errorSplitHandler struct {
+	slog.Handler
+	errors slog.Handler
+}
+
+func (h *errorSplitHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelError {
+		return h.errors.Handle(ctx, r)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *errorSplitHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &errorSplitHandler{Handler: h.Handler.WithAttrs(attrs), errors: h.errors.WithAttrs(attrs)}
+}
+
+func (h *errorSplitHandler) WithGroup(name string) slog.Handler {
+	return &errorSplitHandler{Handler: h.Handler.WithGroup(name), errors: h.errors.WithGroup(name)}
+}
+
+// replaceLevelName names the trace level, which slog would show as DEBUG-4.
+func replaceLevelName(_ []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.LevelKey {
+		if level, ok := a.Value.Any().(slog.Level); ok && level == LevelTrace {
+			return slog.String(slog.LevelKey, "TRACE")
+		}
+	}
+	return a
+}
+
+// colorEnabled returns true if w is a terminal and colors haven't been disabled with NO_COLOR.
+func colorEnabled(w io.Writer) bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+const (
+	redColor    = "\033[31m"
+	yellowColor = "\033[33m"
+	resetColor  = "\033[0m"
+)
+
+// textHandler writes every message on a single line, followed by its fields as key=value pairs. Messages below the
+// info level are prefixed with their level, warnings and errors are colored when written to a terminal.
+type textHandler struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	color  bool
+	level  slog.Leveler
+	prefix string
+	attrs  string
+}
+
+func newTextHandler(w io.Writer, level slog.Leveler) *textHandler {
+	return &textHandler{mu: &sync.Mutex{}, w: w, color: colorEnabled(w), level: level}
+}
+
+func (h *textHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	sb := strings.Builder{}
+	color := ""
+	switch {
+	case r.Level >= slog.LevelError:
+		sb.WriteString("error: ")
+		color = redColor
+	case r.Level >= slog.LevelWarn:
+		sb.WriteString("warning: ")
+		color = yellowColor
+	case r.Level < slog.LevelDebug:
+		sb.WriteString("trace: ")
+	case r.Level < slog.LevelInfo:
+		sb.WriteString("debug: ")
+	}
+	sb.WriteString(r.Message)
+	sb.WriteString(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		writeAttr(&sb, h.prefix, a)
+		return true
+	})
+
+	line := sb.String()
+	if color != "" && h.color {
+		line = color + line + resetColor
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, line+"\n")
+	return err
+}
+
+func (h *textHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	sb := strings.Builder{}
+	sb.WriteString(h.attrs)
+	for _, a := range attrs {
+		writeAttr(&sb, h.prefix, a)
+	}
+	c := *h
+	c.attrs = sb.String()
+	return &c
+}
+
+func (h *textHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	c := *h
+	c.prefix = h.prefix + name + "."
+	return &c
+}
+
+func writeAttr(sb *strings.Builder, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		for _, child := range a.Value.Group() {
+			writeAttr(sb, prefix+a.Key+".", child)
+		}
+		return
+	}
+	value := a.Value.String()
+	if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+		value = strconv.Quote(value)
+	}
+	_, _ = fmt.Fprintf(sb, " %s%s=%s", prefix, a.Key, value)
+}
+
+// withRequestLogging returns a copy of the config whose requests to the api server of the cluster are logged
+// together with their responses at the trace level.
+func withRequestLogging(config *rest.Config, cluster string) *rest.Config {
+	config = rest.CopyConfig(config)
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &loggingRoundTripper{next: rt, cluster: cluster}
+	})
+	return config
+}
+
+// loggingRoundTripper logs every request and its response, including their bodies with the credentials they hold
+// redacted, see redactedBody.
+type loggingRoundTripper struct {
+	next    http.RoundTripper
+	cluster string
+}
+
+func (t *loggingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if !logger.Enabled(ctx, LevelTrace) {
+		return t.next.RoundTrip(req)
+	}
+
+	var requestBody []byte
+	if req.Body != nil && req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			requestBody, _ = io.ReadAll(body)
+			_ = body.Close()
+		}
+	}
+	logger.Log(ctx, LevelTrace, "API request", "cluster", t.cluster, "method", req.Method, "url", req.URL.String(), "body", redactedBody(req.URL.Path, requestBody))
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		logger.Log(ctx, LevelTrace, "API request failed", "cluster", t.cluster, "method", req.Method, "url", req.URL.String(), "duration", time.Since(start), "error", err)
+		return resp, err
+	}
+
+	// watches and log streams are never read to the end
+	var responseBody []byte
+	if req.URL.Query().Get("watch") != "true" && req.URL.Query().Get("follow") != "true" {
+		responseBody, err = io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(responseBody))
+	}
+	logger.Log(ctx, LevelTrace, "API response", "cluster", t.cluster, "method", req.Method, "url", req.URL.String(), "status", resp.StatusCode, "duration", time.Since(start), "body", redactedBody(req.URL.Path, responseBody))
+	return resp, nil
+}
+
+// redacted replaces the values of credentials in the logged bodies.
+const redacted = "REDACTED"
+
+// credentialPaths are parts of the paths of the requests whose bodies may hold credentials: Secrets, ServiceAccount
+// tokens and client certificates.
+var credentialPaths = []string{"/secrets", "/token", "/certificatesigningrequests"}
+
+// redactedBody returns the body of a request to the path, or of its response, with the values of the data and
+// stringData of Secrets, and the status.token and status.certificate issued by the TokenRequest and
+// CertificateSigningRequest APIs redacted. Bodies of requests that may hold credentials but aren't JSON objects,
+// like JSON patches, are replaced by their size.
+func redactedBody(path string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	credentials := false
+	for _, credentialPath := range credentialPaths {
+		credentials = credentials || strings.Contains(path, credentialPath)
+	}
+
+	var object map[string]any
+	if err := json.Unmarshal(body, &object); err != nil {
+		if credentials {
+			return fmt.Sprintf("<%d bytes redacted>", len(body))
+		}
+		return string(body)
+	}
+
+	secret := strings.Contains(path, "/secrets") || object["kind"] == "Secret" || object["kind"] == "SecretList"
+	redactObject(object, secret)
+	if items, ok := object["items"].([]any); ok {
+		for _, item := range items {
+			if item, ok := item.(map[string]any); ok {
+				redactObject(item, secret)
+			}
+		}
+	}
+	result, err := json.Marshal(object)
+	if err != nil {
+		return fmt.Sprintf("<%d bytes redacted>", len(body))
+	}
+	return string(result)
+}
+
+func redactObject(object map[string]any, secret bool) {
+	if secret || object["kind"] == "Secret" {
+		for _, field := range []string{"data", "stringData"} {
+			if data, ok := object[field].(map[string]any); ok {
+				for key := range data {
+					data[key] = redacted
+				}
+			}
+		}
+	}
+	if status, ok := object["status"].(map[string]any); ok {
+		for _, field := range []string{"token", "certificate"} {
+			if _, ok := status[field]; ok {
+				status[field] = redacted
+			}
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigureLogging(t *testing.T) {
+	defaultLogger := logger
+	defer func() { logger = defaultLogger }()
+
+	ctx := context.Background()
+	require.NoError(t, ConfigureLogging(io.Discard, io.Discard, LogOptions{}))
+	assert.True(t, logger.Enabled(ctx, slog.LevelInfo))
+	assert.False(t, logger.Enabled(ctx, slog.LevelDebug))
+
+	require.NoError(t, ConfigureLogging(io.Discard, io.Discard, LogOptions{Quiet: true}))
+	assert.False(t, logger.Enabled(ctx, slog.LevelInfo))
+	assert.True(t, logger.Enabled(ctx, slog.LevelWarn))
+
+	require.NoError(t, ConfigureLogging(io.Discard, io.Discard, LogOptions{Verbosity: 1, Format: LogFormatJSON}))
+	assert.True(t, logger.Enabled(ctx, slog.LevelDebug))
+	assert.False(t, logger.Enabled(ctx, LevelTrace))
+
+	require.NoError(t, ConfigureLogging(io.Discard, io.Discard, LogOptions{Verbosity: 2}))
+	assert.True(t, logger.Enabled(ctx, LevelTrace))
+
+	assert.EqualError(t, ConfigureLogging(io.Discard, io.Discard, LogOptions{Verbosity: 1, Quiet: true}), "quiet cannot be used together with verbose")
+	assert.EqualError(t, ConfigureLogging(io.Discard, io.Discard, LogOptions{Format: "xml"}), `unknown log format "xml", expected one of text, json`)
+
+	buf, errBuf := bytes.Buffer{}, bytes.Buffer{}
+	require.NoError(t, ConfigureLogging(&buf, &errBuf, LogOptions{}))
+	Logger().Info("Ensured namespaces exist in all clusters.")
+	Logger().With("cluster", "member-1").Error("Failed collecting")
+	assert.Equal(t, "Ensured namespaces exist in all clusters.\n", buf.String())
+	assert.Equal(t, "error: Failed collecting cluster=member-1\n", errBuf.String())
+
+	// errors are written in the format of all other messages
+	buf.Reset()
+	errBuf.Reset()
+	require.NoError(t, ConfigureLogging(&buf, &errBuf, LogOptions{Quiet: true, Format: LogFormatJSON}))
+	Logger().Info("Ensured namespaces exist in all clusters.")
+	Logger().Error("Failed collecting")
+	assert.Empty(t, buf.String())
+	assert.Contains(t, errBuf.String(), `"level":"ERROR","msg":"Failed collecting"`)
+}
+
+func TestTextHandler(t *testing.T) {
+	buf := bytes.Buffer{}
+	log := slog.New(newTextHandler(&buf, LevelTrace)).With("cluster", "member-1")
+
+	log.Info("Deleting Secret", "namespace", "mongodb", "name", "operator-token")
+	log.Warn("image pull secret is missing", "reason", "not found")
+	log.Error("Failed collecting", "error", io.EOF)
+	log.Debug("Applied ClusterRole", "name", "")
+	log.Log(context.Background(), LevelTrace, "API request", slog.Group("request", "method", "GET"))
+
+	// colors are only used in terminals, never in a buffer
+	assert.Equal(t, []string{
+		"Deleting Secret cluster=member-1 namespace=mongodb name=operator-token",
+		`warning: image pull secret is missing cluster=member-1 reason="not found"`,
+		"error: Failed collecting cluster=member-1 error=EOF",
+		`debug: Applied ClusterRole cluster=member-1 name=""`,
+		"trace: API request cluster=member-1 request.method=GET",
+	}, strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n"))
+}
+
+func TestLoggingRoundTripper(t *testing.T) {
+	defaultLogger := logger
+	defer func() { logger = defaultLogger }()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write(append([]byte("created "), body...))
+	}))
+	defer server.Close()
+
+	buf := bytes.Buffer{}
+	logger = slog.New(newTextHandler(&buf, LevelTrace))
+	rt := &loggingRoundTripper{next: http.DefaultTransport, cluster: "central"}
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/api/v1/namespaces", strings.NewReader("mongodb"))
+	require.NoError(t, err)
+	resp, err := rt.RoundTrip(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	// the response body is still readable after it was logged
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "created mongodb", string(body))
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t, "trace: API request cluster=central method=POST url="+server.URL+"/api/v1/namespaces body=mongodb", lines[0])
+	assert.Contains(t, lines[1], "trace: API response cluster=central method=POST url="+server.URL+"/api/v1/namespaces status=201")
+	assert.Contains(t, lines[1], `body="created mongodb"`)
+
+	// nothing is logged below the trace level
+	buf.Reset()
+	logger = slog.New(newTextHandler(&buf, slog.LevelDebug))
+	req, err = http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	resp, err = rt.RoundTrip(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Empty(t, buf.String())
+}
+
+func TestRedactedBody(t *testing.T) {
+	secret := `{"kind":"Secret","metadata":{"name":"kubeconfig"},"data":{"kubeconfig":"YXBpVmVyc2lvbjogdjE="},"stringData":{"token":"eyJhbGciOi"}}`
+	assert.Equal(t, `{"data":{"kubeconfig":"REDACTED"},"kind":"Secret","metadata":{"name":"kubeconfig"},"stringData":{"token":"REDACTED"}}`, redactedBody("/api/v1/namespaces/mongodb/secrets", []byte(secret)))
+
+	// the items of lists don't have a kind
+	list := `{"kind":"SecretList","items":[{"metadata":{"name":"token"},"data":{"token":"ZXlKaGJHY2lPaQ=="}}]}`
+	assert.Equal(t, `{"items":[{"data":{"token":"REDACTED"},"metadata":{"name":"token"}}],"kind":"SecretList"}`, redactedBody("/api/v1/namespaces/mongodb/secrets", []byte(list)))
+
+	tokenRequest := `{"kind":"TokenRequest","spec":{"expirationSeconds":3600},"status":{"token":"eyJhbGciOi","expirationTimestamp":"2026-10-17T00:00:00Z"}}`
+	assert.Equal(t, `{"kind":"TokenRequest","spec":{"expirationSeconds":3600},"status":{"expirationTimestamp":"2026-10-17T00:00:00Z","token":"REDACTED"}}`, redactedBody("/api/v1/namespaces/mongodb/serviceaccounts/operator/token", []byte(tokenRequest)))
+
+	csr := `{"kind":"CertificateSigningRequest","status":{"certificate":"LS0tLS1CRUdJTg=="}}`
+	assert.Equal(t, `{"kind":"CertificateSigningRequest","status":{"certificate":"REDACTED"}}`, redactedBody("/apis/certificates.k8s.io/v1/certificatesigningrequests/operator", []byte(csr)))
+
+	// patches of secrets aren't objects the values can be found in
+	assert.Equal(t, "<54 bytes redacted>", redactedBody("/api/v1/namespaces/mongodb/secrets/kubeconfig", []byte(`[{"op":"replace","path":"/data/token","value":"ZXlK"}]`)))
+
+	configMap := `{"kind":"ConfigMap","data":{"member-1":""}}`
+	assert.Equal(t, `{"data":{"member-1":""},"kind":"ConfigMap"}`, redactedBody("/api/v1/namespaces/mongodb/configmaps", []byte(configMap)))
+	assert.Equal(t, "mongodb", redactedBody("/api/v1/namespaces", []byte("mongodb")))
+}
@@ -0,0 +1,20 @@
+// Package manifests embeds the operator manifests shipped at the root of the repository, which are copied here
+// because go:embed can't reach files outside of the module. Run go generate after changing them, the tests of this
+// package fail while the copies differ.
+package manifests
+
+import (
+	_ "embed"
+)
+
+//go:generate cp ../../../../../crds.yaml ../../../../../mongodb-enterprise-multi-cluster.yaml .
+
+// CRDs are the custom resource definitions of crds.yaml.
+//
+//go:embed crds.yaml
+var CRDs []byte
+
+// MultiClusterOperator is the operator installation of mongodb-enterprise-multi-cluster.yaml.
+//
+//go:embed mongodb-enterprise-multi-cluster.yaml
+var MultiClusterOperator []byte
@@ -0,0 +1,26 @@
+package manifests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// repositoryRoot is where the manifests embedded by this package are maintained.
+const repositoryRoot = "../../../../.."
+
+func TestManifests_MatchTheRepositoryRoot(t *testing.T) {
+	for name, embedded := range map[string][]byte{
+		"crds.yaml":                             CRDs,
+		"mongodb-enterprise-multi-cluster.yaml": MultiClusterOperator,
+	} {
+		t.Run(name, func(t *testing.T) {
+			root, err := os.ReadFile(filepath.Join(repositoryRoot, name))
+			require.NoError(t, err)
+			assert.True(t, string(root) == string(embedded), "%s differs from the one at the root of the repository, run go generate ./pkg/common/manifests", name)
+		})
+	}
+}
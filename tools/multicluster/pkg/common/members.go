@@ -0,0 +1,312 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"golang.org/x/xerrors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// MongoDBMultiClusterGVR is the resource of the MongoDBMultiCluster custom resources.
+var MongoDBMultiClusterGVR = schema.GroupVersionResource{Group: MongoDBGroup, Version: "v1", Resource: "mongodbmulticluster"}
+
+// AddMemberCluster sets up the operator's ServiceAccount and Roles in a single new member cluster, and adds the
+// cluster to the KubeConfig secret and the member list ConfigMap in the central cluster. The other member clusters
+// are not touched. flags.MemberClusters and flags.MemberClusterApiServerUrls must only hold the new cluster.
+func AddMemberCluster(ctx context.Context, flags Flags, clientMap map[string]KubeClient) error {
+	if len(flags.MemberClusters) != 1 || len(flags.MemberClusterApiServerUrls) != 1 {
+		return xerrors.Errorf("exactly one member cluster with its api server is required")
+	}
+	cluster := flags.MemberClusters[0]
+	centralClusterClient := clientMap[flags.CentralCluster]
+	memberClusterClient := clientMap[cluster]
+
+	// the secret is only read here to fail before touching the member cluster if setup didn't run, it is read again
+	// when the new cluster is merged into it
+	if _, err := readKubeConfigSecret(ctx, centralClusterClient, flags); err != nil {
+		return err
+	}
+
+	for _, namespace := range flags.clusterNamespaces(cluster) {
+		if err := ensureNamespace(ctx, memberClusterClient, flags, namespace); err != nil {
+			return xerrors.Errorf("failed to ensure namespace %s in member cluster %s: %w", namespace, cluster, err)
+		}
+	}
+	logger.Info("Ensured namespaces exist", "cluster", cluster)
+
+	var err error
+	if cluster == flags.CentralCluster {
+		// the central cluster's roles include the member rules already, they only need to be bound to the member subjects
+		err = createCentralClusterServiceAccountAndRoles(ctx, memberClusterClient, flags)
+	} else {
+		err = createMemberClusterServiceAccountAndRoles(ctx, memberClusterClient, cluster, flags)
+	}
+	if err != nil {
+		return xerrors.Errorf("failed creating service account and roles in cluster %s: %w", cluster, err)
+	}
+	logger.Info("Ensured ServiceAccounts and Roles")
+
+	secrets, err := getMemberClusterCredentials(ctx, clientMap, flags)
+	if err != nil {
+		return err
+	}
+	memberKubeConfig, err := createKubeConfigFromServiceAccountTokens(secrets, flags)
+	if err != nil {
+		return xerrors.Errorf("failed to create kube config from service account tokens: %w", err)
+	}
+	if flags.CheckKubeConfig && !flags.DryRun {
+		if err := checkKubeConfigConnections(ctx, memberKubeConfig, flags.MemberClusters, flags, NewKubeClientForConfig); err != nil {
+			return err
+		}
+	}
+	if err := updateKubeConfigSecret(ctx, centralClusterClient, flags, func(kubeConfig *KubeConfigFile) {
+		kubeConfig.setClusters(memberKubeConfig)
+	}); err != nil {
+		return err
+	}
+
+	if err := updateClusterMembersConfigMap(ctx, centralClusterClient, flags, cluster, true); err != nil {
+		return err
+	}
+
+	if flags.InstallDatabaseRoles {
+		if err := createDatabaseRoles(ctx, memberClusterClient, flags, cluster); err != nil {
+			return xerrors.Errorf("failed installing database roles: %w", err)
+		}
+		logger.Info("Ensured database Roles", "cluster", cluster)
+	}
+	return nil
+}
+
+// RemoveMemberCluster removes a member cluster from the KubeConfig secret and the member list ConfigMap in the central
+// cluster, and deletes the resources created by this tool in the member cluster. It refuses to remove a cluster that
+// is still used by a MongoDBMultiCluster resource, unless force is set. The member cluster's client may be missing
+// from clientMap if it can't be reached anymore, in which case its resources are left behind.
+func RemoveMemberCluster(ctx context.Context, flags Flags, clientMap map[string]KubeClient, cluster string, force bool) error {
+	centralClusterClient := clientMap[flags.CentralCluster]
+
+	references, err := getMongoDBMultiClusterReferences(ctx, centralClusterClient, cluster)
+	if err != nil {
+		return err
+	}
+	if len(references) > 0 {
+		if !force {
+			return xerrors.Errorf("cluster %s is still referenced in the clusterSpecList of MongoDBMultiCluster resources %s, remove it from them first or pass --force", cluster, strings.Join(references, ", "))
+		}
+		Warnf("removing cluster %s still referenced by MongoDBMultiCluster resources %s", cluster, strings.Join(references, ", "))
+	}
+
+	if err := updateKubeConfigSecret(ctx, centralClusterClient, flags, func(kubeConfig *KubeConfigFile) {
+		if !kubeConfig.removeCluster(cluster) {
+			logger.Info("Cluster not found in KubeConfig secret", "cluster", flags.CentralCluster, "namespace", flags.CentralClusterNamespace, "name", KubeConfigSecretName, "removedCluster", cluster)
+		}
+	}); err != nil {
+		return err
+	}
+
+	if err := updateClusterMembersConfigMap(ctx, centralClusterClient, flags, cluster, false); err != nil {
+		return err
+	}
+
+	memberClusterClient, ok := clientMap[cluster]
+	if !ok || cluster == flags.CentralCluster {
+		return nil
+	}
+	for _, namespace := range flags.clusterNamespaces(cluster) {
+		if err := cleanupClusterResources(ctx, memberClusterClient, cluster, namespace, installationSelector(flags)); err != nil {
+			// the cluster is no longer used by the operator, so its leftovers don't fail the removal
+			Warnf("failed cleaning up namespace %s in cluster %s: %s", namespace, cluster, err)
+		}
+	}
+	return nil
+}
+
+// CheckClusterReachable returns an error if the api server of the cluster doesn't answer. Creating a client doesn't
+// connect to the cluster, so a removed cluster that is gone is only noticed this way.
+func CheckClusterReachable(ctx context.Context, c KubeClient, cluster string) error {
+	if _, err := serverVersion(ctx, c.Discovery()); err != nil {
+		return xerrors.Errorf("the api server of cluster %s is not reachable: %w", cluster, err)
+	}
+	return nil
+}
+
+// getMongoDBMultiClusterReferences returns the MongoDBMultiCluster resources with the cluster in their clusterSpecList.
+func getMongoDBMultiClusterReferences(ctx context.Context, c KubeClient, cluster string) ([]string, error) {
+	list, err := c.Resource(MongoDBMultiClusterGVR).Namespace(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if errors.IsNotFound(err) {
+		// the CRD isn't installed
+		return nil, nil
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("failed listing MongoDBMultiCluster resources: %w", err)
+	}
+
+	var references []string
+	for _, item := range list.Items {
+		clusterSpecList, _, _ := unstructured.NestedSlice(item.Object, "spec", "clusterSpecList")
+		for _, clusterSpec := range clusterSpecList {
+			spec, ok := clusterSpec.(map[string]interface{})
+			if ok && spec["clusterName"] == cluster {
+				references = append(references, fmt.Sprintf("%s/%s", item.GetNamespace(), item.GetName()))
+				break
+			}
+		}
+	}
+	return references, nil
+}
+
+// readKubeConfigSecret returns the KubeConfig stored in the central cluster by setup.
+func readKubeConfigSecret(ctx context.Context, centralClusterClient KubeClient, flags Flags) (KubeConfigFile, error) {
+	_, kubeConfig, err := getKubeConfigSecret(ctx, centralClusterClient, flags)
+	return kubeConfig, err
+}
+
+// getKubeConfigSecret returns the KubeConfig secret stored in the central cluster by setup, and the KubeConfig it holds.
+func getKubeConfigSecret(ctx context.Context, centralClusterClient KubeClient, flags Flags) (*corev1.Secret, KubeConfigFile, error) {
+	secret, err := centralClusterClient.CoreV1().Secrets(flags.CentralClusterNamespace).Get(ctx, KubeConfigSecretName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, KubeConfigFile{}, xerrors.Errorf("secret %s/%s not found in cluster %s, run setup first", flags.CentralClusterNamespace, KubeConfigSecretName, flags.CentralCluster)
+		}
+		return nil, KubeConfigFile{}, xerrors.Errorf("failed getting secret %s/%s: %w", flags.CentralClusterNamespace, KubeConfigSecretName, err)
+	}
+
+	kubeConfig := KubeConfigFile{}
+	if err := yaml.Unmarshal(secret.Data[KubeConfigSecretKey], &kubeConfig); err != nil {
+		return nil, KubeConfigFile{}, xerrors.Errorf("failed parsing kubeconfig from secret %s/%s: %w", flags.CentralClusterNamespace, KubeConfigSecretName, err)
+	}
+	return secret, kubeConfig, nil
+}
+
+// updateKubeConfigSecret changes the KubeConfig stored in the central cluster with update. The secret is read again
+// after a conflict, so that the clusters added or removed, and the credentials rotated, concurrently are kept.
+func updateKubeConfigSecret(ctx context.Context, centralClusterClient KubeClient, flags Flags, update func(kubeConfig *KubeConfigFile)) error {
+	secrets := centralClusterClient.CoreV1().Secrets(flags.CentralClusterNamespace)
+	err := retryOnConflict(func() error {
+		secret, kubeConfig, err := getKubeConfigSecret(ctx, centralClusterClient, flags)
+		if err != nil {
+			return err
+		}
+		update(&kubeConfig)
+		kubeConfigBytes, err := yaml.Marshal(kubeConfig)
+		if err != nil {
+			return xerrors.Errorf("failed to marshal kubeconfig: %w", err)
+		}
+
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		secret.Data[KubeConfigSecretKey] = kubeConfigBytes
+		setOwnership(secret, flags)
+		logger.Info("Updating KubeConfig secret", "cluster", flags.CentralCluster, "namespace", flags.CentralClusterNamespace, "name", KubeConfigSecretName)
+		_, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return xerrors.Errorf("failed updating KubeConfig secret: %w", err)
+	}
+	return nil
+}
+
+func writeKubeConfigSecret(ctx context.Context, centralClusterClient KubeClient, kubeConfig KubeConfigFile, flags Flags) error {
+	kubeConfigBytes, err := yaml.Marshal(kubeConfig)
+	if err != nil {
+		return xerrors.Errorf("failed to marshal kubeconfig: %w", err)
+	}
+	if err := createKubeConfigSecret(ctx, centralClusterClient, kubeConfigBytes, flags); err != nil {
+		return xerrors.Errorf("failed updating KubeConfig secret: %w", err)
+	}
+	return nil
+}
+
+// setClusters adds the clusters, contexts and users of other to the KubeConfig, replacing the entries of the same name.
+func (k *KubeConfigFile) setClusters(other KubeConfigFile) {
+	for _, cluster := range other.Clusters {
+		k.removeCluster(cluster.Name)
+	}
+	k.Clusters = append(k.Clusters, other.Clusters...)
+	k.Contexts = append(k.Contexts, other.Contexts...)
+	k.Users = append(k.Users, other.Users...)
+}
+
+// removeCluster removes the cluster, context and user of the given name and returns whether the cluster was found.
+func (k *KubeConfigFile) removeCluster(name string) bool {
+	found := false
+	var clusters []KubeConfigClusterItem
+	for _, cluster := range k.Clusters {
+		if cluster.Name == name {
+			found = true
+		} else {
+			clusters = append(clusters, cluster)
+		}
+	}
+	var contexts []KubeConfigContextItem
+	for _, kubeContext := range k.Contexts {
+		if kubeContext.Name != name {
+			contexts = append(contexts, kubeContext)
+		}
+	}
+	var users []KubeConfigUserItem
+	for _, user := range k.Users {
+		if user.Name != name {
+			users = append(users, user)
+		}
+	}
+	k.Clusters, k.Contexts, k.Users = clusters, contexts, users
+	return found
+}
+
+// updateClusterMembersConfigMap adds or removes a single cluster from the member list ConfigMap, keeping the others.
+func updateClusterMembersConfigMap(ctx context.Context, centralClusterClient KubeClient, flags Flags, cluster string, add bool) error {
+	configMaps := centralClusterClient.CoreV1().ConfigMaps(flags.CentralClusterNamespace)
+	// the list is read again after a conflict, so that clusters added or removed concurrently are kept
+	return retryOnConflict(func() error {
+		members, err := configMaps.Get(ctx, DefaultOperatorConfigMapName, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			if !add {
+				return nil
+			}
+			members = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        DefaultOperatorConfigMapName,
+					Namespace:   flags.CentralClusterNamespace,
+					Labels:      multiClusterLabels(flags),
+					Annotations: multiClusterAnnotations(flags),
+				},
+				Data: map[string]string{},
+			}
+			addToSet([]string{cluster}, members)
+			logger.Info("Creating Member list ConfigMap", "cluster", flags.CentralCluster, "namespace", flags.CentralClusterNamespace, "name", DefaultOperatorConfigMapName)
+			if _, err := configMaps.Create(ctx, members, metav1.CreateOptions{}); err != nil {
+				return xerrors.Errorf("failed creating configmap: %w", err)
+			}
+			return nil
+		}
+		if err != nil {
+			return xerrors.Errorf("failed getting configmap %s/%s: %w", flags.CentralClusterNamespace, DefaultOperatorConfigMapName, err)
+		}
+
+		if members.Data == nil {
+			members.Data = map[string]string{}
+		}
+		setOwnership(members, flags)
+		if add {
+			addToSet([]string{cluster}, members)
+			logger.Info("Adding cluster to Member list ConfigMap", "cluster", flags.CentralCluster, "namespace", flags.CentralClusterNamespace, "name", DefaultOperatorConfigMapName, "addedCluster", cluster)
+		} else {
+			delete(members.Data, cluster)
+			logger.Info("Removing cluster from Member list ConfigMap", "cluster", flags.CentralCluster, "namespace", flags.CentralClusterNamespace, "name", DefaultOperatorConfigMapName, "removedCluster", cluster)
+		}
+		if _, err := configMaps.Update(ctx, members, metav1.UpdateOptions{}); err != nil {
+			return xerrors.Errorf("failed updating configmap: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,239 @@
+package common
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestAddMemberCluster_OnlyConfiguresTheNewCluster(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	clientMap := getClientResources(ctx, flags)
+	newCluster, newApiServer := flags.MemberClusters[2], flags.MemberClusterApiServerUrls[2]
+	flags.MemberClusters, flags.MemberClusterApiServerUrls = flags.MemberClusters[:2], flags.MemberClusterApiServerUrls[:2]
+	require.NoError(t, EnsureMultiClusterResources(ctx, flags, clientMap))
+	require.NoError(t, ReplaceClusterMembersConfigMap(ctx, clientMap[flags.CentralCluster], flags))
+	kubeConfigBefore, err := readKubeConfig(ctx, clientMap[flags.CentralCluster], flags.CentralClusterNamespace)
+	require.NoError(t, err)
+	existingMember := clientMap[flags.MemberClusters[0]].(*KubeClientContainer).staticClient.(*fake.Clientset)
+	existingMember.ClearActions()
+
+	addFlags := flags
+	addFlags.MemberClusters, addFlags.MemberClusterApiServerUrls = []string{newCluster}, []string{newApiServer}
+	require.NoError(t, AddMemberCluster(ctx, addFlags, clientMap))
+
+	assert.Empty(t, existingMember.Actions(), "existing member clusters must not be touched")
+	assertMemberRolesExist(t, ctx, clientMap, addFlags)
+
+	kubeConfig, err := readKubeConfig(ctx, clientMap[flags.CentralCluster], flags.CentralClusterNamespace)
+	require.NoError(t, err)
+	require.Len(t, kubeConfig.Clusters, 3)
+	assert.Equal(t, kubeConfigBefore.Clusters, kubeConfig.Clusters[:2])
+	assert.Equal(t, kubeConfigBefore.Users, kubeConfig.Users[:2])
+	assert.Equal(t, KubeConfigClusterItem{Name: newCluster, Cluster: KubeConfigCluster{Server: newApiServer, CertificateAuthorityData: []byte("ca.crt: member-cluster-2")}}, kubeConfig.Clusters[2])
+	assert.Equal(t, newCluster, kubeConfig.Contexts[2].Name)
+	assert.Equal(t, newCluster, kubeConfig.Users[2].Name)
+
+	members, err := clientMap[flags.CentralCluster].CoreV1().ConfigMaps(flags.CentralClusterNamespace).Get(ctx, DefaultOperatorConfigMapName, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"member-cluster-0": "", "member-cluster-1": "", "member-cluster-2": ""}, members.Data)
+}
+
+func TestAddMemberCluster_RequiresSetup(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	clientMap := getClientResources(ctx, flags)
+	flags.MemberClusters, flags.MemberClusterApiServerUrls = flags.MemberClusters[:1], flags.MemberClusterApiServerUrls[:1]
+
+	err := AddMemberCluster(ctx, flags, clientMap)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "run setup first")
+}
+
+func TestRemoveMemberCluster_RemovesClusterAndItsResources(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	clientMap := setupWithMongoDBMultiClusters(ctx, t, flags, "member-cluster-0", "member-cluster-2")
+
+	require.NoError(t, RemoveMemberCluster(ctx, flags, clientMap, "member-cluster-1", false))
+
+	kubeConfig, err := readKubeConfig(ctx, clientMap[flags.CentralCluster], flags.CentralClusterNamespace)
+	require.NoError(t, err)
+	require.Len(t, kubeConfig.Clusters, 2)
+	for i, cluster := range []string{"member-cluster-0", "member-cluster-2"} {
+		assert.Equal(t, cluster, kubeConfig.Clusters[i].Name)
+		assert.Equal(t, cluster, kubeConfig.Contexts[i].Name)
+		assert.Equal(t, cluster, kubeConfig.Users[i].Name)
+	}
+
+	members, err := clientMap[flags.CentralCluster].CoreV1().ConfigMaps(flags.CentralClusterNamespace).Get(ctx, DefaultOperatorConfigMapName, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"member-cluster-0": "", "member-cluster-2": ""}, members.Data)
+
+	roles, err := clientMap["member-cluster-1"].RbacV1().Roles(flags.MemberClusterNamespace).List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, roles.Items)
+	serviceAccounts, err := clientMap["member-cluster-1"].CoreV1().ServiceAccounts(flags.CentralClusterNamespace).List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, serviceAccounts.Items)
+}
+
+func TestCheckClusterReachable(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset()
+	require.NoError(t, CheckClusterReachable(ctx, NewKubeClientContainer(nil, clientset, nil), "member-cluster-1"))
+
+	clientset.PrependReactor("get", "version", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, xerrors.Errorf("dial tcp: lookup api.member-cluster-1: no such host")
+	})
+	err := CheckClusterReachable(ctx, NewKubeClientContainer(nil, clientset, nil), "member-cluster-1")
+	assert.EqualError(t, err, "the api server of cluster member-cluster-1 is not reachable: dial tcp: lookup api.member-cluster-1: no such host")
+}
+
+func TestRemoveMemberCluster_RefusesWhenReferenced_UnlessForced(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	clientMap := setupWithMongoDBMultiClusters(ctx, t, flags, "member-cluster-0", "member-cluster-1")
+
+	err := RemoveMemberCluster(ctx, flags, clientMap, "member-cluster-1", false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "member-namespace/mdb-1")
+	kubeConfig, err := readKubeConfig(ctx, clientMap[flags.CentralCluster], flags.CentralClusterNamespace)
+	require.NoError(t, err)
+	assert.Len(t, kubeConfig.Clusters, 3, "the kubeconfig must not change")
+
+	require.NoError(t, RemoveMemberCluster(ctx, flags, clientMap, "member-cluster-1", true))
+	kubeConfig, err = readKubeConfig(ctx, clientMap[flags.CentralCluster], flags.CentralClusterNamespace)
+	require.NoError(t, err)
+	assert.Len(t, kubeConfig.Clusters, 2)
+}
+
+// setupWithMongoDBMultiClusters runs setup and creates a MongoDBMultiCluster resource in the central cluster for
+// each of the given member clusters.
+func setupWithMongoDBMultiClusters(ctx context.Context, t *testing.T, flags Flags, clusters ...string) map[string]KubeClient {
+	clientMap := getClientResources(ctx, flags)
+	require.NoError(t, EnsureMultiClusterResources(ctx, flags, clientMap))
+	require.NoError(t, ReplaceClusterMembersConfigMap(ctx, clientMap[flags.CentralCluster], flags))
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		MongoDBGVR:             "MongoDBList",
+		MongoDBMultiClusterGVR: "MongoDBMultiClusterList",
+		OpsManagerGVR:          "MongoDBOpsManagerList",
+	})
+	for _, cluster := range clusters {
+		mdb := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "mongodb.com/v1",
+			"kind":       "MongoDBMultiCluster",
+			"metadata":   map[string]interface{}{"name": "mdb-" + cluster[len(cluster)-1:], "namespace": flags.MemberClusterNamespace},
+			"spec": map[string]interface{}{
+				"clusterSpecList": []interface{}{map[string]interface{}{"clusterName": cluster, "members": int64(3)}},
+			},
+		}}
+		_, err := dynamicClient.Resource(MongoDBMultiClusterGVR).Namespace(flags.MemberClusterNamespace).Create(ctx, mdb, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+	central := clientMap[flags.CentralCluster].(*KubeClientContainer)
+	clientMap[flags.CentralCluster] = NewKubeClientContainer(nil, central.staticClient, dynamicClient)
+	return clientMap
+}
+
+func TestUpdateClusterMembersConfigMap_RereadsAfterConflict(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	clientMap := getClientResources(ctx, flags)
+	central := clientMap[flags.CentralCluster]
+	require.NoError(t, ReplaceClusterMembersConfigMap(ctx, central, flags))
+
+	// another cluster is added between the read and the write of the first attempt
+	configMaps := central.CoreV1().ConfigMaps(flags.CentralClusterNamespace)
+	stale, err := configMaps.Get(ctx, DefaultOperatorConfigMapName, metav1.GetOptions{})
+	require.NoError(t, err)
+	concurrent := stale.DeepCopy()
+	concurrent.Data["concurrent-cluster"] = ""
+	_, err = configMaps.Update(ctx, concurrent, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	clientset := central.(*KubeClientContainer).staticClient.(*fake.Clientset)
+	staleGet, staleUpdate := true, true
+	clientset.PrependReactor("get", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if !staleGet {
+			return false, nil, nil
+		}
+		staleGet = false
+		return true, stale.DeepCopy(), nil
+	})
+	clientset.PrependReactor("update", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if !staleUpdate {
+			return false, nil, nil
+		}
+		staleUpdate = false
+		return true, nil, errors.NewConflict(action.GetResource().GroupResource(), DefaultOperatorConfigMapName, assert.AnError)
+	})
+
+	require.NoError(t, updateClusterMembersConfigMap(ctx, central, flags, "new-cluster", true))
+
+	members, err := central.CoreV1().ConfigMaps(flags.CentralClusterNamespace).Get(ctx, DefaultOperatorConfigMapName, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"member-cluster-0": "", "member-cluster-1": "", "member-cluster-2": "", "concurrent-cluster": "", "new-cluster": ""}, members.Data)
+}
+
+func TestRemoveMemberCluster_RereadsKubeConfigAfterConflict(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	clientMap := setupWithMongoDBMultiClusters(ctx, t, flags)
+	central := clientMap[flags.CentralCluster]
+
+	// another cluster is added between the read and the write of the first attempt
+	secrets := central.CoreV1().Secrets(flags.CentralClusterNamespace)
+	stale, err := secrets.Get(ctx, KubeConfigSecretName, metav1.GetOptions{})
+	require.NoError(t, err)
+	kubeConfig, err := readKubeConfigSecret(ctx, central, flags)
+	require.NoError(t, err)
+	kubeConfig.setClusters(KubeConfigFile{
+		Clusters: []KubeConfigClusterItem{{Name: "concurrent-cluster"}},
+		Contexts: []KubeConfigContextItem{{Name: "concurrent-cluster"}},
+		Users:    []KubeConfigUserItem{{Name: "concurrent-cluster"}},
+	})
+	require.NoError(t, writeKubeConfigSecret(ctx, central, kubeConfig, flags))
+
+	clientset := central.(*KubeClientContainer).staticClient.(*fake.Clientset)
+	staleGet, staleUpdate := true, true
+	clientset.PrependReactor("get", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if !staleGet || action.(k8stesting.GetAction).GetName() != KubeConfigSecretName {
+			return false, nil, nil
+		}
+		staleGet = false
+		return true, stale.DeepCopy(), nil
+	})
+	clientset.PrependReactor("update", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if !staleUpdate {
+			return false, nil, nil
+		}
+		staleUpdate = false
+		return true, nil, errors.NewConflict(action.GetResource().GroupResource(), KubeConfigSecretName, assert.AnError)
+	})
+
+	require.NoError(t, RemoveMemberCluster(ctx, flags, clientMap, "member-cluster-1", false))
+
+	kubeConfig, err = readKubeConfig(ctx, central, flags.CentralClusterNamespace)
+	require.NoError(t, err)
+	var clusters, users []string
+	for i := range kubeConfig.Clusters {
+		clusters = append(clusters, kubeConfig.Clusters[i].Name)
+		users = append(users, kubeConfig.Users[i].Name)
+	}
+	assert.Equal(t, []string{"member-cluster-0", "member-cluster-2", "concurrent-cluster"}, clusters)
+	assert.Equal(t, clusters, users)
+}
@@ -0,0 +1,74 @@
+package common
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"golang.org/x/xerrors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// memberNamespaces returns the namespaces watched by the operator in every member cluster: MemberClusterNamespace
+// followed by the additional MemberClusterNamespaces.
+func (f Flags) memberNamespaces() []string {
+	return uniqueNamespaces(append([]string{f.MemberClusterNamespace}, f.MemberClusterNamespaces...))
+}
+
+// watchesMultipleNamespaces returns true if the operator watches more than one member namespace.
+func (f Flags) watchesMultipleNamespaces() bool {
+	return len(f.memberNamespaces()) > 1
+}
+
+func uniqueNamespaces(namespaces []string) []string {
+	var unique []string
+	for _, namespace := range namespaces {
+		if namespace != "" && !Contains(unique, namespace) {
+			unique = append(unique, namespace)
+		}
+	}
+	return unique
+}
+
+// SelectMemberNamespaces adds the namespaces matching flags.MemberNamespaceSelector in any of the clusters of the
+// client map to flags.MemberClusterNamespaces, so that the operator's Roles are created in each of them on every
+// cluster.
+func SelectMemberNamespaces(ctx context.Context, clientMap map[string]KubeClient, flags *Flags) error {
+	if flags.MemberNamespaceSelector == "" {
+		return nil
+	}
+
+	selected := map[string]bool{}
+	mu := sync.Mutex{}
+	var clusters []string
+	for cluster := range clientMap {
+		clusters = append(clusters, cluster)
+	}
+	sort.Strings(clusters)
+	err := forEachCluster(ctx, clusters, flags.Parallelism, func(ctx context.Context, cluster string) error {
+		namespaces, err := clientMap[cluster].CoreV1().Namespaces().List(ctx, metav1.ListOptions{LabelSelector: flags.MemberNamespaceSelector})
+		if err != nil {
+			return xerrors.Errorf("failed listing namespaces matching %s in cluster %s: %w", flags.MemberNamespaceSelector, cluster, err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, ns := range namespaces.Items {
+			selected[ns.Name] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for name := range selected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		Warnf("no namespace matches %s in any cluster", flags.MemberNamespaceSelector)
+	}
+	flags.MemberClusterNamespaces = uniqueNamespaces(append(flags.MemberClusterNamespaces, names...))
+	return nil
+}
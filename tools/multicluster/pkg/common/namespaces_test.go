@@ -0,0 +1,94 @@
+package common
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMemberNamespaces(t *testing.T) {
+	flags := Flags{CentralClusterNamespace: "operator", MemberClusterNamespace: "mongodb", MemberClusterNamespaces: []string{"team-a", "mongodb", "operator"}}
+
+	assert.Equal(t, []string{"mongodb", "team-a", "operator"}, flags.memberNamespaces())
+	assert.True(t, flags.watchesMultipleNamespaces())
+	assert.False(t, Flags{MemberClusterNamespace: "mongodb"}.watchesMultipleNamespaces())
+}
+
+func TestEnsureMultiClusterResources_CreatesRolesInEveryMemberNamespace(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	flags.InstallDatabaseRoles = true
+	flags.MemberClusterNamespaces = []string{"team-a", "team-b"}
+	clientMap := getClientResources(ctx, flags)
+	require.NoError(t, EnsureMultiClusterResources(ctx, flags, clientMap))
+
+	roleName := buildMemberEntityRole(flags, flags.MemberClusterNamespace).Name
+	for _, cluster := range flags.MemberClusters {
+		for _, namespace := range flags.memberNamespaces() {
+			_, err := clientMap[cluster].CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+			assert.NoError(t, err, "namespace %s must exist in cluster %s", namespace, cluster)
+			_, err = clientMap[cluster].RbacV1().Roles(namespace).Get(ctx, roleName, metav1.GetOptions{})
+			assert.NoError(t, err, "role must exist in namespace %s of cluster %s", namespace, cluster)
+			_, err = clientMap[cluster].RbacV1().RoleBindings(namespace).Get(ctx, roleName+"-binding", metav1.GetOptions{})
+			assert.NoError(t, err, "role binding must exist in namespace %s of cluster %s", namespace, cluster)
+			_, err = clientMap[cluster].CoreV1().ServiceAccounts(namespace).Get(ctx, AppdbServiceAccount, metav1.GetOptions{})
+			assert.NoError(t, err, "database service account must exist in namespace %s of cluster %s", namespace, cluster)
+		}
+	}
+	for _, namespace := range flags.memberNamespaces() {
+		_, err := clientMap[flags.CentralCluster].RbacV1().Roles(namespace).Get(ctx, roleName, metav1.GetOptions{})
+		assert.NoError(t, err, "central role must exist in namespace %s", namespace)
+	}
+
+	kubeConfig, err := readKubeConfig(ctx, clientMap[flags.CentralCluster], flags.CentralClusterNamespace)
+	require.NoError(t, err)
+	for _, kubeContext := range kubeConfig.Contexts {
+		assert.Empty(t, kubeContext.Context.Namespace, "context %s must not default to one of the namespaces", kubeContext.Name)
+	}
+
+	require.NoError(t, performCleanup(ctx, clientMap, flags))
+	for _, cluster := range allClusters(flags) {
+		_, err := clientMap[cluster].RbacV1().Roles("team-b").Get(ctx, roleName, metav1.GetOptions{})
+		assert.True(t, errors.IsNotFound(err), "role must be cleaned up in cluster %s", cluster)
+	}
+}
+
+func TestSelectMemberNamespaces(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	flags.MemberClusterNamespaces = []string{"team-a"}
+	flags.MemberNamespaceSelector = "mongodb.com/watched=true"
+	clientMap := getClientResources(ctx, flags)
+
+	watched := map[string]string{"mongodb.com/watched": "true"}
+	namespaces := map[string][]corev1.Namespace{
+		flags.MemberClusters[0]: {
+			{ObjectMeta: metav1.ObjectMeta{Name: "team-c", Labels: watched}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: watched}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "unwatched"}},
+		},
+		flags.MemberClusters[1]: {
+			{ObjectMeta: metav1.ObjectMeta{Name: "team-b", Labels: watched}},
+		},
+	}
+	for cluster, items := range namespaces {
+		for _, ns := range items {
+			_, err := clientMap[cluster].CoreV1().Namespaces().Create(ctx, &ns, metav1.CreateOptions{})
+			require.NoError(t, err)
+		}
+	}
+
+	require.NoError(t, SelectMemberNamespaces(ctx, clientMap, &flags))
+	assert.Equal(t, []string{"team-a", "team-b", "team-c"}, flags.MemberClusterNamespaces)
+
+	require.NoError(t, EnsureMultiClusterResources(ctx, flags, clientMap))
+	for _, cluster := range flags.MemberClusters {
+		_, err := clientMap[cluster].RbacV1().Roles("team-c").Get(ctx, buildMemberEntityRole(flags, "team-c").Name, metav1.GetOptions{})
+		assert.NoError(t, err, "selected namespaces get roles in every cluster, missing in %s", cluster)
+	}
+}
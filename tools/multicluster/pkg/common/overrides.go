@@ -0,0 +1,75 @@
+package common
+
+// ClusterOverrides changes the namespaces and the operator's ServiceAccount in a single member cluster. Empty fields
+// keep the value of the corresponding global flag.
+type ClusterOverrides struct {
+	// MemberNamespace replaces MemberClusterNamespace in the cluster.
+	MemberNamespace string
+	// ServiceAccountNamespace is the namespace of the operator's ServiceAccount in the cluster, instead of
+	// CentralClusterNamespace.
+	ServiceAccountNamespace string
+	// ServiceAccount is the name of the operator's ServiceAccount in the cluster, instead of ServiceAccount.
+	ServiceAccount string
+}
+
+// overridesFor returns the overrides of the cluster. The central cluster can't be overridden, as the operator runs
+// there with the global ServiceAccount.
+func (f Flags) overridesFor(cluster string) ClusterOverrides {
+	if cluster == f.CentralCluster {
+		return ClusterOverrides{}
+	}
+	return f.ClusterOverrides[cluster]
+}
+
+// memberNamespaceFor returns the main member namespace of the cluster.
+func (f Flags) memberNamespaceFor(cluster string) string {
+	if namespace := f.overridesFor(cluster).MemberNamespace; namespace != "" {
+		return namespace
+	}
+	return f.MemberClusterNamespace
+}
+
+// memberNamespacesFor returns the namespaces watched by the operator in the cluster: its main member namespace
+// followed by the additional MemberClusterNamespaces.
+func (f Flags) memberNamespacesFor(cluster string) []string {
+	return uniqueNamespaces(append([]string{f.memberNamespaceFor(cluster)}, f.MemberClusterNamespaces...))
+}
+
+// serviceAccountFor returns the namespace and name of the operator's ServiceAccount in the cluster.
+func (f Flags) serviceAccountFor(cluster string) (string, string) {
+	overrides := f.overridesFor(cluster)
+	namespace, name := f.CentralClusterNamespace, f.ServiceAccount
+	if overrides.ServiceAccountNamespace != "" {
+		namespace = overrides.ServiceAccountNamespace
+	}
+	if overrides.ServiceAccount != "" {
+		name = overrides.ServiceAccount
+	}
+	return namespace, name
+}
+
+// serviceAccountNamespaces returns the namespaces this tool creates in the cluster, which hold the operator's and the
+// database ServiceAccounts: the namespace of the operator's ServiceAccount, followed by the member namespaces if the
+// cluster is a member cluster.
+func (f Flags) serviceAccountNamespaces(cluster string) []string {
+	if !Contains(f.MemberClusters, cluster) {
+		serviceAccountNamespace, _ := f.serviceAccountFor(cluster)
+		return []string{serviceAccountNamespace}
+	}
+	return f.clusterNamespaces(cluster)
+}
+
+// clusterNamespaces returns all the namespaces this tool creates objects in, in the cluster: the namespace of the
+// operator's ServiceAccount followed by the member namespaces. The central cluster has the operator's Roles in the
+// member namespaces too.
+func (f Flags) clusterNamespaces(cluster string) []string {
+	serviceAccountNamespace, _ := f.serviceAccountFor(cluster)
+	var namespaces []string
+	if cluster == f.CentralCluster {
+		namespaces = append(namespaces, f.memberNamespaces()...)
+	}
+	if cluster != f.CentralCluster || Contains(f.MemberClusters, cluster) {
+		namespaces = append(namespaces, f.memberNamespacesFor(cluster)...)
+	}
+	return uniqueNamespaces(append([]string{serviceAccountNamespace}, namespaces...))
+}
@@ -0,0 +1,100 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestClusterOverrides(t *testing.T) {
+	flags := Flags{
+		CentralCluster:          "central",
+		CentralClusterNamespace: "operator",
+		MemberClusterNamespace:  "mongodb",
+		MemberClusterNamespaces: []string{"team-a"},
+		MemberClusters:          []string{"central", "eu", "us"},
+		ServiceAccount:          "operator-sa",
+		ClusterOverrides: map[string]ClusterOverrides{
+			"central": {MemberNamespace: "ignored"},
+			"eu":      {MemberNamespace: "mongodb-eu"},
+			"us":      {ServiceAccountNamespace: "operator-us", ServiceAccount: "operator-sa-us"},
+		},
+	}
+
+	namespace, name := flags.serviceAccountFor("central")
+	assert.Equal(t, []string{"operator", "operator-sa"}, []string{namespace, name})
+	namespace, name = flags.serviceAccountFor("us")
+	assert.Equal(t, []string{"operator-us", "operator-sa-us"}, []string{namespace, name})
+
+	assert.Equal(t, "mongodb", flags.memberNamespaceFor("central"))
+	assert.Equal(t, []string{"mongodb-eu", "team-a"}, flags.memberNamespacesFor("eu"))
+	assert.Equal(t, []string{"operator", "mongodb", "team-a"}, flags.clusterNamespaces("central"))
+	assert.Equal(t, []string{"operator", "mongodb-eu", "team-a"}, flags.clusterNamespaces("eu"))
+	assert.Equal(t, []string{"operator-us", "mongodb", "team-a"}, flags.clusterNamespaces("us"))
+}
+
+func TestEnsureMultiClusterResources_WithClusterOverrides(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	flags.InstallDatabaseRoles = true
+	eu, us := flags.MemberClusters[0], flags.MemberClusters[1]
+	flags.ClusterOverrides = map[string]ClusterOverrides{
+		eu: {MemberNamespace: "mongodb-eu"},
+		us: {ServiceAccountNamespace: "operator-us", ServiceAccount: "operator-us"},
+	}
+	clientMap := getClientResources(ctx, flags)
+	require.NoError(t, EnsureMultiClusterResources(ctx, flags, clientMap))
+
+	_, err := clientMap[eu].RbacV1().Roles("mongodb-eu").Get(ctx, buildMemberEntityRole(flags, "mongodb-eu").Name, metav1.GetOptions{})
+	assert.NoError(t, err, "the member role must be created in the overridden namespace")
+	_, err = clientMap[eu].CoreV1().ServiceAccounts("mongodb-eu").Get(ctx, AppdbServiceAccount, metav1.GetOptions{})
+	assert.NoError(t, err, "the database service accounts must be created in the overridden namespace")
+
+	_, err = clientMap[us].CoreV1().ServiceAccounts("operator-us").Get(ctx, "operator-us", metav1.GetOptions{})
+	require.NoError(t, err, "the operator's service account must be created with the overridden name and namespace")
+	binding, err := clientMap[us].RbacV1().RoleBindings(flags.MemberClusterNamespace).Get(ctx, buildMemberEntityRole(flags, flags.MemberClusterNamespace).Name+"-binding", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "operator-us", Namespace: "operator-us"}}, binding.Subjects)
+
+	kubeConfig, err := readKubeConfig(ctx, clientMap[flags.CentralCluster], flags.CentralClusterNamespace)
+	require.NoError(t, err)
+	namespaces := map[string]string{}
+	for _, kubeContext := range kubeConfig.Contexts {
+		namespaces[kubeContext.Name] = kubeContext.Context.Namespace
+	}
+	assert.Equal(t, map[string]string{eu: "mongodb-eu", us: flags.MemberClusterNamespace, flags.MemberClusters[2]: flags.MemberClusterNamespace}, namespaces)
+
+	token, err := readSecretKey(ctx, clientMap[us], fmt.Sprintf("%s-token-secret", "operator-us"), "operator-us", "token")
+	require.NoError(t, err)
+	for _, user := range kubeConfig.Users {
+		if user.Name == us {
+			assert.Equal(t, string(token), user.User.Token, "the token must be read from the overridden service account")
+		}
+	}
+}
+
+func TestTopology_ApplyTo_ClusterOverrides(t *testing.T) {
+	topology := Topology{
+		CentralCluster:         TopologyCentralCluster{Context: "cluster-0", Namespace: "operator"},
+		MemberClusterNamespace: "mongodb",
+		MemberClusters: []TopologyMemberCluster{
+			{Name: "cluster-0"},
+			{Name: "cluster-1", Namespace: "mongodb-eu", TLSServerName: "api.internal"},
+			{Name: "cluster-2", ServiceAccount: "operator-us", ServiceAccountNamespace: "operator-us"},
+		},
+	}
+	require.NoError(t, Topology{ApiVersion: TopologyApiVersion, Kind: TopologyKind, CentralCluster: topology.CentralCluster, MemberClusterNamespace: topology.MemberClusterNamespace, MemberClusters: topology.MemberClusters}.Validate())
+
+	flags := Flags{}
+	topology.ApplyTo(&flags)
+	assert.Equal(t, map[string]ClusterOverrides{
+		"cluster-1": {MemberNamespace: "mongodb-eu"},
+		"cluster-2": {ServiceAccountNamespace: "operator-us", ServiceAccount: "operator-us"},
+	}, flags.ClusterOverrides)
+	assert.Equal(t, map[string]ClusterConnection{"cluster-1": {TLSServerName: "api.internal"}}, flags.ClusterConnections)
+}
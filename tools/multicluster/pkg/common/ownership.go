@@ -0,0 +1,331 @@
+package common
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// LegacyLabel is the only label set by older versions of this tool on the objects they created.
+	LegacyLabel = "multi-cluster"
+	// InstallationLabel identifies the installation an object belongs to. Its value is Flags.InstallationID.
+	InstallationLabel = "mongodb.com/multi-cluster-installation"
+	// OperatorNameLabel and OperatorNamespaceLabel make the installation readable in selectors.
+	OperatorNameLabel      = "mongodb.com/operator-name"
+	OperatorNamespaceLabel = "mongodb.com/operator-namespace"
+
+	// InstallationAnnotation holds the readable identity of the installation an object belongs to.
+	InstallationAnnotation = "mongodb.com/multi-cluster-installation"
+	// VersionAnnotation holds the version of this tool that last applied the object.
+	VersionAnnotation = "mongodb.com/kubectl-mongodb-version"
+	// CreatedAtAnnotation holds the time the object was first created by this tool.
+	CreatedAtAnnotation = "mongodb.com/created-at"
+)
+
+// Version is the version of this tool recorded on the objects it creates. It is set at build time with
+// -ldflags "-X github.com/10gen/ops-manager-kubernetes/multi/pkg/common.Version=<version>".
+var Version string
+
+// toolVersion returns Version, falling back to the VCS revision the binary was built from.
+func toolVersion() string {
+	if Version != "" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+	}
+	return "unknown"
+}
+
+// operatorName returns the name of the operator deployment of the installation.
+func (f Flags) operatorName() string {
+	if f.OperatorName != "" {
+		return f.OperatorName
+	}
+	return DefaultOperatorName
+}
+
+// installation returns the readable identity of the installation: the operator name and the namespace it runs in.
+// The central cluster is only identified by the installation ID, as its kubeconfig context name differs between the
+// people running this tool.
+func (f Flags) installation() string {
+	return fmt.Sprintf("%s/%s", f.CentralClusterNamespace, f.operatorName())
+}
+
+// installationID returns the value of InstallationLabel for the installation.
+func (f Flags) installationID() string {
+	return f.InstallationID
+}
+
+// ResolveInstallationID sets flags.InstallationID, unless it was given explicitly, to a hash of the UID of the
+// kube-system namespace of the central cluster, the central namespace and the operator name. The UID is the same for
+// everyone running this tool against the cluster, whatever their kubeconfig calls it, and the combination doesn't
+// always fit into a label value.
+func ResolveInstallationID(ctx context.Context, centralClusterClient KubeClient, flags *Flags) error {
+	if flags.InstallationID != "" {
+		if problems := validation.IsValidLabelValue(flags.InstallationID); len(problems) > 0 {
+			return xerrors.Errorf("invalid installation id %q: %s", flags.InstallationID, strings.Join(problems, ", "))
+		}
+		return nil
+	}
+
+	ns, err := centralClusterClient.CoreV1().Namespaces().Get(ctx, metav1.NamespaceSystem, metav1.GetOptions{})
+	if err != nil {
+		return xerrors.Errorf("failed reading the identity of the central cluster %s from namespace %s, pass --installation-id instead: %w", flags.CentralCluster, metav1.NamespaceSystem, err)
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s/%s", ns.UID, flags.installation())))
+	flags.InstallationID = hex.EncodeToString(sum[:])[:16]
+	logger.Info("Identified the installation", "cluster", flags.CentralCluster, "installation", flags.InstallationID)
+	return nil
+}
+
+// clusterScopedName returns the name of a ClusterRole or ClusterRoleBinding of the installation. Cluster scoped objects
+// are shared by all installations in a cluster, so their names always include the installation. The ones created by
+// older versions of this tool are replaced rather than adopted, see replaceLegacyClusterObjects.
+func (f Flags) clusterScopedName(name string) string {
+	return fmt.Sprintf("%s-%s", name, f.installationID())
+}
+
+// multiClusterLabels the labels that will be applied to every resource created by this tool. Besides the legacy
+// label, they identify the installation, so that cleaning up one installation doesn't touch the objects of another.
+func multiClusterLabels(f Flags) map[string]string {
+	labels := map[string]string{
+		LegacyLabel:       "true",
+		InstallationLabel: f.installationID(),
+	}
+	// cluster names can be arbitrary kubeconfig context names, so only the operator name and namespace are readable
+	if len(validation.IsValidLabelValue(f.operatorName())) == 0 {
+		labels[OperatorNameLabel] = f.operatorName()
+	}
+	if len(validation.IsValidLabelValue(f.CentralClusterNamespace)) == 0 {
+		labels[OperatorNamespaceLabel] = f.CentralClusterNamespace
+	}
+	return labels
+}
+
+// multiClusterAnnotations the annotations that will be applied to every resource created by this tool.
+func multiClusterAnnotations(f Flags) map[string]string {
+	return map[string]string{
+		InstallationAnnotation: f.installation(),
+		VersionAnnotation:      toolVersion(),
+		CreatedAtAnnotation:    time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+// setOwnership adds the labels and annotations of the installation to an existing object, keeping its other labels
+// and annotations, and its creation time if it has one.
+func setOwnership(obj metav1.Object, f Flags) {
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	for k, v := range multiClusterLabels(f) {
+		labels[k] = v
+	}
+	obj.SetLabels(labels)
+
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	for k, v := range multiClusterAnnotations(f) {
+		if _, ok := annotations[k]; ok && k == CreatedAtAnnotation {
+			continue
+		}
+		annotations[k] = v
+	}
+	obj.SetAnnotations(annotations)
+}
+
+// keepCreatedAt copies the creation time recorded on the live object to the object replacing it.
+func keepCreatedAt(obj, live metav1.Object) {
+	createdAt, ok := live.GetAnnotations()[CreatedAtAnnotation]
+	if !ok {
+		return
+	}
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[CreatedAtAnnotation] = createdAt
+	obj.SetAnnotations(annotations)
+}
+
+// installationSelector selects the objects of the installation.
+func installationSelector(f Flags) string {
+	return fmt.Sprintf("%s=true,%s=%s", LegacyLabel, InstallationLabel, f.installationID())
+}
+
+// cleanupSelectors returns the selectors of the objects deleted when cleaning up the installation.
+func cleanupSelectors(f Flags) []string {
+	if f.AdoptLegacyObjects {
+		return []string{installationSelector(f), legacySelector}
+	}
+	return []string{installationSelector(f)}
+}
+
+// legacySelector selects the objects created by older versions of this tool, which don't record their installation.
+const legacySelector = LegacyLabel + "=true,!" + InstallationLabel
+
+// listUpdateClient is implemented by the typed clients of all the objects cleaned up by this tool.
+type listUpdateClient[T plannedObject, L runtime.Object] interface {
+	Get(ctx context.Context, name string, opts metav1.GetOptions) (T, error)
+	List(ctx context.Context, opts metav1.ListOptions) (L, error)
+	Update(ctx context.Context, obj T, opts metav1.UpdateOptions) (T, error)
+}
+
+// listObjects returns the objects matching the selector.
+func listObjects[T plannedObject, L runtime.Object](ctx context.Context, client listUpdateClient[T, L], selector string) ([]T, error) {
+	list, err := client.List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]T, 0, len(items))
+	for _, item := range items {
+		objects = append(objects, item.(T))
+	}
+	return objects, nil
+}
+
+// adoptObjects labels the objects created by older versions of this tool as part of the installation.
+func adoptObjects[T plannedObject, L runtime.Object](ctx context.Context, client listUpdateClient[T, L], f Flags, cluster, kind string) error {
+	objects, err := listObjects(ctx, client, legacySelector)
+	if err != nil {
+		return xerrors.Errorf("failed listing %ss: %w", kind, err)
+	}
+	for _, obj := range objects {
+		listed := true
+		err := retryOnConflict(func() error {
+			// after a conflict, the labels are set on the latest version of the object
+			if !listed {
+				latest, err := client.Get(ctx, obj.GetName(), metav1.GetOptions{})
+				if err != nil {
+					return err
+				}
+				obj = latest
+			}
+			listed = false
+			setOwnership(obj, f)
+			_, err := client.Update(ctx, obj, metav1.UpdateOptions{})
+			return err
+		})
+		if err != nil {
+			return xerrors.Errorf("failed adopting %s %s: %w", kind, obj.GetName(), err)
+		}
+		logger.Info("Adopted "+kind, "cluster", cluster, "namespace", obj.GetNamespace(), "name", obj.GetName())
+	}
+	return nil
+}
+
+// adoptLegacyObjects labels the objects created by older versions of this tool in the given namespaces of a cluster as
+// part of the installation. They are then managed, and cleaned up, like the objects created by this version. Cluster
+// scoped objects are replaced instead, see replaceLegacyClusterObjects.
+func adoptLegacyObjects(ctx context.Context, c KubeClient, f Flags, cluster string, namespaces []string) error {
+	for _, namespace := range namespaces {
+		if err := adoptObjects[*corev1.Secret, *corev1.SecretList](ctx, c.CoreV1().Secrets(namespace), f, cluster, "Secret"); err != nil {
+			return err
+		}
+		if err := adoptObjects[*corev1.ConfigMap, *corev1.ConfigMapList](ctx, c.CoreV1().ConfigMaps(namespace), f, cluster, "ConfigMap"); err != nil {
+			return err
+		}
+		if err := adoptObjects[*corev1.ServiceAccount, *corev1.ServiceAccountList](ctx, c.CoreV1().ServiceAccounts(namespace), f, cluster, "ServiceAccount"); err != nil {
+			return err
+		}
+		if err := adoptObjects[*rbacv1.Role, *rbacv1.RoleList](ctx, c.RbacV1().Roles(namespace), f, cluster, "Role"); err != nil {
+			return err
+		}
+		if err := adoptObjects[*rbacv1.RoleBinding, *rbacv1.RoleBindingList](ctx, c.RbacV1().RoleBindings(namespace), f, cluster, "RoleBinding"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceLegacyClusterObjects deletes the ClusterRoles and ClusterRoleBindings created by older versions of this tool
+// in a cluster with flags.AdoptLegacyObjects. Their names don't include the installation and objects can't be
+// renamed, so they are deleted once the installation's own ones exist instead of being adopted. Without
+// flags.AdoptLegacyObjects they are kept and reported.
+func replaceLegacyClusterObjects(ctx context.Context, c KubeClient, f Flags, cluster string) error {
+	clusterRoleBindings, err := listObjects[*rbacv1.ClusterRoleBinding, *rbacv1.ClusterRoleBindingList](ctx, c.RbacV1().ClusterRoleBindings(), legacySelector)
+	if err != nil {
+		return xerrors.Errorf("failed listing ClusterRoleBindings: %w", err)
+	}
+	clusterRoles, err := listObjects[*rbacv1.ClusterRole, *rbacv1.ClusterRoleList](ctx, c.RbacV1().ClusterRoles(), legacySelector)
+	if err != nil {
+		return xerrors.Errorf("failed listing ClusterRoles: %w", err)
+	}
+	if len(clusterRoleBindings)+len(clusterRoles) == 0 {
+		return nil
+	}
+	if !f.AdoptLegacyObjects {
+		Warnf("kept %d ClusterRoles and ClusterRoleBindings in cluster %s created by older versions of this tool, the installation now uses its own ones, pass --adopt-legacy-objects to delete them", len(clusterRoleBindings)+len(clusterRoles), cluster)
+		return nil
+	}
+
+	// the bindings are deleted first, so that no binding ever refers to a missing ClusterRole
+	for _, binding := range clusterRoleBindings {
+		logger.Info("Deleting ClusterRoleBinding replaced by the installation's own", "cluster", cluster, "name", binding.Name)
+		if err := c.RbacV1().ClusterRoleBindings().Delete(ctx, binding.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return xerrors.Errorf("failed deleting ClusterRoleBinding %s: %w", binding.Name, err)
+		}
+	}
+	for _, role := range clusterRoles {
+		logger.Info("Deleting ClusterRole replaced by the installation's own", "cluster", cluster, "name", role.Name)
+		if err := c.RbacV1().ClusterRoles().Delete(ctx, role.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return xerrors.Errorf("failed deleting ClusterRole %s: %w", role.Name, err)
+		}
+	}
+	return nil
+}
+
+// countLegacyObjects returns the number of namespaced objects created by older versions of this tool in the given
+// namespaces of a cluster. Cluster scoped ones are reported by replaceLegacyClusterObjects.
+func countLegacyObjects(ctx context.Context, c KubeClient, namespaces []string) (int, error) {
+	count := 0
+	add := func(n int, err error) error {
+		count += n
+		return err
+	}
+
+	for _, namespace := range namespaces {
+		secrets, err := listObjects[*corev1.Secret, *corev1.SecretList](ctx, c.CoreV1().Secrets(namespace), legacySelector)
+		if err := add(len(secrets), err); err != nil {
+			return 0, err
+		}
+		serviceAccounts, err := listObjects[*corev1.ServiceAccount, *corev1.ServiceAccountList](ctx, c.CoreV1().ServiceAccounts(namespace), legacySelector)
+		if err := add(len(serviceAccounts), err); err != nil {
+			return 0, err
+		}
+		roles, err := listObjects[*rbacv1.Role, *rbacv1.RoleList](ctx, c.RbacV1().Roles(namespace), legacySelector)
+		if err := add(len(roles), err); err != nil {
+			return 0, err
+		}
+		roleBindings, err := listObjects[*rbacv1.RoleBinding, *rbacv1.RoleBindingList](ctx, c.RbacV1().RoleBindings(namespace), legacySelector)
+		if err := add(len(roleBindings), err); err != nil {
+			return 0, err
+		}
+	}
+	return count, nil
+}
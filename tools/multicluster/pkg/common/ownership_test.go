@@ -0,0 +1,181 @@
+package common
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestMultiClusterLabels_IdentifyTheInstallation(t *testing.T) {
+	flags := testFlags(t, false)
+	labels := multiClusterLabels(flags)
+
+	assert.Equal(t, "true", labels[LegacyLabel])
+	assert.Equal(t, DefaultOperatorName, labels[OperatorNameLabel])
+	assert.Equal(t, flags.CentralClusterNamespace, labels[OperatorNamespaceLabel])
+	assert.Len(t, labels[InstallationLabel], 16)
+
+	assert.Equal(t, flags.InstallationID, labels[InstallationLabel])
+
+	annotations := multiClusterAnnotations(flags)
+	assert.Equal(t, "central-namespace/"+DefaultOperatorName, annotations[InstallationAnnotation])
+	assert.NotEmpty(t, annotations[VersionAnnotation])
+	assert.NotEmpty(t, annotations[CreatedAtAnnotation])
+}
+
+func TestApplyObject_KeepsCreatedAt(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	client := getClientResources(ctx, flags)[flags.CentralCluster]
+
+	role := buildMemberEntityRole(flags, flags.MemberClusterNamespace)
+	role.Annotations[CreatedAtAnnotation] = "2020-01-01T00:00:00Z"
+	_, err := applyObject(ctx, client.RbacV1().Roles(flags.MemberClusterNamespace), &role)
+	require.NoError(t, err)
+
+	role = buildMemberEntityRole(flags, flags.MemberClusterNamespace)
+	_, err = applyObject(ctx, client.RbacV1().Roles(flags.MemberClusterNamespace), &role)
+	require.NoError(t, err)
+
+	live, err := client.RbacV1().Roles(flags.MemberClusterNamespace).Get(ctx, role.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "2020-01-01T00:00:00Z", live.Annotations[CreatedAtAnnotation])
+}
+
+// createForeignRoles creates a Role belonging to another installation and a Role created by an older version of this
+// tool in the member namespace of the cluster.
+func createForeignRoles(t *testing.T, ctx context.Context, c KubeClient, flags Flags) (rbacv1.Role, rbacv1.Role) {
+	otherInstallation := flags
+	otherInstallation.OperatorName = "other-operator"
+	otherInstallation.InstallationID = "other-installation"
+	otherRole := rbacv1.Role{ObjectMeta: metav1.ObjectMeta{
+		Name:      "other-operator-role",
+		Namespace: flags.MemberClusterNamespace,
+		Labels:    multiClusterLabels(otherInstallation),
+	}}
+	legacyRole := rbacv1.Role{ObjectMeta: metav1.ObjectMeta{
+		Name:      "legacy-role",
+		Namespace: flags.MemberClusterNamespace,
+		Labels:    map[string]string{LegacyLabel: "true"},
+	}}
+	for _, role := range []rbacv1.Role{otherRole, legacyRole} {
+		_, err := c.RbacV1().Roles(flags.MemberClusterNamespace).Create(ctx, &role, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+	return otherRole, legacyRole
+}
+
+func TestPerformCleanup_OnlyDeletesTheInstallationsObjects(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	clientMap := getClientResources(ctx, flags)
+	require.NoError(t, EnsureMultiClusterResources(ctx, flags, clientMap))
+	member := clientMap[flags.MemberClusters[0]]
+	otherRole, legacyRole := createForeignRoles(t, ctx, member, flags)
+
+	require.NoError(t, performCleanup(ctx, clientMap, flags))
+
+	assertMemberRolesDoNotExist(t, ctx, clientMap, flags)
+	_, err := member.RbacV1().Roles(flags.MemberClusterNamespace).Get(ctx, otherRole.Name, metav1.GetOptions{})
+	assert.NoError(t, err, "roles of other installations must be kept")
+	_, err = member.RbacV1().Roles(flags.MemberClusterNamespace).Get(ctx, legacyRole.Name, metav1.GetOptions{})
+	assert.NoError(t, err, "roles without installation must be kept unless adopted")
+}
+
+func TestEnsureMultiClusterResources_AdoptsLegacyObjects(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	clientMap := getClientResources(ctx, flags)
+	require.NoError(t, EnsureMultiClusterResources(ctx, flags, clientMap))
+	member := clientMap[flags.MemberClusters[0]]
+	otherRole, legacyRole := createForeignRoles(t, ctx, member, flags)
+
+	flags.AdoptLegacyObjects = true
+	require.NoError(t, EnsureMultiClusterResources(ctx, flags, clientMap))
+
+	adopted, err := member.RbacV1().Roles(flags.MemberClusterNamespace).Get(ctx, legacyRole.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, multiClusterLabels(flags), adopted.Labels)
+	assert.Equal(t, flags.installation(), adopted.Annotations[InstallationAnnotation])
+
+	require.NoError(t, performCleanup(ctx, clientMap, flags))
+
+	_, err = member.RbacV1().Roles(flags.MemberClusterNamespace).Get(ctx, legacyRole.Name, metav1.GetOptions{})
+	assert.True(t, errors.IsNotFound(err), "adopted roles are cleaned up with the installation")
+	_, err = member.RbacV1().Roles(flags.MemberClusterNamespace).Get(ctx, otherRole.Name, metav1.GetOptions{})
+	assert.NoError(t, err, "roles of other installations must be kept")
+}
+
+func TestEnsureMultiClusterResources_ReplacesLegacyClusterRoles(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	clientMap := getClientResources(ctx, flags)
+	central := clientMap[flags.CentralCluster]
+	legacyLabels := map[string]string{LegacyLabel: "true"}
+	legacyRole := rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "mongodb-enterprise-operator-multi-cluster-role-telemetry", Labels: legacyLabels}}
+	_, err := central.RbacV1().ClusterRoles().Create(ctx, &legacyRole, metav1.CreateOptions{})
+	require.NoError(t, err)
+	legacyBinding := rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "mongodb-enterprise-operator-multi-telemetry-cluster-role-binding", Labels: legacyLabels}}
+	_, err = central.RbacV1().ClusterRoleBindings().Create(ctx, &legacyBinding, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	bindingNames := func() []string {
+		bindings, err := central.RbacV1().ClusterRoleBindings().List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		var names []string
+		for _, binding := range bindings.Items {
+			names = append(names, binding.Name)
+		}
+		return names
+	}
+	installationBinding := flags.clusterScopedName("mongodb-enterprise-operator-multi-telemetry-cluster-role-binding")
+
+	require.NoError(t, EnsureMultiClusterResources(ctx, flags, clientMap))
+	assert.ElementsMatch(t, []string{legacyBinding.Name, installationBinding}, bindingNames(), "legacy objects are kept unless adopted")
+
+	flags.AdoptLegacyObjects = true
+	require.NoError(t, EnsureMultiClusterResources(ctx, flags, clientMap))
+	assert.Equal(t, []string{installationBinding}, bindingNames())
+	_, err = central.RbacV1().ClusterRoles().Get(ctx, legacyRole.Name, metav1.GetOptions{})
+	assert.True(t, errors.IsNotFound(err), "legacy cluster roles are replaced by the installation's own")
+
+	// the names don't depend on the flag, later runs without it update the same objects
+	flags.AdoptLegacyObjects = false
+	require.NoError(t, EnsureMultiClusterResources(ctx, flags, clientMap))
+	assert.Equal(t, []string{installationBinding}, bindingNames())
+}
+
+func TestResolveInstallationID(t *testing.T) {
+	ctx := context.Background()
+	kubeSystem := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: metav1.NamespaceSystem, UID: "0b9c3c1e-6f0e-4a43-9d1b-2f5e8c7a1d20"}}
+	central := NewKubeClientContainer(nil, fake.NewSimpleClientset(kubeSystem), nil)
+	resolve := func(modify func(f *Flags)) string {
+		flags := testFlags(t, false)
+		flags.InstallationID = ""
+		modify(&flags)
+		require.NoError(t, ResolveInstallationID(ctx, central, &flags))
+		return flags.InstallationID
+	}
+
+	id := resolve(func(*Flags) {})
+	assert.Len(t, id, 16)
+	assert.Equal(t, id, resolve(func(f *Flags) { f.CentralCluster = "admin-2-context" }), "the kubeconfig context name of the central cluster doesn't matter")
+	assert.NotEqual(t, id, resolve(func(f *Flags) { f.OperatorName = "other-operator" }))
+	assert.NotEqual(t, id, resolve(func(f *Flags) { f.CentralClusterNamespace = "other-namespace" }))
+	assert.Equal(t, "mongodb-prod", resolve(func(f *Flags) { f.InstallationID = "mongodb-prod" }))
+
+	flags := testFlags(t, false)
+	flags.InstallationID = "not a label value"
+	assert.ErrorContains(t, ResolveInstallationID(ctx, central, &flags), `invalid installation id "not a label value"`)
+
+	flags.InstallationID = ""
+	empty := NewKubeClientContainer(nil, fake.NewSimpleClientset(), nil)
+	assert.ErrorContains(t, ResolveInstallationID(ctx, empty, &flags), "pass --installation-id instead")
+}
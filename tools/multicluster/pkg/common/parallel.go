@@ -0,0 +1,85 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultParallelism is the number of clusters that are processed concurrently when not specified.
+const DefaultParallelism = 5
+
+// ClusterErrors is returned when an operation failed in some of the clusters it was run against.
+// It holds the error of every failed cluster and the clusters the operation succeeded in.
+type ClusterErrors struct {
+	Errors    map[string]error
+	Succeeded []string
+}
+
+func (e *ClusterErrors) Error() string {
+	var failed []string
+	for cluster := range e.Errors {
+		failed = append(failed, cluster)
+	}
+	sort.Strings(failed)
+
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("failed in %d of %d clusters:\n", len(failed), len(failed)+len(e.Succeeded)))
+	for _, cluster := range failed {
+		sb.WriteString(fmt.Sprintf("  %s: %s\n", cluster, e.Errors[cluster]))
+	}
+	if len(e.Succeeded) > 0 {
+		sb.WriteString(fmt.Sprintf("succeeded in: %s", strings.Join(e.Succeeded, ", ")))
+	} else {
+		sb.WriteString("succeeded in: none")
+	}
+	return sb.String()
+}
+
+// forEachCluster calls fn for every cluster, running at most parallelism calls at a time. A failure in one cluster
+// doesn't stop the others; all the errors are returned together as *ClusterErrors.
+func forEachCluster(ctx context.Context, clusters []string, parallelism int, fn func(ctx context.Context, cluster string) error) error {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	errs := make([]error, len(clusters))
+	sem := make(chan struct{}, parallelism)
+	wg := sync.WaitGroup{}
+	for i, cluster := range clusters {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = fn(ctx, cluster)
+		}()
+	}
+	wg.Wait()
+
+	result := &ClusterErrors{Errors: map[string]error{}}
+	for i, cluster := range clusters {
+		if errs[i] != nil {
+			result.Errors[cluster] = errs[i]
+		} else {
+			result.Succeeded = append(result.Succeeded, cluster)
+		}
+	}
+	if len(result.Errors) > 0 {
+		return result
+	}
+	return nil
+}
+
+// allClusters returns the central cluster followed by every member cluster that isn't the central cluster.
+func allClusters(f Flags) []string {
+	clusters := []string{f.CentralCluster}
+	for _, cluster := range f.MemberClusters {
+		if cluster != f.CentralCluster {
+			clusters = append(clusters, cluster)
+		}
+	}
+	return clusters
+}
@@ -0,0 +1,80 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestForEachCluster_LimitsParallelism(t *testing.T) {
+	var running, maxRunning int32
+	clusters := []string{"cluster-0", "cluster-1", "cluster-2", "cluster-3", "cluster-4", "cluster-5"}
+
+	err := forEachCluster(context.Background(), clusters, 2, func(ctx context.Context, cluster string) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), maxRunning)
+}
+
+func TestForEachCluster_AggregatesErrors(t *testing.T) {
+	clusters := []string{"cluster-0", "cluster-1", "cluster-2"}
+
+	err := forEachCluster(context.Background(), clusters, 0, func(ctx context.Context, cluster string) error {
+		if cluster == "cluster-1" {
+			return fmt.Errorf("unreachable")
+		}
+		return nil
+	})
+
+	require.Error(t, err)
+	clusterErrors := &ClusterErrors{}
+	require.True(t, xerrors.As(err, &clusterErrors))
+	assert.Equal(t, []string{"cluster-0", "cluster-2"}, clusterErrors.Succeeded)
+	assert.Len(t, clusterErrors.Errors, 1)
+	assert.Equal(t, "failed in 1 of 3 clusters:\n  cluster-1: unreachable\nsucceeded in: cluster-0, cluster-2", err.Error())
+}
+
+func TestEnsureMultiClusterResources_ContinuesInOtherClusters_WhenOneFails(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	flags.Parallelism = 3
+	clientMap := getClientResources(ctx, flags)
+
+	failingCluster := flags.MemberClusters[1]
+	clientMap[failingCluster].(*KubeClientContainer).staticClient.(*fake.Clientset).PrependReactor("patch", "serviceaccounts", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("connection refused")
+	})
+
+	err := EnsureMultiClusterResources(ctx, flags, clientMap)
+	require.Error(t, err)
+	clusterErrors := &ClusterErrors{}
+	require.True(t, xerrors.As(err, &clusterErrors))
+	assert.Contains(t, clusterErrors.Errors[failingCluster].Error(), "connection refused")
+	assert.ElementsMatch(t, []string{flags.CentralCluster, flags.MemberClusters[0], flags.MemberClusters[2]}, clusterErrors.Succeeded)
+
+	for _, cluster := range clusterErrors.Succeeded {
+		_, err := clientMap[cluster].CoreV1().ServiceAccounts(flags.CentralClusterNamespace).Get(ctx, flags.ServiceAccount, metav1.GetOptions{})
+		assert.NoError(t, err, "the service account should be created in cluster %s", cluster)
+	}
+}
@@ -0,0 +1,323 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+const (
+	// MongoDBGroup is the API group of the MongoDB custom resources.
+	MongoDBGroup = "mongodb.com"
+
+	// preflightProbeTimeout bounds the request made to an api server that the local kubeconfig doesn't point to.
+	preflightProbeTimeout = 10 * time.Second
+)
+
+// RequiredCRDs are the resources of the MongoDB custom resource definitions the operator needs in the central cluster.
+var RequiredCRDs = []string{"mongodb", "mongodbmulticluster", "mongodbusers", "opsmanagers"}
+
+// RunPreflightChecks validates that setup can be run against the central and member clusters. For every cluster it
+// checks the local kubeconfig, that the api server is reachable and which permissions are missing. It also checks
+// that the MongoDB CRDs are installed in the central cluster.
+func RunPreflightChecks(ctx context.Context, flags Flags, clientMap map[string]KubeClient, kubeconfig *clientcmdapi.Config) CheckReport {
+	return checkClusters(ctx, allClusters(flags), flags.Parallelism, func(ctx context.Context, cluster string) []CheckResult {
+		return runClusterPreflightChecks(ctx, flags, clientMap[cluster], cluster, kubeconfig)
+	})
+}
+
+func runClusterPreflightChecks(ctx context.Context, flags Flags, c KubeClient, cluster string, kubeconfig *clientcmdapi.Config) []CheckResult {
+	checks := []CheckResult{checkKubeConfigContext(flags, cluster, kubeconfig)}
+
+	apiServer := checkApiServer(ctx, flags, c, cluster)
+	checks = append(checks, apiServer)
+	if apiServer.Status == CheckFail {
+		return checks
+	}
+
+	checks = append(checks, checkPermissions(ctx, flags, c, cluster))
+	if cluster == flags.CentralCluster {
+		checks = append(checks, checkCRDs(ctx, c, cluster))
+	}
+	return checks
+}
+
+// checkKubeConfigContext checks that the cluster's context exists in the local kubeconfig and points to a kubeconfig
+// cluster of the same name. The operator identifies member clusters by that name.
+func checkKubeConfigContext(flags Flags, cluster string, kubeconfig *clientcmdapi.Config) CheckResult {
+	check := CheckResult{Cluster: cluster, Check: "kubeconfig"}
+	if kubeconfig == nil {
+		check.Status, check.Message = CheckWarn, "no local kubeconfig loaded"
+		return check
+	}
+
+	contextName := flags.ClusterContext(cluster)
+	kubeContext := kubeconfig.Contexts[contextName]
+	if kubeContext == nil {
+		check.Status, check.Message = CheckFail, fmt.Sprintf("context %s not found in kubeconfig", contextName)
+		return check
+	}
+	if kubeContext.Cluster != cluster {
+		check.Status, check.Message = CheckWarn, fmt.Sprintf("context %s points to kubeconfig cluster %s, not %s", contextName, kubeContext.Cluster, cluster)
+		if Contains(flags.MemberClusters, cluster) && memberClusterApiServerUrl(flags, cluster) == "" {
+			check.Status = CheckFail
+			check.Message += ", set its api server with --member-clusters-api-servers"
+		}
+		return check
+	}
+	check.Status, check.Message = CheckPass, fmt.Sprintf("context %s", contextName)
+	return check
+}
+
+// checkApiServer checks that the api server is reachable and reports its version. For member clusters, the api server
+// is reached at the url that is written to the operator's kubeconfig, which may differ from the local kubeconfig.
+func checkApiServer(ctx context.Context, flags Flags, c KubeClient, cluster string) CheckResult {
+	check := CheckResult{Cluster: cluster, Check: "api-server"}
+
+	url := memberClusterApiServerUrl(flags, cluster)
+	if restConfig := c.GetRestConfig(); restConfig != nil && url == "" {
+		url = restConfig.Host
+	}
+
+	versionClient := c.Discovery()
+	if restConfig := c.GetRestConfig(); restConfig != nil && url != restConfig.Host {
+		probeConfig := rest.CopyConfig(restConfig)
+		probeConfig.Host = url
+		probeConfig.Timeout = preflightProbeTimeout
+		probeClient, err := kubernetes.NewForConfig(probeConfig)
+		if err != nil {
+			check.Status, check.Message = CheckFail, fmt.Sprintf("failed creating client for %s: %s", url, err)
+			return check
+		}
+		versionClient = probeClient.Discovery()
+	}
+
+	version, err := serverVersion(ctx, versionClient)
+	if err != nil {
+		check.Status, check.Message = CheckFail, fmt.Sprintf("%s not reachable: %s", url, err)
+		return check
+	}
+	if url == "" {
+		check.Status, check.Message = CheckPass, fmt.Sprintf("Kubernetes %s", version.GitVersion)
+	} else {
+		check.Status, check.Message = CheckPass, fmt.Sprintf("%s, Kubernetes %s", url, version.GitVersion)
+	}
+	return check
+}
+
+// memberClusterApiServerUrl returns the api server of the member cluster that is written to the operator's kubeconfig,
+// or an empty string if it isn't known.
+func memberClusterApiServerUrl(flags Flags, cluster string) string {
+	for i, memberCluster := range flags.MemberClusters {
+		if memberCluster == cluster && i < len(flags.MemberClusterApiServerUrls) {
+			return flags.MemberClusterApiServerUrls[i]
+		}
+	}
+	return ""
+}
+
+// requiredPermissions returns the permissions setup needs in the given cluster.
+func requiredPermissions(flags Flags, cluster string) []authorizationv1.ResourceAttributes {
+	// the ServiceAccount of the operator is created in the central namespace of the central cluster, but its namespace
+	// can be overridden in the member clusters
+	namespaces := flags.clusterNamespaces(cluster)
+	serviceAccountNamespace, _ := flags.serviceAccountFor(cluster)
+
+	permissions := []authorizationv1.ResourceAttributes{
+		{Verb: "create", Resource: "namespaces"},
+	}
+	for _, namespace := range namespaces {
+		permissions = append(permissions,
+			authorizationv1.ResourceAttributes{Namespace: namespace, Verb: "patch", Resource: "serviceaccounts"},
+			authorizationv1.ResourceAttributes{Namespace: namespace, Verb: "get", Resource: "serviceaccounts"},
+			authorizationv1.ResourceAttributes{Namespace: namespace, Verb: "patch", Group: "rbac.authorization.k8s.io", Resource: "roles"},
+			authorizationv1.ResourceAttributes{Namespace: namespace, Verb: "patch", Group: "rbac.authorization.k8s.io", Resource: "rolebindings"},
+		)
+	}
+	if flags.ClusterScoped || flags.CreateTelemetryClusterRoles {
+		permissions = append(permissions,
+			authorizationv1.ResourceAttributes{Verb: "patch", Group: "rbac.authorization.k8s.io", Resource: "clusterroles"},
+			authorizationv1.ResourceAttributes{Verb: "patch", Group: "rbac.authorization.k8s.io", Resource: "clusterrolebindings"},
+		)
+	}
+
+	if flags.Cleanup {
+		permissions = append(permissions, cleanupPermissions(namespaces)...)
+	}
+
+	if cluster == flags.CentralCluster {
+		if flags.InstallationID == "" {
+			// the installation is identified by the UID of the kube-system namespace, see ResolveInstallationID
+			permissions = append(permissions, authorizationv1.ResourceAttributes{Verb: "get", Resource: "namespaces", Name: metav1.NamespaceSystem})
+		}
+		permissions = append(permissions,
+			authorizationv1.ResourceAttributes{Namespace: flags.CentralClusterNamespace, Verb: "create", Resource: "secrets"},
+			authorizationv1.ResourceAttributes{Namespace: flags.CentralClusterNamespace, Verb: "update", Resource: "secrets"},
+			authorizationv1.ResourceAttributes{Namespace: flags.CentralClusterNamespace, Verb: "create", Resource: "configmaps"},
+			authorizationv1.ResourceAttributes{Namespace: flags.CentralClusterNamespace, Verb: "update", Resource: "configmaps"},
+		)
+	}
+
+	if flags.ImagePullSecrets != "" {
+		// the image pull secret is applied in every namespace a ServiceAccount is created in, or only read when it is
+		// managed outside of this tool, see ensureImagePullSecret
+		verb := "patch"
+		if len(flags.ImagePullSecretDockerConfig) == 0 {
+			verb = "get"
+		}
+		for _, namespace := range flags.serviceAccountNamespaces(cluster) {
+			permissions = append(permissions,
+				authorizationv1.ResourceAttributes{Namespace: namespace, Verb: verb, Resource: "secrets", Name: flags.ImagePullSecrets},
+			)
+		}
+	}
+
+	if !Contains(flags.MemberClusters, cluster) {
+		return permissions
+	}
+	switch {
+	case flags.ClientCertificateAuth:
+		permissions = append(permissions,
+			authorizationv1.ResourceAttributes{Verb: "create", Group: "certificates.k8s.io", Resource: "certificatesigningrequests"},
+			authorizationv1.ResourceAttributes{Verb: "get", Group: "certificates.k8s.io", Resource: "certificatesigningrequests"},
+			authorizationv1.ResourceAttributes{Namespace: serviceAccountNamespace, Verb: "get", Resource: "configmaps", Name: RootCAConfigMapName},
+		)
+		if flags.ApproveCSR {
+			permissions = append(permissions,
+				authorizationv1.ResourceAttributes{Verb: "update", Group: "certificates.k8s.io", Resource: "certificatesigningrequests", Subresource: "approval"},
+				authorizationv1.ResourceAttributes{Verb: "approve", Group: "certificates.k8s.io", Resource: "signers", Name: "kubernetes.io/kube-apiserver-client"},
+			)
+		}
+	case flags.TokenExpiry > 0:
+		permissions = append(permissions,
+			authorizationv1.ResourceAttributes{Namespace: serviceAccountNamespace, Verb: "create", Resource: "serviceaccounts", Subresource: "token"},
+			authorizationv1.ResourceAttributes{Namespace: serviceAccountNamespace, Verb: "get", Resource: "configmaps", Name: RootCAConfigMapName},
+		)
+	default:
+		// the token secret of the ServiceAccount is found by listing the secrets of its namespace
+		permissions = append(permissions,
+			authorizationv1.ResourceAttributes{Namespace: serviceAccountNamespace, Verb: "list", Resource: "secrets"},
+		)
+		if flags.createsServiceAccountTokenSecrets() {
+			permissions = append(permissions,
+				authorizationv1.ResourceAttributes{Namespace: serviceAccountNamespace, Verb: "patch", Resource: "secrets"},
+			)
+		}
+	}
+	if flags.InstallDatabaseRoles {
+		for _, namespace := range flags.memberNamespacesFor(cluster) {
+			permissions = append(permissions,
+				authorizationv1.ResourceAttributes{Namespace: namespace, Verb: "patch", Resource: "serviceaccounts"},
+				authorizationv1.ResourceAttributes{Namespace: namespace, Verb: "patch", Group: "rbac.authorization.k8s.io", Resource: "roles"},
+				authorizationv1.ResourceAttributes{Namespace: namespace, Verb: "patch", Group: "rbac.authorization.k8s.io", Resource: "rolebindings"},
+			)
+		}
+	}
+	return permissions
+}
+
+// cleanupPermissions returns the permissions needed to list and delete the objects cleaned up in the given namespaces,
+// see cleanupClusterResources.
+func cleanupPermissions(namespaces []string) []authorizationv1.ResourceAttributes {
+	var permissions []authorizationv1.ResourceAttributes
+	for _, verb := range []string{"list", "delete"} {
+		for _, namespace := range namespaces {
+			permissions = append(permissions,
+				authorizationv1.ResourceAttributes{Namespace: namespace, Verb: verb, Resource: "secrets"},
+				authorizationv1.ResourceAttributes{Namespace: namespace, Verb: verb, Resource: "serviceaccounts"},
+				authorizationv1.ResourceAttributes{Namespace: namespace, Verb: verb, Group: "rbac.authorization.k8s.io", Resource: "roles"},
+				authorizationv1.ResourceAttributes{Namespace: namespace, Verb: verb, Group: "rbac.authorization.k8s.io", Resource: "rolebindings"},
+			)
+		}
+		permissions = append(permissions,
+			authorizationv1.ResourceAttributes{Verb: verb, Group: "rbac.authorization.k8s.io", Resource: "clusterroles"},
+			authorizationv1.ResourceAttributes{Verb: verb, Group: "rbac.authorization.k8s.io", Resource: "clusterrolebindings"},
+		)
+	}
+	return permissions
+}
+
+// checkPermissions runs a SelfSubjectAccessReview for every permission setup needs in the cluster.
+func checkPermissions(ctx context.Context, flags Flags, c KubeClient, cluster string) CheckResult {
+	check := CheckResult{Cluster: cluster, Check: "permissions"}
+
+	seen := map[authorizationv1.ResourceAttributes]bool{}
+	var denied []string
+	for _, attributes := range requiredPermissions(flags, cluster) {
+		if seen[attributes] {
+			continue
+		}
+		seen[attributes] = true
+
+		review := &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{ResourceAttributes: &attributes},
+		}
+		review, err := c.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+		if err != nil {
+			check.Status, check.Message = CheckFail, fmt.Sprintf("failed reviewing access: %s", err)
+			return check
+		}
+		if !review.Status.Allowed {
+			denied = append(denied, describePermission(attributes))
+		}
+	}
+
+	if len(denied) > 0 {
+		check.Status, check.Message = CheckFail, fmt.Sprintf("missing permissions: %s", strings.Join(denied, ", "))
+		return check
+	}
+	check.Status, check.Message = CheckPass, fmt.Sprintf("%d permissions granted", len(seen))
+	return check
+}
+
+func describePermission(attributes authorizationv1.ResourceAttributes) string {
+	resource := attributes.Resource
+	if attributes.Subresource != "" {
+		resource += "/" + attributes.Subresource
+	}
+	if attributes.Group != "" {
+		resource += "." + attributes.Group
+	}
+	if attributes.Name != "" {
+		resource += " " + attributes.Name
+	}
+	if attributes.Namespace != "" {
+		return fmt.Sprintf("%s %s in %s", attributes.Verb, resource, attributes.Namespace)
+	}
+	return fmt.Sprintf("%s %s", attributes.Verb, resource)
+}
+
+// checkCRDs checks that the MongoDB custom resources are served by the cluster.
+func checkCRDs(ctx context.Context, c KubeClient, cluster string) CheckResult {
+	check := CheckResult{Cluster: cluster, Check: "crds"}
+
+	served := map[string]bool{}
+	if resources, err := serverResourcesForGroupVersion(ctx, c.Discovery(), MongoDBGroup+"/v1"); err == nil {
+		for _, resource := range resources.APIResources {
+			served[resource.Name] = true
+		}
+	}
+
+	var missing []string
+	for _, crd := range RequiredCRDs {
+		if !served[crd] {
+			missing = append(missing, fmt.Sprintf("%s.%s", crd, MongoDBGroup))
+		}
+	}
+	sort.Strings(missing)
+
+	if len(missing) > 0 {
+		check.Status, check.Message = CheckFail, fmt.Sprintf("missing CRDs: %s", strings.Join(missing, ", "))
+		return check
+	}
+	check.Status, check.Message = CheckPass, fmt.Sprintf("%d CRDs installed", len(RequiredCRDs))
+	return check
+}
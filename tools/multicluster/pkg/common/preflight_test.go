@@ -0,0 +1,179 @@
+package common
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestRunPreflightChecks_Passes(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	clientMap := getClientResources(ctx, flags)
+	addAccessReviews(clientMap, nil)
+	addMongoDBCRDs(clientMap[flags.CentralCluster])
+
+	report := RunPreflightChecks(ctx, flags, clientMap, preflightKubeConfig(flags))
+
+	assert.False(t, report.Failed())
+	var checks []string
+	for _, check := range report {
+		assert.Equal(t, CheckPass, check.Status, "%s %s: %s", check.Cluster, check.Check, check.Message)
+		checks = append(checks, check.Cluster+" "+check.Check)
+	}
+	assert.Equal(t, []string{
+		"central-cluster kubeconfig", "central-cluster api-server", "central-cluster permissions", "central-cluster crds",
+		"member-cluster-0 kubeconfig", "member-cluster-0 api-server", "member-cluster-0 permissions",
+		"member-cluster-1 kubeconfig", "member-cluster-1 api-server", "member-cluster-1 permissions",
+		"member-cluster-2 kubeconfig", "member-cluster-2 api-server", "member-cluster-2 permissions",
+	}, checks)
+}
+
+func TestRunPreflightChecks_ReportsProblems(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	clientMap := getClientResources(ctx, flags)
+	addAccessReviews(clientMap, map[string]bool{"member-cluster-1": true})
+
+	kubeconfig := preflightKubeConfig(flags)
+	kubeconfig.Contexts["member-cluster-0"].Cluster = "gke_project_zone_member-cluster-0"
+	delete(kubeconfig.Contexts, "member-cluster-2")
+
+	report := RunPreflightChecks(ctx, flags, clientMap, kubeconfig)
+
+	assert.True(t, report.Failed())
+	statuses := map[string]CheckResult{}
+	for _, check := range report {
+		statuses[check.Cluster+" "+check.Check] = check
+	}
+	assert.Equal(t, CheckFail, statuses["central-cluster crds"].Status)
+	assert.Contains(t, statuses["central-cluster crds"].Message, "mongodbmulticluster.mongodb.com")
+	assert.Equal(t, CheckWarn, statuses["member-cluster-0 kubeconfig"].Status, "the api server is known from the flags")
+	assert.Equal(t, CheckPass, statuses["member-cluster-0 permissions"].Status)
+	assert.Equal(t, CheckFail, statuses["member-cluster-1 permissions"].Status)
+	assert.Contains(t, statuses["member-cluster-1 permissions"].Message, "create namespaces")
+	assert.Contains(t, statuses["member-cluster-1 permissions"].Message, "patch roles.rbac.authorization.k8s.io in member-namespace")
+	assert.Equal(t, CheckFail, statuses["member-cluster-2 kubeconfig"].Status)
+}
+
+func TestCheckKubeConfigContext_FailsWhenSetupCannotFindTheApiServer(t *testing.T) {
+	flags := testFlags(t, false)
+	flags.MemberClusterApiServerUrls[1] = ""
+	kubeconfig := preflightKubeConfig(flags)
+	kubeconfig.Contexts["member-cluster-1"].Cluster = "gke_project_zone_member-cluster-1"
+
+	check := checkKubeConfigContext(flags, "member-cluster-1", kubeconfig)
+
+	assert.Equal(t, CheckFail, check.Status)
+	assert.Contains(t, check.Message, "--member-clusters-api-servers")
+}
+
+func TestRequiredPermissions_DependOnCredentials(t *testing.T) {
+	flags := testFlags(t, false)
+	cluster := flags.MemberClusters[0]
+
+	assert.Contains(t, requiredPermissions(flags, cluster), authorizationv1.ResourceAttributes{Namespace: flags.CentralClusterNamespace, Verb: "patch", Resource: "secrets"})
+	assert.Contains(t, requiredPermissions(flags, cluster), authorizationv1.ResourceAttributes{Namespace: flags.CentralClusterNamespace, Verb: "list", Resource: "secrets"})
+
+	flags.TokenExpiry = MinTokenExpiry
+	assert.Contains(t, requiredPermissions(flags, cluster), authorizationv1.ResourceAttributes{Namespace: flags.CentralClusterNamespace, Verb: "create", Resource: "serviceaccounts", Subresource: "token"})
+	assert.NotContains(t, requiredPermissions(flags, cluster), authorizationv1.ResourceAttributes{Namespace: flags.CentralClusterNamespace, Verb: "patch", Resource: "secrets"})
+
+	flags.TokenExpiry = 0
+	flags.ClientCertificateAuth = true
+	flags.ApproveCSR = true
+	assert.Contains(t, requiredPermissions(flags, cluster), authorizationv1.ResourceAttributes{Verb: "update", Group: "certificates.k8s.io", Resource: "certificatesigningrequests", Subresource: "approval"})
+	assert.NotContains(t, requiredPermissions(flags, flags.CentralCluster), authorizationv1.ResourceAttributes{Verb: "create", Group: "certificates.k8s.io", Resource: "certificatesigningrequests"})
+}
+
+func TestRequiredPermissions_IncludeCleanup(t *testing.T) {
+	flags := testFlags(t, false)
+	cluster := flags.MemberClusters[0]
+	deleteRoles := authorizationv1.ResourceAttributes{Namespace: flags.MemberClusterNamespace, Verb: "delete", Group: "rbac.authorization.k8s.io", Resource: "roles"}
+	listClusterRoleBindings := authorizationv1.ResourceAttributes{Verb: "list", Group: "rbac.authorization.k8s.io", Resource: "clusterrolebindings"}
+
+	assert.NotContains(t, requiredPermissions(flags, cluster), deleteRoles)
+
+	flags.Cleanup = true
+	permissions := requiredPermissions(flags, cluster)
+	assert.Contains(t, permissions, deleteRoles)
+	assert.Contains(t, permissions, listClusterRoleBindings)
+	for _, resource := range []string{"secrets", "serviceaccounts"} {
+		for _, verb := range []string{"list", "delete"} {
+			assert.Contains(t, permissions, authorizationv1.ResourceAttributes{Namespace: flags.CentralClusterNamespace, Verb: verb, Resource: resource})
+		}
+	}
+}
+
+func TestRequiredPermissions_IncludeImagePullSecret(t *testing.T) {
+	flags := testFlags(t, false)
+	flags.InstallDatabaseRoles = true
+	cluster := flags.MemberClusters[0]
+	flags.ImagePullSecrets = "registry-credentials"
+
+	permissions := requiredPermissions(flags, cluster)
+	for _, namespace := range flags.serviceAccountNamespaces(cluster) {
+		assert.Contains(t, permissions, authorizationv1.ResourceAttributes{Namespace: namespace, Verb: "get", Resource: "secrets", Name: "registry-credentials"})
+	}
+	assert.Contains(t, permissions, authorizationv1.ResourceAttributes{Namespace: flags.MemberClusterNamespace, Verb: "get", Resource: "secrets", Name: "registry-credentials"})
+
+	flags.ImagePullSecretDockerConfig = []byte(`{"auths":{"quay.io":{}}}`)
+	permissions = requiredPermissions(flags, cluster)
+	for _, namespace := range flags.serviceAccountNamespaces(cluster) {
+		assert.Contains(t, permissions, authorizationv1.ResourceAttributes{Namespace: namespace, Verb: "patch", Resource: "secrets", Name: "registry-credentials"})
+		assert.NotContains(t, permissions, authorizationv1.ResourceAttributes{Namespace: namespace, Verb: "get", Resource: "secrets", Name: "registry-credentials"})
+	}
+}
+
+func TestCheckKubeConfigContext_UsesClusterContexts(t *testing.T) {
+	flags := testFlags(t, false)
+	flags.ClusterContexts = map[string]string{"member-cluster-0": "admin@member-cluster-0"}
+	kubeconfig := preflightKubeConfig(flags)
+	kubeconfig.Contexts["admin@member-cluster-0"] = &clientcmdapi.Context{Cluster: "member-cluster-0"}
+
+	check := checkKubeConfigContext(flags, "member-cluster-0", kubeconfig)
+
+	require.Equal(t, CheckPass, check.Status, check.Message)
+	assert.Equal(t, "context admin@member-cluster-0", check.Message)
+}
+
+// preflightKubeConfig returns a kubeconfig with a context for every cluster that points to the cluster of the same name.
+func preflightKubeConfig(flags Flags) *clientcmdapi.Config {
+	kubeconfig := clientcmdapi.NewConfig()
+	for _, cluster := range allClusters(flags) {
+		kubeconfig.Clusters[cluster] = &clientcmdapi.Cluster{Server: "https://" + cluster}
+		kubeconfig.Contexts[cluster] = &clientcmdapi.Context{Cluster: cluster}
+	}
+	return kubeconfig
+}
+
+// addAccessReviews makes the fake clientsets answer SelfSubjectAccessReviews, allowing everything except in the
+// denied clusters.
+func addAccessReviews(clientMap map[string]KubeClient, denied map[string]bool) {
+	for cluster, c := range clientMap {
+		allowed := !denied[cluster]
+		clientset := c.(*KubeClientContainer).staticClient.(*fake.Clientset)
+		clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview).DeepCopy()
+			review.Status.Allowed = allowed
+			return true, review, nil
+		})
+	}
+}
+
+func addMongoDBCRDs(c KubeClient) {
+	clientset := c.(*KubeClientContainer).staticClient.(*fake.Clientset)
+	var resources []metav1.APIResource
+	for _, crd := range RequiredCRDs {
+		resources = append(resources, metav1.APIResource{Name: crd, Namespaced: true})
+	}
+	clientset.Resources = append(clientset.Resources, &metav1.APIResourceList{GroupVersion: MongoDBGroup + "/v1", APIResources: resources})
+}
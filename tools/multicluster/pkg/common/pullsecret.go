@@ -0,0 +1,130 @@
+package common
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"strings"
+
+	"golang.org/x/xerrors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RegistryPasswordEnv is the environment variable the registry password is read from when no password file is given,
+// so that it doesn't show up in the process list or the shell history.
+const RegistryPasswordEnv = "MDB_REGISTRY_PASSWORD"
+
+// RegistryCredentials are the credentials of a container registry the image pull secret is created for.
+type RegistryCredentials struct {
+	Server   string
+	Username string
+	Password string
+}
+
+// IsEmpty returns true if none of the credentials are set.
+func (c RegistryCredentials) IsEmpty() bool {
+	return c == RegistryCredentials{}
+}
+
+// dockerConfig is the format of the .dockerconfigjson key of kubernetes.io/dockerconfigjson Secrets.
+type dockerConfig struct {
+	Auths map[string]dockerConfigEntry `json:"auths"`
+}
+
+type dockerConfigEntry struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Auth     string `json:"auth,omitempty"`
+}
+
+// DockerConfigFromCredentials returns the content of a docker config file granting access to the registry.
+func DockerConfigFromCredentials(c RegistryCredentials) ([]byte, error) {
+	if AnyAreEmpty(c.Server, c.Username, c.Password) {
+		return nil, xerrors.Errorf("the registry server, username and password are all required")
+	}
+	return json.Marshal(dockerConfig{Auths: map[string]dockerConfigEntry{
+		c.Server: {
+			Username: c.Username,
+			Password: c.Password,
+			Auth:     base64.StdEncoding.EncodeToString([]byte(c.Username + ":" + c.Password)),
+		},
+	}})
+}
+
+// LoadRegistryPassword reads the registry password from the file at path, without its trailing newline, or from the
+// RegistryPasswordEnv environment variable if no path is given.
+func LoadRegistryPassword(path string) (string, error) {
+	if path == "" {
+		return os.Getenv(RegistryPasswordEnv), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", xerrors.Errorf("failed to read registry password %s: %w", path, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// LoadDockerConfig reads a docker config file, like the ~/.docker/config.json written by docker login, and checks
+// that it has credentials for at least one registry.
+func LoadDockerConfig(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read docker config %s: %w", path, err)
+	}
+	config := dockerConfig{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, xerrors.Errorf("failed to parse docker config %s: %w", path, err)
+	}
+	if len(config.Auths) == 0 {
+		return nil, xerrors.Errorf("docker config %s has no credentials in auths, credential helpers are not supported", path)
+	}
+	return data, nil
+}
+
+// imagePullSecretReferences returns the image pull secrets set in the ServiceAccounts created by this tool.
+func (f Flags) imagePullSecretReferences() []corev1.LocalObjectReference {
+	if f.ImagePullSecrets == "" {
+		return nil
+	}
+	return []corev1.LocalObjectReference{{Name: f.ImagePullSecrets}}
+}
+
+// ensureImagePullSecret creates or updates the image pull secret in every namespace of the cluster the operator's
+// or the database ServiceAccounts are created in. Without a docker config, the secret is expected to be managed
+// outside of this tool and a warning is printed for each namespace it is missing from.
+func ensureImagePullSecret(ctx context.Context, c KubeClient, f Flags, cluster string) error {
+	if f.ImagePullSecrets == "" {
+		return nil
+	}
+
+	for _, namespace := range f.serviceAccountNamespaces(cluster) {
+		if len(f.ImagePullSecretDockerConfig) == 0 {
+			_, err := c.CoreV1().Secrets(namespace).Get(ctx, f.ImagePullSecrets, metav1.GetOptions{})
+			if errors.IsNotFound(err) {
+				Warnf("image pull secret %s/%s does not exist in cluster %s", namespace, f.ImagePullSecrets, cluster)
+			} else if err != nil {
+				return xerrors.Errorf("failed getting image pull secret %s/%s: %w", namespace, f.ImagePullSecrets, err)
+			}
+			continue
+		}
+
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      f.ImagePullSecrets,
+				Namespace: namespace,
+			},
+			Type: corev1.SecretTypeDockerConfigJson,
+			Data: map[string][]byte{
+				corev1.DockerConfigJsonKey: f.ImagePullSecretDockerConfig,
+			},
+		}
+		setOwnership(secret, f)
+		if _, err := applyObject(ctx, c.CoreV1().Secrets(namespace), secret); err != nil {
+			return xerrors.Errorf("cannot apply image pull secret %s/%s: %w", namespace, secret.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package common
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDockerConfigFromCredentials(t *testing.T) {
+	config, err := DockerConfigFromCredentials(RegistryCredentials{Server: "quay.io", Username: "user", Password: "secret"})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"auths":{"quay.io":{"username":"user","password":"secret","auth":"dXNlcjpzZWNyZXQ="}}}`, string(config))
+
+	_, err = DockerConfigFromCredentials(RegistryCredentials{Server: "quay.io", Username: "user"})
+	assert.ErrorContains(t, err, "the registry server, username and password are all required")
+}
+
+func TestLoadDockerConfig(t *testing.T) {
+	write := func(content string) string {
+		path := filepath.Join(t.TempDir(), "config.json")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	content := `{"auths":{"quay.io":{"auth":"dXNlcjpzZWNyZXQ="}}}`
+	config, err := LoadDockerConfig(write(content))
+	require.NoError(t, err)
+	assert.Equal(t, content, string(config))
+
+	_, err = LoadDockerConfig(write(`{"credsStore":"desktop"}`))
+	assert.ErrorContains(t, err, "has no credentials in auths")
+	_, err = LoadDockerConfig(write(`auths: {}`))
+	assert.ErrorContains(t, err, "failed to parse docker config")
+}
+
+func TestLoadRegistryPassword(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, os.WriteFile(path, []byte("s3cret\n"), 0o600))
+	password, err := LoadRegistryPassword(path)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", password)
+
+	t.Setenv(RegistryPasswordEnv, "from-env")
+	password, err = LoadRegistryPassword("")
+	require.NoError(t, err)
+	assert.Equal(t, "from-env", password)
+
+	_, err = LoadRegistryPassword(filepath.Join(t.TempDir(), "missing"))
+	assert.ErrorContains(t, err, "failed to read registry password")
+}
+
+func TestEnsureMultiClusterResources_CreatesImagePullSecret(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	flags.InstallDatabaseRoles = true
+	flags.ImagePullSecrets = "registry-credentials"
+	flags.ImagePullSecretDockerConfig = []byte(`{"auths":{"quay.io":{"auth":"b2xkOmNyZWRlbnRpYWxz"}}}`)
+	clientMap := getClientResources(ctx, flags)
+	require.NoError(t, EnsureMultiClusterResources(ctx, flags, clientMap))
+
+	// the credentials are rotated on re-runs
+	flags.ImagePullSecretDockerConfig = []byte(`{"auths":{"quay.io":{"auth":"bmV3OmNyZWRlbnRpYWxz"}}}`)
+	require.NoError(t, EnsureMultiClusterResources(ctx, flags, clientMap))
+
+	serviceAccounts := map[string][]string{flags.CentralCluster: {flags.CentralClusterNamespace, flags.ServiceAccount}}
+	for _, cluster := range flags.MemberClusters {
+		serviceAccounts[cluster] = []string{flags.CentralClusterNamespace, flags.ServiceAccount, flags.MemberClusterNamespace, AppdbServiceAccount}
+	}
+	for cluster, namespacedNames := range serviceAccounts {
+		for i := 0; i < len(namespacedNames); i += 2 {
+			namespace, name := namespacedNames[i], namespacedNames[i+1]
+			secret, err := clientMap[cluster].CoreV1().Secrets(namespace).Get(ctx, flags.ImagePullSecrets, metav1.GetOptions{})
+			require.NoError(t, err, "the image pull secret must exist in %s/%s of cluster %s", namespace, flags.ImagePullSecrets, cluster)
+			assert.Equal(t, corev1.SecretTypeDockerConfigJson, secret.Type)
+			assert.Equal(t, flags.ImagePullSecretDockerConfig, secret.Data[corev1.DockerConfigJsonKey])
+			assert.Equal(t, flags.installationID(), secret.Labels[InstallationLabel])
+
+			sa, err := clientMap[cluster].CoreV1().ServiceAccounts(namespace).Get(ctx, name, metav1.GetOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, []corev1.LocalObjectReference{{Name: flags.ImagePullSecrets}}, sa.ImagePullSecrets)
+		}
+	}
+}
+
+func TestCopyDatabaseRoles_CopiesAllImagePullSecrets(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	src, dst := flags.MemberClusters[0], flags.MemberClusters[1]
+	clientMap := getClientResources(ctx, flags)
+	require.NoError(t, createDatabaseRoles(ctx, clientMap[src], flags, src))
+
+	namespace := flags.MemberClusterNamespace
+	for sa, secrets := range map[string][]string{
+		AppdbServiceAccount:        {"registry-a", "registry-b"},
+		DatabasePodsServiceAccount: {"registry-b"},
+		OpsManagerServiceAccount:   {"registry-c"},
+	} {
+		serviceAccount, err := clientMap[src].CoreV1().ServiceAccounts(namespace).Get(ctx, sa, metav1.GetOptions{})
+		require.NoError(t, err)
+		for _, name := range secrets {
+			serviceAccount.ImagePullSecrets = append(serviceAccount.ImagePullSecrets, corev1.LocalObjectReference{Name: name})
+		}
+		_, err = clientMap[src].CoreV1().ServiceAccounts(namespace).Update(ctx, serviceAccount, metav1.UpdateOptions{})
+		require.NoError(t, err)
+	}
+	for _, name := range []string{"registry-a", "registry-b", "registry-c"} {
+		_, err := clientMap[src].CoreV1().Secrets(namespace).Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(name)},
+		}, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, copyDatabaseRoles(ctx, clientMap[src], clientMap[dst], namespace, namespace))
+
+	for _, name := range []string{"registry-a", "registry-b", "registry-c"} {
+		secret, err := clientMap[dst].CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+		require.NoError(t, err, "image pull secret %s must be copied", name)
+		assert.Equal(t, corev1.SecretTypeDockerConfigJson, secret.Type)
+		assert.Equal(t, []byte(name), secret.Data[corev1.DockerConfigJsonKey])
+	}
+}
@@ -0,0 +1,301 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"golang.org/x/xerrors"
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+const RBACProfileKind = "RBACProfile"
+
+// RBACProfile customizes the rules of the Roles and ClusterRoles created by this tool, which can be passed with
+// --rbac-profile. The central rules are the rules on the MongoDB custom resources, only granted to the operator in
+// the central cluster. The member rules are granted in every cluster, and the telemetry rules are those of the
+// telemetry ClusterRole. The default telemetry rules only read nodes, the kube-system namespace and the version, the
+// telemetry rule set is the only way to change their verbs.
+//
+// Example:
+//
+//	apiVersion: kubectl-mongodb/v1
+//	kind: RBACProfile
+//	member:
+//	  append:
+//	    - apiGroups: ["policy"]
+//	      resources: ["poddisruptionbudgets"]
+//	      verbs: ["get", "list", "watch", "create", "update", "delete"]
+//	    - apiGroups: ["cert-manager.io"]
+//	      resources: ["certificates"]
+//	      verbs: ["get", "list", "watch", "create", "update", "delete"]
+//	  remove:
+//	    - apiGroups: [""]
+//	      resources: ["pods"]
+//	      verbs: ["deletecollection"]
+type RBACProfile struct {
+	ApiVersion string      `json:"apiVersion"`
+	Kind       string      `json:"kind"`
+	Central    RBACRuleSet `json:"central,omitempty"`
+	Member     RBACRuleSet `json:"member,omitempty"`
+	Telemetry  RBACRuleSet `json:"telemetry,omitempty"`
+}
+
+// RBACRuleSet changes a set of default rules. Override replaces the default rules, then the rules in Remove are
+// removed and the rules in Append are added.
+type RBACRuleSet struct {
+	Override []rbacv1.PolicyRule `json:"override,omitempty"`
+	// Remove removes the verbs of the rules from the given resources, or all their verbs if no verbs are set. It
+	// applies to the rules whose API groups are all in the API groups of the removed rule.
+	Remove []rbacv1.PolicyRule `json:"remove,omitempty"`
+	Append []rbacv1.PolicyRule `json:"append,omitempty"`
+}
+
+// LoadRBACProfile reads and validates an RBAC profile file.
+func LoadRBACProfile(path string) (*RBACProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read rbac profile %s: %w", path, err)
+	}
+
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to parse rbac profile %s: %w", path, err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.DisallowUnknownFields()
+
+	p := &RBACProfile{}
+	if err := decoder.Decode(p); err != nil {
+		return nil, xerrors.Errorf("failed to parse rbac profile %s: %w", path, err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, xerrors.Errorf("invalid rbac profile %s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Validate returns an error listing every problem found in the rules of the profile. Whether the profile can be
+// applied to the generated rules is checked by Flags.ValidateRBAC.
+func (p *RBACProfile) Validate() error {
+	var problems []string
+	addProblem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if p.ApiVersion != TopologyApiVersion {
+		addProblem("apiVersion must be %s", TopologyApiVersion)
+	}
+	if p.Kind != RBACProfileKind {
+		addProblem("kind must be %s", RBACProfileKind)
+	}
+
+	ruleSets := []struct {
+		name string
+		set  RBACRuleSet
+		// namespaced rule sets end up in Roles, which can't grant non-resource URLs
+		namespaced bool
+	}{
+		{"central", p.Central, true},
+		{"member", p.Member, true},
+		{"telemetry", p.Telemetry, false},
+	}
+	for _, s := range ruleSets {
+		for i, rule := range s.set.Override {
+			for _, problem := range validateRule(rule, s.namespaced) {
+				addProblem("%s.override[%d]: %s", s.name, i, problem)
+			}
+		}
+		for i, rule := range s.set.Append {
+			for _, problem := range validateRule(rule, s.namespaced) {
+				addProblem("%s.append[%d]: %s", s.name, i, problem)
+			}
+		}
+		for i, rule := range s.set.Remove {
+			if len(rule.APIGroups) == 0 || len(rule.Resources) == 0 {
+				addProblem("%s.remove[%d]: apiGroups and resources are required", s.name, i)
+			}
+			if len(rule.NonResourceURLs) > 0 || len(rule.ResourceNames) > 0 {
+				addProblem("%s.remove[%d]: nonResourceURLs and resourceNames are not supported", s.name, i)
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return xerrors.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func validateRule(rule rbacv1.PolicyRule, namespaced bool) []string {
+	var problems []string
+	if len(rule.Verbs) == 0 {
+		problems = append(problems, "verbs are required")
+	}
+	if len(rule.NonResourceURLs) > 0 {
+		if namespaced {
+			problems = append(problems, "nonResourceURLs can only be granted by the telemetry ClusterRole")
+		}
+		if len(rule.Resources) > 0 || len(rule.APIGroups) > 0 {
+			problems = append(problems, "nonResourceURLs cannot be combined with apiGroups and resources")
+		}
+	} else if len(rule.APIGroups) == 0 || len(rule.Resources) == 0 {
+		problems = append(problems, "apiGroups and resources are required")
+	}
+	return problems
+}
+
+// apply returns the default rules changed by the rule set.
+func (s RBACRuleSet) apply(defaults []rbacv1.PolicyRule) ([]rbacv1.PolicyRule, error) {
+	rules := defaults
+	if len(s.Override) > 0 {
+		rules = s.Override
+	}
+	rules = copyRules(rules)
+
+	for _, removed := range s.Remove {
+		var err error
+		if rules, err = removeRule(rules, removed); err != nil {
+			return nil, err
+		}
+	}
+	return append(rules, copyRules(s.Append)...), nil
+}
+
+// removeRule removes the verbs of the removed rule from the matching resources of the rules. Rules that only
+// partially match are split, so that the other resources keep all their verbs.
+func removeRule(rules []rbacv1.PolicyRule, removed rbacv1.PolicyRule) ([]rbacv1.PolicyRule, error) {
+	var result []rbacv1.PolicyRule
+	for _, rule := range rules {
+		if len(rule.NonResourceURLs) > 0 || len(rule.APIGroups) == 0 || !allMatch(rule.APIGroups, removed.APIGroups) {
+			result = append(result, rule)
+			continue
+		}
+
+		var kept, matched []string
+		for _, resource := range rule.Resources {
+			if matchesRule(removed.Resources, resource) {
+				matched = append(matched, resource)
+			} else {
+				kept = append(kept, resource)
+			}
+		}
+		if len(matched) == 0 {
+			result = append(result, rule)
+			continue
+		}
+
+		var verbs []string
+		if len(removed.Verbs) > 0 && !Contains(removed.Verbs, rbacv1.VerbAll) {
+			if Contains(rule.Verbs, rbacv1.VerbAll) {
+				return nil, xerrors.Errorf("cannot remove verbs %s from resources %s granted all verbs, override the rules instead", strings.Join(removed.Verbs, ","), strings.Join(matched, ","))
+			}
+			for _, verb := range rule.Verbs {
+				if !Contains(removed.Verbs, verb) {
+					verbs = append(verbs, verb)
+				}
+			}
+		}
+
+		if len(kept) > 0 {
+			keptRule := *rule.DeepCopy()
+			keptRule.Resources = kept
+			result = append(result, keptRule)
+		}
+		if len(verbs) > 0 {
+			matchedRule := *rule.DeepCopy()
+			matchedRule.Resources, matchedRule.Verbs = matched, verbs
+			result = append(result, matchedRule)
+		}
+	}
+	return result, nil
+}
+
+// allMatch returns true if all the values match the rule values.
+func allMatch(values, ruleValues []string) bool {
+	for _, value := range values {
+		if !matchesRule(ruleValues, value) {
+			return false
+		}
+	}
+	return true
+}
+
+func copyRules(rules []rbacv1.PolicyRule) []rbacv1.PolicyRule {
+	copied := make([]rbacv1.PolicyRule, 0, len(rules))
+	for _, rule := range rules {
+		copied = append(copied, *rule.DeepCopy())
+	}
+	return copied
+}
+
+// ValidateRBAC returns an error if the managed kinds are unknown, or if the RBAC profile can't be applied to the
+// rules generated for them.
+func (f Flags) ValidateRBAC() error {
+	if err := validateManagedKinds(f.ManagedKinds); err != nil {
+		return err
+	}
+	if f.RBACProfile == nil {
+		return nil
+	}
+	if _, err := f.RBACProfile.Central.apply(f.baseCentralRules()); err != nil {
+		return xerrors.Errorf("invalid rbac profile: central: %w", err)
+	}
+	if _, err := f.RBACProfile.Member.apply(f.baseMemberRules()); err != nil {
+		return xerrors.Errorf("invalid rbac profile: member: %w", err)
+	}
+	if _, err := f.RBACProfile.Telemetry.apply(getTelemetryRules()); err != nil {
+		return xerrors.Errorf("invalid rbac profile: telemetry: %w", err)
+	}
+	return nil
+}
+
+// centralRules returns the central rules with the RBAC profile applied.
+func (f Flags) centralRules() []rbacv1.PolicyRule {
+	if f.RBACProfile == nil {
+		return f.baseCentralRules()
+	}
+	// the profile is checked by ValidateRBAC, so it applies cleanly to the generated rules
+	rules, _ := f.RBACProfile.Central.apply(f.baseCentralRules())
+	return rules
+}
+
+// memberRules returns the member rules with the RBAC profile applied.
+func (f Flags) memberRules() []rbacv1.PolicyRule {
+	if f.RBACProfile == nil {
+		return f.baseMemberRules()
+	}
+	rules, _ := f.RBACProfile.Member.apply(f.baseMemberRules())
+	return rules
+}
+
+// telemetryRules returns the telemetry rules with the RBAC profile applied.
+func (f Flags) telemetryRules() []rbacv1.PolicyRule {
+	if f.RBACProfile == nil {
+		return getTelemetryRules()
+	}
+	rules, _ := f.RBACProfile.Telemetry.apply(getTelemetryRules())
+	return rules
+}
+
+// formatRule returns a single line description of the rule.
+func formatRule(rule rbacv1.PolicyRule) string {
+	var parts []string
+	if len(rule.NonResourceURLs) > 0 {
+		parts = append(parts, fmt.Sprintf("nonResourceURLs=[%s]", strings.Join(rule.NonResourceURLs, " ")))
+	} else {
+		groups := make([]string, 0, len(rule.APIGroups))
+		for _, group := range rule.APIGroups {
+			groups = append(groups, fmt.Sprintf("%q", group))
+		}
+		parts = append(parts, fmt.Sprintf("apiGroups=[%s]", strings.Join(groups, " ")), fmt.Sprintf("resources=[%s]", strings.Join(rule.Resources, " ")))
+	}
+	if len(rule.ResourceNames) > 0 {
+		parts = append(parts, fmt.Sprintf("resourceNames=[%s]", strings.Join(rule.ResourceNames, " ")))
+	}
+	parts = append(parts, fmt.Sprintf("verbs=[%s]", strings.Join(rule.Verbs, " ")))
+	return strings.Join(parts, " ")
+}
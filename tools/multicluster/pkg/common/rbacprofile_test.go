@@ -0,0 +1,182 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var pdbRule = rbacv1.PolicyRule{
+	APIGroups: []string{"policy"},
+	Resources: []string{"poddisruptionbudgets"},
+	Verbs:     []string{"get", "list", "watch", "create", "update", "delete"},
+}
+
+func writeRBACProfile(t *testing.T, content string) string {
+	fileName := filepath.Join(t.TempDir(), "rbac-profile.yaml")
+	require.NoError(t, os.WriteFile(fileName, []byte(content), 0o644))
+	return fileName
+}
+
+func TestRBACRuleSet_Apply(t *testing.T) {
+	defaults := []rbacv1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"secrets", "services"}, Verbs: []string{"get", "list", "delete"}},
+		{APIGroups: []string{"apps"}, Resources: []string{"statefulsets"}, Verbs: []string{"get", "delete"}},
+	}
+
+	t.Run("append", func(t *testing.T) {
+		rules, err := RBACRuleSet{Append: []rbacv1.PolicyRule{pdbRule}}.apply(defaults)
+		require.NoError(t, err)
+		assert.Equal(t, append(copyRules(defaults), pdbRule), rules)
+	})
+
+	t.Run("remove verbs splits the rule", func(t *testing.T) {
+		rules, err := RBACRuleSet{Remove: []rbacv1.PolicyRule{
+			{APIGroups: []string{""}, Resources: []string{"services"}, Verbs: []string{"delete"}},
+		}}.apply(defaults)
+		require.NoError(t, err)
+		assert.Equal(t, []rbacv1.PolicyRule{
+			{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get", "list", "delete"}},
+			{APIGroups: []string{""}, Resources: []string{"services"}, Verbs: []string{"get", "list"}},
+			defaults[1],
+		}, rules)
+	})
+
+	t.Run("remove all verbs", func(t *testing.T) {
+		rules, err := RBACRuleSet{Remove: []rbacv1.PolicyRule{
+			{APIGroups: []string{"apps"}, Resources: []string{"statefulsets"}},
+		}}.apply(defaults)
+		require.NoError(t, err)
+		assert.Equal(t, defaults[:1], rules)
+	})
+
+	t.Run("override", func(t *testing.T) {
+		rules, err := RBACRuleSet{Override: []rbacv1.PolicyRule{pdbRule}}.apply(defaults)
+		require.NoError(t, err)
+		assert.Equal(t, []rbacv1.PolicyRule{pdbRule}, rules)
+	})
+
+	t.Run("verbs can't be removed from all verbs", func(t *testing.T) {
+		_, err := RBACRuleSet{Remove: []rbacv1.PolicyRule{
+			{APIGroups: []string{"mongodb.com"}, Resources: []string{"mongodb"}, Verbs: []string{"delete"}},
+		}}.apply(getCentralRules())
+		assert.ErrorContains(t, err, "cannot remove verbs delete from resources mongodb granted all verbs")
+	})
+
+	assert.Len(t, defaults[0].Resources, 2, "the default rules must not be modified")
+}
+
+func TestLoadRBACProfile(t *testing.T) {
+	fileName := writeRBACProfile(t, `
+apiVersion: kubectl-mongodb/v1
+kind: RBACProfile
+member:
+  append:
+    - apiGroups: ["policy"]
+      resources: ["poddisruptionbudgets"]
+      verbs: ["get", "list", "watch", "create", "update", "delete"]
+  remove:
+    - apiGroups: [""]
+      resources: ["pods"]
+      verbs: ["deletecollection"]
+telemetry:
+  append:
+    - nonResourceURLs: ["/version"]
+      verbs: ["get"]
+`)
+	profile, err := LoadRBACProfile(fileName)
+	require.NoError(t, err)
+
+	flags := Flags{RBACProfile: profile}
+	assert.Equal(t, getCentralRules(), flags.centralRules())
+	memberRules := flags.memberRules()
+	assert.Contains(t, memberRules, pdbRule)
+	assert.Contains(t, memberRules, rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list", "watch", "delete"}})
+	assert.Len(t, flags.telemetryRules(), len(getTelemetryRules())+1)
+}
+
+func TestLoadRBACProfile_Invalid(t *testing.T) {
+	tests := map[string]struct {
+		content string
+		err     string
+	}{
+		"unknown field": {
+			content: "apiVersion: kubectl-mongodb/v1\nkind: RBACProfile\nmembers: {}\n",
+			err:     `unknown field "members"`,
+		},
+		"wrong kind": {
+			content: "apiVersion: kubectl-mongodb/v1\nkind: Topology\n",
+			err:     "kind must be RBACProfile",
+		},
+		"missing verbs": {
+			content: "apiVersion: kubectl-mongodb/v1\nkind: RBACProfile\nmember:\n  append:\n    - apiGroups: [policy]\n      resources: [poddisruptionbudgets]\n",
+			err:     "member.append[0]: verbs are required",
+		},
+		"non resource urls in a role": {
+			content: "apiVersion: kubectl-mongodb/v1\nkind: RBACProfile\ncentral:\n  append:\n    - nonResourceURLs: [/version]\n      verbs: [get]\n",
+			err:     "central.append[0]: nonResourceURLs can only be granted by the telemetry ClusterRole",
+		},
+		"remove without resources": {
+			content: "apiVersion: kubectl-mongodb/v1\nkind: RBACProfile\nmember:\n  remove:\n    - apiGroups: [\"\"]\n",
+			err:     "member.remove[0]: apiGroups and resources are required",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := LoadRBACProfile(writeRBACProfile(t, tc.content))
+			assert.ErrorContains(t, err, tc.err)
+		})
+	}
+}
+
+func TestEnsureMultiClusterResources_AppliesRBACProfile(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	flags.RBACProfile = &RBACProfile{
+		ApiVersion: TopologyApiVersion,
+		Kind:       RBACProfileKind,
+		Member:     RBACRuleSet{Append: []rbacv1.PolicyRule{pdbRule}},
+	}
+	require.NoError(t, flags.RBACProfile.Validate())
+	clientMap := getClientResources(ctx, flags)
+	require.NoError(t, EnsureMultiClusterResources(ctx, flags, clientMap))
+
+	for _, cluster := range flags.MemberClusters {
+		role, err := clientMap[cluster].RbacV1().Roles(flags.MemberClusterNamespace).Get(ctx, buildMemberEntityRole(flags, flags.MemberClusterNamespace).Name, metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Contains(t, role.Rules, pdbRule, "cluster %s", cluster)
+	}
+	role, err := clientMap[flags.CentralCluster].RbacV1().Roles(flags.CentralClusterNamespace).Get(ctx, buildCentralEntityRole(flags, flags.CentralClusterNamespace).Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, role.Rules, pdbRule)
+}
+
+func TestPlan_Print_ShowsRules(t *testing.T) {
+	role := &rbacv1.Role{Rules: []rbacv1.PolicyRule{pdbRule}}
+	clusterRole := &rbacv1.ClusterRole{Rules: []rbacv1.PolicyRule{{NonResourceURLs: []string{"/version"}, Verbs: []string{"get"}}}}
+	plan := NewPlan()
+	plan.record(PlannedAction{Cluster: "cluster-1", Kind: "Role", Namespace: "mongodb", Name: "role", Action: ActionCreate, Object: role})
+	plan.record(PlannedAction{Cluster: "cluster-1", Kind: "ClusterRole", Name: "cluster-role", Action: ActionUnchanged, Object: clusterRole})
+	plan.record(PlannedAction{Cluster: "cluster-1", Kind: "ClusterRole", Name: "telemetry", Action: ActionUpdate, Object: clusterRole})
+
+	buf := &bytes.Buffer{}
+	plan.Print(buf)
+
+	assert.Equal(t, `Cluster cluster-1:
+  create     Role mongodb/role
+      rules:
+        - apiGroups=["policy"] resources=[poddisruptionbudgets] verbs=[get list watch create update delete]
+  unchanged  ClusterRole cluster-role
+  update     ClusterRole telemetry
+      rules:
+        - nonResourceURLs=[/version] verbs=[get]
+
+`, buf.String())
+}
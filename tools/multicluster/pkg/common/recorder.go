@@ -0,0 +1,310 @@
+package common
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	rbacv1client "k8s.io/client-go/kubernetes/typed/rbac/v1"
+)
+
+// NewRecordingClientMap wraps every client in the map with a client that performs all writes against the live
+// clusters and records what they did to the objects managed by this tool in the plan, so that it can be reported
+// once the command is done.
+func NewRecordingClientMap(clientMap map[string]KubeClient, plan *Plan) map[string]KubeClient {
+	recordingMap := map[string]KubeClient{}
+	for cluster, c := range clientMap {
+		recordingMap[cluster] = &recordingKubeClient{KubeClient: c, recorder: &recorder{cluster: cluster, plan: plan}}
+	}
+	return recordingMap
+}
+
+type recordingKubeClient struct {
+	KubeClient
+	*recorder
+}
+
+func (c *recordingKubeClient) CoreV1() corev1client.CoreV1Interface {
+	return &recordingCoreV1{CoreV1Interface: c.KubeClient.CoreV1(), recorder: c.recorder}
+}
+
+func (c *recordingKubeClient) RbacV1() rbacv1client.RbacV1Interface {
+	return &recordingRbacV1{RbacV1Interface: c.KubeClient.RbacV1(), recorder: c.recorder}
+}
+
+// recorder records the actions performed in a single cluster.
+type recorder struct {
+	cluster string
+	plan    *Plan
+}
+
+// record stores the action performed on the object. An object that was created or updated earlier in the same
+// command keeps that action when it is written again.
+func (r *recorder) record(kind, namespace, name string, action ActionType) {
+	if existing, ok := r.plan.lookup(r.cluster, kind, namespace, name); ok {
+		if action == ActionUnchanged && existing.Action != ActionDelete || action == ActionUpdate && existing.Action == ActionCreate {
+			return
+		}
+	}
+	r.plan.record(PlannedAction{Cluster: r.cluster, Kind: kind, Namespace: namespace, Name: name, Action: action})
+}
+
+// recordWrite records the update or the apply of an object, comparing its state before and after the write.
+func recordWrite[T plannedObject](r *recorder, kind, namespace, name string, live T, getErr error, written T) {
+	action := ActionUpdate
+	if errors.IsNotFound(getErr) {
+		action = ActionCreate
+	} else if getErr == nil {
+		if diff, err := diffObjects(kind, live, written); err == nil && len(diff) == 0 {
+			action = ActionUnchanged
+		}
+	}
+	r.record(kind, namespace, name, action)
+}
+
+func recordCreate[T plannedObject](ctx context.Context, r *recorder, kind, namespace string, obj T, opts metav1.CreateOptions, create func(context.Context, T, metav1.CreateOptions) (T, error)) (T, error) {
+	created, err := create(ctx, obj, opts)
+	if err == nil {
+		r.record(kind, namespace, obj.GetName(), ActionCreate)
+	} else if errors.IsAlreadyExists(err) {
+		r.record(kind, namespace, obj.GetName(), ActionUnchanged)
+	}
+	return created, err
+}
+
+func recordUpdate[T plannedObject](ctx context.Context, r *recorder, kind, namespace string, obj T, opts metav1.UpdateOptions, get getter[T], update func(context.Context, T, metav1.UpdateOptions) (T, error)) (T, error) {
+	live, getErr := get(ctx, obj.GetName(), metav1.GetOptions{})
+	updated, err := update(ctx, obj, opts)
+	if err == nil {
+		recordWrite(r, kind, namespace, obj.GetName(), live, getErr, updated)
+	}
+	return updated, err
+}
+
+func recordPatch[T plannedObject](ctx context.Context, r *recorder, kind, namespace, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources []string, get getter[T], patch func(context.Context, string, types.PatchType, []byte, metav1.PatchOptions, ...string) (T, error)) (T, error) {
+	live, getErr := get(ctx, name, metav1.GetOptions{})
+	patched, err := patch(ctx, name, pt, data, opts, subresources...)
+	if err == nil {
+		recordWrite(r, kind, namespace, name, live, getErr, patched)
+	}
+	return patched, err
+}
+
+func recordDelete(ctx context.Context, r *recorder, kind, namespace, name string, opts metav1.DeleteOptions, del func(context.Context, string, metav1.DeleteOptions) error) error {
+	err := del(ctx, name, opts)
+	if err == nil {
+		r.record(kind, namespace, name, ActionDelete)
+	}
+	return err
+}
+
+type recordingCoreV1 struct {
+	corev1client.CoreV1Interface
+	*recorder
+}
+
+func (c *recordingCoreV1) Namespaces() corev1client.NamespaceInterface {
+	return &recordingNamespaces{NamespaceInterface: c.CoreV1Interface.Namespaces(), recorder: c.recorder}
+}
+
+func (c *recordingCoreV1) ServiceAccounts(namespace string) corev1client.ServiceAccountInterface {
+	return &recordingServiceAccounts{ServiceAccountInterface: c.CoreV1Interface.ServiceAccounts(namespace), recorder: c.recorder, namespace: namespace}
+}
+
+func (c *recordingCoreV1) Secrets(namespace string) corev1client.SecretInterface {
+	return &recordingSecrets{SecretInterface: c.CoreV1Interface.Secrets(namespace), recorder: c.recorder, namespace: namespace}
+}
+
+func (c *recordingCoreV1) ConfigMaps(namespace string) corev1client.ConfigMapInterface {
+	return &recordingConfigMaps{ConfigMapInterface: c.CoreV1Interface.ConfigMaps(namespace), recorder: c.recorder, namespace: namespace}
+}
+
+type recordingRbacV1 struct {
+	rbacv1client.RbacV1Interface
+	*recorder
+}
+
+func (c *recordingRbacV1) Roles(namespace string) rbacv1client.RoleInterface {
+	return &recordingRoles{RoleInterface: c.RbacV1Interface.Roles(namespace), recorder: c.recorder, namespace: namespace}
+}
+
+func (c *recordingRbacV1) RoleBindings(namespace string) rbacv1client.RoleBindingInterface {
+	return &recordingRoleBindings{RoleBindingInterface: c.RbacV1Interface.RoleBindings(namespace), recorder: c.recorder, namespace: namespace}
+}
+
+func (c *recordingRbacV1) ClusterRoles() rbacv1client.ClusterRoleInterface {
+	return &recordingClusterRoles{ClusterRoleInterface: c.RbacV1Interface.ClusterRoles(), recorder: c.recorder}
+}
+
+func (c *recordingRbacV1) ClusterRoleBindings() rbacv1client.ClusterRoleBindingInterface {
+	return &recordingClusterRoleBindings{ClusterRoleBindingInterface: c.RbacV1Interface.ClusterRoleBindings(), recorder: c.recorder}
+}
+
+type recordingNamespaces struct {
+	corev1client.NamespaceInterface
+	*recorder
+}
+
+func (c *recordingNamespaces) Create(ctx context.Context, ns *corev1.Namespace, opts metav1.CreateOptions) (*corev1.Namespace, error) {
+	return recordCreate(ctx, c.recorder, "Namespace", "", ns, opts, c.NamespaceInterface.Create)
+}
+
+func (c *recordingNamespaces) Update(ctx context.Context, ns *corev1.Namespace, opts metav1.UpdateOptions) (*corev1.Namespace, error) {
+	return recordUpdate(ctx, c.recorder, "Namespace", "", ns, opts, c.NamespaceInterface.Get, c.NamespaceInterface.Update)
+}
+
+func (c *recordingNamespaces) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return recordDelete(ctx, c.recorder, "Namespace", "", name, opts, c.NamespaceInterface.Delete)
+}
+
+type recordingServiceAccounts struct {
+	corev1client.ServiceAccountInterface
+	*recorder
+	namespace string
+}
+
+func (c *recordingServiceAccounts) Create(ctx context.Context, sa *corev1.ServiceAccount, opts metav1.CreateOptions) (*corev1.ServiceAccount, error) {
+	return recordCreate(ctx, c.recorder, "ServiceAccount", c.namespace, sa, opts, c.ServiceAccountInterface.Create)
+}
+
+func (c *recordingServiceAccounts) Update(ctx context.Context, sa *corev1.ServiceAccount, opts metav1.UpdateOptions) (*corev1.ServiceAccount, error) {
+	return recordUpdate(ctx, c.recorder, "ServiceAccount", c.namespace, sa, opts, c.ServiceAccountInterface.Get, c.ServiceAccountInterface.Update)
+}
+
+func (c *recordingServiceAccounts) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*corev1.ServiceAccount, error) {
+	return recordPatch(ctx, c.recorder, "ServiceAccount", c.namespace, name, pt, data, opts, subresources, c.ServiceAccountInterface.Get, c.ServiceAccountInterface.Patch)
+}
+
+func (c *recordingServiceAccounts) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return recordDelete(ctx, c.recorder, "ServiceAccount", c.namespace, name, opts, c.ServiceAccountInterface.Delete)
+}
+
+type recordingSecrets struct {
+	corev1client.SecretInterface
+	*recorder
+	namespace string
+}
+
+func (c *recordingSecrets) Create(ctx context.Context, secret *corev1.Secret, opts metav1.CreateOptions) (*corev1.Secret, error) {
+	return recordCreate(ctx, c.recorder, "Secret", c.namespace, secret, opts, c.SecretInterface.Create)
+}
+
+func (c *recordingSecrets) Update(ctx context.Context, secret *corev1.Secret, opts metav1.UpdateOptions) (*corev1.Secret, error) {
+	return recordUpdate(ctx, c.recorder, "Secret", c.namespace, secret, opts, c.SecretInterface.Get, c.SecretInterface.Update)
+}
+
+func (c *recordingSecrets) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*corev1.Secret, error) {
+	return recordPatch(ctx, c.recorder, "Secret", c.namespace, name, pt, data, opts, subresources, c.SecretInterface.Get, c.SecretInterface.Patch)
+}
+
+func (c *recordingSecrets) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return recordDelete(ctx, c.recorder, "Secret", c.namespace, name, opts, c.SecretInterface.Delete)
+}
+
+type recordingConfigMaps struct {
+	corev1client.ConfigMapInterface
+	*recorder
+	namespace string
+}
+
+func (c *recordingConfigMaps) Create(ctx context.Context, cm *corev1.ConfigMap, opts metav1.CreateOptions) (*corev1.ConfigMap, error) {
+	return recordCreate(ctx, c.recorder, "ConfigMap", c.namespace, cm, opts, c.ConfigMapInterface.Create)
+}
+
+func (c *recordingConfigMaps) Update(ctx context.Context, cm *corev1.ConfigMap, opts metav1.UpdateOptions) (*corev1.ConfigMap, error) {
+	return recordUpdate(ctx, c.recorder, "ConfigMap", c.namespace, cm, opts, c.ConfigMapInterface.Get, c.ConfigMapInterface.Update)
+}
+
+func (c *recordingConfigMaps) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return recordDelete(ctx, c.recorder, "ConfigMap", c.namespace, name, opts, c.ConfigMapInterface.Delete)
+}
+
+type recordingRoles struct {
+	rbacv1client.RoleInterface
+	*recorder
+	namespace string
+}
+
+func (c *recordingRoles) Create(ctx context.Context, role *rbacv1.Role, opts metav1.CreateOptions) (*rbacv1.Role, error) {
+	return recordCreate(ctx, c.recorder, "Role", c.namespace, role, opts, c.RoleInterface.Create)
+}
+
+func (c *recordingRoles) Update(ctx context.Context, role *rbacv1.Role, opts metav1.UpdateOptions) (*rbacv1.Role, error) {
+	return recordUpdate(ctx, c.recorder, "Role", c.namespace, role, opts, c.RoleInterface.Get, c.RoleInterface.Update)
+}
+
+func (c *recordingRoles) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*rbacv1.Role, error) {
+	return recordPatch(ctx, c.recorder, "Role", c.namespace, name, pt, data, opts, subresources, c.RoleInterface.Get, c.RoleInterface.Patch)
+}
+
+func (c *recordingRoles) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return recordDelete(ctx, c.recorder, "Role", c.namespace, name, opts, c.RoleInterface.Delete)
+}
+
+type recordingRoleBindings struct {
+	rbacv1client.RoleBindingInterface
+	*recorder
+	namespace string
+}
+
+func (c *recordingRoleBindings) Create(ctx context.Context, rb *rbacv1.RoleBinding, opts metav1.CreateOptions) (*rbacv1.RoleBinding, error) {
+	return recordCreate(ctx, c.recorder, "RoleBinding", c.namespace, rb, opts, c.RoleBindingInterface.Create)
+}
+
+func (c *recordingRoleBindings) Update(ctx context.Context, rb *rbacv1.RoleBinding, opts metav1.UpdateOptions) (*rbacv1.RoleBinding, error) {
+	return recordUpdate(ctx, c.recorder, "RoleBinding", c.namespace, rb, opts, c.RoleBindingInterface.Get, c.RoleBindingInterface.Update)
+}
+
+func (c *recordingRoleBindings) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*rbacv1.RoleBinding, error) {
+	return recordPatch(ctx, c.recorder, "RoleBinding", c.namespace, name, pt, data, opts, subresources, c.RoleBindingInterface.Get, c.RoleBindingInterface.Patch)
+}
+
+func (c *recordingRoleBindings) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return recordDelete(ctx, c.recorder, "RoleBinding", c.namespace, name, opts, c.RoleBindingInterface.Delete)
+}
+
+type recordingClusterRoles struct {
+	rbacv1client.ClusterRoleInterface
+	*recorder
+}
+
+func (c *recordingClusterRoles) Create(ctx context.Context, cr *rbacv1.ClusterRole, opts metav1.CreateOptions) (*rbacv1.ClusterRole, error) {
+	return recordCreate(ctx, c.recorder, "ClusterRole", "", cr, opts, c.ClusterRoleInterface.Create)
+}
+
+func (c *recordingClusterRoles) Update(ctx context.Context, cr *rbacv1.ClusterRole, opts metav1.UpdateOptions) (*rbacv1.ClusterRole, error) {
+	return recordUpdate(ctx, c.recorder, "ClusterRole", "", cr, opts, c.ClusterRoleInterface.Get, c.ClusterRoleInterface.Update)
+}
+
+func (c *recordingClusterRoles) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*rbacv1.ClusterRole, error) {
+	return recordPatch(ctx, c.recorder, "ClusterRole", "", name, pt, data, opts, subresources, c.ClusterRoleInterface.Get, c.ClusterRoleInterface.Patch)
+}
+
+func (c *recordingClusterRoles) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return recordDelete(ctx, c.recorder, "ClusterRole", "", name, opts, c.ClusterRoleInterface.Delete)
+}
+
+type recordingClusterRoleBindings struct {
+	rbacv1client.ClusterRoleBindingInterface
+	*recorder
+}
+
+func (c *recordingClusterRoleBindings) Create(ctx context.Context, crb *rbacv1.ClusterRoleBinding, opts metav1.CreateOptions) (*rbacv1.ClusterRoleBinding, error) {
+	return recordCreate(ctx, c.recorder, "ClusterRoleBinding", "", crb, opts, c.ClusterRoleBindingInterface.Create)
+}
+
+func (c *recordingClusterRoleBindings) Update(ctx context.Context, crb *rbacv1.ClusterRoleBinding, opts metav1.UpdateOptions) (*rbacv1.ClusterRoleBinding, error) {
+	return recordUpdate(ctx, c.recorder, "ClusterRoleBinding", "", crb, opts, c.ClusterRoleBindingInterface.Get, c.ClusterRoleBindingInterface.Update)
+}
+
+func (c *recordingClusterRoleBindings) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*rbacv1.ClusterRoleBinding, error) {
+	return recordPatch(ctx, c.recorder, "ClusterRoleBinding", "", name, pt, data, opts, subresources, c.ClusterRoleBindingInterface.Get, c.ClusterRoleBindingInterface.Patch)
+}
+
+func (c *recordingClusterRoleBindings) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return recordDelete(ctx, c.recorder, "ClusterRoleBinding", "", name, opts, c.ClusterRoleBindingInterface.Delete)
+}
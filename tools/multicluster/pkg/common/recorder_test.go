@@ -0,0 +1,90 @@
+package common
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRecordingClient_RecordsActions(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	clientMap := getClientResources(ctx, flags)
+
+	plan := NewPlan()
+	recordingClientMap := NewRecordingClientMap(clientMap, plan)
+	require.NoError(t, EnsureMultiClusterResources(ctx, flags, recordingClientMap))
+	require.NoError(t, ReplaceClusterMembersConfigMap(ctx, recordingClientMap[flags.CentralCluster], flags))
+
+	// the objects are created in the clusters
+	_, err := clientMap[flags.CentralCluster].CoreV1().Secrets(flags.CentralClusterNamespace).Get(ctx, KubeConfigSecretName, metav1.GetOptions{})
+	require.NoError(t, err)
+
+	recorded := plannedActions(plan)
+	for _, a := range plan.Actions() {
+		assert.Equal(t, ActionCreate, a.Action, "%s %s/%s should be created", a.Kind, a.Namespace, a.Name)
+	}
+	for _, cluster := range flags.MemberClusters {
+		assert.Contains(t, recorded, planKey(cluster, "Namespace", "", flags.MemberClusterNamespace))
+		assert.Contains(t, recorded, planKey(cluster, "ServiceAccount", flags.CentralClusterNamespace, flags.ServiceAccount))
+		assert.Contains(t, recorded, planKey(cluster, "Role", flags.MemberClusterNamespace, buildMemberEntityRole(flags, flags.MemberClusterNamespace).Name))
+	}
+	assert.Contains(t, recorded, planKey(flags.CentralCluster, "Secret", flags.CentralClusterNamespace, KubeConfigSecretName))
+	assert.Contains(t, recorded, planKey(flags.CentralCluster, "ConfigMap", flags.CentralClusterNamespace, DefaultOperatorConfigMapName))
+
+	// running again changes nothing
+	plan = NewPlan()
+	recordingClientMap = NewRecordingClientMap(clientMap, plan)
+	require.NoError(t, EnsureMultiClusterResources(ctx, flags, recordingClientMap))
+	require.NoError(t, ReplaceClusterMembersConfigMap(ctx, recordingClientMap[flags.CentralCluster], flags))
+
+	require.NotEmpty(t, plan.Actions())
+	for _, a := range plan.Actions() {
+		assert.Equal(t, ActionUnchanged, a.Action, "%s %s/%s should be unchanged", a.Kind, a.Namespace, a.Name)
+	}
+}
+
+func TestRecordingClient_MergesActionsOnTheSameObject(t *testing.T) {
+	ctx := context.Background()
+	plan := NewPlan()
+	client := NewKubeClientContainer(nil, newFakeClientset(ctx, "central", nil), nil)
+	configMaps := NewRecordingClientMap(map[string]KubeClient{"central": client}, plan)["central"].CoreV1().ConfigMaps("mongodb")
+	action := func() ActionType {
+		a, ok := plan.lookup("central", "ConfigMap", "mongodb", "members")
+		require.True(t, ok)
+		return a.Action
+	}
+
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "members", Namespace: "mongodb"}, Data: map[string]string{"cluster-1": ""}}
+	_, err := configMaps.Create(ctx, cm, metav1.CreateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, ActionCreate, action())
+
+	// an object created by the command stays created when it is updated afterwards
+	cm.Data["cluster-2"] = ""
+	_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, ActionCreate, action())
+
+	plan = NewPlan()
+	configMaps = NewRecordingClientMap(map[string]KubeClient{"central": client}, plan)["central"].CoreV1().ConfigMaps("mongodb")
+	_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, ActionUnchanged, action())
+
+	cm.Data["cluster-3"] = ""
+	_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, ActionUpdate, action())
+
+	_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, ActionUpdate, action())
+
+	require.NoError(t, configMaps.Delete(ctx, "members", metav1.DeleteOptions{}))
+	assert.Equal(t, ActionDelete, action())
+}
@@ -0,0 +1,78 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"golang.org/x/xerrors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// NewRenderClientMap returns clients for the given clusters that don't talk to any API server. Every cluster is
+// treated as empty, and all the objects that would be created are recorded in the plan so that they can be written
+// to disk with WriteRenderedManifests.
+func NewRenderClientMap(clusters []string, plan *Plan) map[string]KubeClient {
+	clientMap := map[string]KubeClient{}
+	for _, cluster := range clusters {
+		clientMap[cluster] = NewDryRunKubeClient(cluster, NewKubeClientContainer(nil, fake.NewSimpleClientset(), nil), plan)
+	}
+	return clientMap
+}
+
+// WriteRenderedManifests writes the objects recorded in the plan to one YAML file per cluster in the given directory.
+// It returns the paths of the written files.
+func WriteRenderedManifests(dir string, plan *Plan) ([]string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, xerrors.Errorf("failed to create directory %s: %w", dir, err)
+	}
+
+	var clusters []string
+	manifests := map[string]*strings.Builder{}
+	for _, a := range plan.Actions() {
+		if a.Object == nil {
+			continue
+		}
+		sb, ok := manifests[a.Cluster]
+		if !ok {
+			sb = &strings.Builder{}
+			manifests[a.Cluster] = sb
+			clusters = append(clusters, a.Cluster)
+		}
+
+		data, err := marshalManifest(a.Object)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to marshal %s %s: %w", a.Kind, objectRef(a.Namespace, a.Name), err)
+		}
+		sb.WriteString("---\n")
+		sb.Write(data)
+	}
+
+	var files []string
+	for _, cluster := range clusters {
+		fileName := filepath.Join(dir, fmt.Sprintf("%s.yaml", cleanClusterName(cluster)))
+		if err := os.WriteFile(fileName, []byte(manifests[cluster].String()), 0o644); err != nil {
+			return nil, xerrors.Errorf("failed to write manifests of cluster %s: %w", cluster, err)
+		}
+		files = append(files, fileName)
+	}
+	return files, nil
+}
+
+// marshalManifest marshals the object to YAML including its apiVersion and kind, without the fields that are only
+// ever set by the API server.
+func marshalManifest(obj runtime.Object) ([]byte, error) {
+	content, err := manifestContent(obj)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(content)
+}
+
+// cleanClusterName makes the cluster name safe to use as a file name.
+func cleanClusterName(cluster string) string {
+	return strings.NewReplacer("/", "-", ":", "-").Replace(cluster)
+}
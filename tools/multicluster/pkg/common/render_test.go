@@ -0,0 +1,75 @@
+package common
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderManifests(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	flags.DryRun = true
+	flags.ClusterScoped = true
+	flags.InstallDatabaseRoles = true
+
+	plan := NewPlan()
+	clientMap := NewRenderClientMap(append([]string{flags.CentralCluster}, flags.MemberClusters...), plan)
+	require.NoError(t, EnsureMultiClusterResources(ctx, flags, clientMap))
+	require.NoError(t, ReplaceClusterMembersConfigMap(ctx, clientMap[flags.CentralCluster], flags))
+
+	dir := t.TempDir()
+	files, err := WriteRenderedManifests(dir, plan)
+	require.NoError(t, err)
+	require.Len(t, files, len(flags.MemberClusters)+1)
+
+	central := readManifests(t, filepath.Join(dir, flags.CentralCluster+".yaml"))
+	assert.Contains(t, central, "Namespace/"+flags.CentralClusterNamespace)
+	assert.Contains(t, central, "ServiceAccount/"+flags.ServiceAccount)
+	assert.Contains(t, central, "ClusterRole/"+buildCentralEntityClusterRole(flags).Name)
+	assert.Contains(t, central, "ClusterRoleBinding/"+flags.clusterScopedName("mongodb-enterprise-operator-multi-cluster-role-binding"))
+	assert.Contains(t, central, "Secret/"+KubeConfigSecretName)
+	assert.Contains(t, central, "ConfigMap/"+DefaultOperatorConfigMapName)
+
+	for _, cluster := range flags.MemberClusters {
+		member := readManifests(t, filepath.Join(dir, cluster+".yaml"))
+		assert.Contains(t, member, "Namespace/"+flags.MemberClusterNamespace)
+		assert.Contains(t, member, "ClusterRole/"+buildMemberEntityClusterRole(flags).Name)
+		assert.Contains(t, member, "ClusterRole/"+buildClusterRoleTelemetry(flags).Name)
+		assert.Contains(t, member, "Secret/"+flags.ServiceAccount+"-token-secret")
+		assert.Contains(t, member, "Role/"+AppdbRole)
+		assert.NotContains(t, member, "Secret/"+KubeConfigSecretName)
+
+		roleManifest := member["ClusterRole/"+buildMemberEntityClusterRole(flags).Name]
+		assert.Equal(t, "rbac.authorization.k8s.io/v1", roleManifest["apiVersion"])
+		assert.NotContains(t, roleManifest["metadata"], "creationTimestamp")
+	}
+}
+
+func TestCleanClusterName(t *testing.T) {
+	assert.Equal(t, "arn-aws-eks-eu-west-1-1234-cluster-member", cleanClusterName("arn:aws:eks:eu-west-1:1234:cluster/member"))
+}
+
+// readManifests reads a multi-document YAML file and returns its documents keyed by "<kind>/<name>".
+func readManifests(t *testing.T, fileName string) map[string]map[string]interface{} {
+	data, err := os.ReadFile(fileName)
+	require.NoError(t, err)
+
+	manifests := map[string]map[string]interface{}{}
+	for _, doc := range strings.Split(string(data), "---\n") {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+		manifest := map[string]interface{}{}
+		require.NoError(t, yaml.Unmarshal([]byte(doc), &manifest))
+		metadata := manifest["metadata"].(map[string]interface{})
+		manifests[manifest["kind"].(string)+"/"+metadata["name"].(string)] = manifest
+	}
+	return manifests
+}
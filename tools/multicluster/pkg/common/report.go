@@ -0,0 +1,71 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"text/tabwriter"
+)
+
+// CheckStatus is the outcome of a single check.
+type CheckStatus string
+
+const (
+	CheckPass CheckStatus = "PASS"
+	CheckWarn CheckStatus = "WARN"
+	CheckFail CheckStatus = "FAIL"
+)
+
+// CheckResult is the result of a single check against a cluster.
+type CheckResult struct {
+	Cluster string
+	Check   string
+	Status  CheckStatus
+	Message string
+}
+
+// CheckReport holds the results of all the checks, in the order of the clusters they were run against.
+type CheckReport []CheckResult
+
+// Failed returns true if any of the checks failed.
+func (r CheckReport) Failed() bool {
+	for _, check := range r {
+		if check.Status == CheckFail {
+			return true
+		}
+	}
+	return false
+}
+
+// Print writes the report as a table.
+func (r CheckReport) Print(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "CLUSTER\tCHECK\tSTATUS\tMESSAGE")
+	for _, check := range r {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", check.Cluster, check.Check, check.Status, check.Message)
+	}
+	_ = tw.Flush()
+}
+
+// checkClusters runs check against the clusters, at most parallelism at a time, and returns the results in the order
+// of the clusters. Checks never fail, failures are reported in their results instead.
+func checkClusters(ctx context.Context, clusters []string, parallelism int, check func(ctx context.Context, cluster string) []CheckResult) CheckReport {
+	results := map[string][]CheckResult{}
+	mu := sync.Mutex{}
+
+	_ = forEachCluster(ctx, clusters, parallelism, func(ctx context.Context, cluster string) error {
+		checks := check(ctx, cluster)
+
+		mu.Lock()
+		defer mu.Unlock()
+		results[cluster] = checks
+		return nil
+	})
+
+	var report CheckReport
+	for _, cluster := range clusters {
+		report = append(report, results[cluster]...)
+	}
+	return report
+}
@@ -0,0 +1,44 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckReport_Print(t *testing.T) {
+	report := CheckReport{
+		{Cluster: "central-cluster", Check: "api-server", Status: CheckPass, Message: "Kubernetes v1.30.1"},
+		{Cluster: "member-cluster-0", Check: "permissions", Status: CheckFail, Message: "missing permissions: create namespaces"},
+	}
+
+	buf := bytes.Buffer{}
+	report.Print(&buf)
+
+	assert.Equal(t, `CLUSTER           CHECK        STATUS  MESSAGE
+central-cluster   api-server   PASS    Kubernetes v1.30.1
+member-cluster-0  permissions  FAIL    missing permissions: create namespaces
+`, buf.String())
+}
+
+func TestCheckClusters_KeepsTheOrderOfTheClusters(t *testing.T) {
+	clusters := []string{"central-cluster", "member-cluster-0", "member-cluster-1"}
+	report := checkClusters(context.Background(), clusters, 3, func(_ context.Context, cluster string) []CheckResult {
+		if cluster == "member-cluster-0" {
+			return nil
+		}
+		return []CheckResult{
+			{Cluster: cluster, Check: "api-server", Status: CheckPass},
+			{Cluster: cluster, Check: "permissions", Status: CheckPass},
+		}
+	})
+
+	assert.Equal(t, CheckReport{
+		{Cluster: "central-cluster", Check: "api-server", Status: CheckPass},
+		{Cluster: "central-cluster", Check: "permissions", Status: CheckPass},
+		{Cluster: "member-cluster-1", Check: "api-server", Status: CheckPass},
+		{Cluster: "member-cluster-1", Check: "permissions", Status: CheckPass},
+	}, report)
+}
@@ -0,0 +1,938 @@
+package common
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"golang.org/x/xerrors"
+	appsv1 "k8s.io/api/apps/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	appsv1client "k8s.io/client-go/kubernetes/typed/apps/v1"
+	certificatesv1client "k8s.io/client-go/kubernetes/typed/certificates/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	rbacv1client "k8s.io/client-go/kubernetes/typed/rbac/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	// DefaultQPS and DefaultBurst are well above the client-go defaults, which throttle setup with many clusters.
+	DefaultQPS          = 50
+	DefaultBurst        = 100
+	DefaultRetries      = 5
+	DefaultRetryBackoff = 500 * time.Millisecond
+
+	// maxRetryBackoff caps the exponential backoff.
+	maxRetryBackoff = 30 * time.Second
+)
+
+// ClientOptions configure the clients of all the clusters.
+type ClientOptions struct {
+	QPS   float32
+	Burst int
+	// RequestTimeout bounds every request to an api server, 0 means no timeout.
+	RequestTimeout time.Duration
+	// Retries is how many times a request failing with a retriable error is retried.
+	Retries int
+	// RetryBackoff is the delay before the first retry, doubled for every following one.
+	RetryBackoff time.Duration
+}
+
+var clientOptions = ClientOptions{QPS: DefaultQPS, Burst: DefaultBurst, Retries: DefaultRetries, RetryBackoff: DefaultRetryBackoff}
+
+// ConfigureClients replaces the options of the clients created from then on. It must be called before any command runs.
+func ConfigureClients(opts ClientOptions) error {
+	if opts.QPS <= 0 || opts.Burst < 1 {
+		return xerrors.Errorf("qps and burst must be positive")
+	}
+	if opts.Retries < 0 {
+		return xerrors.Errorf("retries cannot be negative")
+	}
+	if opts.RetryBackoff <= 0 {
+		return xerrors.Errorf("retry-backoff must be positive")
+	}
+	if opts.RequestTimeout < 0 {
+		return xerrors.Errorf("request-timeout cannot be negative")
+	}
+	clientOptions = opts
+	return nil
+}
+
+// configureRestConfig returns a copy of the config with the client options applied and every request logged.
+// Throttled requests are retried by client-go itself, honouring the Retry-After of the api server.
+func configureRestConfig(config *rest.Config, cluster string) *rest.Config {
+	config = withRequestLogging(config, cluster)
+	config.QPS = clientOptions.QPS
+	config.Burst = clientOptions.Burst
+	if config.Timeout == 0 {
+		config.Timeout = clientOptions.RequestTimeout
+	}
+	return config
+}
+
+// NewRetryingKubeClient wraps the client with one that retries the requests failing with a server error, a broken
+// connection or throttling: reads, creates, updates, deletes and patches other than JSON patches. A create whose first
+// attempt succeeded without the response reaching the client fails with AlreadyExists when it is retried, which counts
+// as success, and so does a delete failing with NotFound. Patches failing with a conflict are retried too, as they are
+// applied to the latest version of the object. Updates failing with a conflict aren't: resending the same object fails
+// again, so the callers read the latest object and recompute the update with retryOnConflict. Only the resources used
+// by this tool are wrapped, other requests are sent once.
+func NewRetryingKubeClient(cluster string, c KubeClient) KubeClient {
+	return &retryingKubeClient{KubeClient: c, retrier: &retrier{cluster: cluster, retries: clientOptions.Retries, backoff: clientOptions.RetryBackoff}}
+}
+
+// retrier retries the requests to a single cluster with an exponential backoff.
+type retrier struct {
+	cluster string
+	retries int
+	backoff time.Duration
+}
+
+// do calls the request until it succeeds, fails with an error that isn't retriable or runs out of retries.
+func (r *retrier) do(ctx context.Context, verb, resource string, request func() error) error {
+	backoff := r.backoff
+	for attempt := 0; ; attempt++ {
+		err := request()
+		if err == nil || attempt >= r.retries || !isRetriable(err) && !(verb == "patch" && errors.IsConflict(err)) {
+			return err
+		}
+
+		delay := min(backoff, maxRetryBackoff)
+		// throttled requests tell how long to wait before sending them again
+		if seconds, ok := errors.SuggestsClientDelay(err); ok {
+			delay = max(delay, time.Duration(seconds)*time.Second)
+		}
+		logger.Debug("Retrying API request", "cluster", r.cluster, "verb", verb, "resource", resource, "error", err.Error(), "attempt", attempt+1, "delay", delay)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		backoff *= 2
+	}
+}
+
+// retried calls the request with the retrier and returns its result.
+func retried[T any](ctx context.Context, r *retrier, verb, resource string, request func() (T, error)) (T, error) {
+	var result T
+	err := r.do(ctx, verb, resource, func() error {
+		var err error
+		result, err = request()
+		return err
+	})
+	return result, err
+}
+
+// retriedCreate calls the create with the retrier. If the create fails with AlreadyExists after it was retried, the
+// object was created by an earlier attempt, and it is read back instead.
+func retriedCreate[T any](ctx context.Context, r *retrier, resource string, create func() (T, error), get func() (T, error)) (T, error) {
+	attempts := 0
+	result, err := retried(ctx, r, "create", resource, func() (T, error) {
+		attempts++
+		return create()
+	})
+	if attempts > 1 && errors.IsAlreadyExists(err) {
+		logger.Debug("API request created the object on an earlier attempt", "cluster", r.cluster, "verb", "create", "resource", resource)
+		return get()
+	}
+	return result, err
+}
+
+// retriedDelete calls the delete with the retrier. If the delete fails with NotFound after it was retried, the object
+// was deleted by an earlier attempt.
+func retriedDelete(ctx context.Context, r *retrier, resource string, del func() error) error {
+	attempts := 0
+	err := r.do(ctx, "delete", resource, func() error {
+		attempts++
+		return del()
+	})
+	if attempts > 1 && errors.IsNotFound(err) {
+		logger.Debug("API request deleted the object on an earlier attempt", "cluster", r.cluster, "verb", "delete", "resource", resource)
+		return nil
+	}
+	return err
+}
+
+// isRetriable returns true for the errors that may go away when the request is sent again: server errors other than
+// 501 Not Implemented, throttling and broken connections. client-go already retries throttled requests a few times,
+// but gives up on api servers throttling for longer. Conflicts depend on the request, see NewRetryingKubeClient.
+func isRetriable(err error) bool {
+	if utilnet.IsConnectionReset(err) || utilnet.IsProbableEOF(err) {
+		return true
+	}
+	var status errors.APIStatus
+	if xerrors.As(err, &status) {
+		code := status.Status().Code
+		return code >= 500 && code != 501 || code == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// retryOnConflict calls update until it succeeds or fails with an error other than a conflict, with the retries and
+// the backoff of the clients. update must read the latest version of the object on every attempt.
+func retryOnConflict(update func() error) error {
+	backoff := wait.Backoff{Steps: clientOptions.Retries + 1, Duration: clientOptions.RetryBackoff, Factor: 2, Cap: maxRetryBackoff}
+	return retry.RetryOnConflict(backoff, update)
+}
+
+// idempotentPatch returns true for the patches that have the same effect when they are applied twice.
+func idempotentPatch(pt types.PatchType) bool {
+	return pt != types.JSONPatchType
+}
+
+type retryingKubeClient struct {
+	KubeClient
+	*retrier
+}
+
+func (c *retryingKubeClient) CoreV1() corev1client.CoreV1Interface {
+	return &retryingCoreV1{CoreV1Interface: c.KubeClient.CoreV1(), retrier: c.retrier}
+}
+
+func (c *retryingKubeClient) RbacV1() rbacv1client.RbacV1Interface {
+	return &retryingRbacV1{RbacV1Interface: c.KubeClient.RbacV1(), retrier: c.retrier}
+}
+
+func (c *retryingKubeClient) CertificatesV1() certificatesv1client.CertificatesV1Interface {
+	return &retryingCertificatesV1{CertificatesV1Interface: c.KubeClient.CertificatesV1(), retrier: c.retrier}
+}
+
+func (c *retryingKubeClient) AppsV1() appsv1client.AppsV1Interface {
+	return &retryingAppsV1{AppsV1Interface: c.KubeClient.AppsV1(), retrier: c.retrier}
+}
+
+func (c *retryingKubeClient) Discovery() discovery.DiscoveryInterface {
+	return &retryingDiscovery{DiscoveryInterface: c.KubeClient.Discovery(), retrier: c.retrier}
+}
+
+func (c *retryingKubeClient) Resource(resource schema.GroupVersionResource) dynamic.NamespaceableResourceInterface {
+	return &retryingNamespaceableResource{NamespaceableResourceInterface: c.KubeClient.Resource(resource), retrier: c.retrier, resource: resource.Resource}
+}
+
+type retryingCoreV1 struct {
+	corev1client.CoreV1Interface
+	*retrier
+}
+
+func (c *retryingCoreV1) Namespaces() corev1client.NamespaceInterface {
+	return &retryingNamespaces{NamespaceInterface: c.CoreV1Interface.Namespaces(), retrier: c.retrier}
+}
+
+func (c *retryingCoreV1) ServiceAccounts(namespace string) corev1client.ServiceAccountInterface {
+	return &retryingServiceAccounts{ServiceAccountInterface: c.CoreV1Interface.ServiceAccounts(namespace), retrier: c.retrier}
+}
+
+func (c *retryingCoreV1) Secrets(namespace string) corev1client.SecretInterface {
+	return &retryingSecrets{SecretInterface: c.CoreV1Interface.Secrets(namespace), retrier: c.retrier}
+}
+
+func (c *retryingCoreV1) ConfigMaps(namespace string) corev1client.ConfigMapInterface {
+	return &retryingConfigMaps{ConfigMapInterface: c.CoreV1Interface.ConfigMaps(namespace), retrier: c.retrier}
+}
+
+func (c *retryingCoreV1) Pods(namespace string) corev1client.PodInterface {
+	return &retryingPods{PodInterface: c.CoreV1Interface.Pods(namespace), retrier: c.retrier}
+}
+
+func (c *retryingCoreV1) Endpoints(namespace string) corev1client.EndpointsInterface {
+	return &retryingEndpoints{EndpointsInterface: c.CoreV1Interface.Endpoints(namespace), retrier: c.retrier}
+}
+
+type retryingRbacV1 struct {
+	rbacv1client.RbacV1Interface
+	*retrier
+}
+
+func (c *retryingRbacV1) Roles(namespace string) rbacv1client.RoleInterface {
+	return &retryingRoles{RoleInterface: c.RbacV1Interface.Roles(namespace), retrier: c.retrier}
+}
+
+func (c *retryingRbacV1) RoleBindings(namespace string) rbacv1client.RoleBindingInterface {
+	return &retryingRoleBindings{RoleBindingInterface: c.RbacV1Interface.RoleBindings(namespace), retrier: c.retrier}
+}
+
+func (c *retryingRbacV1) ClusterRoles() rbacv1client.ClusterRoleInterface {
+	return &retryingClusterRoles{ClusterRoleInterface: c.RbacV1Interface.ClusterRoles(), retrier: c.retrier}
+}
+
+func (c *retryingRbacV1) ClusterRoleBindings() rbacv1client.ClusterRoleBindingInterface {
+	return &retryingClusterRoleBindings{ClusterRoleBindingInterface: c.RbacV1Interface.ClusterRoleBindings(), retrier: c.retrier}
+}
+
+type retryingCertificatesV1 struct {
+	certificatesv1client.CertificatesV1Interface
+	*retrier
+}
+
+func (c *retryingCertificatesV1) CertificateSigningRequests() certificatesv1client.CertificateSigningRequestInterface {
+	return &retryingCertificateSigningRequests{CertificateSigningRequestInterface: c.CertificatesV1Interface.CertificateSigningRequests(), retrier: c.retrier}
+}
+
+type retryingAppsV1 struct {
+	appsv1client.AppsV1Interface
+	*retrier
+}
+
+func (c *retryingAppsV1) Deployments(namespace string) appsv1client.DeploymentInterface {
+	return &retryingDeployments{DeploymentInterface: c.AppsV1Interface.Deployments(namespace), retrier: c.retrier}
+}
+
+func (c *retryingAppsV1) StatefulSets(namespace string) appsv1client.StatefulSetInterface {
+	return &retryingStatefulSets{StatefulSetInterface: c.AppsV1Interface.StatefulSets(namespace), retrier: c.retrier}
+}
+
+type retryingNamespaces struct {
+	corev1client.NamespaceInterface
+	*retrier
+}
+
+func (c *retryingNamespaces) Get(ctx context.Context, name string, opts metav1.GetOptions) (*corev1.Namespace, error) {
+	return retried(ctx, c.retrier, "get", "namespaces", func() (*corev1.Namespace, error) { return c.NamespaceInterface.Get(ctx, name, opts) })
+}
+
+func (c *retryingNamespaces) List(ctx context.Context, opts metav1.ListOptions) (*corev1.NamespaceList, error) {
+	return retried(ctx, c.retrier, "list", "namespaces", func() (*corev1.NamespaceList, error) { return c.NamespaceInterface.List(ctx, opts) })
+}
+
+func (c *retryingNamespaces) Create(ctx context.Context, obj *corev1.Namespace, opts metav1.CreateOptions) (*corev1.Namespace, error) {
+	return retriedCreate(ctx, c.retrier, "namespaces", func() (*corev1.Namespace, error) {
+		return c.NamespaceInterface.Create(ctx, obj, opts)
+	}, func() (*corev1.Namespace, error) {
+		return c.Get(ctx, obj.Name, metav1.GetOptions{})
+	})
+}
+
+func (c *retryingNamespaces) Update(ctx context.Context, obj *corev1.Namespace, opts metav1.UpdateOptions) (*corev1.Namespace, error) {
+	return retried(ctx, c.retrier, "update", "namespaces", func() (*corev1.Namespace, error) { return c.NamespaceInterface.Update(ctx, obj, opts) })
+}
+
+func (c *retryingNamespaces) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return retriedDelete(ctx, c.retrier, "namespaces", func() error { return c.NamespaceInterface.Delete(ctx, name, opts) })
+}
+
+func (c *retryingNamespaces) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*corev1.Namespace, error) {
+	if !idempotentPatch(pt) {
+		return c.NamespaceInterface.Patch(ctx, name, pt, data, opts, subresources...)
+	}
+	return retried(ctx, c.retrier, "patch", "namespaces", func() (*corev1.Namespace, error) {
+		return c.NamespaceInterface.Patch(ctx, name, pt, data, opts, subresources...)
+	})
+}
+
+type retryingServiceAccounts struct {
+	corev1client.ServiceAccountInterface
+	*retrier
+}
+
+func (c *retryingServiceAccounts) Get(ctx context.Context, name string, opts metav1.GetOptions) (*corev1.ServiceAccount, error) {
+	return retried(ctx, c.retrier, "get", "serviceaccounts", func() (*corev1.ServiceAccount, error) { return c.ServiceAccountInterface.Get(ctx, name, opts) })
+}
+
+func (c *retryingServiceAccounts) List(ctx context.Context, opts metav1.ListOptions) (*corev1.ServiceAccountList, error) {
+	return retried(ctx, c.retrier, "list", "serviceaccounts", func() (*corev1.ServiceAccountList, error) { return c.ServiceAccountInterface.List(ctx, opts) })
+}
+
+func (c *retryingServiceAccounts) Create(ctx context.Context, obj *corev1.ServiceAccount, opts metav1.CreateOptions) (*corev1.ServiceAccount, error) {
+	return retriedCreate(ctx, c.retrier, "serviceaccounts", func() (*corev1.ServiceAccount, error) {
+		return c.ServiceAccountInterface.Create(ctx, obj, opts)
+	}, func() (*corev1.ServiceAccount, error) {
+		return c.Get(ctx, obj.Name, metav1.GetOptions{})
+	})
+}
+
+func (c *retryingServiceAccounts) CreateToken(ctx context.Context, serviceAccountName string, tokenRequest *authenticationv1.TokenRequest, opts metav1.CreateOptions) (*authenticationv1.TokenRequest, error) {
+	return retried(ctx, c.retrier, "create", "serviceaccounts/token", func() (*authenticationv1.TokenRequest, error) {
+		return c.ServiceAccountInterface.CreateToken(ctx, serviceAccountName, tokenRequest, opts)
+	})
+}
+
+func (c *retryingServiceAccounts) Update(ctx context.Context, obj *corev1.ServiceAccount, opts metav1.UpdateOptions) (*corev1.ServiceAccount, error) {
+	return retried(ctx, c.retrier, "update", "serviceaccounts", func() (*corev1.ServiceAccount, error) { return c.ServiceAccountInterface.Update(ctx, obj, opts) })
+}
+
+func (c *retryingServiceAccounts) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return retriedDelete(ctx, c.retrier, "serviceaccounts", func() error { return c.ServiceAccountInterface.Delete(ctx, name, opts) })
+}
+
+func (c *retryingServiceAccounts) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*corev1.ServiceAccount, error) {
+	if !idempotentPatch(pt) {
+		return c.ServiceAccountInterface.Patch(ctx, name, pt, data, opts, subresources...)
+	}
+	return retried(ctx, c.retrier, "patch", "serviceaccounts", func() (*corev1.ServiceAccount, error) {
+		return c.ServiceAccountInterface.Patch(ctx, name, pt, data, opts, subresources...)
+	})
+}
+
+type retryingSecrets struct {
+	corev1client.SecretInterface
+	*retrier
+}
+
+func (c *retryingSecrets) Get(ctx context.Context, name string, opts metav1.GetOptions) (*corev1.Secret, error) {
+	return retried(ctx, c.retrier, "get", "secrets", func() (*corev1.Secret, error) { return c.SecretInterface.Get(ctx, name, opts) })
+}
+
+func (c *retryingSecrets) List(ctx context.Context, opts metav1.ListOptions) (*corev1.SecretList, error) {
+	return retried(ctx, c.retrier, "list", "secrets", func() (*corev1.SecretList, error) { return c.SecretInterface.List(ctx, opts) })
+}
+
+func (c *retryingSecrets) Create(ctx context.Context, obj *corev1.Secret, opts metav1.CreateOptions) (*corev1.Secret, error) {
+	return retriedCreate(ctx, c.retrier, "secrets", func() (*corev1.Secret, error) {
+		return c.SecretInterface.Create(ctx, obj, opts)
+	}, func() (*corev1.Secret, error) {
+		return c.Get(ctx, obj.Name, metav1.GetOptions{})
+	})
+}
+
+func (c *retryingSecrets) Update(ctx context.Context, obj *corev1.Secret, opts metav1.UpdateOptions) (*corev1.Secret, error) {
+	return retried(ctx, c.retrier, "update", "secrets", func() (*corev1.Secret, error) { return c.SecretInterface.Update(ctx, obj, opts) })
+}
+
+func (c *retryingSecrets) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return retriedDelete(ctx, c.retrier, "secrets", func() error { return c.SecretInterface.Delete(ctx, name, opts) })
+}
+
+func (c *retryingSecrets) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*corev1.Secret, error) {
+	if !idempotentPatch(pt) {
+		return c.SecretInterface.Patch(ctx, name, pt, data, opts, subresources...)
+	}
+	return retried(ctx, c.retrier, "patch", "secrets", func() (*corev1.Secret, error) {
+		return c.SecretInterface.Patch(ctx, name, pt, data, opts, subresources...)
+	})
+}
+
+type retryingConfigMaps struct {
+	corev1client.ConfigMapInterface
+	*retrier
+}
+
+func (c *retryingConfigMaps) Get(ctx context.Context, name string, opts metav1.GetOptions) (*corev1.ConfigMap, error) {
+	return retried(ctx, c.retrier, "get", "configmaps", func() (*corev1.ConfigMap, error) { return c.ConfigMapInterface.Get(ctx, name, opts) })
+}
+
+func (c *retryingConfigMaps) List(ctx context.Context, opts metav1.ListOptions) (*corev1.ConfigMapList, error) {
+	return retried(ctx, c.retrier, "list", "configmaps", func() (*corev1.ConfigMapList, error) { return c.ConfigMapInterface.List(ctx, opts) })
+}
+
+func (c *retryingConfigMaps) Create(ctx context.Context, obj *corev1.ConfigMap, opts metav1.CreateOptions) (*corev1.ConfigMap, error) {
+	return retriedCreate(ctx, c.retrier, "configmaps", func() (*corev1.ConfigMap, error) {
+		return c.ConfigMapInterface.Create(ctx, obj, opts)
+	}, func() (*corev1.ConfigMap, error) {
+		return c.Get(ctx, obj.Name, metav1.GetOptions{})
+	})
+}
+
+func (c *retryingConfigMaps) Update(ctx context.Context, obj *corev1.ConfigMap, opts metav1.UpdateOptions) (*corev1.ConfigMap, error) {
+	return retried(ctx, c.retrier, "update", "configmaps", func() (*corev1.ConfigMap, error) { return c.ConfigMapInterface.Update(ctx, obj, opts) })
+}
+
+func (c *retryingConfigMaps) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return retriedDelete(ctx, c.retrier, "configmaps", func() error { return c.ConfigMapInterface.Delete(ctx, name, opts) })
+}
+
+func (c *retryingConfigMaps) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*corev1.ConfigMap, error) {
+	if !idempotentPatch(pt) {
+		return c.ConfigMapInterface.Patch(ctx, name, pt, data, opts, subresources...)
+	}
+	return retried(ctx, c.retrier, "patch", "configmaps", func() (*corev1.ConfigMap, error) {
+		return c.ConfigMapInterface.Patch(ctx, name, pt, data, opts, subresources...)
+	})
+}
+
+type retryingPods struct {
+	corev1client.PodInterface
+	*retrier
+}
+
+func (c *retryingPods) Get(ctx context.Context, name string, opts metav1.GetOptions) (*corev1.Pod, error) {
+	return retried(ctx, c.retrier, "get", "pods", func() (*corev1.Pod, error) { return c.PodInterface.Get(ctx, name, opts) })
+}
+
+func (c *retryingPods) List(ctx context.Context, opts metav1.ListOptions) (*corev1.PodList, error) {
+	return retried(ctx, c.retrier, "list", "pods", func() (*corev1.PodList, error) { return c.PodInterface.List(ctx, opts) })
+}
+
+func (c *retryingPods) Create(ctx context.Context, obj *corev1.Pod, opts metav1.CreateOptions) (*corev1.Pod, error) {
+	return retriedCreate(ctx, c.retrier, "pods", func() (*corev1.Pod, error) {
+		return c.PodInterface.Create(ctx, obj, opts)
+	}, func() (*corev1.Pod, error) {
+		return c.Get(ctx, obj.Name, metav1.GetOptions{})
+	})
+}
+
+func (c *retryingPods) Update(ctx context.Context, obj *corev1.Pod, opts metav1.UpdateOptions) (*corev1.Pod, error) {
+	return retried(ctx, c.retrier, "update", "pods", func() (*corev1.Pod, error) { return c.PodInterface.Update(ctx, obj, opts) })
+}
+
+func (c *retryingPods) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return retriedDelete(ctx, c.retrier, "pods", func() error { return c.PodInterface.Delete(ctx, name, opts) })
+}
+
+func (c *retryingPods) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*corev1.Pod, error) {
+	if !idempotentPatch(pt) {
+		return c.PodInterface.Patch(ctx, name, pt, data, opts, subresources...)
+	}
+	return retried(ctx, c.retrier, "patch", "pods", func() (*corev1.Pod, error) { return c.PodInterface.Patch(ctx, name, pt, data, opts, subresources...) })
+}
+
+type retryingEndpoints struct {
+	corev1client.EndpointsInterface
+	*retrier
+}
+
+func (c *retryingEndpoints) Get(ctx context.Context, name string, opts metav1.GetOptions) (*corev1.Endpoints, error) {
+	return retried(ctx, c.retrier, "get", "endpoints", func() (*corev1.Endpoints, error) { return c.EndpointsInterface.Get(ctx, name, opts) })
+}
+
+func (c *retryingEndpoints) List(ctx context.Context, opts metav1.ListOptions) (*corev1.EndpointsList, error) {
+	return retried(ctx, c.retrier, "list", "endpoints", func() (*corev1.EndpointsList, error) { return c.EndpointsInterface.List(ctx, opts) })
+}
+
+func (c *retryingEndpoints) Create(ctx context.Context, obj *corev1.Endpoints, opts metav1.CreateOptions) (*corev1.Endpoints, error) {
+	return retriedCreate(ctx, c.retrier, "endpoints", func() (*corev1.Endpoints, error) {
+		return c.EndpointsInterface.Create(ctx, obj, opts)
+	}, func() (*corev1.Endpoints, error) {
+		return c.Get(ctx, obj.Name, metav1.GetOptions{})
+	})
+}
+
+func (c *retryingEndpoints) Update(ctx context.Context, obj *corev1.Endpoints, opts metav1.UpdateOptions) (*corev1.Endpoints, error) {
+	return retried(ctx, c.retrier, "update", "endpoints", func() (*corev1.Endpoints, error) { return c.EndpointsInterface.Update(ctx, obj, opts) })
+}
+
+func (c *retryingEndpoints) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return retriedDelete(ctx, c.retrier, "endpoints", func() error { return c.EndpointsInterface.Delete(ctx, name, opts) })
+}
+
+func (c *retryingEndpoints) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*corev1.Endpoints, error) {
+	if !idempotentPatch(pt) {
+		return c.EndpointsInterface.Patch(ctx, name, pt, data, opts, subresources...)
+	}
+	return retried(ctx, c.retrier, "patch", "endpoints", func() (*corev1.Endpoints, error) {
+		return c.EndpointsInterface.Patch(ctx, name, pt, data, opts, subresources...)
+	})
+}
+
+type retryingRoles struct {
+	rbacv1client.RoleInterface
+	*retrier
+}
+
+func (c *retryingRoles) Get(ctx context.Context, name string, opts metav1.GetOptions) (*rbacv1.Role, error) {
+	return retried(ctx, c.retrier, "get", "roles", func() (*rbacv1.Role, error) { return c.RoleInterface.Get(ctx, name, opts) })
+}
+
+func (c *retryingRoles) List(ctx context.Context, opts metav1.ListOptions) (*rbacv1.RoleList, error) {
+	return retried(ctx, c.retrier, "list", "roles", func() (*rbacv1.RoleList, error) { return c.RoleInterface.List(ctx, opts) })
+}
+
+func (c *retryingRoles) Create(ctx context.Context, obj *rbacv1.Role, opts metav1.CreateOptions) (*rbacv1.Role, error) {
+	return retriedCreate(ctx, c.retrier, "roles", func() (*rbacv1.Role, error) {
+		return c.RoleInterface.Create(ctx, obj, opts)
+	}, func() (*rbacv1.Role, error) {
+		return c.Get(ctx, obj.Name, metav1.GetOptions{})
+	})
+}
+
+func (c *retryingRoles) Update(ctx context.Context, obj *rbacv1.Role, opts metav1.UpdateOptions) (*rbacv1.Role, error) {
+	return retried(ctx, c.retrier, "update", "roles", func() (*rbacv1.Role, error) { return c.RoleInterface.Update(ctx, obj, opts) })
+}
+
+func (c *retryingRoles) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return retriedDelete(ctx, c.retrier, "roles", func() error { return c.RoleInterface.Delete(ctx, name, opts) })
+}
+
+func (c *retryingRoles) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*rbacv1.Role, error) {
+	if !idempotentPatch(pt) {
+		return c.RoleInterface.Patch(ctx, name, pt, data, opts, subresources...)
+	}
+	return retried(ctx, c.retrier, "patch", "roles", func() (*rbacv1.Role, error) { return c.RoleInterface.Patch(ctx, name, pt, data, opts, subresources...) })
+}
+
+type retryingRoleBindings struct {
+	rbacv1client.RoleBindingInterface
+	*retrier
+}
+
+func (c *retryingRoleBindings) Get(ctx context.Context, name string, opts metav1.GetOptions) (*rbacv1.RoleBinding, error) {
+	return retried(ctx, c.retrier, "get", "rolebindings", func() (*rbacv1.RoleBinding, error) { return c.RoleBindingInterface.Get(ctx, name, opts) })
+}
+
+func (c *retryingRoleBindings) List(ctx context.Context, opts metav1.ListOptions) (*rbacv1.RoleBindingList, error) {
+	return retried(ctx, c.retrier, "list", "rolebindings", func() (*rbacv1.RoleBindingList, error) { return c.RoleBindingInterface.List(ctx, opts) })
+}
+
+func (c *retryingRoleBindings) Create(ctx context.Context, obj *rbacv1.RoleBinding, opts metav1.CreateOptions) (*rbacv1.RoleBinding, error) {
+	return retriedCreate(ctx, c.retrier, "rolebindings", func() (*rbacv1.RoleBinding, error) {
+		return c.RoleBindingInterface.Create(ctx, obj, opts)
+	}, func() (*rbacv1.RoleBinding, error) {
+		return c.Get(ctx, obj.Name, metav1.GetOptions{})
+	})
+}
+
+func (c *retryingRoleBindings) Update(ctx context.Context, obj *rbacv1.RoleBinding, opts metav1.UpdateOptions) (*rbacv1.RoleBinding, error) {
+	return retried(ctx, c.retrier, "update", "rolebindings", func() (*rbacv1.RoleBinding, error) { return c.RoleBindingInterface.Update(ctx, obj, opts) })
+}
+
+func (c *retryingRoleBindings) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return retriedDelete(ctx, c.retrier, "rolebindings", func() error { return c.RoleBindingInterface.Delete(ctx, name, opts) })
+}
+
+func (c *retryingRoleBindings) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*rbacv1.RoleBinding, error) {
+	if !idempotentPatch(pt) {
+		return c.RoleBindingInterface.Patch(ctx, name, pt, data, opts, subresources...)
+	}
+	return retried(ctx, c.retrier, "patch", "rolebindings", func() (*rbacv1.RoleBinding, error) {
+		return c.RoleBindingInterface.Patch(ctx, name, pt, data, opts, subresources...)
+	})
+}
+
+type retryingClusterRoles struct {
+	rbacv1client.ClusterRoleInterface
+	*retrier
+}
+
+func (c *retryingClusterRoles) Get(ctx context.Context, name string, opts metav1.GetOptions) (*rbacv1.ClusterRole, error) {
+	return retried(ctx, c.retrier, "get", "clusterroles", func() (*rbacv1.ClusterRole, error) { return c.ClusterRoleInterface.Get(ctx, name, opts) })
+}
+
+func (c *retryingClusterRoles) List(ctx context.Context, opts metav1.ListOptions) (*rbacv1.ClusterRoleList, error) {
+	return retried(ctx, c.retrier, "list", "clusterroles", func() (*rbacv1.ClusterRoleList, error) { return c.ClusterRoleInterface.List(ctx, opts) })
+}
+
+func (c *retryingClusterRoles) Create(ctx context.Context, obj *rbacv1.ClusterRole, opts metav1.CreateOptions) (*rbacv1.ClusterRole, error) {
+	return retriedCreate(ctx, c.retrier, "clusterroles", func() (*rbacv1.ClusterRole, error) {
+		return c.ClusterRoleInterface.Create(ctx, obj, opts)
+	}, func() (*rbacv1.ClusterRole, error) {
+		return c.Get(ctx, obj.Name, metav1.GetOptions{})
+	})
+}
+
+func (c *retryingClusterRoles) Update(ctx context.Context, obj *rbacv1.ClusterRole, opts metav1.UpdateOptions) (*rbacv1.ClusterRole, error) {
+	return retried(ctx, c.retrier, "update", "clusterroles", func() (*rbacv1.ClusterRole, error) { return c.ClusterRoleInterface.Update(ctx, obj, opts) })
+}
+
+func (c *retryingClusterRoles) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return retriedDelete(ctx, c.retrier, "clusterroles", func() error { return c.ClusterRoleInterface.Delete(ctx, name, opts) })
+}
+
+func (c *retryingClusterRoles) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*rbacv1.ClusterRole, error) {
+	if !idempotentPatch(pt) {
+		return c.ClusterRoleInterface.Patch(ctx, name, pt, data, opts, subresources...)
+	}
+	return retried(ctx, c.retrier, "patch", "clusterroles", func() (*rbacv1.ClusterRole, error) {
+		return c.ClusterRoleInterface.Patch(ctx, name, pt, data, opts, subresources...)
+	})
+}
+
+type retryingClusterRoleBindings struct {
+	rbacv1client.ClusterRoleBindingInterface
+	*retrier
+}
+
+func (c *retryingClusterRoleBindings) Get(ctx context.Context, name string, opts metav1.GetOptions) (*rbacv1.ClusterRoleBinding, error) {
+	return retried(ctx, c.retrier, "get", "clusterrolebindings", func() (*rbacv1.ClusterRoleBinding, error) { return c.ClusterRoleBindingInterface.Get(ctx, name, opts) })
+}
+
+func (c *retryingClusterRoleBindings) List(ctx context.Context, opts metav1.ListOptions) (*rbacv1.ClusterRoleBindingList, error) {
+	return retried(ctx, c.retrier, "list", "clusterrolebindings", func() (*rbacv1.ClusterRoleBindingList, error) { return c.ClusterRoleBindingInterface.List(ctx, opts) })
+}
+
+func (c *retryingClusterRoleBindings) Create(ctx context.Context, obj *rbacv1.ClusterRoleBinding, opts metav1.CreateOptions) (*rbacv1.ClusterRoleBinding, error) {
+	return retriedCreate(ctx, c.retrier, "clusterrolebindings", func() (*rbacv1.ClusterRoleBinding, error) {
+		return c.ClusterRoleBindingInterface.Create(ctx, obj, opts)
+	}, func() (*rbacv1.ClusterRoleBinding, error) {
+		return c.Get(ctx, obj.Name, metav1.GetOptions{})
+	})
+}
+
+func (c *retryingClusterRoleBindings) Update(ctx context.Context, obj *rbacv1.ClusterRoleBinding, opts metav1.UpdateOptions) (*rbacv1.ClusterRoleBinding, error) {
+	return retried(ctx, c.retrier, "update", "clusterrolebindings", func() (*rbacv1.ClusterRoleBinding, error) {
+		return c.ClusterRoleBindingInterface.Update(ctx, obj, opts)
+	})
+}
+
+func (c *retryingClusterRoleBindings) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return retriedDelete(ctx, c.retrier, "clusterrolebindings", func() error { return c.ClusterRoleBindingInterface.Delete(ctx, name, opts) })
+}
+
+func (c *retryingClusterRoleBindings) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*rbacv1.ClusterRoleBinding, error) {
+	if !idempotentPatch(pt) {
+		return c.ClusterRoleBindingInterface.Patch(ctx, name, pt, data, opts, subresources...)
+	}
+	return retried(ctx, c.retrier, "patch", "clusterrolebindings", func() (*rbacv1.ClusterRoleBinding, error) {
+		return c.ClusterRoleBindingInterface.Patch(ctx, name, pt, data, opts, subresources...)
+	})
+}
+
+type retryingCertificateSigningRequests struct {
+	certificatesv1client.CertificateSigningRequestInterface
+	*retrier
+}
+
+func (c *retryingCertificateSigningRequests) Get(ctx context.Context, name string, opts metav1.GetOptions) (*certificatesv1.CertificateSigningRequest, error) {
+	return retried(ctx, c.retrier, "get", "certificatesigningrequests", func() (*certificatesv1.CertificateSigningRequest, error) {
+		return c.CertificateSigningRequestInterface.Get(ctx, name, opts)
+	})
+}
+
+func (c *retryingCertificateSigningRequests) List(ctx context.Context, opts metav1.ListOptions) (*certificatesv1.CertificateSigningRequestList, error) {
+	return retried(ctx, c.retrier, "list", "certificatesigningrequests", func() (*certificatesv1.CertificateSigningRequestList, error) {
+		return c.CertificateSigningRequestInterface.List(ctx, opts)
+	})
+}
+
+func (c *retryingCertificateSigningRequests) Create(ctx context.Context, obj *certificatesv1.CertificateSigningRequest, opts metav1.CreateOptions) (*certificatesv1.CertificateSigningRequest, error) {
+	return retriedCreate(ctx, c.retrier, "certificatesigningrequests", func() (*certificatesv1.CertificateSigningRequest, error) {
+		return c.CertificateSigningRequestInterface.Create(ctx, obj, opts)
+	}, func() (*certificatesv1.CertificateSigningRequest, error) {
+		return c.Get(ctx, obj.Name, metav1.GetOptions{})
+	})
+}
+
+func (c *retryingCertificateSigningRequests) Update(ctx context.Context, obj *certificatesv1.CertificateSigningRequest, opts metav1.UpdateOptions) (*certificatesv1.CertificateSigningRequest, error) {
+	return retried(ctx, c.retrier, "update", "certificatesigningrequests", func() (*certificatesv1.CertificateSigningRequest, error) {
+		return c.CertificateSigningRequestInterface.Update(ctx, obj, opts)
+	})
+}
+
+func (c *retryingCertificateSigningRequests) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return retriedDelete(ctx, c.retrier, "certificatesigningrequests", func() error { return c.CertificateSigningRequestInterface.Delete(ctx, name, opts) })
+}
+
+func (c *retryingCertificateSigningRequests) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*certificatesv1.CertificateSigningRequest, error) {
+	if !idempotentPatch(pt) {
+		return c.CertificateSigningRequestInterface.Patch(ctx, name, pt, data, opts, subresources...)
+	}
+	return retried(ctx, c.retrier, "patch", "certificatesigningrequests", func() (*certificatesv1.CertificateSigningRequest, error) {
+		return c.CertificateSigningRequestInterface.Patch(ctx, name, pt, data, opts, subresources...)
+	})
+}
+
+func (c *retryingCertificateSigningRequests) UpdateApproval(ctx context.Context, name string, csr *certificatesv1.CertificateSigningRequest, opts metav1.UpdateOptions) (*certificatesv1.CertificateSigningRequest, error) {
+	return retried(ctx, c.retrier, "update", "certificatesigningrequests/approval", func() (*certificatesv1.CertificateSigningRequest, error) {
+		return c.CertificateSigningRequestInterface.UpdateApproval(ctx, name, csr, opts)
+	})
+}
+
+type retryingDeployments struct {
+	appsv1client.DeploymentInterface
+	*retrier
+}
+
+func (c *retryingDeployments) Get(ctx context.Context, name string, opts metav1.GetOptions) (*appsv1.Deployment, error) {
+	return retried(ctx, c.retrier, "get", "deployments", func() (*appsv1.Deployment, error) { return c.DeploymentInterface.Get(ctx, name, opts) })
+}
+
+func (c *retryingDeployments) List(ctx context.Context, opts metav1.ListOptions) (*appsv1.DeploymentList, error) {
+	return retried(ctx, c.retrier, "list", "deployments", func() (*appsv1.DeploymentList, error) { return c.DeploymentInterface.List(ctx, opts) })
+}
+
+func (c *retryingDeployments) Create(ctx context.Context, obj *appsv1.Deployment, opts metav1.CreateOptions) (*appsv1.Deployment, error) {
+	return retriedCreate(ctx, c.retrier, "deployments", func() (*appsv1.Deployment, error) {
+		return c.DeploymentInterface.Create(ctx, obj, opts)
+	}, func() (*appsv1.Deployment, error) {
+		return c.Get(ctx, obj.Name, metav1.GetOptions{})
+	})
+}
+
+func (c *retryingDeployments) Update(ctx context.Context, obj *appsv1.Deployment, opts metav1.UpdateOptions) (*appsv1.Deployment, error) {
+	return retried(ctx, c.retrier, "update", "deployments", func() (*appsv1.Deployment, error) { return c.DeploymentInterface.Update(ctx, obj, opts) })
+}
+
+func (c *retryingDeployments) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return retriedDelete(ctx, c.retrier, "deployments", func() error { return c.DeploymentInterface.Delete(ctx, name, opts) })
+}
+
+func (c *retryingDeployments) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*appsv1.Deployment, error) {
+	if !idempotentPatch(pt) {
+		return c.DeploymentInterface.Patch(ctx, name, pt, data, opts, subresources...)
+	}
+	return retried(ctx, c.retrier, "patch", "deployments", func() (*appsv1.Deployment, error) {
+		return c.DeploymentInterface.Patch(ctx, name, pt, data, opts, subresources...)
+	})
+}
+
+type retryingStatefulSets struct {
+	appsv1client.StatefulSetInterface
+	*retrier
+}
+
+func (c *retryingStatefulSets) Get(ctx context.Context, name string, opts metav1.GetOptions) (*appsv1.StatefulSet, error) {
+	return retried(ctx, c.retrier, "get", "statefulsets", func() (*appsv1.StatefulSet, error) { return c.StatefulSetInterface.Get(ctx, name, opts) })
+}
+
+func (c *retryingStatefulSets) List(ctx context.Context, opts metav1.ListOptions) (*appsv1.StatefulSetList, error) {
+	return retried(ctx, c.retrier, "list", "statefulsets", func() (*appsv1.StatefulSetList, error) { return c.StatefulSetInterface.List(ctx, opts) })
+}
+
+func (c *retryingStatefulSets) Create(ctx context.Context, obj *appsv1.StatefulSet, opts metav1.CreateOptions) (*appsv1.StatefulSet, error) {
+	return retriedCreate(ctx, c.retrier, "statefulsets", func() (*appsv1.StatefulSet, error) {
+		return c.StatefulSetInterface.Create(ctx, obj, opts)
+	}, func() (*appsv1.StatefulSet, error) {
+		return c.Get(ctx, obj.Name, metav1.GetOptions{})
+	})
+}
+
+func (c *retryingStatefulSets) Update(ctx context.Context, obj *appsv1.StatefulSet, opts metav1.UpdateOptions) (*appsv1.StatefulSet, error) {
+	return retried(ctx, c.retrier, "update", "statefulsets", func() (*appsv1.StatefulSet, error) { return c.StatefulSetInterface.Update(ctx, obj, opts) })
+}
+
+func (c *retryingStatefulSets) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return retriedDelete(ctx, c.retrier, "statefulsets", func() error { return c.StatefulSetInterface.Delete(ctx, name, opts) })
+}
+
+func (c *retryingStatefulSets) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*appsv1.StatefulSet, error) {
+	if !idempotentPatch(pt) {
+		return c.StatefulSetInterface.Patch(ctx, name, pt, data, opts, subresources...)
+	}
+	return retried(ctx, c.retrier, "patch", "statefulsets", func() (*appsv1.StatefulSet, error) {
+		return c.StatefulSetInterface.Patch(ctx, name, pt, data, opts, subresources...)
+	})
+}
+
+type retryingDiscovery struct {
+	discovery.DiscoveryInterface
+	*retrier
+}
+
+func (c *retryingDiscovery) ServerVersion() (*version.Info, error) {
+	return c.serverVersion(context.Background())
+}
+
+func (c *retryingDiscovery) ServerResourcesForGroupVersion(groupVersion string) (*metav1.APIResourceList, error) {
+	return c.serverResourcesForGroupVersion(context.Background(), groupVersion)
+}
+
+func (c *retryingDiscovery) serverVersion(ctx context.Context) (*version.Info, error) {
+	return retried(ctx, c.retrier, "get", "version", c.DiscoveryInterface.ServerVersion)
+}
+
+func (c *retryingDiscovery) serverResourcesForGroupVersion(ctx context.Context, groupVersion string) (*metav1.APIResourceList, error) {
+	return retried(ctx, c.retrier, "get", groupVersion, func() (*metav1.APIResourceList, error) {
+		return c.DiscoveryInterface.ServerResourcesForGroupVersion(groupVersion)
+	})
+}
+
+// serverVersion returns the version of the api server. The discovery client doesn't take a context, so the retries of
+// a retrying client are stopped with the given one instead.
+func serverVersion(ctx context.Context, d discovery.DiscoveryInterface) (*version.Info, error) {
+	if r, ok := d.(*retryingDiscovery); ok {
+		return r.serverVersion(ctx)
+	}
+	return d.ServerVersion()
+}
+
+// serverResourcesForGroupVersion returns the resources served for the group version, see serverVersion.
+func serverResourcesForGroupVersion(ctx context.Context, d discovery.DiscoveryInterface, groupVersion string) (*metav1.APIResourceList, error) {
+	if r, ok := d.(*retryingDiscovery); ok {
+		return r.serverResourcesForGroupVersion(ctx, groupVersion)
+	}
+	return d.ServerResourcesForGroupVersion(groupVersion)
+}
+
+type retryingNamespaceableResource struct {
+	dynamic.NamespaceableResourceInterface
+	*retrier
+	resource string
+}
+
+func (c *retryingNamespaceableResource) Namespace(namespace string) dynamic.ResourceInterface {
+	return &retryingResource{ResourceInterface: c.NamespaceableResourceInterface.Namespace(namespace), retrier: c.retrier, resource: c.resource}
+}
+
+func (c *retryingNamespaceableResource) Get(ctx context.Context, name string, opts metav1.GetOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	return retried(ctx, c.retrier, "get", c.resource, func() (*unstructured.Unstructured, error) {
+		return c.NamespaceableResourceInterface.Get(ctx, name, opts, subresources...)
+	})
+}
+
+func (c *retryingNamespaceableResource) List(ctx context.Context, opts metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	return retried(ctx, c.retrier, "list", c.resource, func() (*unstructured.UnstructuredList, error) {
+		return c.NamespaceableResourceInterface.List(ctx, opts)
+	})
+}
+
+func (c *retryingNamespaceableResource) Create(ctx context.Context, obj *unstructured.Unstructured, opts metav1.CreateOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	return retriedCreate(ctx, c.retrier, c.resource, func() (*unstructured.Unstructured, error) {
+		return c.NamespaceableResourceInterface.Create(ctx, obj, opts, subresources...)
+	}, func() (*unstructured.Unstructured, error) {
+		return c.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	})
+}
+
+func (c *retryingNamespaceableResource) Update(ctx context.Context, obj *unstructured.Unstructured, opts metav1.UpdateOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	return retried(ctx, c.retrier, "update", c.resource, func() (*unstructured.Unstructured, error) {
+		return c.NamespaceableResourceInterface.Update(ctx, obj, opts, subresources...)
+	})
+}
+
+func (c *retryingNamespaceableResource) Delete(ctx context.Context, name string, opts metav1.DeleteOptions, subresources ...string) error {
+	return retriedDelete(ctx, c.retrier, c.resource, func() error { return c.NamespaceableResourceInterface.Delete(ctx, name, opts, subresources...) })
+}
+
+func (c *retryingNamespaceableResource) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	if !idempotentPatch(pt) {
+		return c.NamespaceableResourceInterface.Patch(ctx, name, pt, data, opts, subresources...)
+	}
+	return retried(ctx, c.retrier, "patch", c.resource, func() (*unstructured.Unstructured, error) {
+		return c.NamespaceableResourceInterface.Patch(ctx, name, pt, data, opts, subresources...)
+	})
+}
+
+type retryingResource struct {
+	dynamic.ResourceInterface
+	*retrier
+	resource string
+}
+
+func (c *retryingResource) Get(ctx context.Context, name string, opts metav1.GetOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	return retried(ctx, c.retrier, "get", c.resource, func() (*unstructured.Unstructured, error) {
+		return c.ResourceInterface.Get(ctx, name, opts, subresources...)
+	})
+}
+
+func (c *retryingResource) List(ctx context.Context, opts metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	return retried(ctx, c.retrier, "list", c.resource, func() (*unstructured.UnstructuredList, error) { return c.ResourceInterface.List(ctx, opts) })
+}
+
+func (c *retryingResource) Create(ctx context.Context, obj *unstructured.Unstructured, opts metav1.CreateOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	return retriedCreate(ctx, c.retrier, c.resource, func() (*unstructured.Unstructured, error) {
+		return c.ResourceInterface.Create(ctx, obj, opts, subresources...)
+	}, func() (*unstructured.Unstructured, error) {
+		return c.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	})
+}
+
+func (c *retryingResource) Update(ctx context.Context, obj *unstructured.Unstructured, opts metav1.UpdateOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	return retried(ctx, c.retrier, "update", c.resource, func() (*unstructured.Unstructured, error) {
+		return c.ResourceInterface.Update(ctx, obj, opts, subresources...)
+	})
+}
+
+func (c *retryingResource) Delete(ctx context.Context, name string, opts metav1.DeleteOptions, subresources ...string) error {
+	return retriedDelete(ctx, c.retrier, c.resource, func() error { return c.ResourceInterface.Delete(ctx, name, opts, subresources...) })
+}
+
+func (c *retryingResource) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	if !idempotentPatch(pt) {
+		return c.ResourceInterface.Patch(ctx, name, pt, data, opts, subresources...)
+	}
+	return retried(ctx, c.retrier, "patch", c.resource, func() (*unstructured.Unstructured, error) {
+		return c.ResourceInterface.Patch(ctx, name, pt, data, opts, subresources...)
+	})
+}
@@ -0,0 +1,240 @@
+package common
+
+import (
+	"context"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// withClientOptions sets the client options for the duration of the test.
+func withClientOptions(t *testing.T, opts ClientOptions) {
+	defaultOptions := clientOptions
+	t.Cleanup(func() { clientOptions = defaultOptions })
+	require.NoError(t, ConfigureClients(opts))
+}
+
+// failingReactor fails the first calls of the verb on the resource with the error, and counts all the calls.
+func failingReactor(clientset *fake.Clientset, verb, resource string, failures int, err error) *int {
+	calls := 0
+	clientset.PrependReactor(verb, resource, func(action k8stesting.Action) (bool, runtime.Object, error) {
+		calls++
+		if calls <= failures {
+			return true, nil, err
+		}
+		return false, nil, nil
+	})
+	return &calls
+}
+
+func TestIsRetriable(t *testing.T) {
+	resource := schema.GroupResource{Resource: "secrets"}
+	connectionReset := &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+
+	for name, tc := range map[string]struct {
+		err       error
+		retriable bool
+	}{
+		"connection reset":    {err: connectionReset, retriable: true},
+		"internal error":      {err: errors.NewInternalError(assert.AnError), retriable: true},
+		"service unavailable": {err: errors.NewServiceUnavailable("unavailable"), retriable: true},
+		"not implemented":     {err: errors.NewGenericServerResponse(501, "get", resource, "config", "", 0, false), retriable: false},
+		"throttled":           {err: errors.NewTooManyRequests("throttled", 1), retriable: true},
+		"conflict":            {err: errors.NewConflict(resource, "config", assert.AnError), retriable: false},
+		"already exists":      {err: errors.NewAlreadyExists(resource, "config"), retriable: false},
+		"not found":           {err: errors.NewNotFound(resource, "config"), retriable: false},
+		"other error":         {err: assert.AnError, retriable: false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.retriable, isRetriable(tc.err))
+		})
+	}
+}
+
+func TestRetryingKubeClient(t *testing.T) {
+	ctx := context.Background()
+	withClientOptions(t, ClientOptions{QPS: DefaultQPS, Burst: DefaultBurst, Retries: 3, RetryBackoff: time.Millisecond})
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "mongodb"}}
+	unavailable := errors.NewServiceUnavailable("unavailable")
+
+	newClient := func() (KubeClient, *fake.Clientset) {
+		clientset := fake.NewSimpleClientset(secret.DeepCopy())
+		return NewRetryingKubeClient("central", NewKubeClientContainer(nil, clientset, nil)), clientset
+	}
+
+	t.Run("reads are retried", func(t *testing.T) {
+		c, clientset := newClient()
+		calls := failingReactor(clientset, "get", "secrets", 2, unavailable)
+		_, err := c.CoreV1().Secrets("mongodb").Get(ctx, "config", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, 3, *calls)
+	})
+
+	t.Run("updates are retried", func(t *testing.T) {
+		c, clientset := newClient()
+		calls := failingReactor(clientset, "update", "secrets", 1, unavailable)
+		_, err := c.CoreV1().Secrets("mongodb").Update(ctx, secret, metav1.UpdateOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, 2, *calls)
+	})
+
+	t.Run("out of retries", func(t *testing.T) {
+		c, clientset := newClient()
+		calls := failingReactor(clientset, "delete", "secrets", 5, unavailable)
+		err := c.CoreV1().Secrets("mongodb").Delete(ctx, "config", metav1.DeleteOptions{})
+		assert.True(t, errors.IsServiceUnavailable(err))
+		assert.Equal(t, 4, *calls)
+	})
+
+	t.Run("deletes that succeeded on an earlier attempt", func(t *testing.T) {
+		c, clientset := newClient()
+		// the first attempt deletes the secret but its response is lost
+		calls := 0
+		clientset.PrependReactor("delete", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			calls++
+			if calls == 1 {
+				require.NoError(t, clientset.Tracker().Delete(schema.GroupVersionResource{Version: "v1", Resource: "secrets"}, "mongodb", "config"))
+				return true, nil, unavailable
+			}
+			return false, nil, nil
+		})
+		require.NoError(t, c.CoreV1().Secrets("mongodb").Delete(ctx, "config", metav1.DeleteOptions{}))
+		assert.Equal(t, 2, calls)
+
+		err := c.CoreV1().Secrets("mongodb").Delete(ctx, "config", metav1.DeleteOptions{})
+		assert.True(t, errors.IsNotFound(err), "objects that didn't exist before are still reported")
+	})
+
+	t.Run("creates are retried", func(t *testing.T) {
+		c, clientset := newClient()
+		calls := failingReactor(clientset, "create", "secrets", 1, unavailable)
+		_, err := c.CoreV1().Secrets("mongodb").Create(ctx, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "mongodb"}}, metav1.CreateOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, 2, *calls)
+	})
+
+	t.Run("creates that succeeded on an earlier attempt", func(t *testing.T) {
+		c, clientset := newClient()
+		// the first attempt creates the secret but its response is lost
+		calls := 0
+		clientset.PrependReactor("create", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			calls++
+			if calls == 1 {
+				obj := action.(k8stesting.CreateAction).GetObject()
+				require.NoError(t, clientset.Tracker().Create(schema.GroupVersionResource{Version: "v1", Resource: "secrets"}, obj, "mongodb"))
+				return true, nil, unavailable
+			}
+			return false, nil, nil
+		})
+		created, err := c.CoreV1().Secrets("mongodb").Create(ctx, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "mongodb"}}, metav1.CreateOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "other", created.Name)
+		assert.Equal(t, 2, calls)
+
+		_, err = c.CoreV1().Secrets("mongodb").Create(ctx, secret, metav1.CreateOptions{})
+		assert.True(t, errors.IsAlreadyExists(err), "objects that existed before are still reported")
+	})
+
+	t.Run("json patches are not retried", func(t *testing.T) {
+		c, clientset := newClient()
+		calls := failingReactor(clientset, "patch", "secrets", 1, unavailable)
+		_, err := c.CoreV1().Secrets("mongodb").Patch(ctx, "config", types.JSONPatchType, []byte(`[{"op":"add","path":"/metadata/labels","value":{}}]`), metav1.PatchOptions{})
+		assert.True(t, errors.IsServiceUnavailable(err))
+		assert.Equal(t, 1, *calls)
+
+		calls = failingReactor(clientset, "patch", "secrets", 1, unavailable)
+		_, err = c.CoreV1().Secrets("mongodb").Patch(ctx, "config", types.MergePatchType, []byte(`{"metadata":{"labels":{"a":"b"}}}`), metav1.PatchOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, 2, *calls)
+	})
+
+	t.Run("throttled requests are retried", func(t *testing.T) {
+		c, clientset := newClient()
+		calls := failingReactor(clientset, "list", "secrets", 2, errors.NewTooManyRequests("throttled", 0))
+		_, err := c.CoreV1().Secrets("mongodb").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, 3, *calls)
+	})
+
+	t.Run("conflicting patches are retried", func(t *testing.T) {
+		c, clientset := newClient()
+		calls := failingReactor(clientset, "patch", "secrets", 1, errors.NewConflict(schema.GroupResource{Resource: "secrets"}, "config", assert.AnError))
+		_, err := c.CoreV1().Secrets("mongodb").Patch(ctx, "config", types.MergePatchType, []byte(`{"metadata":{"labels":{"a":"b"}}}`), metav1.PatchOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, 2, *calls)
+	})
+
+	t.Run("conflicting updates are not retried", func(t *testing.T) {
+		c, clientset := newClient()
+		calls := failingReactor(clientset, "update", "secrets", 1, errors.NewConflict(schema.GroupResource{Resource: "secrets"}, "config", assert.AnError))
+		_, err := c.CoreV1().Secrets("mongodb").Update(ctx, secret, metav1.UpdateOptions{})
+		assert.True(t, errors.IsConflict(err))
+		assert.Equal(t, 1, *calls)
+	})
+}
+
+func TestRetryOnConflict_UsesTheClientOptions(t *testing.T) {
+	withClientOptions(t, ClientOptions{QPS: DefaultQPS, Burst: DefaultBurst, Retries: 2, RetryBackoff: time.Millisecond})
+	conflict := errors.NewConflict(schema.GroupResource{Resource: "secrets"}, "config", assert.AnError)
+
+	calls := 0
+	err := retryOnConflict(func() error {
+		calls++
+		return conflict
+	})
+	assert.True(t, errors.IsConflict(err))
+	assert.Equal(t, 3, calls)
+}
+
+func TestRetrier_StopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	r := &retrier{cluster: "central", retries: 3, backoff: time.Hour}
+
+	calls := 0
+	err := r.do(ctx, "get", "secrets", func() error {
+		calls++
+		return errors.NewServiceUnavailable("unavailable")
+	})
+	assert.True(t, errors.IsServiceUnavailable(err))
+	assert.Equal(t, 1, calls)
+}
+
+func TestRetryingDiscovery_StopsWhenCancelled(t *testing.T) {
+	withClientOptions(t, ClientOptions{QPS: DefaultQPS, Burst: DefaultBurst, Retries: 3, RetryBackoff: time.Hour})
+	clientset := fake.NewSimpleClientset()
+	calls := failingReactor(clientset, "get", "version", 5, errors.NewServiceUnavailable("unavailable"))
+	c := NewRetryingKubeClient("central", NewKubeClientContainer(nil, clientset, nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := serverVersion(ctx, c.Discovery())
+	assert.Error(t, err)
+	assert.Equal(t, 1, *calls)
+}
+
+func TestConfigureRestConfig(t *testing.T) {
+	withClientOptions(t, ClientOptions{QPS: 20, Burst: 30, RequestTimeout: time.Minute, Retries: 2, RetryBackoff: time.Millisecond})
+
+	config := configureRestConfig(&rest.Config{Host: "https://central"}, "central")
+	assert.Equal(t, float32(20), config.QPS)
+	assert.Equal(t, 30, config.Burst)
+	assert.Equal(t, time.Minute, config.Timeout)
+
+	assert.EqualError(t, ConfigureClients(ClientOptions{QPS: 1, Burst: 1, Retries: -1, RetryBackoff: time.Second}), "retries cannot be negative")
+	assert.EqualError(t, ConfigureClients(ClientOptions{QPS: 0, Burst: 1, RetryBackoff: time.Second}), "qps and burst must be positive")
+}
@@ -0,0 +1,223 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"golang.org/x/xerrors"
+)
+
+// OutputFormat is the format of the report written by setup, recover and debug once they are done.
+type OutputFormat string
+
+const (
+	// OutputText prints free-form progress and no report.
+	OutputText OutputFormat = ""
+	OutputJSON OutputFormat = "json"
+	OutputYAML OutputFormat = "yaml"
+)
+
+// ParseOutputFormat returns the output format with the given name.
+func ParseOutputFormat(name string) (OutputFormat, error) {
+	switch format := OutputFormat(strings.ToLower(name)); format {
+	case OutputText, OutputJSON, OutputYAML:
+		return format, nil
+	}
+	return OutputText, xerrors.Errorf("unknown output format %q, expected one of json, yaml", name)
+}
+
+// ArtifactType is the type of something a command generated that automation wrapping it might need.
+type ArtifactType string
+
+const (
+	ArtifactKubeConfigSecret ArtifactType = "kubeconfig-secret"
+	ArtifactHelmValues       ArtifactType = "helm-values"
+	ArtifactManifest         ArtifactType = "manifest"
+	ArtifactDebugBundle      ArtifactType = "debug-bundle"
+	ArtifactDebugDirectory   ArtifactType = "debug-directory"
+)
+
+// Artifact is an object created in a cluster or a file written to disk by a command.
+type Artifact struct {
+	Type      ArtifactType `json:"type"`
+	Cluster   string       `json:"cluster,omitempty"`
+	Namespace string       `json:"namespace,omitempty"`
+	Name      string       `json:"name,omitempty"`
+	Path      string       `json:"path,omitempty"`
+}
+
+// ReportedAction is what a command did to a single object.
+type ReportedAction struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	// Action is one of created, updated, unchanged and deleted.
+	Action string `json:"action"`
+}
+
+// ClusterRunReport holds the actions performed in a single cluster and the error the command failed with in it.
+type ClusterRunReport struct {
+	Name    string           `json:"name"`
+	Actions []ReportedAction `json:"actions"`
+	Error   string           `json:"error,omitempty"`
+}
+
+// RunReport is the machine-readable outcome of a command. When the command ran in dry-run mode the actions are the
+// ones that would have been performed. It is safe for concurrent use.
+type RunReport struct {
+	mu sync.Mutex
+
+	Command         string             `json:"command"`
+	Succeeded       bool               `json:"succeeded"`
+	DryRun          bool               `json:"dryRun,omitempty"`
+	StartTime       time.Time          `json:"startTime"`
+	EndTime         time.Time          `json:"endTime"`
+	DurationSeconds float64            `json:"durationSeconds"`
+	Clusters        []ClusterRunReport `json:"clusters"`
+	Warnings        []string           `json:"warnings,omitempty"`
+	Artifacts       []Artifact         `json:"artifacts,omitempty"`
+	Error           string             `json:"error,omitempty"`
+}
+
+// reportedActions are the names of the actions in the report.
+var reportedActions = map[ActionType]string{
+	ActionCreate:    "created",
+	ActionUpdate:    "updated",
+	ActionUnchanged: "unchanged",
+	ActionDelete:    "deleted",
+}
+
+var (
+	activeReportMu sync.Mutex
+	activeReport   *RunReport
+)
+
+// NewRunReport starts the report of the command. Warnings logged with Warnf from then on are added to it.
+func NewRunReport(command string) *RunReport {
+	r := &RunReport{Command: command, StartTime: time.Now(), Clusters: []ClusterRunReport{}}
+	activeReportMu.Lock()
+	activeReport = r
+	activeReportMu.Unlock()
+	return r
+}
+
+// Warnf logs a warning and adds it to the report of the running command, if any.
+func Warnf(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	logger.Warn(message)
+
+	activeReportMu.Lock()
+	r := activeReport
+	activeReportMu.Unlock()
+	if r != nil {
+		r.mu.Lock()
+		r.Warnings = append(r.Warnings, message)
+		r.mu.Unlock()
+	}
+}
+
+// SetClusters adds the central cluster and the member clusters to the report, in the order they are configured in.
+func (r *RunReport) SetClusters(f Flags) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, cluster := range allClusters(f) {
+		r.cluster(cluster)
+	}
+}
+
+// AddArtifact adds something the command generated to the report.
+func (r *RunReport) AddArtifact(artifact Artifact) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Artifacts = append(r.Artifacts, artifact)
+}
+
+// AddActions adds the actions recorded in the plan to the clusters they were performed in.
+func (r *RunReport) AddActions(plan *Plan) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, a := range plan.Actions() {
+		c := r.cluster(a.Cluster)
+		c.Actions = append(c.Actions, ReportedAction{Kind: a.Kind, Namespace: a.Namespace, Name: a.Name, Action: reportedActions[a.Action]})
+	}
+}
+
+// AddClusterError records an error that happened in a single cluster without failing the command.
+func (r *RunReport) AddClusterError(cluster string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := r.cluster(cluster)
+	if c.Error != "" {
+		c.Error += "; "
+	}
+	c.Error += err.Error()
+}
+
+// Fail records the error the command failed with. The errors of the individual clusters are taken from
+// *ClusterErrors, if the error wraps one.
+func (r *RunReport) Fail(err error) {
+	var clusterErrors *ClusterErrors
+	if errors.As(err, &clusterErrors) {
+		for cluster, clusterErr := range clusterErrors.Errors {
+			r.AddClusterError(cluster, clusterErr)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Error = err.Error()
+}
+
+// Finish records the end of the command and whether it succeeded.
+func (r *RunReport) Finish() {
+	activeReportMu.Lock()
+	if activeReport == r {
+		activeReport = nil
+	}
+	activeReportMu.Unlock()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.EndTime = time.Now()
+	r.DurationSeconds = r.EndTime.Sub(r.StartTime).Seconds()
+	r.Succeeded = r.Error == ""
+}
+
+// Write writes the report in the given format.
+func (r *RunReport) Write(w io.Writer, format OutputFormat) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var data []byte
+	var err error
+	switch format {
+	case OutputJSON:
+		data, err = json.MarshalIndent(r, "", "  ")
+		data = append(data, '\n')
+	case OutputYAML:
+		data, err = yaml.Marshal(r)
+	default:
+		return xerrors.Errorf("the report cannot be written as %q", format)
+	}
+	if err != nil {
+		return xerrors.Errorf("failed to marshal the report: %w", err)
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// cluster returns the report of the cluster, adding it if needed. It must be called with the lock held.
+func (r *RunReport) cluster(name string) *ClusterRunReport {
+	for i := range r.Clusters {
+		if r.Clusters[i].Name == name {
+			return &r.Clusters[i]
+		}
+	}
+	r.Clusters = append(r.Clusters, ClusterRunReport{Name: name, Actions: []ReportedAction{}})
+	return &r.Clusters[len(r.Clusters)-1]
+}
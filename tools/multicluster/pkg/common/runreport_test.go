@@ -0,0 +1,63 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+func TestParseOutputFormat(t *testing.T) {
+	for name, expected := range map[string]OutputFormat{"": OutputText, "json": OutputJSON, "YAML": OutputYAML} {
+		format, err := ParseOutputFormat(name)
+		require.NoError(t, err)
+		assert.Equal(t, expected, format)
+	}
+	_, err := ParseOutputFormat("table")
+	assert.EqualError(t, err, `unknown output format "table", expected one of json, yaml`)
+}
+
+func TestRunReport(t *testing.T) {
+	flags := Flags{CentralCluster: "central", MemberClusters: []string{"member-1", "central", "member-2"}}
+	report := NewRunReport("setup")
+	report.SetClusters(flags)
+
+	plan := NewPlan()
+	plan.record(PlannedAction{Cluster: "member-2", Kind: "Role", Namespace: "mongodb", Name: "operator", Action: ActionUpdate})
+	plan.record(PlannedAction{Cluster: "central", Kind: "Namespace", Name: "mongodb", Action: ActionCreate})
+	report.AddActions(plan)
+	report.AddArtifact(Artifact{Type: ArtifactKubeConfigSecret, Cluster: "central", Namespace: "mongodb", Name: KubeConfigSecretName})
+	Warnf("cluster %s is slow", "member-1")
+	report.Fail(xerrors.Errorf("failed creating service accounts: %w", &ClusterErrors{Errors: map[string]error{"member-1": xerrors.New("forbidden")}, Succeeded: []string{"central", "member-2"}}))
+	report.Finish()
+
+	// warnings are no longer added once the report is finished
+	Warnf("another warning")
+
+	assert.False(t, report.Succeeded)
+	assert.Equal(t, []string{"cluster member-1 is slow"}, report.Warnings)
+	assert.Equal(t, []ClusterRunReport{
+		{Name: "central", Actions: []ReportedAction{{Kind: "Namespace", Name: "mongodb", Action: "created"}}},
+		{Name: "member-1", Actions: []ReportedAction{}, Error: "forbidden"},
+		{Name: "member-2", Actions: []ReportedAction{{Kind: "Role", Namespace: "mongodb", Name: "operator", Action: "updated"}}},
+	}, report.Clusters)
+
+	buf := bytes.Buffer{}
+	require.NoError(t, report.Write(&buf, OutputJSON))
+	var fromJSON map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &fromJSON))
+	assert.Equal(t, "setup", fromJSON["command"])
+	assert.Equal(t, false, fromJSON["succeeded"])
+	assert.Contains(t, fromJSON["error"], "member-1: forbidden")
+	assert.Equal(t, []interface{}{map[string]interface{}{"type": "kubeconfig-secret", "cluster": "central", "namespace": "mongodb", "name": KubeConfigSecretName}}, fromJSON["artifacts"])
+
+	buf.Reset()
+	require.NoError(t, report.Write(&buf, OutputYAML))
+	var fromYAML map[string]interface{}
+	require.NoError(t, yaml.Unmarshal(buf.Bytes(), &fromYAML))
+	assert.Equal(t, fromJSON, fromYAML)
+}
@@ -0,0 +1,121 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"golang.org/x/xerrors"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	// MongoDBGVR is the resource of the MongoDB custom resources.
+	MongoDBGVR = schema.GroupVersionResource{Group: MongoDBGroup, Version: "v1", Resource: "mongodb"}
+	// OpsManagerGVR is the resource of the MongoDBOpsManager custom resources.
+	OpsManagerGVR = schema.GroupVersionResource{Group: MongoDBGroup, Version: "v1", Resource: "opsmanagers"}
+)
+
+// TeardownMultiCluster deletes everything setup created for the installation in the central and member clusters:
+// the operator's ServiceAccounts, Roles and ClusterRoles with their bindings, the database ServiceAccounts and Roles,
+// the KubeConfig secret and the member list ConfigMap. The namespaces are only deleted with deleteNamespaces, and only
+// if they were created by this tool for the installation. It refuses to run while the operator still manages
+// MongoDB, MongoDBMultiCluster or MongoDBOpsManager resources in the installation's namespaces, as they could no
+// longer be cleaned up by the operator.
+func TeardownMultiCluster(ctx context.Context, flags Flags, clientMap map[string]KubeClient, deleteNamespaces bool) error {
+	resources, err := getOperatorResources(ctx, clientMap[flags.CentralCluster], flags.clusterNamespaces(flags.CentralCluster))
+	if err != nil {
+		return err
+	}
+	if len(resources) > 0 {
+		return xerrors.Errorf("the operator still manages %s in cluster %s, delete them first", strings.Join(resources, ", "), flags.CentralCluster)
+	}
+
+	return forEachCluster(ctx, allClusters(flags), flags.Parallelism, func(ctx context.Context, cluster string) error {
+		c := clientMap[cluster]
+		namespaces := flags.clusterNamespaces(cluster)
+		for _, namespace := range namespaces {
+			for _, selector := range cleanupSelectors(flags) {
+				if err := cleanupClusterResources(ctx, c, cluster, namespace, selector); err != nil {
+					return xerrors.Errorf("failed cleaning up namespace %s in cluster %s: %w", namespace, cluster, err)
+				}
+				if err := deleteConfigMaps(ctx, c, cluster, namespace, selector); err != nil {
+					return xerrors.Errorf("failed cleaning up namespace %s in cluster %s: %w", namespace, cluster, err)
+				}
+			}
+		}
+
+		if !deleteNamespaces {
+			return nil
+		}
+		for _, namespace := range namespaces {
+			if err := deleteNamespace(ctx, c, flags, cluster, namespace); err != nil {
+				return xerrors.Errorf("failed deleting namespace %s in cluster %s: %w", namespace, cluster, err)
+			}
+		}
+		return nil
+	})
+}
+
+// getOperatorResources returns the MongoDB, MongoDBMultiCluster and MongoDBOpsManager resources in the namespaces.
+// Resources whose CRD isn't installed are skipped.
+func getOperatorResources(ctx context.Context, c KubeClient, namespaces []string) ([]string, error) {
+	var resources []string
+	for _, gvr := range []schema.GroupVersionResource{MongoDBGVR, MongoDBMultiClusterGVR, OpsManagerGVR} {
+		for _, namespace := range namespaces {
+			list, err := c.Resource(gvr).Namespace(namespace).List(ctx, metav1.ListOptions{})
+			if errors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return nil, xerrors.Errorf("failed listing %s in namespace %s: %w", gvr.Resource, namespace, err)
+			}
+			for _, item := range list.Items {
+				resources = append(resources, fmt.Sprintf("%s %s/%s", item.GetKind(), item.GetNamespace(), item.GetName()))
+			}
+		}
+	}
+	return resources, nil
+}
+
+// deleteConfigMaps deletes the ConfigMaps matching the label selector in the namespace.
+func deleteConfigMaps(ctx context.Context, c KubeClient, cluster, namespace, selector string) error {
+	configMaps, err := c.CoreV1().ConfigMaps(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return err
+	}
+	for _, cm := range configMaps.Items {
+		logger.Info("Deleting ConfigMap", "cluster", cluster, "namespace", cm.Namespace, "name", cm.Name)
+		if err := c.CoreV1().ConfigMaps(namespace).Delete(ctx, cm.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteNamespace deletes the namespace if it was created by this tool for the installation. Namespaces created by
+// older versions of this tool are only deleted with flags.AdoptLegacyObjects.
+func deleteNamespace(ctx context.Context, c KubeClient, flags Flags, cluster, namespace string) error {
+	ns, err := c.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	installation, ok := ns.Labels[InstallationLabel]
+	legacy := !ok && ns.Labels[LegacyLabel] == "true"
+	if installation != flags.installationID() && !(legacy && flags.AdoptLegacyObjects) {
+		logger.Info("Keeping namespace, it wasn't created for this installation", "cluster", cluster, "name", namespace)
+		return nil
+	}
+
+	logger.Info("Deleting Namespace", "cluster", cluster, "name", namespace)
+	if err := c.CoreV1().Namespaces().Delete(ctx, namespace, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package common
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestTeardownMultiCluster_DeletesEverythingSetupCreated(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	flags.InstallDatabaseRoles = true
+	flags.ClusterScoped = true
+	clientMap := setupWithMongoDBMultiClusters(ctx, t, flags)
+	namespacesBefore := map[string]int{}
+	for _, cluster := range allClusters(flags) {
+		namespaces, err := clientMap[cluster].CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		namespacesBefore[cluster] = len(namespaces.Items)
+	}
+
+	require.NoError(t, TeardownMultiCluster(ctx, flags, clientMap, false))
+
+	for _, cluster := range allClusters(flags) {
+		assertNoObjectsLeft(t, ctx, clientMap[cluster], flags)
+		namespaces, err := clientMap[cluster].CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		assert.Len(t, namespaces.Items, namespacesBefore[cluster], "namespaces are kept by default")
+	}
+
+	require.NoError(t, TeardownMultiCluster(ctx, flags, clientMap, true))
+
+	for _, cluster := range allClusters(flags) {
+		for _, namespace := range []string{flags.CentralClusterNamespace, flags.MemberClusterNamespace} {
+			_, err := clientMap[cluster].CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+			assert.True(t, errors.IsNotFound(err), "namespace %s in cluster %s should be deleted", namespace, cluster)
+		}
+	}
+}
+
+func TestTeardownMultiCluster_KeepsNamespacesNotCreatedForTheInstallation(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	clientMap := setupWithMongoDBMultiClusters(ctx, t, flags)
+	central := clientMap[flags.CentralCluster]
+	ns, err := central.CoreV1().Namespaces().Get(ctx, flags.CentralClusterNamespace, metav1.GetOptions{})
+	require.NoError(t, err)
+	ns.Labels = nil
+	_, err = central.CoreV1().Namespaces().Update(ctx, ns, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	require.NoError(t, TeardownMultiCluster(ctx, flags, clientMap, true))
+
+	_, err = central.CoreV1().Namespaces().Get(ctx, flags.CentralClusterNamespace, metav1.GetOptions{})
+	assert.NoError(t, err)
+	_, err = central.CoreV1().Namespaces().Get(ctx, flags.MemberClusterNamespace, metav1.GetOptions{})
+	assert.True(t, errors.IsNotFound(err))
+}
+
+func TestTeardownMultiCluster_DryRunOnlyPlansDeletions(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	clientMap := setupWithMongoDBMultiClusters(ctx, t, flags)
+
+	plan := NewPlan()
+	require.NoError(t, TeardownMultiCluster(ctx, flags, NewDryRunClientMap(clientMap, plan), true))
+
+	require.NotEmpty(t, plan.Actions())
+	for _, a := range plan.Actions() {
+		assert.Equal(t, ActionDelete, a.Action, "%s %s/%s", a.Kind, a.Namespace, a.Name)
+	}
+	assert.Contains(t, plan.Actions(), PlannedAction{Cluster: flags.CentralCluster, Kind: "Secret", Namespace: flags.CentralClusterNamespace, Name: KubeConfigSecretName, Action: ActionDelete})
+	assertMemberRolesExist(t, ctx, clientMap, flags)
+	_, err := readKubeConfig(ctx, clientMap[flags.CentralCluster], flags.CentralClusterNamespace)
+	assert.NoError(t, err)
+}
+
+func TestTeardownMultiCluster_RefusesWhileOperatorResourcesExist(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	clientMap := setupWithMongoDBMultiClusters(ctx, t, flags, "member-cluster-0")
+
+	err := TeardownMultiCluster(ctx, flags, clientMap, true)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "MongoDBMultiCluster member-namespace/mdb-0")
+
+	_, err = readKubeConfig(ctx, clientMap[flags.CentralCluster], flags.CentralClusterNamespace)
+	assert.NoError(t, err, "nothing is deleted")
+}
+
+// assertNoObjectsLeft asserts that none of the objects created by this tool are left in the cluster.
+func assertNoObjectsLeft(t *testing.T, ctx context.Context, c KubeClient, flags Flags) {
+	listOpts := metav1.ListOptions{LabelSelector: LegacyLabel + "=true"}
+	for _, namespace := range []string{flags.CentralClusterNamespace, flags.MemberClusterNamespace} {
+		secrets, err := c.CoreV1().Secrets(namespace).List(ctx, listOpts)
+		require.NoError(t, err)
+		assert.Empty(t, secrets.Items)
+		configMaps, err := c.CoreV1().ConfigMaps(namespace).List(ctx, listOpts)
+		require.NoError(t, err)
+		assert.Empty(t, configMaps.Items)
+		serviceAccounts, err := c.CoreV1().ServiceAccounts(namespace).List(ctx, listOpts)
+		require.NoError(t, err)
+		assert.Empty(t, serviceAccounts.Items)
+		roles, err := c.RbacV1().Roles(namespace).List(ctx, listOpts)
+		require.NoError(t, err)
+		assert.Empty(t, roles.Items)
+		roleBindings, err := c.RbacV1().RoleBindings(namespace).List(ctx, listOpts)
+		require.NoError(t, err)
+		assert.Empty(t, roleBindings.Items)
+	}
+	clusterRoles, err := c.RbacV1().ClusterRoles().List(ctx, listOpts)
+	require.NoError(t, err)
+	assert.Empty(t, clusterRoles.Items)
+	clusterRoleBindings, err := c.RbacV1().ClusterRoleBindings().List(ctx, listOpts)
+	require.NoError(t, err)
+	assert.Empty(t, clusterRoleBindings.Items)
+}
+
+func TestTeardownMultiCluster_KeepsTheClusterRolesOfOtherInstallations(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	flags.ClusterScoped = true
+	clientMap := setupWithMongoDBMultiClusters(ctx, t, flags)
+
+	other := flags
+	other.OperatorName = "other-operator"
+	other.InstallationID = "other-installation"
+	other.ServiceAccount = "other-operator-multicluster"
+	other.CentralClusterNamespace = "other-central-namespace"
+	other.MemberClusterNamespace = "other-member-namespace"
+	require.NoError(t, EnsureMultiClusterResources(ctx, other, clientMap))
+
+	require.NoError(t, TeardownMultiCluster(ctx, other, clientMap, false))
+
+	for _, cluster := range allClusters(flags) {
+		c := clientMap[cluster]
+		clusterRole := buildMemberEntityClusterRole(flags)
+		if cluster == flags.CentralCluster {
+			clusterRole = buildCentralEntityClusterRole(flags)
+		}
+		for _, name := range []string{clusterRole.Name, buildClusterRoleTelemetry(flags).Name} {
+			live, err := c.RbacV1().ClusterRoles().Get(ctx, name, metav1.GetOptions{})
+			require.NoError(t, err, "cluster role %s in cluster %s", name, cluster)
+			assert.Equal(t, flags.installationID(), live.Labels[InstallationLabel])
+		}
+		bindingNames := []string{
+			flags.clusterScopedName("mongodb-enterprise-operator-multi-cluster-role-binding"),
+			flags.clusterScopedName("mongodb-enterprise-operator-multi-telemetry-cluster-role-binding"),
+		}
+		for _, name := range bindingNames {
+			binding, err := c.RbacV1().ClusterRoleBindings().Get(ctx, name, metav1.GetOptions{})
+			require.NoError(t, err, "cluster role binding %s in cluster %s", name, cluster)
+			assert.Equal(t, flags.installationID(), binding.Labels[InstallationLabel])
+			require.Len(t, binding.Subjects, 1)
+			assert.Equal(t, flags.ServiceAccount, binding.Subjects[0].Name)
+			assert.Equal(t, flags.CentralClusterNamespace, binding.Subjects[0].Namespace)
+		}
+
+		listOpts := metav1.ListOptions{LabelSelector: installationSelector(other)}
+		clusterRoles, err := c.RbacV1().ClusterRoles().List(ctx, listOpts)
+		require.NoError(t, err)
+		assert.Empty(t, clusterRoles.Items)
+		clusterRoleBindings, err := c.RbacV1().ClusterRoleBindings().List(ctx, listOpts)
+		require.NoError(t, err)
+		assert.Empty(t, clusterRoleBindings.Items)
+	}
+}
@@ -0,0 +1,167 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// RootCAConfigMapName is the ConfigMap published by Kubernetes in every namespace, holding the CA bundle
+	// used to verify the API server.
+	RootCAConfigMapName = "kube-root-ca.crt"
+	RootCAConfigMapKey  = "ca.crt"
+
+	// MinTokenExpiry is the shortest expiry accepted by the TokenRequest API.
+	MinTokenExpiry = 10 * time.Minute
+)
+
+// TokenExpiries holds the expiry of the token minted in every member cluster.
+type TokenExpiries map[string]time.Time
+
+// Print writes the expiry of every token, sorted by cluster name.
+func (e TokenExpiries) Print(w io.Writer) {
+	var clusters []string
+	for cluster := range e {
+		clusters = append(clusters, cluster)
+	}
+	sort.Strings(clusters)
+	for _, cluster := range clusters {
+		_, _ = fmt.Fprintf(w, "  %s: token expires at %s\n", cluster, e[cluster].Format(time.RFC3339))
+	}
+}
+
+// requestAllMemberClusterServiceAccountTokens mints a token for the operator's ServiceAccount in every member cluster
+// using the TokenRequest API. The tokens are returned in the same shape as the legacy token Secrets, so they can be
+// passed to createKubeConfigFromServiceAccountTokens.
+func requestAllMemberClusterServiceAccountTokens(ctx context.Context, clientSetMap map[string]KubeClient, flags Flags) (map[string]corev1.Secret, TokenExpiries, error) {
+	allSecrets := map[string]corev1.Secret{}
+	expiries := TokenExpiries{}
+	mu := sync.Mutex{}
+
+	err := forEachCluster(ctx, flags.MemberClusters, flags.Parallelism, func(ctx context.Context, cluster string) error {
+		secret, expiry, err := requestServiceAccountToken(ctx, clientSetMap[cluster], cluster, flags)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		allSecrets[cluster] = secret
+		expiries[cluster] = expiry
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return allSecrets, expiries, nil
+}
+
+// requestServiceAccountToken mints a token for the operator's ServiceAccount in the cluster and returns it together
+// with the CA of the cluster.
+func requestServiceAccountToken(ctx context.Context, c KubeClient, cluster string, flags Flags) (corev1.Secret, time.Time, error) {
+	namespace, serviceAccount := flags.serviceAccountFor(cluster)
+	tokenRequest := &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{
+			ExpirationSeconds: ptr.To(int64(flags.TokenExpiry.Seconds())),
+		},
+	}
+	tokenRequest, err := c.CoreV1().ServiceAccounts(namespace).CreateToken(ctx, serviceAccount, tokenRequest, metav1.CreateOptions{})
+	if err != nil {
+		return corev1.Secret{}, time.Time{}, xerrors.Errorf("failed requesting token for service account %s/%s: %w", namespace, serviceAccount, err)
+	}
+
+	ca, err := getClusterCA(ctx, c, namespace)
+	if err != nil {
+		if !flags.DryRun {
+			return corev1.Secret{}, time.Time{}, err
+		}
+		ca = []byte("<ca.crt of the cluster>")
+	}
+
+	secret := corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      serviceAccount,
+			Namespace: namespace,
+		},
+		Data: map[string][]byte{
+			"ca.crt": ca,
+			"token":  []byte(tokenRequest.Status.Token),
+		},
+	}
+	return secret, tokenRequest.Status.ExpirationTimestamp.Time, nil
+}
+
+// getClusterCA returns the CA bundle of the cluster's API server from the ConfigMap Kubernetes publishes in every
+// namespace.
+func getClusterCA(ctx context.Context, c KubeClient, namespace string) ([]byte, error) {
+	cm, err := c.CoreV1().ConfigMaps(namespace).Get(ctx, RootCAConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		return nil, xerrors.Errorf("failed getting the cluster CA from configmap %s/%s: %w", namespace, RootCAConfigMapName, err)
+	}
+	ca, ok := cm.Data[RootCAConfigMapKey]
+	if !ok {
+		return nil, xerrors.Errorf("key '%s' missing from configmap %s/%s", RootCAConfigMapKey, namespace, RootCAConfigMapName)
+	}
+	return []byte(ca), nil
+}
+
+// checkRotatable returns an error if the operator authenticates to the member clusters with client certificates. Its
+// roles are bound to the user of the certificates, so it would have no permissions with ServiceAccount tokens.
+func checkRotatable(kubeConfig KubeConfigFile, flags Flags) error {
+	usesCertificates := flags.ClientCertificateAuth
+	for _, item := range kubeConfig.Users {
+		usesCertificates = usesCertificates || len(item.User.ClientCertificateData) > 0
+	}
+	if usesCertificates {
+		return xerrors.Errorf("the operator authenticates to the member clusters with client certificates, which rotate-credentials can't replace with ServiceAccount tokens; run recover with --client-certificate-auth to issue new certificates")
+	}
+	return nil
+}
+
+// RotateCredentials mints new tokens for the operator's ServiceAccount in all member clusters and replaces the
+// KubeConfig secret in the central cluster with a single write once all the tokens have been minted. The secret
+// is left untouched if minting fails in any cluster. The api servers, CAs and connection settings in the secret are
+// kept unless the flags override them.
+func RotateCredentials(ctx context.Context, flags Flags, clientMap map[string]KubeClient) (TokenExpiries, error) {
+	centralClusterClient := clientMap[flags.CentralCluster]
+	current, err := readKubeConfigSecret(ctx, centralClusterClient, flags)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRotatable(current, flags); err != nil {
+		return nil, err
+	}
+	flags.keepConnections(current)
+	if err := flags.keepApiServers(current); err != nil {
+		return nil, err
+	}
+
+	secrets, expiries, err := requestAllMemberClusterServiceAccountTokens(ctx, clientMap, flags)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to request service account tokens: %w", err)
+	}
+
+	kubeConfig, err := createKubeConfigFromServiceAccountTokens(secrets, flags)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to create kube config from service account tokens: %w", err)
+	}
+	if flags.CheckKubeConfig && !flags.DryRun {
+		if err := checkKubeConfigConnections(ctx, kubeConfig, flags.MemberClusters, flags, NewKubeClientForConfig); err != nil {
+			return nil, err
+		}
+	}
+	if err := writeKubeConfigSecret(ctx, centralClusterClient, kubeConfig, flags); err != nil {
+		return nil, err
+	}
+	return expiries, nil
+}
@@ -0,0 +1,175 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestEnsureMultiClusterResources_WithTokenExpiry_UsesRequestedTokens(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	flags.TokenExpiry = time.Hour
+	clientMap := getClientResources(ctx, flags)
+	addTokenRequestSupport(ctx, t, clientMap, flags)
+
+	require.NoError(t, EnsureMultiClusterResources(ctx, flags, clientMap))
+
+	kubeConfig, err := readKubeConfig(ctx, clientMap[flags.CentralCluster], flags.CentralClusterNamespace)
+	require.NoError(t, err)
+	for i, cluster := range flags.MemberClusters {
+		assert.Equal(t, fmt.Sprintf("ca.crt: %s", cluster), string(kubeConfig.Clusters[i].Cluster.CertificateAuthorityData))
+		assert.Contains(t, kubeConfig.Users[i].User.Token, fmt.Sprintf("requested token: %s", cluster))
+
+		_, err := clientMap[cluster].CoreV1().Secrets(flags.CentralClusterNamespace).Get(ctx, fmt.Sprintf("%s-token-secret", flags.ServiceAccount), metav1.GetOptions{})
+		assert.Error(t, err, "no legacy token secret should be created in cluster %s", cluster)
+	}
+}
+
+func TestRotateCredentials_ReplacesTokensInKubeConfig(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	clientMap := getClientResources(ctx, flags)
+	require.NoError(t, EnsureMultiClusterResources(ctx, flags, clientMap))
+	addTokenRequestSupport(ctx, t, clientMap, flags)
+
+	flags.TokenExpiry = 2 * time.Hour
+	expiries, err := RotateCredentials(ctx, flags, clientMap)
+	require.NoError(t, err)
+
+	kubeConfig, err := readKubeConfig(ctx, clientMap[flags.CentralCluster], flags.CentralClusterNamespace)
+	require.NoError(t, err)
+	require.Len(t, expiries, len(flags.MemberClusters))
+	for i, cluster := range flags.MemberClusters {
+		assert.Contains(t, kubeConfig.Users[i].User.Token, fmt.Sprintf("requested token: %s", cluster))
+		assert.WithinDuration(t, time.Now().Add(2*time.Hour), expiries[cluster], time.Minute)
+	}
+}
+
+func TestRotateCredentials_LeavesKubeConfigUntouched_WhenOneClusterFails(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	clientMap := getClientResources(ctx, flags)
+	require.NoError(t, EnsureMultiClusterResources(ctx, flags, clientMap))
+	addTokenRequestSupport(ctx, t, clientMap, flags)
+	before, err := readKubeConfig(ctx, clientMap[flags.CentralCluster], flags.CentralClusterNamespace)
+	require.NoError(t, err)
+
+	clientMap[flags.MemberClusters[2]].(*KubeClientContainer).staticClient.(*fake.Clientset).PrependReactor("create", "serviceaccounts", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("connection refused")
+	})
+
+	flags.TokenExpiry = time.Hour
+	_, err = RotateCredentials(ctx, flags, clientMap)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), flags.MemberClusters[2])
+
+	after, err := readKubeConfig(ctx, clientMap[flags.CentralCluster], flags.CentralClusterNamespace)
+	require.NoError(t, err)
+	assert.Equal(t, before, after)
+}
+
+func TestRotateCredentials_KeepsApiServersAndCAsFromKubeConfig(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	clientMap := getClientResources(ctx, flags)
+	ca := []byte("custom ca")
+	flags.ClusterConnections = map[string]ClusterConnection{flags.MemberClusters[0]: {CertificateAuthorityData: ca}}
+	flags.MemberClusterApiServerUrls = []string{"https://discovered-1:6443", "https://discovered-2:6443", "https://discovered-3:6443"}
+	require.NoError(t, EnsureMultiClusterResources(ctx, flags, clientMap))
+	addTokenRequestSupport(ctx, t, clientMap, flags)
+
+	// rotating without the flags setup was run with
+	flags.ClusterConnections = nil
+	flags.MemberClusterApiServerUrls = nil
+	flags.TokenExpiry = time.Hour
+	_, err := RotateCredentials(ctx, flags, clientMap)
+	require.NoError(t, err)
+
+	kubeConfig, err := readKubeConfig(ctx, clientMap[flags.CentralCluster], flags.CentralClusterNamespace)
+	require.NoError(t, err)
+	for i, cluster := range flags.MemberClusters {
+		assert.Equal(t, fmt.Sprintf("https://discovered-%d:6443", i+1), kubeConfig.Clusters[i].Cluster.Server)
+		assert.Contains(t, kubeConfig.Users[i].User.Token, fmt.Sprintf("requested token: %s", cluster))
+	}
+	assert.Equal(t, ca, kubeConfig.Clusters[0].Cluster.CertificateAuthorityData)
+}
+
+func TestRotateCredentials_RefusesClientCertificateAuth(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	clientMap := getClientResources(ctx, flags)
+	require.NoError(t, EnsureMultiClusterResources(ctx, flags, clientMap))
+	addTokenRequestSupport(ctx, t, clientMap, flags)
+
+	kubeConfig, err := readKubeConfig(ctx, clientMap[flags.CentralCluster], flags.CentralClusterNamespace)
+	require.NoError(t, err)
+	kubeConfig.Users[1].User = KubeConfigUser{ClientCertificateData: []byte("cert"), ClientKeyData: []byte("key")}
+	require.NoError(t, writeKubeConfigSecret(ctx, clientMap[flags.CentralCluster], kubeConfig, flags))
+
+	flags.TokenExpiry = time.Hour
+	_, err = RotateCredentials(ctx, flags, clientMap)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "run recover with --client-certificate-auth")
+
+	after, err := readKubeConfig(ctx, clientMap[flags.CentralCluster], flags.CentralClusterNamespace)
+	require.NoError(t, err)
+	assert.Equal(t, kubeConfig, after)
+}
+
+func TestRotateCredentials_RequiresKubeConfigSecret(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	flags.TokenExpiry = time.Hour
+	clientMap := getClientResources(ctx, flags)
+
+	_, err := RotateCredentials(ctx, flags, clientMap)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "run setup first")
+}
+
+// addRootCAConfigMaps publishes the CA of every cluster the same way Kubernetes does.
+func addRootCAConfigMaps(ctx context.Context, t *testing.T, clientMap map[string]KubeClient, flags Flags) {
+	for cluster, c := range clientMap {
+		_, err := c.CoreV1().ConfigMaps(flags.CentralClusterNamespace).Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: RootCAConfigMapName, Namespace: flags.CentralClusterNamespace},
+			Data:       map[string]string{RootCAConfigMapKey: fmt.Sprintf("ca.crt: %s", cluster)},
+		}, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+}
+
+// addTokenRequestSupport publishes the cluster CA and makes the fake clientsets mint tokens for existing
+// ServiceAccounts, which they don't support out of the box.
+func addTokenRequestSupport(ctx context.Context, t *testing.T, clientMap map[string]KubeClient, flags Flags) {
+	addRootCAConfigMaps(ctx, t, clientMap, flags)
+
+	var minted int32
+	for cluster, c := range clientMap {
+		clientset := c.(*KubeClientContainer).staticClient.(*fake.Clientset)
+		clientset.PrependReactor("create", "serviceaccounts", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			createAction := action.(k8stesting.CreateActionImpl)
+			if createAction.GetSubresource() != "token" {
+				return false, nil, nil
+			}
+			tokenRequest := createAction.GetObject().(*authenticationv1.TokenRequest).DeepCopy()
+			if _, err := clientset.Tracker().Get(action.GetResource(), action.GetNamespace(), createAction.Name); err != nil {
+				return true, nil, err
+			}
+			tokenRequest.Status.Token = fmt.Sprintf("requested token: %s %d", cluster, atomic.AddInt32(&minted, 1))
+			tokenRequest.Status.ExpirationTimestamp = metav1.NewTime(time.Now().Add(time.Duration(*tokenRequest.Spec.ExpirationSeconds) * time.Second))
+			return true, tokenRequest, nil
+		})
+	}
+}
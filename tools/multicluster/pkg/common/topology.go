@@ -0,0 +1,324 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"golang.org/x/xerrors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	TopologyApiVersion = "kubectl-mongodb/v1"
+	TopologyKind       = "MultiClusterTopology"
+
+	ScopeNamespace = "namespace"
+	ScopeCluster   = "cluster"
+)
+
+// Topology is the declarative description of a multi-cluster environment that can be passed with --config
+// instead of the individual flags.
+//
+// Example:
+//
+//	apiVersion: kubectl-mongodb/v1
+//	kind: MultiClusterTopology
+//	centralCluster:
+//	  context: operator-cluster
+//	  namespace: mongodb-operator
+//	memberClusterNamespace: mongodb
+//	memberClusterNamespaces: [team-a, team-b]
+//	memberClusters:
+//	  - name: cluster-1
+//	    context: gke_project_europe-west1_cluster-1
+//	    apiServer: https://35.1.2.3
+//	    tlsServerName: cluster-1.internal.example.com
+//	    proxyUrl: http://proxy.example.com:3128
+//	  - name: cluster-2
+//	    namespace: mongodb-us
+//	    serviceAccount: mongodb-operator-us
+//	serviceAccount: mongodb-enterprise-operator-multi-cluster
+//	scope: namespace
+//	databaseRoles:
+//	  install: true
+type Topology struct {
+	ApiVersion                  string                  `json:"apiVersion"`
+	Kind                        string                  `json:"kind"`
+	CentralCluster              TopologyCentralCluster  `json:"centralCluster"`
+	MemberClusters              []TopologyMemberCluster `json:"memberClusters"`
+	MemberClusterNamespace      string                  `json:"memberClusterNamespace,omitempty"`
+	MemberClusterNamespaces     []string                `json:"memberClusterNamespaces,omitempty"`
+	MemberNamespaceSelector     string                  `json:"memberNamespaceSelector,omitempty"`
+	ServiceAccount              string                  `json:"serviceAccount,omitempty"`
+	OperatorName                string                  `json:"operatorName,omitempty"`
+	InstallationID              string                  `json:"installationId,omitempty"`
+	Scope                       string                  `json:"scope,omitempty"`
+	CreateTelemetryRoles        *bool                   `json:"createTelemetryRoles,omitempty"`
+	CreateServiceAccountSecrets *bool                   `json:"createServiceAccountSecrets,omitempty"`
+	ImagePullSecrets            string                  `json:"imagePullSecrets,omitempty"`
+	DatabaseRoles               TopologyDatabaseRoles   `json:"databaseRoles,omitempty"`
+}
+
+type TopologyCentralCluster struct {
+	// Context is the kubeconfig context used to connect to the central cluster.
+	Context string `json:"context"`
+	// Namespace is the namespace the operator is deployed to.
+	Namespace string `json:"namespace"`
+}
+
+type TopologyMemberCluster struct {
+	// Name is the name of the cluster used by the operator, in the generated kubeconfig and in the clusterSpecList
+	// of MongoDBMultiCluster resources.
+	Name string `json:"name"`
+	// Context is the kubeconfig context used to connect to the cluster. It defaults to the name of the cluster.
+	Context string `json:"context,omitempty"`
+	// ApiServer is the address the operator uses to reach the cluster's API server. It defaults to the server of
+	// the context's cluster in the local kubeconfig.
+	ApiServer string `json:"apiServer,omitempty"`
+	// Namespace is the namespace the member cluster resources are deployed to. It defaults to memberClusterNamespace.
+	Namespace string `json:"namespace,omitempty"`
+	// ServiceAccount is the name of the operator's ServiceAccount in the cluster. It defaults to serviceAccount.
+	ServiceAccount string `json:"serviceAccount,omitempty"`
+	// ServiceAccountNamespace is the namespace of the operator's ServiceAccount in the cluster. It defaults to the
+	// namespace of the central cluster.
+	ServiceAccountNamespace string `json:"serviceAccountNamespace,omitempty"`
+	// TLSServerName is the name the certificate of the API server is checked against. It defaults to the host of
+	// apiServer.
+	TLSServerName string `json:"tlsServerName,omitempty"`
+	// ProxyURL is the proxy the operator connects to the API server through.
+	ProxyURL string `json:"proxyUrl,omitempty"`
+	// DisableCompression disables the compression of the responses of the API server.
+	DisableCompression bool `json:"disableCompression,omitempty"`
+	// CertificateAuthorityData is the base64 encoded PEM CA the certificate of the API server is checked against. It
+	// defaults to the CA of the cluster.
+	CertificateAuthorityData []byte `json:"certificateAuthorityData,omitempty"`
+}
+
+// connection returns the settings the operator connects to the member cluster with.
+func (m TopologyMemberCluster) connection() ClusterConnection {
+	return ClusterConnection{
+		TLSServerName:            m.TLSServerName,
+		ProxyURL:                 m.ProxyURL,
+		DisableCompression:       m.DisableCompression,
+		CertificateAuthorityData: m.CertificateAuthorityData,
+	}
+}
+
+// overrides returns the per-cluster overrides of the member cluster.
+func (m TopologyMemberCluster) overrides() ClusterOverrides {
+	return ClusterOverrides{
+		MemberNamespace:         m.Namespace,
+		ServiceAccountNamespace: m.ServiceAccountNamespace,
+		ServiceAccount:          m.ServiceAccount,
+	}
+}
+
+type TopologyDatabaseRoles struct {
+	// Install creates the ServiceAccounts and Roles required for running database workloads in the member clusters.
+	Install bool `json:"install,omitempty"`
+	// SourceCluster copies the database ServiceAccounts and Roles from the given healthy member cluster instead.
+	SourceCluster string `json:"sourceCluster,omitempty"`
+}
+
+// clusterNameRegex matches the names that can be used as a key in the member list ConfigMap.
+var clusterNameRegex = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+
+// LoadTopology reads and validates the topology file at the given path.
+func LoadTopology(path string) (Topology, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Topology{}, xerrors.Errorf("failed to read topology file %s: %w", path, err)
+	}
+
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return Topology{}, xerrors.Errorf("failed to parse topology file %s: %w", path, err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.DisallowUnknownFields()
+
+	t := Topology{}
+	if err := decoder.Decode(&t); err != nil {
+		return Topology{}, xerrors.Errorf("failed to parse topology file %s: %w", path, err)
+	}
+	if err := t.Validate(); err != nil {
+		return Topology{}, xerrors.Errorf("invalid topology file %s: %w", path, err)
+	}
+	return t, nil
+}
+
+// Validate returns an error listing every problem found in the topology.
+func (t Topology) Validate() error {
+	var problems []string
+	addProblem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if t.ApiVersion != TopologyApiVersion {
+		addProblem("apiVersion must be %q, got %q", TopologyApiVersion, t.ApiVersion)
+	}
+	if t.Kind != TopologyKind {
+		addProblem("kind must be %q, got %q", TopologyKind, t.Kind)
+	}
+	if t.CentralCluster.Context == "" {
+		addProblem("centralCluster.context is required")
+	}
+	if t.CentralCluster.Namespace == "" {
+		addProblem("centralCluster.namespace is required")
+	}
+	if t.MemberClusterNamespace == "" {
+		addProblem("memberClusterNamespace is required")
+	}
+	for i, namespace := range t.MemberClusterNamespaces {
+		if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+			addProblem("memberClusterNamespaces[%d] %q is not a valid namespace: %s", i, namespace, strings.Join(errs, ", "))
+		}
+	}
+	if t.MemberNamespaceSelector != "" {
+		if _, err := labels.Parse(t.MemberNamespaceSelector); err != nil {
+			addProblem("memberNamespaceSelector %q is not a valid label selector: %s", t.MemberNamespaceSelector, err)
+		}
+	}
+	if len(t.MemberClusters) == 0 {
+		addProblem("at least one entry in memberClusters is required")
+	}
+	if t.Scope != "" && t.Scope != ScopeNamespace && t.Scope != ScopeCluster {
+		addProblem("scope must be either %q or %q, got %q", ScopeNamespace, ScopeCluster, t.Scope)
+	}
+
+	names := map[string]bool{}
+	contexts := map[string]string{}
+	for i, m := range t.MemberClusters {
+		field := fmt.Sprintf("memberClusters[%d]", i)
+		if m.Name == "" {
+			addProblem("%s.name is required", field)
+		} else if !clusterNameRegex.MatchString(m.Name) {
+			addProblem("%s.name %q may only contain alphanumeric characters, '-', '_' or '.'", field, m.Name)
+		} else if names[m.Name] {
+			addProblem("%s.name %q is used by more than one member cluster", field, m.Name)
+		}
+		names[m.Name] = true
+
+		context := m.kubeContext()
+		if other, ok := contexts[context]; ok {
+			addProblem("%s.context %q is already used by member cluster %q", field, context, other)
+		}
+		contexts[context] = m.Name
+
+		if m.ApiServer != "" {
+			if u, err := url.Parse(m.ApiServer); err != nil || u.Scheme != "https" || u.Host == "" {
+				addProblem("%s.apiServer %q must be an https:// URL", field, m.ApiServer)
+			}
+		}
+		if m.Namespace != "" {
+			if errs := validation.IsDNS1123Label(m.Namespace); len(errs) > 0 {
+				addProblem("%s.namespace %q is not a valid namespace: %s", field, m.Namespace, strings.Join(errs, ", "))
+			}
+		}
+		if m.ServiceAccountNamespace != "" {
+			if errs := validation.IsDNS1123Label(m.ServiceAccountNamespace); len(errs) > 0 {
+				addProblem("%s.serviceAccountNamespace %q is not a valid namespace: %s", field, m.ServiceAccountNamespace, strings.Join(errs, ", "))
+			}
+		}
+		if m.ServiceAccount != "" {
+			if errs := validation.IsDNS1123Subdomain(m.ServiceAccount); len(errs) > 0 {
+				addProblem("%s.serviceAccount %q is not a valid name: %s", field, m.ServiceAccount, strings.Join(errs, ", "))
+			}
+		}
+		if err := m.connection().Validate(); err != nil {
+			addProblem("%s: %s", field, err)
+		}
+		if context == t.CentralCluster.Context && m.overrides() != (ClusterOverrides{}) {
+			addProblem("%s is the central cluster, its namespace and serviceAccount can't be overridden", field)
+		}
+	}
+
+	if t.DatabaseRoles.SourceCluster != "" && !names[t.DatabaseRoles.SourceCluster] {
+		addProblem("databaseRoles.sourceCluster %q must be one of the member clusters", t.DatabaseRoles.SourceCluster)
+	}
+
+	if len(problems) > 0 {
+		return xerrors.Errorf("\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// ApplyTo sets the flags described by the topology. Values that are not set in the topology keep the value of
+// the corresponding command line flag. The API server of member clusters without an explicit apiServer is left
+// empty and has to be filled in from the local kubeconfig.
+func (t Topology) ApplyTo(f *Flags) {
+	f.CentralCluster = t.CentralCluster.Context
+	f.CentralClusterNamespace = t.CentralCluster.Namespace
+	f.MemberClusterNamespace = t.MemberClusterNamespace
+	f.MemberClusterNamespaces = t.MemberClusterNamespaces
+	f.MemberNamespaceSelector = t.MemberNamespaceSelector
+	f.MemberClusters = nil
+	f.MemberClusterApiServerUrls = nil
+	f.ClusterContexts = map[string]string{}
+
+	for _, m := range t.MemberClusters {
+		f.MemberClusters = append(f.MemberClusters, m.Name)
+		f.MemberClusterApiServerUrls = append(f.MemberClusterApiServerUrls, m.ApiServer)
+		if m.kubeContext() == t.CentralCluster.Context {
+			// the central cluster is also a member cluster, it needs to be referred to by the same name
+			f.CentralCluster = m.Name
+		}
+		if m.kubeContext() != m.Name {
+			f.ClusterContexts[m.Name] = m.kubeContext()
+		}
+		if connection := m.connection(); !connection.isEmpty() {
+			if f.ClusterConnections == nil {
+				f.ClusterConnections = map[string]ClusterConnection{}
+			}
+			f.ClusterConnections[m.Name] = connection
+		}
+		if overrides := m.overrides(); overrides != (ClusterOverrides{}) {
+			if f.ClusterOverrides == nil {
+				f.ClusterOverrides = map[string]ClusterOverrides{}
+			}
+			f.ClusterOverrides[m.Name] = overrides
+		}
+	}
+
+	if t.ServiceAccount != "" {
+		f.ServiceAccount = t.ServiceAccount
+	}
+	if t.OperatorName != "" {
+		f.OperatorName = t.OperatorName
+	}
+	if t.InstallationID != "" {
+		f.InstallationID = t.InstallationID
+	}
+	if t.Scope != "" {
+		f.ClusterScoped = t.Scope == ScopeCluster
+	}
+	if t.CreateTelemetryRoles != nil {
+		f.CreateTelemetryClusterRoles = *t.CreateTelemetryRoles
+	}
+	if t.CreateServiceAccountSecrets != nil {
+		f.CreateServiceAccountSecrets = *t.CreateServiceAccountSecrets
+	}
+	if t.ImagePullSecrets != "" {
+		f.ImagePullSecrets = t.ImagePullSecrets
+	}
+	if t.DatabaseRoles.Install {
+		f.InstallDatabaseRoles = true
+	}
+	if t.DatabaseRoles.SourceCluster != "" {
+		f.SourceCluster = t.DatabaseRoles.SourceCluster
+	}
+}
+
+func (m TopologyMemberCluster) kubeContext() string {
+	if m.Context != "" {
+		return m.Context
+	}
+	return m.Name
+}
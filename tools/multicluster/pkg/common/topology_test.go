@@ -0,0 +1,117 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const testTopology = `apiVersion: kubectl-mongodb/v1
+kind: MultiClusterTopology
+centralCluster:
+  context: member-cluster-0
+  namespace: central-namespace
+memberClusterNamespace: member-namespace
+memberClusters:
+  - name: cluster-0
+    context: member-cluster-0
+    apiServer: https://api.cluster-0
+  - name: member-cluster-1
+  - name: cluster-2
+    context: member-cluster-2
+serviceAccount: test-service-account
+scope: cluster
+createTelemetryRoles: false
+databaseRoles:
+  install: true
+`
+
+func writeTopology(t *testing.T, content string) string {
+	fileName := filepath.Join(t.TempDir(), "topology.yaml")
+	require.NoError(t, os.WriteFile(fileName, []byte(content), 0o644))
+	return fileName
+}
+
+func TestLoadTopology_AppliesToFlags(t *testing.T) {
+	topology, err := LoadTopology(writeTopology(t, testTopology))
+	require.NoError(t, err)
+
+	flags := Flags{CreateTelemetryClusterRoles: true, OperatorName: "mongodb-enterprise-operator-multi-cluster"}
+	topology.ApplyTo(&flags)
+
+	assert.Equal(t, []string{"cluster-0", "member-cluster-1", "cluster-2"}, flags.MemberClusters)
+	assert.Equal(t, []string{"https://api.cluster-0", "", ""}, flags.MemberClusterApiServerUrls)
+	assert.Equal(t, "cluster-0", flags.CentralCluster, "the central cluster is referred to by its member cluster name")
+	assert.Equal(t, "central-namespace", flags.CentralClusterNamespace)
+	assert.Equal(t, "member-namespace", flags.MemberClusterNamespace)
+	assert.Equal(t, "test-service-account", flags.ServiceAccount)
+	assert.Equal(t, "mongodb-enterprise-operator-multi-cluster", flags.OperatorName)
+	assert.True(t, flags.ClusterScoped)
+	assert.False(t, flags.CreateTelemetryClusterRoles)
+	assert.True(t, flags.InstallDatabaseRoles)
+
+	assert.Equal(t, "member-cluster-0", flags.ClusterContext("cluster-0"))
+	assert.Equal(t, "member-cluster-1", flags.ClusterContext("member-cluster-1"))
+	assert.Equal(t, "member-cluster-2", flags.ClusterContext("cluster-2"))
+
+	kubeconfig, err := clientcmd.Load([]byte(testKubeconfig))
+	require.NoError(t, err)
+	require.NoError(t, FillMemberClusterApiServerUrls(kubeconfig, &flags))
+	assert.Equal(t, []string{"https://api.cluster-0", "https://api.member-cluster-1", "https://api.member-cluster-2"}, flags.MemberClusterApiServerUrls)
+}
+
+func TestLoadTopology_RejectsUnknownFields(t *testing.T) {
+	_, err := LoadTopology(writeTopology(t, testTopology+"memberClusterApiServers: https://api.cluster-0\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "memberClusterApiServers")
+}
+
+func TestTopology_Validate(t *testing.T) {
+	topology := Topology{
+		ApiVersion:             TopologyApiVersion,
+		Kind:                   TopologyKind,
+		CentralCluster:         TopologyCentralCluster{Context: "central", Namespace: "central-namespace"},
+		MemberClusterNamespace: "member-namespace",
+		MemberClusters: []TopologyMemberCluster{
+			{Name: "cluster-0", ApiServer: "http://api.cluster-0"},
+			{Name: "cluster-0"},
+			{Name: "cluster/1", Context: "cluster-0"},
+			{Name: "cluster-3", Namespace: "other_namespace", ServiceAccount: "Operator"},
+			{Name: "cluster-4", Context: "central", ServiceAccountNamespace: "operator-namespace", ProxyURL: "ftp://proxy"},
+		},
+		Scope:                   "everything",
+		DatabaseRoles:           TopologyDatabaseRoles{SourceCluster: "cluster-5"},
+		MemberClusterNamespaces: []string{"team-a", "team_b"},
+		MemberNamespaceSelector: "team in (",
+	}
+	require.NoError(t, Topology{
+		ApiVersion:             TopologyApiVersion,
+		Kind:                   TopologyKind,
+		CentralCluster:         TopologyCentralCluster{Context: "central", Namespace: "central-namespace"},
+		MemberClusterNamespace: "member-namespace",
+		MemberClusters:         []TopologyMemberCluster{{Name: "cluster-0"}},
+	}.Validate())
+
+	err := topology.Validate()
+	require.Error(t, err)
+	for _, problem := range []string{
+		`scope must be either "namespace" or "cluster", got "everything"`,
+		`memberClusters[0].apiServer "http://api.cluster-0" must be an https:// URL`,
+		`memberClusters[1].name "cluster-0" is used by more than one member cluster`,
+		`memberClusters[1].context "cluster-0" is already used by member cluster "cluster-0"`,
+		`memberClusters[2].name "cluster/1" may only contain alphanumeric characters`,
+		`memberClusters[3].namespace "other_namespace" is not a valid namespace`,
+		`memberClusters[3].serviceAccount "Operator" is not a valid name`,
+		`memberClusters[4]: proxy url "ftp://proxy" must be an http://, https:// or socks5:// URL`,
+		`memberClusters[4] is the central cluster, its namespace and serviceAccount can't be overridden`,
+		`databaseRoles.sourceCluster "cluster-5" must be one of the member clusters`,
+		`memberClusterNamespaces[1] "team_b" is not a valid namespace`,
+		`memberNamespaceSelector "team in (" is not a valid label selector`,
+	} {
+		assert.Contains(t, err.Error(), problem)
+	}
+}
@@ -0,0 +1,178 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"golang.org/x/xerrors"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// VerifyOperatorCredentials checks that the operator can do its job with the credentials setup created. It connects
+// to every member cluster with the kubeconfig from the KubeConfig secret, and to the central cluster by impersonating
+// the operator's ServiceAccount. In every cluster, a SelfSubjectRulesReview must include the operator's rules in all
+// the namespaces they are needed in. The api servers in the kubeconfig are also probed from the central cluster, where
+// the operator runs, unless probe is nil. newClient creates a client for the given REST configuration.
+func VerifyOperatorCredentials(ctx context.Context, flags Flags, clientMap map[string]KubeClient, newClient func(config *rest.Config) (KubeClient, error), probe ApiServerProbe) (CheckReport, error) {
+	centralClusterClient := clientMap[flags.CentralCluster]
+	secret, err := centralClusterClient.CoreV1().Secrets(flags.CentralClusterNamespace).Get(ctx, KubeConfigSecretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, xerrors.Errorf("failed getting secret %s/%s in cluster %s: %w", flags.CentralClusterNamespace, KubeConfigSecretName, flags.CentralCluster, err)
+	}
+	kubeconfig, err := clientcmd.Load(secret.Data[KubeConfigSecretKey])
+	if err != nil {
+		return nil, xerrors.Errorf("failed parsing kubeconfig from secret %s/%s: %w", flags.CentralClusterNamespace, KubeConfigSecretName, err)
+	}
+
+	return checkClusters(ctx, allClusters(flags), flags.Parallelism, func(ctx context.Context, cluster string) []CheckResult {
+		var checks []CheckResult
+		if cluster == flags.CentralCluster {
+			checks = append(checks, verifyCentralCluster(ctx, flags, centralClusterClient, newClient)...)
+		}
+		if Contains(flags.MemberClusters, cluster) {
+			checks = append(checks, verifyMemberCluster(ctx, flags, kubeconfig, cluster, newClient, probe)...)
+		}
+		return checks
+	}), nil
+}
+
+// verifyCentralCluster checks the rules of the operator's ServiceAccount in the central cluster by impersonating it.
+func verifyCentralCluster(ctx context.Context, flags Flags, c KubeClient, newClient func(config *rest.Config) (KubeClient, error)) []CheckResult {
+	config := &rest.Config{}
+	if restConfig := c.GetRestConfig(); restConfig != nil {
+		config = rest.CopyConfig(restConfig)
+	}
+	config.Impersonate = rest.ImpersonationConfig{
+		UserName: fmt.Sprintf("system:serviceaccount:%s:%s", flags.CentralClusterNamespace, flags.ServiceAccount),
+	}
+
+	operatorClient, err := newClient(config)
+	if err != nil {
+		return []CheckResult{{Cluster: flags.CentralCluster, Check: "service-account", Status: CheckFail, Message: fmt.Sprintf("failed creating client: %s", err)}}
+	}
+
+	rules := append(flags.centralRules(), flags.memberRules()...)
+
+	var checks []CheckResult
+	for _, namespace := range flags.clusterNamespaces(flags.CentralCluster) {
+		checks = append(checks, verifyRules(ctx, operatorClient, flags.CentralCluster, "service-account-rbac/"+namespace, namespace, rules))
+	}
+	return checks
+}
+
+// verifyMemberCluster connects to the member cluster with the operator's kubeconfig and checks its rules.
+func verifyMemberCluster(ctx context.Context, flags Flags, kubeconfig *clientcmdapi.Config, cluster string, newClient func(config *rest.Config) (KubeClient, error), probe ApiServerProbe) []CheckResult {
+	check := CheckResult{Cluster: cluster, Check: "kubeconfig-connect"}
+
+	config, err := clientcmd.NewNonInteractiveClientConfig(*kubeconfig, cluster, &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+	if err != nil {
+		check.Status, check.Message = CheckFail, fmt.Sprintf("no usable context in the operator's kubeconfig: %s", err)
+		return []CheckResult{check}
+	}
+	operatorClient, err := newClient(config)
+	if err != nil {
+		check.Status, check.Message = CheckFail, fmt.Sprintf("failed creating client: %s", err)
+		return []CheckResult{check}
+	}
+	version, err := serverVersion(ctx, operatorClient.Discovery())
+	if err != nil {
+		check.Status, check.Message = CheckFail, fmt.Sprintf("%s not reachable with the operator's credentials: %s", config.Host, err)
+		return []CheckResult{check}
+	}
+	check.Status, check.Message = CheckPass, fmt.Sprintf("%s, Kubernetes %s", config.Host, version.GitVersion)
+
+	checks := []CheckResult{check}
+	if probe != nil {
+		checks = append(checks, verifyReachableFromCentralCluster(ctx, kubeconfig, cluster, config.Host, probe))
+	}
+	serviceAccountNamespace, _ := flags.serviceAccountFor(cluster)
+	for _, namespace := range uniqueNamespaces(append(flags.memberNamespacesFor(cluster), serviceAccountNamespace)) {
+		checks = append(checks, verifyRules(ctx, operatorClient, cluster, "kubeconfig-rbac/"+namespace, namespace, flags.memberRules()))
+	}
+	return checks
+}
+
+// verifyReachableFromCentralCluster probes the api server of the member cluster from the central cluster, as it may
+// be reachable from this machine but not from the operator's pod.
+func verifyReachableFromCentralCluster(ctx context.Context, kubeconfig *clientcmdapi.Config, cluster, url string, probe ApiServerProbe) CheckResult {
+	check := CheckResult{Cluster: cluster, Check: "central-cluster-connect"}
+	if kubeContext := kubeconfig.Contexts[cluster]; kubeContext != nil {
+		if kubeCluster := kubeconfig.Clusters[kubeContext.Cluster]; kubeCluster != nil && kubeCluster.ProxyURL != "" {
+			check.Status, check.Message = CheckWarn, fmt.Sprintf("%s not probed, the operator connects to it through proxy %s", url, kubeCluster.ProxyURL)
+			return check
+		}
+	}
+	if err := probe(ctx, url); err != nil {
+		check.Status, check.Message = CheckFail, fmt.Sprintf("%s not reachable from the central cluster: %s", url, err)
+		return check
+	}
+	check.Status, check.Message = CheckPass, fmt.Sprintf("%s reachable from the central cluster", url)
+	return check
+}
+
+// verifyRules runs a SelfSubjectRulesReview in the namespace and checks that it includes all the required rules.
+func verifyRules(ctx context.Context, c KubeClient, cluster, checkName, namespace string, required []rbacv1.PolicyRule) CheckResult {
+	check := CheckResult{Cluster: cluster, Check: checkName}
+
+	review := &authorizationv1.SelfSubjectRulesReview{
+		Spec: authorizationv1.SelfSubjectRulesReviewSpec{Namespace: namespace},
+	}
+	review, err := c.AuthorizationV1().SelfSubjectRulesReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		check.Status, check.Message = CheckFail, fmt.Sprintf("failed reviewing rules: %s", err)
+		return check
+	}
+
+	missing := missingRules(review.Status.ResourceRules, required)
+	if len(missing) == 0 {
+		check.Status, check.Message = CheckPass, "all rules granted"
+		return check
+	}
+
+	check.Status, check.Message = CheckFail, fmt.Sprintf("missing rules: %s", strings.Join(missing, ", "))
+	if review.Status.Incomplete {
+		// authorizers that can't list rules, like webhooks, may still grant the missing ones
+		check.Status = CheckWarn
+		check.Message += fmt.Sprintf(" (rules review incomplete: %s)", review.Status.EvaluationError)
+	}
+	return check
+}
+
+// missingRules returns every verb on a resource in the required rules that isn't granted by the given rules.
+func missingRules(granted []authorizationv1.ResourceRule, required []rbacv1.PolicyRule) []string {
+	var missing []string
+	for _, rule := range required {
+		for _, group := range rule.APIGroups {
+			for _, resource := range rule.Resources {
+				for _, verb := range rule.Verbs {
+					if !rulesGrant(granted, group, resource, verb) {
+						missing = append(missing, describePermission(authorizationv1.ResourceAttributes{Verb: verb, Group: group, Resource: resource}))
+					}
+				}
+			}
+		}
+	}
+	return missing
+}
+
+func rulesGrant(granted []authorizationv1.ResourceRule, group, resource, verb string) bool {
+	for _, rule := range granted {
+		if len(rule.ResourceNames) > 0 {
+			continue
+		}
+		if matchesRule(rule.APIGroups, group) && matchesRule(rule.Resources, resource) && matchesRule(rule.Verbs, verb) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesRule(values []string, value string) bool {
+	return Contains(values, value) || Contains(values, rbacv1.ResourceAll)
+}
@@ -0,0 +1,183 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestVerifyOperatorCredentials_Passes_AfterSetup(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	clientMap := getClientResources(ctx, flags)
+	require.NoError(t, EnsureMultiClusterResources(ctx, flags, clientMap))
+	addRulesReviews(clientMap)
+
+	report, err := VerifyOperatorCredentials(ctx, flags, clientMap, operatorClients(t, flags, clientMap), nil)
+	require.NoError(t, err)
+
+	assert.False(t, report.Failed())
+	var checks []string
+	for _, check := range report {
+		assert.Equal(t, CheckPass, check.Status, "%s %s: %s", check.Cluster, check.Check, check.Message)
+		checks = append(checks, check.Cluster+" "+check.Check)
+	}
+	assert.Equal(t, []string{
+		"central-cluster service-account-rbac/central-namespace", "central-cluster service-account-rbac/member-namespace",
+		"member-cluster-0 kubeconfig-connect", "member-cluster-0 kubeconfig-rbac/member-namespace", "member-cluster-0 kubeconfig-rbac/central-namespace",
+		"member-cluster-1 kubeconfig-connect", "member-cluster-1 kubeconfig-rbac/member-namespace", "member-cluster-1 kubeconfig-rbac/central-namespace",
+		"member-cluster-2 kubeconfig-connect", "member-cluster-2 kubeconfig-rbac/member-namespace", "member-cluster-2 kubeconfig-rbac/central-namespace",
+	}, checks)
+}
+
+func TestVerifyOperatorCredentials_ReportsMissingRulesAndUnreachableClusters(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	clientMap := getClientResources(ctx, flags)
+	require.NoError(t, EnsureMultiClusterResources(ctx, flags, clientMap))
+	addRulesReviews(clientMap)
+
+	err := clientMap["member-cluster-1"].RbacV1().Roles(flags.MemberClusterNamespace).Delete(ctx, "mongodb-enterprise-operator-multi-role", metav1.DeleteOptions{})
+	require.NoError(t, err)
+	clientMap["member-cluster-2"].(*KubeClientContainer).staticClient.(*fake.Clientset).PrependReactor("get", "version", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("dial tcp: i/o timeout")
+	})
+
+	report, err := VerifyOperatorCredentials(ctx, flags, clientMap, operatorClients(t, flags, clientMap), nil)
+	require.NoError(t, err)
+
+	assert.True(t, report.Failed())
+	checks := map[string]CheckResult{}
+	for _, check := range report {
+		checks[check.Cluster+" "+check.Check] = check
+	}
+	assert.Equal(t, CheckPass, checks["member-cluster-1 kubeconfig-rbac/central-namespace"].Status)
+	assert.Equal(t, CheckFail, checks["member-cluster-1 kubeconfig-rbac/member-namespace"].Status)
+	assert.Contains(t, checks["member-cluster-1 kubeconfig-rbac/member-namespace"].Message, "create statefulsets.apps")
+	assert.Equal(t, CheckFail, checks["member-cluster-2 kubeconfig-connect"].Status)
+	assert.Contains(t, checks["member-cluster-2 kubeconfig-connect"].Message, "https://api.member-cluster-2 not reachable")
+	assert.NotContains(t, checks, "member-cluster-2 kubeconfig-rbac/member-namespace")
+}
+
+func TestVerifyOperatorCredentials_ProbesApiServersFromCentralCluster(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	clientMap := getClientResources(ctx, flags)
+	require.NoError(t, EnsureMultiClusterResources(ctx, flags, clientMap))
+	addRulesReviews(clientMap)
+
+	var probed []string
+	mu := sync.Mutex{}
+	probe := func(_ context.Context, url string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		probed = append(probed, url)
+		if url == flags.MemberClusterApiServerUrls[1] {
+			return errors.New("no response from " + url)
+		}
+		return nil
+	}
+
+	report, err := VerifyOperatorCredentials(ctx, flags, clientMap, operatorClients(t, flags, clientMap), probe)
+	require.NoError(t, err)
+
+	assert.True(t, report.Failed())
+	assert.ElementsMatch(t, flags.MemberClusterApiServerUrls, probed)
+	checks := map[string]CheckResult{}
+	for _, check := range report {
+		checks[check.Cluster+" "+check.Check] = check
+	}
+	assert.Equal(t, CheckPass, checks["member-cluster-0 central-cluster-connect"].Status)
+	assert.Equal(t, CheckPass, checks["member-cluster-1 kubeconfig-connect"].Status, "the api server is reachable from this machine")
+	assert.Equal(t, CheckFail, checks["member-cluster-1 central-cluster-connect"].Status)
+	assert.Contains(t, checks["member-cluster-1 central-cluster-connect"].Message, "not reachable from the central cluster")
+}
+
+func TestVerifyOperatorCredentials_RequiresKubeConfigSecret(t *testing.T) {
+	ctx := context.Background()
+	flags := testFlags(t, false)
+	clientMap := getClientResources(ctx, flags)
+
+	_, err := VerifyOperatorCredentials(ctx, flags, clientMap, operatorClients(t, flags, clientMap), nil)
+	assert.Error(t, err)
+}
+
+func TestMissingRules(t *testing.T) {
+	granted := []authorizationv1.ResourceRule{
+		{Verbs: []string{"get", "list"}, APIGroups: []string{""}, Resources: []string{"secrets"}},
+		{Verbs: []string{"*"}, APIGroups: []string{"apps"}, Resources: []string{"*"}},
+		{Verbs: []string{"delete"}, APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"only-this-one"}},
+	}
+	required := []rbacv1.PolicyRule{
+		{Verbs: []string{"get", "list", "delete"}, APIGroups: []string{""}, Resources: []string{"secrets"}},
+		{Verbs: []string{"create"}, APIGroups: []string{"apps"}, Resources: []string{"statefulsets"}},
+	}
+
+	assert.Equal(t, []string{"delete secrets"}, missingRules(granted, required))
+}
+
+// operatorClients returns a client factory that connects to the fake member clusters by the api server in their
+// kubeconfig and to the central cluster when impersonating the operator.
+func operatorClients(t *testing.T, flags Flags, clientMap map[string]KubeClient) func(config *rest.Config) (KubeClient, error) {
+	return func(config *rest.Config) (KubeClient, error) {
+		if config.Impersonate.UserName != "" {
+			assert.Equal(t, "system:serviceaccount:central-namespace:"+flags.ServiceAccount, config.Impersonate.UserName)
+			return clientMap[flags.CentralCluster], nil
+		}
+		for i, cluster := range flags.MemberClusters {
+			if flags.MemberClusterApiServerUrls[i] == config.Host {
+				assert.NotEmpty(t, config.BearerToken, "the operator's token is used")
+				return clientMap[cluster], nil
+			}
+		}
+		return nil, errors.New("unknown api server " + config.Host)
+	}
+}
+
+// addRulesReviews makes the fake clientsets answer SelfSubjectRulesReviews with the rules of all the Roles and
+// ClusterRoles bound in the namespace.
+func addRulesReviews(clientMap map[string]KubeClient) {
+	for _, c := range clientMap {
+		clientset := c.(*KubeClientContainer).staticClient.(*fake.Clientset)
+		clientset.PrependReactor("create", "selfsubjectrulesreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectRulesReview).DeepCopy()
+
+			// the reactor runs while the fake clientset is locked, so the tracker is used instead of the clientset
+			tracker := clientset.Tracker()
+			var rules []rbacv1.PolicyRule
+			roleBindings, _ := tracker.List(rbacv1.SchemeGroupVersion.WithResource("rolebindings"), rbacv1.SchemeGroupVersion.WithKind("RoleBinding"), review.Spec.Namespace)
+			for _, binding := range roleBindings.(*rbacv1.RoleBindingList).Items {
+				if role, err := tracker.Get(rbacv1.SchemeGroupVersion.WithResource("roles"), review.Spec.Namespace, binding.RoleRef.Name); err == nil {
+					rules = append(rules, role.(*rbacv1.Role).Rules...)
+				}
+			}
+			clusterRoleBindings, _ := tracker.List(rbacv1.SchemeGroupVersion.WithResource("clusterrolebindings"), rbacv1.SchemeGroupVersion.WithKind("ClusterRoleBinding"), "")
+			for _, binding := range clusterRoleBindings.(*rbacv1.ClusterRoleBindingList).Items {
+				if role, err := tracker.Get(rbacv1.SchemeGroupVersion.WithResource("clusterroles"), "", binding.RoleRef.Name); err == nil {
+					rules = append(rules, role.(*rbacv1.ClusterRole).Rules...)
+				}
+			}
+
+			for _, rule := range rules {
+				review.Status.ResourceRules = append(review.Status.ResourceRules, authorizationv1.ResourceRule{
+					Verbs:         rule.Verbs,
+					APIGroups:     rule.APIGroups,
+					Resources:     rule.Resources,
+					ResourceNames: rule.ResourceNames,
+				})
+			}
+			return true, review, nil
+		})
+	}
+}
@@ -29,11 +29,6 @@ var (
 	OpsManagerSchemeGVR    = schema.GroupVersionResource{Group: "mongodb.com", Version: "v1", Resource: "opsmanagers"}
 )
 
-const (
-	redColor   = "\033[31m"
-	resetColor = "\033[0m"
-)
-
 type Filter interface {
 	Accept(object runtime.Object) bool
 }
@@ -230,7 +225,7 @@ func (s *LogsCollector) Collect(ctx context.Context, kubeClient common.KubeClien
 		})
 		LogStream, err := PodLogsConnection.Stream(ctx)
 		if err != nil {
-			fmt.Printf(redColor+"[%T] error from %s/%s, ignoring: %s\n"+resetColor, s, namespace, podName, err)
+			common.Logger().Warn("Failed collecting logs, ignoring", "collector", fmt.Sprintf("%T", s), "namespace", namespace, "pod", podName, "container", logsToCollect[i].ContainerName, "error", err)
 			continue
 		}
 		reader := bufio.NewScanner(LogStream)
@@ -355,6 +350,16 @@ type CollectionResult struct {
 	context       string
 }
 
+// Cluster returns the name of the cluster the data was collected from.
+func (r CollectionResult) Cluster() string {
+	return r.context
+}
+
+// Errors returns the errors of the collectors that failed.
+func (r CollectionResult) Errors() []error {
+	return r.errors
+}
+
 func Collect(ctx context.Context, kubeClient common.KubeClient, context string, namespace string, filter Filter, collectors []Collector, anonymizer Anonymizer) CollectionResult {
 	result := CollectionResult{}
 	result.context = context
@@ -362,11 +367,12 @@ func Collect(ctx context.Context, kubeClient common.KubeClient, context string,
 
 	for _, collector := range collectors {
 		collectedKubeObjects, collectedRawObjects, err := collector.Collect(ctx, kubeClient, namespace, filter, anonymizer)
-		errorString := ""
+		log := common.Logger().With("collector", fmt.Sprintf("%T", collector), "cluster", context, "namespace", namespace, "kubeObjects", len(collectedKubeObjects), "rawObjects", len(collectedRawObjects))
 		if err != nil {
-			errorString = fmt.Sprintf(redColor+" error: %s"+resetColor, err)
+			log.Error("Failed collecting", "error", err)
+		} else {
+			log.Info("Collected")
 		}
-		fmt.Printf("[%T] collected %d kubeObjects, %d rawObjects%s\n", collector, len(collectedKubeObjects), len(collectedRawObjects), errorString)
 		result.kubeResources = append(result.kubeResources, collectedKubeObjects...)
 		result.rawObjects = append(result.rawObjects, collectedRawObjects...)
 		if err != nil {